@@ -0,0 +1,317 @@
+package mph
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+)
+
+// An Algorithm identifies how BuildWithOptions constructs the hash function
+// of a Table. Whatever the algorithm, the table maps each key to its
+// position in the keys it was built from, unless WithHashOrder says
+// otherwise, and is looked up, serialized and loaded the same way.
+type Algorithm uint8
+
+const (
+	// CHD is the "Hash, displace, and compress" algorithm, which places
+	// buckets of keys with displacement seeds. It is the default.
+	CHD Algorithm = iota
+	// BBHash is the cascade of bit vectors of "Fast and scalable minimal
+	// perfect hashing for massive key sets" (Limasset et al., 2017). It
+	// builds in a few linear passes over the keys, with no seed search,
+	// which makes it much faster to build than CHD for very large key sets,
+	// at the cost of a few more bits per key.
+	BBHash
+	// RecSplit is the recursive splitting of "RecSplit: Minimal perfect
+	// hashing via recursive splitting" (Esposito et al., 2020). Its hash
+	// function takes less than 2 bits per key, the least of the
+	// algorithms, but it takes the longest to build and to look up; see
+	// WithRecSplitSizes. It suits tables shipped to memory-constrained
+	// devices, notably hash-only ones built with WithHashOrder: otherwise
+	// level1 maps the number the function gives each key to its position
+	// in log2(n) bits per key with WithPackedIndices, and 32 without, which
+	// outweighs the function itself.
+	RecSplit
+	// PTHash is "PTHash: Revisiting FCH minimal perfect hashing" (Pibiri
+	// and Trani, 2021). A lookup takes a single probe of the hash function,
+	// which reads one pilot value and mixes it into the key hash, so with
+	// Wyhash, which hashes the key once, it looks keys up as fast as CHD
+	// and twice as fast as CHD with Murmur3, which hashes it twice (see
+	// BenchmarkLookup_algorithm). The pilots are coded compactly, in as few
+	// bits as the largest of them takes, which comes to about 3.6 bits per
+	// key, less than half of the seeds of CHD. WithMaxSeedAttempts bounds
+	// the pilots as it bounds the seeds of CHD.
+	PTHash
+	// BDZ is the peeling of random 3-hypergraphs of "Simple and space-
+	// efficient minimal perfect hash functions" (Botelho et al., 2007). Its
+	// build takes linear time whatever the keys: it has no seed to search
+	// for each bucket, which keys chosen to collide could make arbitrarily
+	// long, only a hypergraph that fails to peel with a probability of
+	// about 1% and is then rebuilt with another seed, up to 32 times.
+	// It suits keys from untrusted sources. Its hash function takes about
+	// 2.6 bits per key, and a lookup reads three values and a rank.
+	BDZ
+)
+
+func (a Algorithm) String() string {
+	switch a {
+	case CHD:
+		return "chd"
+	case BBHash:
+		return "bbhash"
+	case RecSplit:
+		return "recsplit"
+	case PTHash:
+		return "pthash"
+	case BDZ:
+		return "bdz"
+	}
+	if b := a.backend(); b != nil {
+		return b.Name()
+	}
+	return "Algorithm(" + strconv.Itoa(int(a)) + ")"
+}
+
+// WithAlgorithm makes BuildWithOptions construct the table with a instead
+// of CHD. The options that tune the seed search of CHD, WithBucketSize,
+// WithLoadFactor, WithExactSizes, WithMaxSeedAttempts and WithParallelism,
+// have no effect on other algorithms, except as noted for PTHash. a may
+// also be a backend registered with RegisterBackend. BuildExternal, Gen
+// and GenC only support CHD.
+func WithAlgorithm(a Algorithm) Option {
+	return func(c *buildConfig) {
+		c.algorithm = a
+	}
+}
+
+// WithHashOrder makes BuildWithOptions number each key by the number that
+// the hash function of the algorithm gives it, rather than by its position
+// in keys, so that the table needs no level1 to map one to the other. It
+// drops from the table the log2(n) bits per key of level1 with
+// WithPackedIndices, or 16 or 32 without, and a load from each lookup: a
+// hash-only RecSplit table then takes less than 2 bits per key, and a
+// BBHash, PTHash or BDZ one about 3.7, 3.6 or 2.6. The indices are still
+// minimal, and Key gives the key of each index, so the caller can lay out
+// the values of the table in index order before dropping its keys (see
+// WithoutKeys).
+//
+// Only the algorithms other than CHD number their keys themselves, and
+// the option cannot be used with WithMonotone or WithStableIndices, which
+// choose the indices in other ways. Merge and DynamicTable, which keep the
+// indices of the keys of a table, do not support it either.
+func WithHashOrder() Option {
+	return func(c *buildConfig) {
+		c.hashOrder = true
+	}
+}
+
+// checkHashOrder returns an error if c has WithHashOrder and options that
+// do not go with it.
+func (c *buildConfig) checkHashOrder() error {
+	if !c.hashOrder {
+		return nil
+	}
+	if c.algorithm == CHD {
+		return errors.New("mph: the chd algorithm does not support WithHashOrder")
+	}
+	if c.monotone || c.stable != nil {
+		return errors.New("mph: WithHashOrder does not support WithMonotone or WithStableIndices")
+	}
+	return nil
+}
+
+// rankIndex returns the index of the key that the hash function of t,
+// which is not CHD, numbers r.
+func (t *Table) rankIndex(r uint32) uint32 {
+	if t.hashOrder {
+		return r
+	}
+	return t.level1.get(int(r))
+}
+
+// algorithm returns the algorithm that t was built with.
+func (t *Table) algorithm() Algorithm {
+	return t.algo
+}
+
+// viewLevel0 sets the view of the hash function of t that level0 holds, if
+// t was not built with CHD, or of its coded seeds.
+func (t *Table) viewLevel0() {
+	switch t.algo {
+	case CHD:
+		t.level0.view()
+	case BBHash:
+		t.cascade = splitCascade(t.level0.wide)
+	case RecSplit:
+		t.recsplit = splitRecSplit(t.level0.wide)
+	case PTHash:
+		t.pilots = splitPilots(t.level0.wide)
+	case BDZ:
+		t.hypergraph = splitHypergraph(t.level0.wide)
+	default:
+		// The words were checked when they were built or decoded.
+		t.backend, _ = t.algo.backend().Unmarshal(t.level0.wide, t.Len())
+	}
+}
+
+// checkLevel0 returns ErrCorrupt unless level0 holds a valid hash function
+// of nkeys keys built with a, which is not CHD.
+func checkLevel0(a Algorithm, level0 *seedArray, nkeys int) error {
+	if level0.wide == nil {
+		return ErrCorrupt
+	}
+	switch a {
+	case BBHash:
+		return checkCascade(level0.wide, nkeys)
+	case RecSplit:
+		return checkRecSplit(level0.wide, nkeys)
+	case PTHash:
+		return checkPilots(level0.wide, nkeys)
+	case BDZ:
+		return checkHypergraph(level0.wide, nkeys)
+	}
+	if b := a.backend(); b != nil {
+		if _, err := b.Unmarshal(level0.wide, nkeys); err != nil {
+			return ErrCorrupt
+		}
+		return nil
+	}
+	return ErrVersion
+}
+
+// rankKey returns the number that the hash function of t, which was not
+// built with CHD, gives s, where kh is keyHash(t.hash, s), and false if it
+// can tell that s is not a key of t.
+func rankKey[T ~string | ~[]byte](t *Table, kh uint64, s T) (uint32, bool) {
+	switch t.algo {
+	case BBHash:
+		return cascadeRank(&t.cascade, t.hash, kh, s)
+	case RecSplit:
+		return recsplitRank(&t.recsplit, t.hash, kh, s), true
+	case BDZ:
+		return hypergraphRank(&t.hypergraph, t.hash, kh, s)
+	case PTHash:
+		return pilotRank(&t.pilots, t.hash, kh, s), true
+	}
+	return t.backend.Lookup(wideKeyHash(t.hash, kh, s))
+}
+
+// equalHashes returns the positions, in increasing order, of the keys that
+// share both their bucket in index and their hash in hashes with another
+// key, and which no hash function of the bucket can therefore tell apart.
+// It sorts the keys of each bucket by hash.
+func equalHashes(index *bucketIndex, hashes []uint64) (stuck []int) {
+	for b := 0; b < index.len(); b++ {
+		vals := index.bucket(b)
+		sort.Slice(vals, func(i, j int) bool { return hashes[vals[i]] < hashes[vals[j]] })
+		for j := 1; j < len(vals); j++ {
+			if hashes[vals[j]] == hashes[vals[j-1]] {
+				if len(stuck) == 0 || stuck[len(stuck)-1] != int(vals[j-1]) {
+					stuck = append(stuck, int(vals[j-1]))
+				}
+				stuck = append(stuck, int(vals[j]))
+			}
+		}
+	}
+	sort.Ints(stuck)
+	return stuck
+}
+
+// A rankBuild builds the hash function of an algorithm other than CHD for
+// the keys of pool, whose key hashes are hashes, which it may overwrite. It
+// returns the serialized form of the function, which level0 holds, and
+// level1, which maps the number the function gives each key to its position
+// in pool. If the function cannot tell some keys apart, it returns their
+// positions, in increasing order, instead.
+type rankBuild func(ctx context.Context, pool keyPool, hashes []uint64, cfg *buildConfig) (words, level1 []uint32, stuck []int, err error)
+
+// buildRanked builds a table of the keys of pool with the algorithm a,
+// whose hash function fn builds. Keys that the function cannot tell apart
+// are checked for duplicates, which it never can, and removed if cfg
+// allows; otherwise the build fails.
+func buildRanked(ctx context.Context, pool keyPool, cfg *buildConfig, a Algorithm, fn rankBuild) (*Table, error) {
+	nkeys := pool.len()
+	sc := cfg.scratchSpace()
+	var words, level1 []uint32
+	for {
+		sc.hashes = reuse(sc.hashes, pool.len())
+		hashes := sc.hashes
+		for i := range hashes {
+			if i%ctxCheckInterval == 0 {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+			}
+			hashes[i] = keyHash(cfg.hash, cfg.seed, pool.key(i))
+		}
+		var stuck []int
+		var err error
+		words, level1, stuck, err = fn(ctx, pool, hashes, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if stuck == nil {
+			break
+		}
+		var dups []duplicate
+		first := make(map[string]int)
+		for _, i := range stuck {
+			k := string(pool.key(i))
+			if f, ok := first[k]; ok {
+				dups = append(dups, duplicate{f, i})
+			} else {
+				first[k] = i
+			}
+		}
+		if len(dups) == 0 {
+			return nil, ErrBuildFailed
+		}
+		if !cfg.dedup {
+			d := dups[0]
+			return nil, &DuplicateKeyError{Key: pool.key(d.second), First: d.first, Second: d.second}
+		}
+		removeDuplicates(&pool, dups)
+	}
+	if cfg.removed != nil {
+		*cfg.removed = nkeys - pool.len()
+	}
+	var indices indexArray
+	if cfg.hashOrder {
+		// Key i of the pool becomes the key that the function numbers i.
+		order := make([]int, len(level1))
+		for r, i := range level1 {
+			order[r] = int(i)
+		}
+		pool = pool.permute(order)
+		level1 = nil
+	} else {
+		if len(level1) == 0 {
+			level1 = []uint32{0}
+		}
+		indices = cfg.indices(level1, pool.len())
+	}
+	t := &Table{
+		keys:        pool,
+		keyWidth:    pool.width(),
+		level0:      seedArray{wide: words},
+		level0Slots: newSlotMap(len(words)),
+		level1:      indices,
+		level1Slots: newSlotMap(len(level1)),
+		algo:        a,
+		hashOrder:   cfg.hashOrder,
+		hash:        cfg.hash,
+		seed:        cfg.seed,
+		normalize:   cfg.normalize,
+	}
+	t.viewLevel0()
+	if cfg.frontCoding {
+		t.frontCode()
+	}
+	arena, err := allocArena(t.arenaSize(true), cfg.alloc)
+	if err != nil {
+		return nil, err
+	}
+	t.compactInto(&arena, true)
+	return t, nil
+}
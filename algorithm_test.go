@@ -0,0 +1,130 @@
+package mph
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestWithHashOrder(t *testing.T) {
+	for _, nkeys := range []int{0, 1, 100, 10000} {
+		var keys []string
+		for i := 0; i < nkeys; i++ {
+			keys = append(keys, "key"+strconv.Itoa(i))
+		}
+		for _, a := range []Algorithm{BBHash, RecSplit, PTHash, BDZ} {
+			table, err := BuildWithOptions(keys, WithAlgorithm(a), WithHashOrder(), WithVerify())
+			if err != nil {
+				t.Fatalf("BuildWithOptions(%v, %d keys): %v", a, nkeys, err)
+			}
+			if s := table.Stats(); s.Level1Len != 0 {
+				t.Errorf("Stats(%v, %d keys): got %d level1 entries; want 0", a, nkeys, s.Level1Len)
+			}
+			// The keys in index order are a permutation of keys.
+			ordered := make([]string, nkeys)
+			for i := range ordered {
+				k, ok := table.Key(uint32(i))
+				if !ok {
+					t.Fatalf("Key(%v, %d): got false", a, i)
+				}
+				ordered[i] = string(k)
+			}
+			sorted := append([]string(nil), ordered...)
+			sort.Strings(sorted)
+			want := append([]string(nil), keys...)
+			sort.Strings(want)
+			for i := range want {
+				if sorted[i] != want[i] {
+					t.Fatalf("Key(%v): got keys %q; want a permutation of %q", a, sorted, want)
+				}
+			}
+			checkTable(t, table, ordered, []string{"", "key-1"})
+			mphf := table.WithoutKeys()
+			for i, k := range ordered {
+				if n, ok := mphf.Lookup(k); !ok || n != uint32(i) {
+					t.Errorf("WithoutKeys().Lookup(%v, %s): got %d, %t; want %d, true", a, k, n, ok, i)
+				}
+			}
+			for _, c := range []*Table{table, mphf} {
+				data := mustMarshal(t, c)
+				var read Table
+				if err := read.UnmarshalBinary(data); err != nil {
+					t.Fatalf("UnmarshalBinary(%v): %v", a, err)
+				}
+				loaded, err := LoadBytes(data)
+				if err != nil {
+					t.Fatalf("LoadBytes(%v): %v", a, err)
+				}
+				if !Equal(&read, c) || !Equal(loaded, c) {
+					t.Errorf("UnmarshalBinary(%v, %d keys): got a different table", a, nkeys)
+				}
+			}
+		}
+	}
+}
+
+func TestWithHashOrder_size(t *testing.T) {
+	var keys []string
+	for i := 0; i < 100000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	plain, err := BuildMPHF(keys, WithAlgorithm(RecSplit), WithPackedIndices())
+	if err != nil {
+		t.Fatalf("BuildMPHF: %v", err)
+	}
+	ordered, err := BuildMPHF(keys, WithAlgorithm(RecSplit), WithHashOrder())
+	if err != nil {
+		t.Fatalf("BuildMPHF(WithHashOrder): %v", err)
+	}
+	bitsPerKey := func(table *Table) float64 {
+		return float64(8*len(mustMarshal(t, table))) / float64(len(keys))
+	}
+	if got := bitsPerKey(ordered); got > 2.5 {
+		t.Errorf("WithHashOrder: got %.2f bits per key; want at most 2.5", got)
+	}
+	if got, packed := bitsPerKey(ordered), bitsPerKey(plain); got > packed-16 {
+		t.Errorf("WithHashOrder: got %.2f bits per key; want 16 fewer than the %.2f of packed indices", got, packed)
+	}
+}
+
+func TestWithHashOrder_errors(t *testing.T) {
+	keys := []string{"a", "b", "c"}
+	prev := Build(keys)
+	for name, opts := range map[string][]Option{
+		"CHD":               {WithHashOrder()},
+		"WithMonotone":      {WithAlgorithm(BDZ), WithHashOrder(), WithMonotone()},
+		"WithStableIndices": {WithAlgorithm(BDZ), WithHashOrder(), WithStableIndices(prev)},
+	} {
+		if _, err := BuildWithOptions(keys, opts...); err == nil {
+			t.Errorf("BuildWithOptions(%s): got no error", name)
+		}
+	}
+	if _, err := BuildSorted(keys, WithAlgorithm(BDZ), WithHashOrder()); err == nil {
+		t.Errorf("BuildSorted: got no error")
+	}
+	if _, err := NewDynamicTable(keys, 0, WithAlgorithm(BDZ), WithHashOrder()); err == nil {
+		t.Errorf("NewDynamicTable: got no error")
+	}
+	table, err := BuildWithOptions(keys, WithAlgorithm(BDZ), WithHashOrder())
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	if _, err := Merge(table, Build([]string{"d"}), nil); err == nil {
+		t.Errorf("Merge: got no error")
+	}
+	// A CHD table, or one with level1 entries, cannot claim hash order.
+	bdz, err := BuildWithOptions(keys, WithAlgorithm(BDZ))
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	for _, c := range []*Table{prev, bdz} {
+		data := mustMarshal(t, c)
+		binary.LittleEndian.PutUint32(data[8:], binary.LittleEndian.Uint32(data[8:])|flagHashOrder)
+		binary.LittleEndian.PutUint32(data[32:], crc32.Checksum(data[:32], crcTable))
+		if _, err := LoadBytes(data); err != ErrCorrupt {
+			t.Errorf("LoadBytes(%v with flagHashOrder): got err=%v; want %v", c.algo, err, ErrCorrupt)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package mph
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// An arena hands out consecutive pieces of one allocation, so that the
+// arrays of a table cost a single allocation and are contiguous in memory.
+// Every piece is 4-byte aligned, and alignLine aligns the next one to a
+// cache line. An arena that is out of room, such as the zero arena,
+// allocates each piece separately instead. The pieces are only zeroed if
+// the arena is on the Go heap.
+type arena struct {
+	b []byte
+}
+
+// cacheLine is the cache line size assumed by alignLine. Allocations are
+// 8-byte aligned, so aligning a piece to a line wastes at most lineSlack
+// bytes.
+const (
+	cacheLine = 64
+	lineSlack = cacheLine - 8
+)
+
+// newArena returns an arena of size bytes.
+func newArena(size int) arena {
+	if size == 0 {
+		return arena{}
+	}
+	words := make([]uint64, (size+7)/8)
+	return arena{b: unsafe.Slice((*byte)(unsafe.Pointer(&words[0])), size)}
+}
+
+// alignLine skips to the next cache line boundary, so that the next piece
+// starts a line. The level arrays are aligned this way: an array that
+// starts mid-line spans one more line than it needs to, and shares its
+// first line with whatever precedes it.
+func (a *arena) alignLine() {
+	if len(a.b) == 0 {
+		return
+	}
+	pad := int(-uintptr(unsafe.Pointer(&a.b[0])) & (cacheLine - 1))
+	if pad >= len(a.b) {
+		a.b = nil
+		return
+	}
+	a.b = a.b[pad:]
+}
+
+// allocArena returns an arena of size bytes in memory from alloc, or from
+// the Go heap if alloc is nil.
+func allocArena(size int, alloc func(size int) []byte) (arena, error) {
+	if alloc == nil || size == 0 {
+		return newArena(size), nil
+	}
+	b := alloc(size)
+	if len(b) < size {
+		return arena{}, fmt.Errorf("mph: allocator returned %d bytes; want %d", len(b), size)
+	}
+	if uintptr(unsafe.Pointer(&b[0]))%8 != 0 {
+		return arena{}, fmt.Errorf("mph: allocator returned memory that is not 8-byte aligned")
+	}
+	return arena{b: b[:size:size]}, nil
+}
+
+// WithAllocator makes BuildWithOptions take the memory of the table from
+// alloc rather than the Go heap, so that an embedder can place the table
+// off the heap, in huge pages, or in an arena of its own. The table calls
+// alloc once, for size bytes, and keeps its level arrays and keys in the
+// result, which must be at least size bytes long and 8-byte aligned but
+// need not be zeroed. The memory must stay valid and unchanged while the
+// table is in use; the table never frees it. The temporary memory of the
+// build, and the memory of keys borrowed with WithBorrowedKeys, still come
+// from the Go heap.
+func WithAllocator(alloc func(size int) []byte) Option {
+	return func(c *buildConfig) {
+		c.alloc = alloc
+	}
+}
+
+// bytes returns n bytes whose capacity is n.
+func (a *arena) bytes(n int) []byte {
+	if n > len(a.b) {
+		return make([]byte, n)
+	}
+	b := a.b[:n:n]
+	if m := (n + 3) &^ 3; m < len(a.b) {
+		a.b = a.b[m:]
+	} else {
+		a.b = nil
+	}
+	return b
+}
+
+// uint32s returns n values whose capacity is n.
+func (a *arena) uint32s(n int) []uint32 {
+	if n == 0 || 4*n > len(a.b) {
+		return make([]uint32, n)
+	}
+	return unsafe.Slice((*uint32)(unsafe.Pointer(&a.bytes(4 * n)[0])), n)
+}
+
+// uint16s returns n values whose capacity is n. It takes a multiple of
+// 4 bytes, so that the next piece stays aligned.
+func (a *arena) uint16s(n int) []uint16 {
+	if n == 0 || 2*n > len(a.b) {
+		return make([]uint16, n)
+	}
+	return unsafe.Slice((*uint16)(unsafe.Pointer(&a.bytes(2 * n)[0])), n)
+}
+
+// arenaSize returns the size of the arena that compact needs for t.
+func (t *Table) arenaSize(keepBorrowed bool) int {
+	size := 2*lineSlack + narrowBytes(len(t.level0.narrow)) + 4*(len(t.level0.escapes)+len(t.level0.wide)+len(t.level0.coded)) +
+		4*(len(t.level1.wide)+len(t.level1.words)) + narrowBytes(len(t.level1.narrow)) +
+		(t.fingerprints.size()+3)&^3 + 4*len(t.keys.offsets) + t.keys.size()
+	if p := &t.keys; p.borrowed != nil {
+		size -= p.nbytes
+		if !keepBorrowed {
+			size += 4*(len(p.borrowed)+1) + p.nbytes
+		}
+	} else if p.front != nil {
+		size += (p.front.size()+3)&^3 - p.front.nbytes
+	}
+	size += 4 * len(t.keys.slotOf)
+	return size
+}
+
+// compact moves the arrays of t into one arena, in the order in which a
+// lookup reads them, with the level arrays aligned to cache lines. The
+// previous arrays are left unchanged, so compact also serves to make a deep
+// copy. Borrowed keys are copied into the arena too unless keepBorrowed.
+func (t *Table) compact(keepBorrowed bool) {
+	a := newArena(t.arenaSize(keepBorrowed))
+	t.compactInto(&a, keepBorrowed)
+}
+
+// compactInto is compact with the arena a, which must have room for
+// t.arenaSize(keepBorrowed) bytes.
+func (t *Table) compactInto(a *arena, keepBorrowed bool) {
+	a.alignLine()
+	if s := &t.level0; s.wide != nil {
+		s.wide = copyUint32s(a, s.wide)
+		t.viewLevel0()
+	} else if s.coded != nil {
+		s.coded = copyUint32s(a, s.coded)
+		s.view()
+	} else {
+		s.narrow = copyUint16s(a, s.narrow)
+		s.escapes = copyUint32s(a, s.escapes)
+	}
+	a.alignLine()
+	if x := &t.level1; x.wide != nil {
+		x.wide = copyUint32s(a, x.wide)
+	} else if x.narrow != nil {
+		x.narrow = copyUint16s(a, x.narrow)
+	} else {
+		x.words = copyUint32s(a, x.words)
+	}
+	if f := &t.fingerprints; f.b8 != nil {
+		f.b8 = append(a.bytes(len(f.b8))[:0], f.b8...)
+	} else if f.b16 != nil {
+		f.b16 = copyUint16s(a, f.b16)
+	}
+	if p := &t.keys; p.borrowed != nil && !keepBorrowed {
+		offsets := a.uint32s(len(p.borrowed) + 1)
+		offsets[0] = 0
+		data := a.bytes(p.nbytes)[:0]
+		for i, k := range p.borrowed {
+			data = append(data, k...)
+			offsets[i+1] = uint32(len(data))
+		}
+		*p = keyPool{data: data, offsets: offsets}
+	} else if p.front != nil {
+		p.front = p.front.copyInto(a)
+	} else if p.offsets != nil {
+		p.slotOf = copyUint32s(a, p.slotOf)
+		p.offsets = copyUint32s(a, p.offsets)
+		p.data = append(a.bytes(p.size())[:0], p.data[:p.size()]...)
+	}
+}
+
+func copyUint32s(a *arena, vs []uint32) []uint32 {
+	if vs == nil {
+		return nil
+	}
+	c := a.uint32s(len(vs))
+	copy(c, vs)
+	return c
+}
+
+func copyUint16s(a *arena, vs []uint16) []uint16 {
+	if vs == nil {
+		return nil
+	}
+	c := a.uint16s(len(vs))
+	copy(c, vs)
+	return c
+}
@@ -0,0 +1,225 @@
+package mph
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+	"unsafe"
+)
+
+func TestArena(t *testing.T) {
+	a := newArena(4 + 8 + 4 + 4)
+	b := a.bytes(3)
+	u16 := a.uint16s(3)
+	u32 := a.uint32s(1)
+	for _, tt := range []struct {
+		name string
+		p    unsafe.Pointer
+		off  uintptr
+	}{
+		{"uint16s", unsafe.Pointer(&u16[0]), 4},
+		{"uint32s", unsafe.Pointer(&u32[0]), 12},
+	} {
+		if got := uintptr(tt.p) - uintptr(unsafe.Pointer(&b[0])); got != tt.off {
+			t.Errorf("%s: got offset %d; want %d", tt.name, got, tt.off)
+		}
+	}
+	if cap(b) != 3 || cap(u16) != 3 || cap(u32) != 1 {
+		t.Errorf("got capacities %d, %d, %d; want 3, 3, 1", cap(b), cap(u16), cap(u32))
+	}
+	// The last 4 bytes are left; a larger piece is allocated apart.
+	if vs := a.uint32s(2); len(vs) != 2 {
+		t.Errorf("uint32s(2): got %d values; want 2", len(vs))
+	}
+	if vs := a.uint32s(1); uintptr(unsafe.Pointer(&vs[0]))-uintptr(unsafe.Pointer(&b[0])) != 16 {
+		t.Errorf("uint32s(1): not taken from the arena")
+	}
+
+	a = newArena(2*cacheLine + lineSlack)
+	for i := 0; i < 2; i++ {
+		a.alignLine()
+		if p := uintptr(unsafe.Pointer(&a.bytes(1)[0])); p%cacheLine != 0 {
+			t.Errorf("alignLine: piece %d at %#x", i, p)
+		}
+	}
+}
+
+// span returns the first and one past the last address of b.
+func span[E any](b []E) (uintptr, uintptr) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	var e E
+	p := uintptr(unsafe.Pointer(&b[0]))
+	return p, p + uintptr(len(b))*unsafe.Sizeof(e)
+}
+
+// checkContiguous reports an error unless the arrays of tb follow one
+// another in memory, in lookup order, padded only to align the level
+// arrays to cache lines.
+func checkContiguous(t *testing.T, name string, tb *Table) {
+	t.Helper()
+	var spans [][2]uintptr
+	add := func(start, end uintptr) {
+		if start != 0 {
+			spans = append(spans, [2]uintptr{start, end})
+		}
+	}
+	add(span(tb.level0.wide))
+	add(span(tb.level0.narrow))
+	add(span(tb.level0.escapes))
+	add(span(tb.level1.wide))
+	add(span(tb.level1.narrow))
+	add(span(tb.level1.words))
+	add(span(tb.fingerprints.b8))
+	add(span(tb.fingerprints.b16))
+	add(span(tb.keys.offsets))
+	add(span(tb.keys.data))
+	for i := 1; i < len(spans); i++ {
+		if gap := spans[i][0] - spans[i-1][1]; spans[i][0] < spans[i-1][1] || gap >= cacheLine {
+			t.Errorf("%s: array %d starts %d bytes after array %d ends", name, i, int(spans[i][0])-int(spans[i-1][1]), i-1)
+		}
+	}
+	for _, p := range []uintptr{spans[0][0], spanStart(tb.level1)} {
+		if p%cacheLine != 0 {
+			t.Errorf("%s: level array at %#x is not aligned to a cache line", name, p)
+		}
+	}
+}
+
+func spanStart(a indexArray) uintptr {
+	for _, p := range []uintptr{first(span(a.wide)), first(span(a.narrow)), first(span(a.words))} {
+		if p != 0 {
+			return p
+		}
+	}
+	return 0
+}
+
+func first(start, _ uintptr) uintptr {
+	return start
+}
+
+func TestCompact(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1001; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	table := Build(keys)
+	checkContiguous(t, "Build", table)
+	checkTable(t, table, keys, []string{"quux"})
+
+	data, err := table.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	var read Table
+	if _, err := read.ReadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+	checkContiguous(t, "ReadFrom", &read)
+	checkTable(t, &read, keys, []string{"quux"})
+
+	fp, err := table.WithFingerprints(8)
+	if err != nil {
+		t.Fatalf("WithFingerprints: %v", err)
+	}
+	checkContiguous(t, "Clone", fp.Clone())
+}
+
+func TestReadFrom_allocs(t *testing.T) {
+	var keys []string
+	for i := 0; i < 10000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	data, err := Build(keys).MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	var table Table
+	r := bytes.NewReader(data)
+	allocs := testing.AllocsPerRun(10, func() {
+		r.Reset(data)
+		table.ReadFrom(r)
+	})
+	// One for the arena and one for the read buffer.
+	if allocs > 2 {
+		t.Errorf("ReadFrom: got %v allocs; want at most 2", allocs)
+	}
+	if allocs := testing.AllocsPerRun(10, func() { table.Clone() }); allocs > 2 {
+		t.Errorf("Clone: got %v allocs; want at most 2", allocs)
+	}
+}
+
+// within reports whether the arrays of tb that are not empty lie in b.
+func within(tb *Table, b []byte) bool {
+	lo, hi := span(b)
+	for _, s := range [][2]uintptr{
+		pair(span(tb.level0.wide)), pair(span(tb.level0.narrow)), pair(span(tb.level0.escapes)),
+		pair(span(tb.level1.wide)), pair(span(tb.level1.narrow)), pair(span(tb.level1.words)),
+		pair(span(tb.keys.offsets)), pair(span(tb.keys.data)),
+	} {
+		if s[0] != 0 && (s[0] < lo || s[1] > hi) {
+			return false
+		}
+	}
+	return true
+}
+
+func pair(start, end uintptr) [2]uintptr {
+	return [2]uintptr{start, end}
+}
+
+func TestWithAllocator(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1001; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	var bufs [][]byte
+	alloc := func(size int) []byte {
+		words := make([]uint64, (size+7)/8+1)
+		b := unsafe.Slice((*byte)(unsafe.Pointer(&words[0])), 8*len(words))
+		for i := range b {
+			b[i] = 0xff // the memory need not be zeroed
+		}
+		bufs = append(bufs, b)
+		return b
+	}
+	table, err := BuildWithOptions(keys, WithAllocator(alloc))
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	if len(bufs) != 1 || !within(table, bufs[0]) {
+		t.Errorf("BuildWithOptions: %d allocations; want the table in 1", len(bufs))
+	}
+	checkContiguous(t, "BuildWithOptions", table)
+	checkTable(t, table, keys, []string{"quux"})
+
+	data := mustMarshal(t, table)
+	for _, parallelism := range []int{1, 4} {
+		bufs = nil
+		read, err := Unmarshal(data, WithDecodeAllocator(alloc), WithDecodeParallelism(parallelism))
+		if err != nil {
+			t.Fatalf("Unmarshal(parallelism %d): %v", parallelism, err)
+		}
+		if len(bufs) != 1 || !within(read, bufs[0]) {
+			t.Errorf("Unmarshal(parallelism %d): %d allocations; want the table in 1", parallelism, len(bufs))
+		}
+		checkTable(t, read, keys, []string{"quux"})
+	}
+
+	for _, tt := range []struct {
+		name  string
+		alloc func(int) []byte
+	}{
+		{"short", func(size int) []byte { return make([]byte, size-1) }},
+		{"misaligned", func(size int) []byte { return make([]byte, size+8)[1:] }},
+	} {
+		if _, err := BuildWithOptions(keys, WithAllocator(tt.alloc)); err == nil {
+			t.Errorf("BuildWithOptions(%s allocator): got nil error", tt.name)
+		}
+		if _, err := Unmarshal(data, WithDecodeAllocator(tt.alloc)); err == nil {
+			t.Errorf("Unmarshal(%s allocator): got nil error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package mph
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// A Backend is an algorithm that builds the hash function of a Table, which
+// RegisterBackend makes available to WithAlgorithm, and to the decoders of
+// serialized tables, under an Algorithm of its own. The table does the
+// rest: it hashes the keys, detects duplicates, maps the numbers that the
+// function gives the keys to their indices, and stores and verifies the
+// keys. A backend works on the 64-bit hashes of the keys, Murmur3 or Wyhash
+// as WithHash selects, which are distinct for the keys it is given.
+type Backend interface {
+	// Name returns the name of the algorithm, which Algorithm.String
+	// returns.
+	Name() string
+
+	// Build builds the hash function of the keys whose hashes are hashes,
+	// which it must not retain, and returns it with the number it gives
+	// each key: numbers[i] is the number of key i, and the numbers are a
+	// permutation of [0, len(hashes)).
+	Build(ctx context.Context, hashes []uint64) (f BackendFunc, numbers []uint32, err error)
+
+	// Unmarshal returns the hash function of nkeys keys whose serialized
+	// form, as returned by its Marshal method, is words, or an error unless
+	// words is valid. The function may alias words, which stay unchanged
+	// while the table is in use.
+	Unmarshal(words []uint32, nkeys int) (BackendFunc, error)
+}
+
+// A BackendFunc is a hash function built or unmarshaled by a Backend.
+type BackendFunc interface {
+	// Lookup returns the number of the key whose hash is h, and false if
+	// it can tell that the key is not one that the function was built for.
+	// The number of any other key must still be less than the number of
+	// keys.
+	Lookup(h uint64) (n uint32, ok bool)
+
+	// Marshal returns the serialized form of the function, which a table
+	// stores as is.
+	Marshal() []uint32
+}
+
+// maxAlgorithm is the largest Algorithm that the header can store.
+const maxAlgorithm = Algorithm(flagAlgorithm >> algorithmShift)
+
+// backends holds the registered backends, indexed by Algorithm.
+var backends struct {
+	sync.RWMutex
+	b [maxAlgorithm + 1]Backend
+}
+
+// RegisterBackend makes b available as the algorithm a, which must be
+// greater than BDZ and at most 15. It is meant to be called from an init
+// function, and returns an error if a is out of range or already
+// registered. A serialized table built with a can only be decoded by a
+// program that registered b as a.
+func RegisterBackend(a Algorithm, b Backend) error {
+	if a <= BDZ || a > maxAlgorithm {
+		return fmt.Errorf("mph: algorithm %d is not in [%d, %d]", a, BDZ+1, maxAlgorithm)
+	}
+	backends.Lock()
+	defer backends.Unlock()
+	if backends.b[a] != nil {
+		return fmt.Errorf("mph: algorithm %d is already registered as %s", a, backends.b[a].Name())
+	}
+	backends.b[a] = b
+	return nil
+}
+
+// backend returns the backend registered as a, or nil.
+func (a Algorithm) backend() Backend {
+	if a <= BDZ || a > maxAlgorithm {
+		return nil
+	}
+	backends.RLock()
+	defer backends.RUnlock()
+	return backends.b[a]
+}
+
+// known reports whether a is one of the algorithms of the package or a
+// registered backend.
+func (a Algorithm) known() bool {
+	return a <= BDZ || a.backend() != nil
+}
+
+// buildBackend returns the rankBuild of the backend b.
+func buildBackend(a Algorithm, b Backend) rankBuild {
+	return func(ctx context.Context, pool keyPool, hashes []uint64, cfg *buildConfig) (words, level1 []uint32, stuck []int, err error) {
+		all := make([]int, len(hashes))
+		for i := range hashes {
+			hashes[i] = wideKeyHash(cfg.hash, hashes[i], pool.key(i))
+			all[i] = i
+		}
+		if stuck := repeatedHashes(hashes, all); stuck != nil {
+			return nil, nil, stuck, nil
+		}
+		f, numbers, err := b.Build(ctx, hashes)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if len(numbers) != len(hashes) {
+			return nil, nil, nil, fmt.Errorf("mph: the %v backend numbered %d of %d keys", a, len(numbers), len(hashes))
+		}
+		level1 = make([]uint32, len(numbers))
+		seen := newBitset(len(numbers))
+		for i, n := range numbers {
+			if int(n) >= len(numbers) || seen.has(int(n)) {
+				return nil, nil, nil, fmt.Errorf("mph: the %v backend gave key %d the number %d, which is out of range or taken", a, i, n)
+			}
+			seen.set(int(n))
+			level1[n] = uint32(i)
+		}
+		return f.Marshal(), level1, nil, nil
+	}
+}
+
+// repeatedHashes returns the positions of keys, in increasing order, whose
+// hash in hashes is the hash of another of them. It reorders keys.
+func repeatedHashes(hashes []uint64, keys []int) []int {
+	sort.Slice(keys, func(a, b int) bool { return hashes[keys[a]] < hashes[keys[b]] })
+	var stuck []int
+	for j := 1; j < len(keys); j++ {
+		if hashes[keys[j]] == hashes[keys[j-1]] {
+			if len(stuck) == 0 || stuck[len(stuck)-1] != keys[j-1] {
+				stuck = append(stuck, keys[j-1])
+			}
+			stuck = append(stuck, keys[j])
+		}
+	}
+	sort.Ints(stuck)
+	return stuck
+}
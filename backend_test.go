@@ -0,0 +1,130 @@
+package mph
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// sortedBackend numbers keys by the rank of their hash among the sorted
+// hashes, which it stores and searches.
+type sortedBackend struct{}
+
+type sortedFunc []uint32 // the sorted hashes, low word first
+
+const sortedAlgorithm = BDZ + 1
+
+func init() {
+	if err := RegisterBackend(sortedAlgorithm, sortedBackend{}); err != nil {
+		panic(err)
+	}
+}
+
+func (sortedBackend) Name() string { return "sorted" }
+
+func (sortedBackend) Build(ctx context.Context, hashes []uint64) (BackendFunc, []uint32, error) {
+	order := make([]int, len(hashes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return hashes[order[a]] < hashes[order[b]] })
+	f := make(sortedFunc, 2*len(hashes))
+	numbers := make([]uint32, len(hashes))
+	for n, i := range order {
+		f[2*n], f[2*n+1] = uint32(hashes[i]), uint32(hashes[i]>>32)
+		numbers[i] = uint32(n)
+	}
+	return f, numbers, nil
+}
+
+func (sortedBackend) Unmarshal(words []uint32, nkeys int) (BackendFunc, error) {
+	if len(words) != 2*nkeys {
+		return nil, ErrCorrupt
+	}
+	return sortedFunc(words), nil
+}
+
+func (f sortedFunc) hash(n int) uint64 {
+	return uint64(f[2*n]) | uint64(f[2*n+1])<<32
+}
+
+func (f sortedFunc) Lookup(h uint64) (uint32, bool) {
+	n := sort.Search(len(f)/2, func(n int) bool { return f.hash(n) >= h })
+	if n == len(f)/2 || f.hash(n) != h {
+		return 0, false
+	}
+	return uint32(n), true
+}
+
+func (f sortedFunc) Marshal() []uint32 { return f }
+
+func TestRegisterBackend(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	if got := sortedAlgorithm.String(); got != "sorted" {
+		t.Errorf("String: got %q; want %q", got, "sorted")
+	}
+	for _, h := range []Hash{Murmur3, Wyhash} {
+		table, err := BuildWithOptions(keys, WithAlgorithm(sortedAlgorithm), WithHash(h))
+		if err != nil {
+			t.Fatalf("BuildWithOptions(%v): %v", h, err)
+		}
+		checkTable(t, table, keys, []string{"-1", "1000"})
+		if s := table.Stats(); s.Level0Len != 2*len(keys) {
+			t.Errorf("Stats(%v): got Level0Len %d; want %d", h, s.Level0Len, 2*len(keys))
+		}
+		data, err := table.WithoutKeys().MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary: %v", err)
+		}
+		decoded, err := LoadBytes(data)
+		if err != nil {
+			t.Fatalf("LoadBytes(%v): %v", h, err)
+		}
+		for i, key := range keys {
+			if n, _ := decoded.Lookup(key); n != uint32(i) {
+				t.Errorf("Lookup(%s): got %d; want %d", key, n, i)
+			}
+		}
+	}
+	if _, err := BuildWithOptions([]string{"a", "b", "a"}, WithAlgorithm(sortedAlgorithm)); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("BuildWithOptions(duplicates): got err=%v; want %v", err, ErrDuplicateKey)
+	}
+	if _, err := EstimateSize(len(keys), 0, WithAlgorithm(sortedAlgorithm)); err == nil {
+		t.Errorf("EstimateSize: got no error")
+	}
+	for _, a := range []Algorithm{CHD, BDZ, sortedAlgorithm, maxAlgorithm + 1} {
+		if err := RegisterBackend(a, sortedBackend{}); err == nil {
+			t.Errorf("RegisterBackend(%d): got no error", a)
+		}
+	}
+	if _, err := BuildWithOptions(keys, WithAlgorithm(sortedAlgorithm+1)); err == nil {
+		t.Errorf("BuildWithOptions(unregistered): got no error")
+	}
+}
+
+// badBackend numbers every key 0.
+type badBackend struct{ sortedBackend }
+
+func (badBackend) Build(ctx context.Context, hashes []uint64) (BackendFunc, []uint32, error) {
+	return sortedFunc(nil), make([]uint32, len(hashes)), nil
+}
+
+func TestRegisterBackend_badNumbers(t *testing.T) {
+	a := sortedAlgorithm + 1
+	backends.Lock()
+	backends.b[a] = badBackend{}
+	backends.Unlock()
+	defer func() {
+		backends.Lock()
+		backends.b[a] = nil
+		backends.Unlock()
+	}()
+	if _, err := BuildWithOptions([]string{"a", "b"}, WithAlgorithm(a)); err == nil {
+		t.Errorf("BuildWithOptions: got no error")
+	}
+}
@@ -0,0 +1,105 @@
+package mph
+
+// NotFound is the index that LookupAll stores for keys that are not in the
+// table.
+const NotFound = ^uint32(0)
+
+// lookupBatch is how many keys LookupAll hashes before it loads from the
+// level arrays and the key pool, so that the loads of a batch can be in
+// flight together.
+const lookupBatch = 16
+
+// LookupAll looks up each of keys in t and stores its index in the
+// corresponding element of out, or NotFound if the key is not in t. It
+// returns the number of keys found. LookupAll panics if out is shorter
+// than keys.
+//
+// For a hash-only table (see WithoutKeys), every key is reported as found
+// unless its fingerprint (see WithFingerprints) rules it out, as for Lookup.
+func LookupAll[T ~string | ~[]byte](t *Table, keys []T, out []uint32) int {
+	out = out[:len(keys)]
+	if t.Len() == 0 {
+		for i := range out {
+			out[i] = NotFound
+		}
+		return 0
+	}
+	if t.normalize != nil || t.prefilter.words != nil || t.algo != CHD || t.slotKeys > 1 || !t.keys.plain() {
+		return lookupAllEach(t, keys, out)
+	}
+	var (
+		kh     [lookupBatch]uint64
+		seeds  [lookupBatch]uint32
+		stored [lookupBatch][]byte
+		found  int
+	)
+	for len(keys) > 0 {
+		n := lookupBatch
+		if len(keys) < n {
+			n = len(keys)
+		}
+		batch, res := keys[:n], out[:n]
+		// Each pass makes one load per key that does not depend on the
+		// other keys of the batch, so that the cache misses of a pass
+		// overlap rather than following one another.
+		for j, s := range batch {
+			kh[j] = keyHash(t.hash, t.seed, s)
+		}
+		for j := range batch {
+			seeds[j] = t.level0.get(t.level0Slots.slot(uint32(kh[j])))
+		}
+		for j, s := range batch {
+			res[j] = t.level1.get(t.level1Slots.slot(level1Hash(t.hash, kh[j], seeds[j], s)))
+		}
+		if t.hashOnly {
+			for j, s := range batch {
+				if matchFingerprint(t, res[j], kh[j], s) {
+					found++
+				} else {
+					res[j] = NotFound
+				}
+			}
+		} else {
+			if w := t.keyWidth; w != 0 {
+				for j := range batch {
+					off := int(res[j]) * w
+					stored[j] = t.keys.data[off : off+w]
+				}
+			} else {
+				for j := range batch {
+					stored[j] = t.keys.key(int(res[j]))
+				}
+			}
+			for j, s := range batch {
+				if string(s) == string(stored[j]) {
+					found++
+				} else {
+					res[j] = NotFound
+				}
+			}
+		}
+		keys, out = keys[n:], out[n:]
+	}
+	return found
+}
+
+// lookupAllEach is LookupAll for a table with a normalizer, which allocates
+// for each key anyway and so gains nothing from batching, a prefilter,
+// which rejects most misses before the loads that batching overlaps, or a
+// hash function other than CHD, whose loads depend on one another, and for
+// a k-perfect table, which has several candidates for a key, or one whose
+// keys are borrowed, front coded, or in slot order, which a batch does not
+// load any faster.
+func lookupAllEach[T ~string | ~[]byte](t *Table, keys []T, out []uint32) int {
+	found := 0
+	for i, s := range keys {
+		n, ok := lookup(t, s)
+		if !ok {
+			n = NotFound
+		} else {
+			found++
+		}
+		out[i] = n
+	}
+	return found
+}
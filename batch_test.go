@@ -0,0 +1,47 @@
+package mph
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestLookupAll(t *testing.T) {
+	var keys, queries []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	for i := 0; i < 2000; i += 3 {
+		queries = append(queries, strconv.Itoa(i))
+	}
+	table := Build(keys)
+	out := make([]uint32, len(queries))
+	found := LookupAll(table, queries, out)
+	want := 0
+	for i, q := range queries {
+		n, ok := table.Lookup(q)
+		if !ok {
+			n = NotFound
+		} else {
+			want++
+		}
+		if out[i] != n {
+			t.Errorf("LookupAll(%s): got %d; want %d", q, out[i], n)
+		}
+	}
+	if found != want {
+		t.Errorf("LookupAll: got %d found; want %d", found, want)
+	}
+}
+
+func BenchmarkLookupAll(b *testing.B) {
+	var keys []string
+	for i := 0; i < 1000000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	table := Build(keys)
+	out := make([]uint32, len(keys))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		LookupAll(table, keys, out)
+	}
+}
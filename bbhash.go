@@ -0,0 +1,236 @@
+package mph
+
+import (
+	"context"
+	"math"
+	"math/bits"
+)
+
+// A cascade is the hash function of a table built with BBHash. Level l is a
+// bit vector with a bit set for each key that hashes to a position of its
+// own in it under the hash of level l; the keys that collide with another
+// key are passed on to level l+1, which has room for just those keys. A
+// key is found at the first level whose bit for it is set, and numbered by
+// the number of set bits before that bit in all the levels.
+//
+// The levels are stored back to back in bits, level l taking the words
+// bits[starts[l]:starts[l+1]], and ranks[b] is the number of set bits in
+// the blocks of cascadeBlock words before block b. All three slices alias
+// the serialized form of the cascade in level0.wide, so that the table
+// handles, copies and serializes it as it does seeds:
+//
+//	nlevels                      uint32
+//	starts[0] ... starts[nlevels] uint32, starting at 0
+//	bits[0] ... bits[S-1]        uint32, where S is starts[nlevels]
+//	ranks[0] ... ranks[S/8-1]    uint32
+//
+// Every level is a whole number of blocks. Bit i of a level is bit i%32 of
+// word i/32.
+type cascade struct {
+	starts []uint32
+	bits   []uint32
+	ranks  []uint32
+}
+
+const (
+	// cascadeGamma is the number of bits of a level per key passed to it.
+	// About 1/e^(1/gamma), or 61%, of the keys of a level are placed in
+	// it, so a table takes about gamma*e^(1/gamma), or 3.3, bits per key,
+	// and a lookup of a key tests 1.6 levels on average.
+	cascadeGamma = 2
+	// cascadeBlock is the number of words of a level array per rank.
+	cascadeBlock = 8
+	// maxCascadeLevels is the number of levels after which the keys that
+	// still collide are taken to be duplicates, or to have equal hashes.
+	maxCascadeLevels = 32
+)
+
+// splitCascade returns the cascade whose serialized form is words, which
+// must be valid.
+func splitCascade(words []uint32) cascade {
+	nl := int(words[0])
+	starts := words[1 : nl+2 : nl+2]
+	s := nl + 2 + int(starts[nl])
+	return cascade{starts: starts, bits: words[nl+2 : s : s], ranks: words[s:]}
+}
+
+// checkCascade returns ErrCorrupt unless words is the serialized form of a
+// cascade of nkeys keys.
+func checkCascade(words []uint32, nkeys int) error {
+	if len(words) < 2 || words[0] > maxCascadeLevels || len(words) < int(words[0])+2 {
+		return ErrCorrupt
+	}
+	nl := int(words[0])
+	starts := words[1 : nl+2]
+	if starts[0] != 0 {
+		return ErrCorrupt
+	}
+	for l := 0; l < nl; l++ {
+		if n := starts[l+1] - starts[l]; starts[l+1] <= starts[l] || n%cascadeBlock != 0 || n > 1<<27 {
+			return ErrCorrupt
+		}
+	}
+	size := uint64(starts[nl])
+	if uint64(len(words)) != uint64(nl)+2+size+size/cascadeBlock {
+		return ErrCorrupt
+	}
+	c := splitCascade(words)
+	var rank uint64
+	for b, r := range c.ranks {
+		if uint64(r) != rank {
+			return ErrCorrupt
+		}
+		for _, w := range c.bits[b*cascadeBlock : (b+1)*cascadeBlock] {
+			rank += uint64(bits.OnesCount32(w))
+		}
+	}
+	if rank != uint64(nkeys) {
+		return ErrCorrupt
+	}
+	return nil
+}
+
+// cascadeHash returns the hash under h that selects the bit of s in level l
+// of a cascade, where kh is keyHash(h, s). Level 0 uses kh itself, so most
+// lookups hash a key once.
+func cascadeHash[T ~string | ~[]byte](h Hash, kh uint64, l int, s T) uint32 {
+	if l == 0 {
+		return uint32(kh)
+	}
+	return level1Hash(h, kh, uint32(l), s)
+}
+
+// cascadeBit returns the position, within a level of n words, that the
+// hash v selects.
+func cascadeBit(v uint32, n uint32) int {
+	return int(uint64(v) * (uint64(n) << 5) >> 32)
+}
+
+// cascadeRank returns the number of s in c, where kh is keyHash(h, s), and
+// false if every level of c tested for s has its bit clear, in which case
+// s is not a key of the table.
+func cascadeRank[T ~string | ~[]byte](c *cascade, h Hash, kh uint64, s T) (uint32, bool) {
+	for l := 0; l+1 < len(c.starts); l++ {
+		start, end := c.starts[l], c.starts[l+1]
+		p := int(start)<<5 + cascadeBit(cascadeHash(h, kh, l, s), end-start)
+		if c.bits[p>>5]&(1<<(p&31)) != 0 {
+			return c.rank(p), true
+		}
+	}
+	return 0, false
+}
+
+// rank returns the number of set bits before bit p.
+func (c *cascade) rank(p int) uint32 {
+	w := p >> 5
+	r := c.ranks[w/cascadeBlock]
+	for _, v := range c.bits[w&^(cascadeBlock-1) : w] {
+		r += uint32(bits.OnesCount32(v))
+	}
+	return r + uint32(bits.OnesCount32(c.bits[w]&(1<<(p&31)-1)))
+}
+
+// cascadeWords returns the number of words of a level for n keys.
+func cascadeWords(n int) int {
+	return (cascadeGamma*n + 32*cascadeBlock - 1) / (32 * cascadeBlock) * cascadeBlock
+}
+
+// buildCascade builds the cascade of the keys of pool, whose key hashes are
+// hashes, as a rankBuild. The keys that collide in every level are stuck.
+func buildCascade(ctx context.Context, pool keyPool, hashes []uint64, cfg *buildConfig) (words, level1 []uint32, stuck []int, err error) {
+	nkeys := pool.len()
+	if uint64(nkeys)*cascadeGamma > math.MaxUint32 {
+		return nil, nil, nil, errTooManyKeys
+	}
+	h := cfg.hash
+	sc := cfg.scratchSpace()
+	sc.slots = reuse(sc.slots, nkeys)
+	pos := sc.slots // bit of each key in the level that placed it
+	levels := make([]uint8, nkeys)
+	rest := make([]uint32, nkeys)
+	for i := range rest {
+		rest[i] = uint32(i)
+	}
+	var levelBits []uint64
+	starts := []uint32{0}
+	placed := 0
+	for l := 0; len(rest) > 0; l++ {
+		if l == maxCascadeLevels {
+			stuck = make([]int, len(rest))
+			for j, i := range rest {
+				stuck[j] = int(i)
+			}
+			return nil, nil, stuck, nil
+		}
+		n := cascadeWords(len(rest))
+		set, collided := newBitset(32*n), newBitset(32*n)
+		for j, i := range rest {
+			if j%ctxCheckInterval == 0 {
+				if err := ctx.Err(); err != nil {
+					return nil, nil, nil, err
+				}
+			}
+			p := cascadeBit(cascadeHash(h, hashes[i], l, pool.key(int(i))), uint32(n))
+			pos[i] = uint32(p)
+			if set.has(p) {
+				collided.set(p)
+			}
+			set.set(p)
+		}
+		next := rest[:0]
+		for _, i := range rest {
+			if collided.has(int(pos[i])) {
+				next = append(next, i)
+			} else {
+				levels[i] = uint8(l)
+			}
+		}
+		for w := range set {
+			set[w] &^= collided[w]
+		}
+		placed += len(rest) - len(next)
+		rest = next
+		levelBits = append(levelBits, set...)
+		starts = append(starts, starts[len(starts)-1]+uint32(n))
+		if cfg.progress != nil {
+			cfg.progress(placed, nkeys)
+		}
+	}
+
+	nl := len(starts) - 1
+	size := int(starts[nl])
+	words = make([]uint32, nl+2+size+size/cascadeBlock)
+	words[0] = uint32(nl)
+	copy(words[1:], starts)
+	for w, v := range levelBits {
+		words[nl+2+2*w] = uint32(v)
+		words[nl+2+2*w+1] = uint32(v >> 32)
+	}
+	c := splitCascade(words)
+	var rank uint32
+	for b := range c.ranks {
+		c.ranks[b] = rank
+		for _, v := range c.bits[b*cascadeBlock : (b+1)*cascadeBlock] {
+			rank += uint32(bits.OnesCount32(v))
+		}
+	}
+	level1 = make([]uint32, nkeys)
+	for i := 0; i < nkeys; i++ {
+		level1[c.rank(int(c.starts[levels[i]])<<5+int(pos[i]))] = uint32(i)
+	}
+	return words, level1, nil, nil
+}
+
+// expectedCascadeWords returns the expected size, in words, of the
+// serialized cascade of nkeys keys. A key of a level of n keys and b bits is
+// placed unless another key hits its bit, with probability about
+// e^(-(n-1)/b).
+func expectedCascadeWords(nkeys int) int {
+	levels, size := 0, 0
+	for n := float64(nkeys); n >= 0.5 && levels < maxCascadeLevels; levels++ {
+		w := cascadeWords(int(math.Ceil(n)))
+		size += w
+		n *= 1 - math.Exp(-(n-1)/float64(32*w))
+	}
+	return levels + 2 + size + size/cascadeBlock
+}
@@ -0,0 +1,155 @@
+package mph
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestBBHash(t *testing.T) {
+	for _, nkeys := range []int{0, 1, 2, 100, 10000} {
+		for _, h := range []Hash{Murmur3, Wyhash} {
+			var keys []string
+			for i := 0; i < nkeys; i++ {
+				keys = append(keys, strconv.Itoa(i))
+			}
+			table, err := BuildWithOptions(keys, WithAlgorithm(BBHash), WithHash(h), WithVerify())
+			if err != nil {
+				t.Fatalf("BuildWithOptions(%d keys, %v): %v", nkeys, h, err)
+			}
+			checkTable(t, table, keys, []string{"-1", "quux"})
+			checkContiguous(t, "BBHash", table)
+			for i, k := range keys {
+				if n := LookupUnchecked(table, k); n != uint32(i) {
+					t.Errorf("LookupUnchecked(%s): got %d; want %d", k, n, i)
+				}
+			}
+
+			data := mustMarshal(t, table)
+			var read Table
+			if err := read.UnmarshalBinary(data); err != nil {
+				t.Fatalf("UnmarshalBinary(%d keys, %v): %v", nkeys, h, err)
+			}
+			if !Equal(table, &read) {
+				t.Errorf("UnmarshalBinary(%d keys, %v): table differs", nkeys, h)
+			}
+			checkTable(t, &read, keys, []string{"quux"})
+			loaded, err := LoadBytes(data)
+			if err != nil {
+				t.Fatalf("LoadBytes(%d keys, %v): %v", nkeys, h, err)
+			}
+			checkTable(t, loaded, keys, []string{"quux"})
+			parallel, err := Unmarshal(data, WithDecodeParallelism(4))
+			if err != nil {
+				t.Fatalf("Unmarshal(%d keys, %v): %v", nkeys, h, err)
+			}
+			checkTable(t, parallel, keys, []string{"quux"})
+			checkTable(t, table.Clone(), keys, []string{"quux"})
+		}
+	}
+}
+
+func TestBBHash_size(t *testing.T) {
+	var keys []string
+	for i := 0; i < 100000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	table, err := BuildWithOptions(keys, WithAlgorithm(BBHash))
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	s := table.Stats()
+	// The cascade takes about 3.7 bits per key with its ranks, and level1
+	// 32 bits.
+	if cascadeBits := 32 * float64(s.Level0Len) / float64(len(keys)); cascadeBits > 4 {
+		t.Errorf("Stats: cascade takes %.2f bits per key; want at most 4", cascadeBits)
+	}
+	if s.Levels < 5 || s.BucketSizes != nil || s.MaxSeed != 0 {
+		t.Errorf("Stats: got %d levels, buckets %v, max seed %d", s.Levels, s.BucketSizes, s.MaxSeed)
+	}
+	est, err := EstimateSize(len(keys), s.KeyBytes, WithAlgorithm(BBHash))
+	if err != nil {
+		t.Fatalf("EstimateSize: %v", err)
+	}
+	if got := len(mustMarshal(t, table)); got < est.File*97/100 || got > est.File*103/100 {
+		t.Errorf("EstimateSize: got File %d; want within 3%% of %d", est.File, got)
+	}
+}
+
+func TestBBHash_hashOnly(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	table, err := BuildWithOptions(keys, WithAlgorithm(BBHash))
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	for i, k := range keys {
+		if n, ok := table.WithoutKeys().Lookup(k); !ok || n != uint32(i) {
+			t.Errorf("WithoutKeys().Lookup(%s): got %d, %t; want %d", k, n, ok, i)
+		}
+	}
+	fp, err := table.WithFingerprints(16)
+	if err != nil {
+		t.Fatalf("WithFingerprints: %v", err)
+	}
+	var read Table
+	if err := read.UnmarshalBinary(mustMarshal(t, fp)); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	checkTable(t, &read, keys, []string{"quux", "-1"})
+}
+
+func TestBBHash_duplicates(t *testing.T) {
+	keys := []string{"a", "b", "c", "b", "d", "a"}
+	_, err := BuildWithOptions(keys, WithAlgorithm(BBHash))
+	var dup *DuplicateKeyError
+	if !errors.As(err, &dup) || string(dup.Key) != "b" || dup.First != 1 || dup.Second != 3 {
+		t.Errorf("BuildWithOptions(duplicates): got err=%v; want b at 1 and 3", err)
+	}
+	var removed int
+	table, err := BuildWithOptions(keys, WithAlgorithm(BBHash), WithDedup(&removed))
+	if err != nil {
+		t.Fatalf("BuildWithOptions(WithDedup): %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("WithDedup: removed %d keys; want 2", removed)
+	}
+	checkTable(t, table, []string{"a", "b", "c", "d"}, []string{"e"})
+}
+
+func TestBBHash_corrupt(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	table, err := BuildWithOptions(keys, WithAlgorithm(BBHash))
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	// Setting a clear bit of the cascade breaks its ranks.
+	words := table.level0.wide
+	bit := -1
+	for i, w := range table.cascade.bits {
+		if w != ^uint32(0) {
+			bit = len(words) - len(table.cascade.bits) - len(table.cascade.ranks) + i
+			break
+		}
+	}
+	corrupt := append([]uint32(nil), words...)
+	corrupt[bit] = ^uint32(0)
+	if err := checkCascade(corrupt, len(keys)); err != ErrCorrupt {
+		t.Errorf("checkCascade(extra bits): got %v; want %v", err, ErrCorrupt)
+	}
+	if err := checkCascade(words, len(keys)+1); err != ErrCorrupt {
+		t.Errorf("checkCascade(wrong count): got %v; want %v", err, ErrCorrupt)
+	}
+	if err := checkCascade(words[:len(words)-1], len(keys)); err != ErrCorrupt {
+		t.Errorf("checkCascade(truncated): got %v; want %v", err, ErrCorrupt)
+	}
+	if err := table.Gen(new(bytes.Buffer), "p", "v"); err == nil {
+		t.Errorf("Gen(BBHash): got nil error")
+	}
+}
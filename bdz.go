@@ -0,0 +1,293 @@
+package mph
+
+import (
+	"context"
+	"math"
+	"math/bits"
+)
+
+// A hypergraph is the hash function of a table built with BDZ. Each key is
+// an edge joining three vertices, one in each third of the vertices, and
+// the edges are peeled: an edge with a vertex of its own is removed, which
+// may leave another edge with a vertex of its own, until none is left.
+// Each vertex has a value g in [0, 3), assigned in the reverse order of
+// the peeling so that the sum of the values of the vertices of an edge,
+// modulo 3, selects the vertex it was peeled at. The vertices that select
+// no key have the value 3, which counts as 0 in the sums, and a key is
+// numbered by the number of vertices before its own that select a key.
+//
+// The values are stored 2 bits each in g, and ranks[b] is the number of
+// vertices that select a key in the blocks of bdzBlock words of g before
+// block b. Both slices alias the serialized form of the hypergraph in
+// level0.wide:
+//
+//	seed                     uint32, the hash seed of the vertices
+//	r                        uint32, the number of vertices in each third
+//	g[0] ... g[G-1]          uint32, where G is 3r*2 bits rounded up to a block
+//	ranks[0] ... ranks[B-1]  uint32, where B is G/bdzBlock
+//
+// The value of vertex v is bits 2*(v%16) and 2*(v%16)+1 of g[v/16].
+type hypergraph struct {
+	seed, r uint32
+	g       []uint32
+	ranks   []uint32
+}
+
+const (
+	// bdzRatio is the number of vertices per key, in hundredths. Random
+	// 3-hypergraphs with more than 1.222 vertices per edge peel completely
+	// with a probability that tends to 1 as they grow, but slowly: with
+	// 1.23, a quarter of the graphs of a few thousand edges fail to peel.
+	// Every third thus has bdzExtra vertices more, plus the square root of
+	// the number of keys, which brings the failures down to about 1% at
+	// any size for a negligible cost in bits per key.
+	bdzRatio = 123
+	bdzExtra = 16
+	// bdzBlock is the number of words of g per rank.
+	bdzBlock = 16
+	// maxBDZSeeds is the number of seeds that a build tries before it
+	// gives up. Each try takes time linear in the number of keys and fails
+	// with a probability of about 1%.
+	maxBDZSeeds = 32
+)
+
+// bdzSize returns the number of vertices in each third of the hypergraph
+// of nkeys keys, and the number of words of its values.
+func bdzSize(nkeys int) (r, gwords int) {
+	r = (bdzRatio*nkeys+299)/300 + bdzExtra + int(math.Sqrt(float64(nkeys)))
+	gwords = (3*r + 16*bdzBlock - 1) / (16 * bdzBlock) * bdzBlock
+	return r, gwords
+}
+
+// splitHypergraph returns the hypergraph whose serialized form is words,
+// which must be valid.
+func splitHypergraph(words []uint32) hypergraph {
+	r := int(words[1])
+	gwords := (3*r + 16*bdzBlock - 1) / (16 * bdzBlock) * bdzBlock
+	return hypergraph{
+		seed:  words[0],
+		r:     words[1],
+		g:     words[2 : 2+gwords : 2+gwords],
+		ranks: words[2+gwords:],
+	}
+}
+
+// checkHypergraph returns ErrCorrupt unless words is the serialized form of
+// a hypergraph of nkeys keys.
+func checkHypergraph(words []uint32, nkeys int) error {
+	if len(words) < 2 || words[1] == 0 || words[1] > math.MaxUint32/3 {
+		return ErrCorrupt
+	}
+	gwords := (3*uint64(words[1]) + 16*bdzBlock - 1) / (16 * bdzBlock) * bdzBlock
+	if uint64(len(words)) != 2+gwords+gwords/bdzBlock {
+		return ErrCorrupt
+	}
+	h := splitHypergraph(words)
+	var rank uint64
+	for b, r := range h.ranks {
+		if uint64(r) != rank {
+			return ErrCorrupt
+		}
+		for _, w := range h.g[b*bdzBlock : (b+1)*bdzBlock] {
+			rank += uint64(selecting(w))
+		}
+	}
+	// The padding vertices past the last third must select no key.
+	for v := 3 * uint64(h.r); v < 16*gwords; v++ {
+		if h.value(uint32(v)) != 3 {
+			return ErrCorrupt
+		}
+	}
+	if rank != uint64(nkeys) {
+		return ErrCorrupt
+	}
+	return nil
+}
+
+// selecting returns the number of the 16 values packed in w that are not 3.
+func selecting(w uint32) int {
+	return 16 - bits.OnesCount32(w&(w>>1)&0x55555555)
+}
+
+// value returns the value of vertex v.
+func (h *hypergraph) value(v uint32) uint32 {
+	return h.g[v>>4] >> (2 * (v & 15)) & 3
+}
+
+// bdzVertices returns the vertices of the key whose 64-bit hash is fp, one in
+// each third of the r*3 vertices of a hypergraph with the seed.
+func bdzVertices(fp uint64, seed, r uint32) (v0, v1, v2 uint32) {
+	s := uint64(seed) * wyp3
+	x := wymix(fp^wyp1, s^wyp2)
+	y := wymix(fp^wyp2, s^wyp0)
+	v0 = uint32(uint64(uint32(x)) * uint64(r) >> 32)
+	v1 = r + uint32(x>>32*uint64(r)>>32)
+	v2 = 2*r + uint32(uint64(uint32(y))*uint64(r)>>32)
+	return v0, v1, v2
+}
+
+// rank returns the number of vertices before v that select a key.
+func (h *hypergraph) rank(v uint32) uint32 {
+	w := v >> 4
+	r := h.ranks[w/bdzBlock]
+	for _, x := range h.g[w&^(bdzBlock-1) : w] {
+		r += uint32(selecting(x))
+	}
+	// The vertices of word w from v on are counted as selecting no key.
+	return r + uint32(selecting(h.g[w]|^uint32(0)<<(2*(v&15))))
+}
+
+// hypergraphRank returns the number of s in h, where kh is keyHash(hash, s),
+// and false if the vertex that s selects selects no key, in which case s is
+// not a key of the table.
+func hypergraphRank[T ~string | ~[]byte](h *hypergraph, hash Hash, kh uint64, s T) (uint32, bool) {
+	v0, v1, v2 := bdzVertices(wideKeyHash(hash, kh, s), h.seed, h.r)
+	g0, g1, g2 := h.value(v0), h.value(v1), h.value(v2)
+	v := v0
+	switch (g0 + g1 + g2) % 3 {
+	case 1:
+		v = v1
+	case 2:
+		v = v2
+	}
+	if h.value(v) == 3 {
+		return 0, false
+	}
+	return h.rank(v), true
+}
+
+// buildHypergraph builds the hypergraph of the keys of pool, whose key
+// hashes are hashes, as a rankBuild. It tries up to maxBDZSeeds seeds,
+// each in linear time. Keys with equal 64-bit hashes, which are equal
+// edges, never peel; they are stuck.
+func buildHypergraph(ctx context.Context, pool keyPool, hashes []uint64, cfg *buildConfig) (words, level1 []uint32, stuck []int, err error) {
+	nkeys := pool.len()
+	if uint64(nkeys)*bdzRatio/100 > math.MaxUint32/2 {
+		return nil, nil, nil, errTooManyKeys
+	}
+	for i := range hashes {
+		hashes[i] = wideKeyHash(cfg.hash, hashes[i], pool.key(i))
+	}
+	r, gwords := bdzSize(nkeys)
+	nv := 3 * r
+	edges := make([]uint32, 3*nkeys)
+	degree := make([]uint32, nv)
+	xor := make([]uint32, nv) // the XOR of the edges of each vertex
+	order := make([]uint32, 0, nkeys)
+	peeled := make([]uint8, nkeys) // the vertex of each edge it was peeled at, or 3
+	var seed uint32
+	for ; ; seed++ {
+		if seed == maxBDZSeeds {
+			return nil, nil, nil, ErrBuildFailed
+		}
+		for v := range degree {
+			degree[v], xor[v] = 0, 0
+		}
+		for i, fp := range hashes {
+			if i%ctxCheckInterval == 0 {
+				if err := ctx.Err(); err != nil {
+					return nil, nil, nil, err
+				}
+			}
+			v0, v1, v2 := bdzVertices(fp, seed, uint32(r))
+			edges[3*i], edges[3*i+1], edges[3*i+2] = v0, v1, v2
+			peeled[i] = 3
+			for _, v := range [3]uint32{v0, v1, v2} {
+				degree[v]++
+				xor[v] ^= uint32(i)
+			}
+		}
+		// The vertices of degree 1 are peeled in turn, and order records
+		// the edges in the order they are peeled.
+		order = order[:0]
+		for v := range degree {
+			if degree[v] == 1 {
+				order = peel(uint32(v), edges, degree, xor, order, peeled)
+			}
+		}
+		if cfg.progress != nil {
+			cfg.progress(len(order), nkeys)
+		}
+		if len(order) == nkeys {
+			break
+		}
+		if stuck := unpeeledEqual(hashes, peeled); stuck != nil {
+			return nil, nil, stuck, nil
+		}
+	}
+
+	words = make([]uint32, 2+gwords+gwords/bdzBlock)
+	words[0], words[1] = seed, uint32(r)
+	h := splitHypergraph(words)
+	for i := range h.g {
+		h.g[i] = ^uint32(0)
+	}
+	for j := len(order) - 1; j >= 0; j-- {
+		e := order[j]
+		vs := edges[3*e : 3*e+3]
+		sum := uint32(peeled[e]) + 6 // keeps it positive
+		for k, v := range vs {
+			if k != int(peeled[e]) {
+				sum -= h.value(v) % 3
+			}
+		}
+		v := vs[peeled[e]]
+		h.g[v>>4] &^= (3 ^ sum%3) << (2 * (v & 15))
+	}
+	var rank uint32
+	for b := range h.ranks {
+		h.ranks[b] = rank
+		for _, w := range h.g[b*bdzBlock : (b+1)*bdzBlock] {
+			rank += uint32(selecting(w))
+		}
+	}
+	level1 = make([]uint32, nkeys)
+	for i := 0; i < nkeys; i++ {
+		level1[h.rank(edges[3*i+int(peeled[i])])] = uint32(i)
+	}
+	return words, level1, nil, nil
+}
+
+// peel peels the edges from vertex v, which has degree 1, and from the
+// vertices that that leaves with degree 1, appending them to order.
+func peel(v uint32, edges, degree, xor, order []uint32, peeled []uint8) []uint32 {
+	for stack := []uint32{v}; len(stack) > 0; {
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if degree[v] != 1 {
+			continue
+		}
+		e := xor[v]
+		order = append(order, e)
+		for k, u := range edges[3*e : 3*e+3] {
+			if u == v {
+				peeled[e] = uint8(k)
+			}
+			degree[u]--
+			xor[u] ^= e
+			if degree[u] == 1 {
+				stack = append(stack, u)
+			}
+		}
+	}
+	return order
+}
+
+// unpeeledEqual returns the positions, in increasing order, of the keys
+// whose edges did not peel and have the same hash as another such key.
+func unpeeledEqual(hashes []uint64, peeled []uint8) []int {
+	var rest []int
+	for i, k := range peeled {
+		if k == 3 {
+			rest = append(rest, i)
+		}
+	}
+	return repeatedHashes(hashes, rest)
+}
+
+// expectedHypergraphWords returns the size, in words, of the serialized
+// hypergraph of nkeys keys, which only depends on nkeys.
+func expectedHypergraphWords(nkeys int) int {
+	_, gwords := bdzSize(nkeys)
+	return 2 + gwords + gwords/bdzBlock
+}
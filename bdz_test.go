@@ -0,0 +1,129 @@
+package mph
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestBDZ(t *testing.T) {
+	for _, nkeys := range []int{0, 1, 2, 100, 10000} {
+		for _, h := range []Hash{Murmur3, Wyhash} {
+			var keys []string
+			for i := 0; i < nkeys; i++ {
+				keys = append(keys, strconv.Itoa(i))
+			}
+			table, err := BuildWithOptions(keys, WithAlgorithm(BDZ), WithHash(h), WithVerify())
+			if err != nil {
+				t.Fatalf("BuildWithOptions(%d keys, %v): %v", nkeys, h, err)
+			}
+			checkTable(t, table, keys, []string{"-1", "quux"})
+			checkContiguous(t, "BDZ", table)
+
+			data := mustMarshal(t, table)
+			var read Table
+			if err := read.UnmarshalBinary(data); err != nil {
+				t.Fatalf("UnmarshalBinary(%d keys, %v): %v", nkeys, h, err)
+			}
+			if !Equal(table, &read) {
+				t.Errorf("UnmarshalBinary(%d keys, %v): table differs", nkeys, h)
+			}
+			checkTable(t, &read, keys, []string{"quux"})
+			loaded, err := LoadBytes(data)
+			if err != nil {
+				t.Fatalf("LoadBytes(%d keys, %v): %v", nkeys, h, err)
+			}
+			checkTable(t, loaded, keys, []string{"quux"})
+			checkTable(t, table.Clone(), keys, []string{"quux"})
+			checkTable(t, table.WithoutKeys(), keys, nil)
+		}
+	}
+}
+
+func TestBDZ_size(t *testing.T) {
+	var keys []string
+	for i := 0; i < 100000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	table, err := BuildWithOptions(keys, WithAlgorithm(BDZ))
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	s := table.Stats()
+	// The values take 1.23*2 bits per key, and the ranks another 0.15.
+	if gBits := 32 * float64(s.Level0Len) / float64(len(keys)); gBits > 2.65 {
+		t.Errorf("Stats: hypergraph takes %.2f bits per key; want at most 2.65", gBits)
+	}
+	if s.MaxSeed != table.hypergraph.seed {
+		t.Errorf("Stats: got max seed %d; want %d", s.MaxSeed, table.hypergraph.seed)
+	}
+	est, err := EstimateSize(len(keys), s.KeyBytes, WithAlgorithm(BDZ))
+	if err != nil {
+		t.Fatalf("EstimateSize: %v", err)
+	}
+	if got := len(mustMarshal(t, table)); got != est.File {
+		t.Errorf("EstimateSize: got File %d; want %d", est.File, got)
+	}
+
+	// Small hypergraphs peel about as well as large ones.
+	var retries uint32
+	for n := 1; n <= 500; n++ {
+		table, err := BuildWithOptions(keys[:n], WithAlgorithm(BDZ))
+		if err != nil {
+			t.Fatalf("BuildWithOptions(%d keys): %v", n, err)
+		}
+		retries += table.Stats().MaxSeed
+	}
+	if retries > 25 {
+		t.Errorf("BuildWithOptions: %d retries for 500 builds; want at most 25", retries)
+	}
+}
+
+func TestBDZ_duplicates(t *testing.T) {
+	keys := []string{"a", "b", "c", "b", "d", "a"}
+	_, err := BuildWithOptions(keys, WithAlgorithm(BDZ))
+	var dup *DuplicateKeyError
+	if !errors.As(err, &dup) || string(dup.Key) != "b" || dup.First != 1 || dup.Second != 3 {
+		t.Errorf("BuildWithOptions(duplicates): got err=%v; want b at 1 and 3", err)
+	}
+	var removed int
+	table, err := BuildWithOptions(keys, WithAlgorithm(BDZ), WithDedup(&removed))
+	if err != nil {
+		t.Fatalf("BuildWithOptions(WithDedup): %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("WithDedup: removed %d keys; want 2", removed)
+	}
+	checkTable(t, table, []string{"a", "b", "c", "d"}, []string{"e"})
+}
+
+func TestBDZ_corrupt(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	table, err := BuildWithOptions(keys, WithAlgorithm(BDZ))
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	words := table.level0.wide
+	if err := checkHypergraph(words, len(keys)); err != nil {
+		t.Errorf("checkHypergraph: %v", err)
+	}
+	if err := checkHypergraph(words, len(keys)+1); err != ErrCorrupt {
+		t.Errorf("checkHypergraph(wrong count): got %v; want %v", err, ErrCorrupt)
+	}
+	if err := checkHypergraph(words[:len(words)-1], len(keys)); err != ErrCorrupt {
+		t.Errorf("checkHypergraph(truncated): got %v; want %v", err, ErrCorrupt)
+	}
+	corrupt := append([]uint32(nil), words...)
+	corrupt[len(corrupt)-1]++
+	if err := checkHypergraph(corrupt, len(keys)); err != ErrCorrupt {
+		t.Errorf("checkHypergraph(wrong rank): got %v; want %v", err, ErrCorrupt)
+	}
+	corrupt = append(corrupt[:0], words...)
+	corrupt[1] = 1 << 31
+	if err := checkHypergraph(corrupt, len(keys)); err != ErrCorrupt {
+		t.Errorf("checkHypergraph(too many vertices): got %v; want %v", err, ErrCorrupt)
+	}
+}
@@ -0,0 +1,23 @@
+package mph
+
+// A bitset is a set of small non-negative integers, one bit each. Slot
+// occupancy during a build is tracked in one, which takes an eighth of the
+// memory of a []bool and keeps more of level1 in cache during the search
+// for seeds.
+type bitset []uint64
+
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+func (s bitset) has(i int) bool {
+	return s[i>>6]&(1<<(uint(i)&63)) != 0
+}
+
+func (s bitset) set(i int) {
+	s[i>>6] |= 1 << (uint(i) & 63)
+}
+
+func (s bitset) clear(i int) {
+	s[i>>6] &^= 1 << (uint(i) & 63)
+}
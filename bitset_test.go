@@ -0,0 +1,23 @@
+package mph
+
+import "testing"
+
+func TestBitset(t *testing.T) {
+	s := newBitset(130)
+	if len(s) != 3 {
+		t.Fatalf("newBitset(130): got %d words; want 3", len(s))
+	}
+	for _, i := range []int{0, 63, 64, 129} {
+		s.set(i)
+	}
+	for i := 0; i < 130; i++ {
+		want := i == 0 || i == 63 || i == 64 || i == 129
+		if got := s.has(i); got != want {
+			t.Errorf("has(%d): got %t; want %t", i, got, want)
+		}
+	}
+	s.clear(64)
+	if s.has(64) || !s.has(63) {
+		t.Errorf("clear(64): got has(63), has(64) = %t, %t; want true, false", s.has(63), s.has(64))
+	}
+}
@@ -0,0 +1,226 @@
+// Package bitvector implements a succinct bit vector: a sequence of bits
+// with an index that answers rank and select queries in constant time, for
+// less than a third more memory than the bits themselves: a quarter for
+// rank, and a sixteenth for select.
+//
+// The index is rank9 of "Broadword implementation of rank/select queries"
+// (Vigna, 2008). The bits are split into blocks of 512, and each block has
+// two words of counts: the number of ones before the block, and the number
+// of ones before each of its words but the first, in 9 bits each. Select
+// samples the block of every 512th one, and of every 512th zero, and
+// searches the blocks between two samples, then the words of a block.
+package bitvector
+
+import (
+	"math/bits"
+)
+
+// A Vector is an immutable sequence of bits indexed for rank and select.
+// It is safe for concurrent use.
+type Vector struct {
+	words  []uint64
+	n      int
+	ones   int
+	counts []uint64 // two words for each block of 512 bits
+
+	// samples1[s] is the block of one s*sampleRate, and samples0[s] the
+	// block of zero s*sampleRate, each followed by the number of blocks.
+	samples1 []uint32
+	samples0 []uint32
+}
+
+const (
+	blockBits  = 512
+	blockWords = blockBits / 64
+	sampleRate = 512
+)
+
+// New returns a Vector of the first n bits of words, bit i being bit i%64
+// of words[i/64]. It keeps words, which must stay unchanged, and panics if
+// words holds fewer than n bits.
+func New(words []uint64, n int) *Vector {
+	nw := (n + 63) / 64
+	if n < 0 || len(words) < nw {
+		panic("bitvector: New: too few words for the bits")
+	}
+	words = words[:nw:nw]
+	nb := (nw + blockWords - 1) / blockWords
+	v := &Vector{words: words, n: n, counts: make([]uint64, 2*nb)}
+	var ones uint64
+	for b := 0; b < nb; b++ {
+		v.counts[2*b] = ones
+		var sub, in uint64
+		for j := 0; j < blockWords; j++ {
+			if j > 0 {
+				sub |= in << (9 * (j - 1))
+			}
+			if w := b*blockWords + j; w < nw {
+				in += uint64(bits.OnesCount64(v.word(w)))
+			}
+		}
+		v.counts[2*b+1] = sub
+		ones += in
+	}
+	v.ones = int(ones)
+	v.samples1 = v.sample(v.ones, false)
+	v.samples0 = v.sample(n-v.ones, true)
+	return v
+}
+
+// word returns word w with the bits from n on cleared.
+func (v *Vector) word(w int) uint64 {
+	x := v.words[w]
+	if r := v.n - 64*w; r < 64 {
+		x &= 1<<uint(r) - 1
+	}
+	return x
+}
+
+// sample returns the samples of the total ones, or zeros, of v.
+func (v *Vector) sample(total int, zeros bool) []uint32 {
+	nb := len(v.counts) / 2
+	samples := make([]uint32, 0, total/sampleRate+2)
+	b := 0
+	for k := 0; k < total; k += sampleRate {
+		for b+1 < nb && v.before(b+1, zeros) <= k {
+			b++
+		}
+		samples = append(samples, uint32(b))
+	}
+	return append(samples, uint32(nb))
+}
+
+// sub returns the number of ones in the words of block b before word j.
+func (v *Vector) sub(b, j int) int {
+	if j == 0 {
+		return 0
+	}
+	return int(v.counts[2*b+1] >> (9 * (j - 1)) & 0x1ff)
+}
+
+// Len returns the number of bits in v.
+func (v *Vector) Len() int {
+	return v.n
+}
+
+// Ones returns the number of ones in v.
+func (v *Vector) Ones() int {
+	return v.ones
+}
+
+// Size returns the memory used by the index of v, not counting the bits,
+// in bytes.
+func (v *Vector) Size() int {
+	return 8*len(v.counts) + 4*(len(v.samples1)+len(v.samples0))
+}
+
+// Get returns bit i. It panics if i is out of range.
+func (v *Vector) Get(i int) bool {
+	if uint(i) >= uint(v.n) {
+		panic("bitvector: Get: index out of range")
+	}
+	return v.words[i>>6]&(1<<(uint(i)&63)) != 0
+}
+
+// Rank1 returns the number of ones before bit i, for i in [0, Len()]. It
+// panics if i is out of range.
+func (v *Vector) Rank1(i int) int {
+	if uint(i) > uint(v.n) {
+		panic("bitvector: Rank: index out of range")
+	}
+	if i == v.n {
+		return v.ones
+	}
+	w := i >> 6
+	b := w / blockWords
+	r := v.before(b, false) + v.sub(b, w%blockWords)
+	return r + bits.OnesCount64(v.words[w]&(1<<(uint(i)&63)-1))
+}
+
+// Rank0 returns the number of zeros before bit i, for i in [0, Len()]. It
+// panics if i is out of range.
+func (v *Vector) Rank0(i int) int {
+	return i - v.Rank1(i)
+}
+
+// Select1 returns the position of one k, counting from 0, for k in
+// [0, Ones()). It panics if k is out of range.
+func (v *Vector) Select1(k int) int {
+	if uint(k) >= uint(v.ones) {
+		panic("bitvector: Select1: index out of range")
+	}
+	b := v.block(k, false)
+	k -= v.before(b, false)
+	j := blockWords - 1
+	for ; j > 0 && v.sub(b, j) > k; j-- {
+	}
+	w := b*blockWords + j
+	return 64*w + selectWord(v.words[w], k-v.sub(b, j))
+}
+
+// Select0 returns the position of zero k, counting from 0, for k in
+// [0, Len()-Ones()). It panics if k is out of range.
+func (v *Vector) Select0(k int) int {
+	if uint(k) >= uint(v.n-v.ones) {
+		panic("bitvector: Select0: index out of range")
+	}
+	b := v.block(k, true)
+	k -= v.before(b, true)
+	j := blockWords - 1
+	for ; j > 0 && 64*j-v.sub(b, j) > k; j-- {
+	}
+	w := b*blockWords + j
+	return 64*w + selectWord(^v.words[w], k-(64*j-v.sub(b, j)))
+}
+
+// block returns the last block that at most k ones, or zeros, precede,
+// searching between the samples of k.
+func (v *Vector) block(k int, zeros bool) int {
+	samples := v.samples1
+	if zeros {
+		samples = v.samples0
+	}
+	s := k / sampleRate
+	lo, hi := int(samples[s]), int(samples[s+1])
+	if hi == len(v.counts)/2 {
+		hi--
+	}
+	// lo is preceded by at most k, and the block after hi, if any, by more.
+	for lo < hi {
+		m := int(uint(lo+hi+1) >> 1)
+		if v.before(m, zeros) <= k {
+			lo = m
+		} else {
+			hi = m - 1
+		}
+	}
+	return lo
+}
+
+// before returns the number of ones, or zeros, in the blocks before block b.
+func (v *Vector) before(b int, zeros bool) int {
+	if zeros {
+		return b*blockBits - int(v.counts[2*b])
+	}
+	return int(v.counts[2*b])
+}
+
+// selectWord returns the position of set bit k of x, which has more than k
+// set bits.
+func selectWord(x uint64, k int) int {
+	p := 0
+	for c := bits.OnesCount32(uint32(x)); c <= k; c = bits.OnesCount32(uint32(x)) {
+		k -= c
+		x >>= 32
+		p += 32
+	}
+	for c := bits.OnesCount8(uint8(x)); c <= k; c = bits.OnesCount8(uint8(x)) {
+		k -= c
+		x >>= 8
+		p += 8
+	}
+	for ; k > 0; k-- {
+		x &= x - 1
+	}
+	return p + bits.TrailingZeros64(x)
+}
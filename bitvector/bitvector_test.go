@@ -0,0 +1,107 @@
+package bitvector
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// randomWords returns n random bits, each set with probability p, and
+// garbage in the bits of the last word from n on.
+func randomWords(r *rand.Rand, n int, p float64) []uint64 {
+	words := make([]uint64, (n+63)/64)
+	for i := 0; i < n; i++ {
+		if r.Float64() < p {
+			words[i/64] |= 1 << (i % 64)
+		}
+	}
+	if n%64 != 0 {
+		words[len(words)-1] |= ^uint64(0) << (n % 64)
+	}
+	return words
+}
+
+func TestVector(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, n := range []int{0, 1, 63, 64, 65, 511, 512, 513, 4096, 20000} {
+		for _, p := range []float64{0, 0.01, 0.5, 0.99, 1} {
+			words := randomWords(r, n, p)
+			v := New(words, n)
+			if v.Len() != n {
+				t.Errorf("Len(n=%d): got %d", n, v.Len())
+			}
+			var ones, zeros []int
+			for i := 0; i < n; i++ {
+				if got := v.Rank1(i); got != len(ones) {
+					t.Fatalf("Rank1(n=%d, p=%v, %d): got %d; want %d", n, p, i, got, len(ones))
+				}
+				if got := v.Rank0(i); got != len(zeros) {
+					t.Fatalf("Rank0(n=%d, p=%v, %d): got %d; want %d", n, p, i, got, len(zeros))
+				}
+				if v.Get(i) {
+					ones = append(ones, i)
+				} else {
+					zeros = append(zeros, i)
+				}
+			}
+			if v.Ones() != len(ones) || v.Rank1(n) != len(ones) || v.Rank0(n) != len(zeros) {
+				t.Errorf("Ones(n=%d, p=%v): got %d, %d, %d; want %d", n, p, v.Ones(), v.Rank1(n), n-v.Rank0(n), len(ones))
+			}
+			for k, i := range ones {
+				if got := v.Select1(k); got != i {
+					t.Fatalf("Select1(n=%d, p=%v, %d): got %d; want %d", n, p, k, got, i)
+				}
+			}
+			for k, i := range zeros {
+				if got := v.Select0(k); got != i {
+					t.Fatalf("Select0(n=%d, p=%v, %d): got %d; want %d", n, p, k, got, i)
+				}
+			}
+		}
+	}
+}
+
+func TestVector_panics(t *testing.T) {
+	v := New([]uint64{0b1011}, 4)
+	for name, f := range map[string]func(){
+		"New":     func() { New([]uint64{0}, 65) },
+		"Get":     func() { v.Get(4) },
+		"Rank1":   func() { v.Rank1(5) },
+		"Select1": func() { v.Select1(3) },
+		"Select0": func() { v.Select0(1) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: did not panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func TestVector_size(t *testing.T) {
+	n := 1 << 20
+	v := New(randomWords(rand.New(rand.NewSource(1)), n, 0.5), n)
+	if bits := float64(8*v.Size()) / float64(n); bits > 0.32 {
+		t.Errorf("Size: got %.3f bits per bit; want at most 0.32", bits)
+	}
+}
+
+func BenchmarkRank1(b *testing.B) {
+	n := 1 << 24
+	v := New(randomWords(rand.New(rand.NewSource(1)), n, 0.5), n)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		v.Rank1(i * 0x9e3779b1 & (n - 1))
+	}
+}
+
+func BenchmarkSelect1(b *testing.B) {
+	n := 1 << 24
+	v := New(randomWords(rand.New(rand.NewSource(1)), n, 0.5), n)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		v.Select1(i * 0x9e3779b1 % v.Ones())
+	}
+}
@@ -0,0 +1,118 @@
+package mph
+
+import (
+	"context"
+	"math"
+)
+
+// A Builder accumulates keys one at a time and builds a Table from them, so
+// that keys produced by a parser or a database cursor need not be collected
+// into a slice first. The keys are copied into one growing buffer as they
+// are added. The zero value is ready to use.
+//
+// A Builder can be reused: after a build it keeps the temporary memory of
+// the build for the next one, as well as the key buffer, since the table
+// holds a copy of the keys. After a failed build the key buffer starts at
+// the size the last build needed instead of growing it. A service that
+// rebuilds a table periodically can keep one Builder to spare the garbage
+// collector; dropping the Builder releases the memory.
+type Builder struct {
+	opts    []Option
+	pool    keyPool
+	scratch buildScratch
+
+	// The size of the key buffer at the last build.
+	lastKeys, lastBytes int
+}
+
+// NewBuilder returns a Builder whose Build method builds with opts.
+func NewBuilder(opts ...Option) *Builder {
+	return &Builder{opts: opts}
+}
+
+// Add adds key to the table being built. Its index will be the number of
+// keys added before it.
+func (b *Builder) Add(key string) {
+	add(b, key)
+}
+
+// AddBytes is like Add but takes the key as a byte slice, which is copied.
+func (b *Builder) AddBytes(key []byte) {
+	add(b, key)
+}
+
+func add[T ~string | ~[]byte](b *Builder, key T) {
+	if b.pool.offsets == nil {
+		b.pool.offsets = make([]uint32, 1, b.lastKeys+1)
+		b.pool.data = make([]byte, 0, b.lastBytes)
+	}
+	b.pool.data = append(b.pool.data, key...)
+	// Offsets past 4 GiB wrap around; Build reports the overflow.
+	b.pool.offsets = append(b.pool.offsets, uint32(len(b.pool.data)))
+}
+
+// Len returns the number of keys added so far.
+func (b *Builder) Len() int {
+	return b.pool.len()
+}
+
+// Build builds a Table from the keys added so far and resets b. It returns
+// the same errors as BuildWithOptions.
+func (b *Builder) Build() (*Table, error) {
+	return b.BuildContext(context.Background())
+}
+
+// BuildContext is like Build but may be canceled through ctx, as for the
+// BuildContext function.
+func (b *Builder) BuildContext(ctx context.Context) (*Table, error) {
+	pool := b.pool
+	b.pool = keyPool{}
+	b.lastKeys, b.lastBytes = pool.len(), len(pool.data)
+	if uint64(len(pool.data)) > math.MaxUint32 {
+		return nil, errPoolTooLarge
+	}
+	if uint64(pool.len()) >= math.MaxUint32 {
+		return nil, errTooManyKeys
+	}
+	cfg := newBuildConfig(b.opts)
+	cfg.scratch = &b.scratch
+	t, err := cfg.finish(buildPool(ctx, pool, cfg))
+	if err == nil && pool.offsets != nil {
+		// The keys of t are in its own arena, so the buffer is free.
+		b.pool = keyPool{data: pool.data[:0], offsets: pool.offsets[:1]}
+	}
+	return t, err
+}
+
+// A buildScratch holds the temporary slices of a build, which a Builder
+// keeps for its next build. Nothing in it is referenced by a built table.
+type buildScratch struct {
+	slots   []uint32 // level0 slot of each key
+	hashes  []uint64 // key hashes, for Wyhash
+	index   bucketIndex
+	buckets []indexBucket
+	occ     bitset
+}
+
+// scratchSpace returns the scratch space of the build, allocating it if the
+// build has none.
+func (c *buildConfig) scratchSpace() *buildScratch {
+	if c.scratch == nil {
+		c.scratch = new(buildScratch)
+	}
+	return c.scratch
+}
+
+// reuse returns a zeroed slice of length n, in the memory of s if it is
+// large enough.
+func reuse[E any](s []E, n int) []E {
+	if cap(s) < n {
+		return make([]E, n)
+	}
+	s = s[:n]
+	var zero E
+	for i := range s {
+		s[i] = zero
+	}
+	return s
+}
@@ -0,0 +1,112 @@
+package mph
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	var keys, extra []string
+	var b Builder
+	for i := 0; i < 2000; i++ {
+		s := strconv.Itoa(i)
+		if i >= 1000 {
+			extra = append(extra, s)
+			continue
+		}
+		keys = append(keys, s)
+		if i%2 == 0 {
+			b.Add(s)
+		} else {
+			b.AddBytes([]byte(s))
+		}
+	}
+	if b.Len() != len(keys) {
+		t.Errorf("Len: got %d; want %d", b.Len(), len(keys))
+	}
+	table, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	checkTable(t, table, keys, extra)
+	if b.Len() != 0 {
+		t.Errorf("Len after Build: got %d; want 0", b.Len())
+	}
+}
+
+func TestBuilder_options(t *testing.T) {
+	b := NewBuilder()
+	b.Add("foo")
+	b.Add("bar")
+	b.Add("foo")
+	if _, err := b.Build(); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("Build: got err=%v; want %v", err, ErrDuplicateKey)
+	}
+
+	var removed int
+	b = NewBuilder(WithDedup(&removed))
+	b.Add("foo")
+	b.Add("bar")
+	b.Add("foo")
+	table, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("removed: got %d; want 1", removed)
+	}
+	checkTable(t, table, []string{"foo", "bar"}, []string{"baz"})
+}
+
+func TestBuilder_reuse(t *testing.T) {
+	for _, h := range []Hash{Murmur3, Wyhash} {
+		b := NewBuilder(WithHash(h), WithDedup(nil))
+		for _, n := range []int{1000, 10000, 10, 5000} {
+			keys := make([]string, n)
+			for i := range keys {
+				keys[i] = strconv.Itoa(n) + "-" + strconv.Itoa(i)
+				b.Add(keys[i])
+			}
+			table, err := b.Build()
+			if err != nil {
+				t.Fatalf("%s: Build(%d keys): %v", h, n, err)
+			}
+			want, err := BuildWithOptions(keys, WithHash(h))
+			if err != nil {
+				t.Fatalf("BuildWithOptions: %v", err)
+			}
+			if !Equal(table, want) {
+				t.Errorf("%s: Build(%d keys) after reuse differs from BuildWithOptions", h, n)
+			}
+			checkTable(t, table, keys, []string{"quux"})
+		}
+	}
+}
+
+func BenchmarkBuilder_reuse(b *testing.B) {
+	keys := make([]string, 100000)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+	}
+	b.Run("new", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			bld := NewBuilder()
+			for _, k := range keys {
+				bld.Add(k)
+			}
+			bld.Build()
+		}
+	})
+	b.Run("reused", func(b *testing.B) {
+		b.ReportAllocs()
+		bld := NewBuilder()
+		for i := 0; i < b.N; i++ {
+			for _, k := range keys {
+				bld.Add(k)
+			}
+			bld.Build()
+		}
+	})
+}
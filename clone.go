@@ -0,0 +1,19 @@
+package mph
+
+// Clone returns a deep copy of t that shares no memory with it. Cloning a
+// table loaded with LoadBytes or OpenFile gives a table that stays valid
+// after the underlying data is modified or unmapped.
+func (t *Table) Clone() *Table {
+	c := t.CloneShared()
+	c.compact(false)
+	c.prefilter = t.prefilter.clone()
+	return c
+}
+
+// CloneShared returns a copy of t that shares its level arrays and keys
+// with t. Since a Table is never modified, this is safe as long as the
+// memory t was loaded from stays valid, and costs only the Table header.
+func (t *Table) CloneShared() *Table {
+	c := *t
+	return &c
+}
@@ -0,0 +1,34 @@
+package mph
+
+import (
+	"testing"
+)
+
+func TestClone(t *testing.T) {
+	keys := []string{"foo", "foo2", "bar", "baz"}
+	data, err := Build(keys).MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	table, err := LoadBytes(data)
+	if err != nil {
+		t.Fatalf("LoadBytes: %v", err)
+	}
+	deep, shared := table.Clone(), table.CloneShared()
+	checkTable(t, deep, keys, []string{"quux"})
+	checkTable(t, shared, keys, []string{"quux"})
+	if &shared.keys.data[0] != &table.keys.data[0] {
+		t.Errorf("CloneShared: keys do not alias the original")
+	}
+
+	// Clobbering the loaded data must not affect the deep copy.
+	for i := range data {
+		data[i] = 0
+	}
+	checkTable(t, deep, keys, []string{"quux"})
+
+	h := Build(keys).WithoutKeys().Clone()
+	if h.Len() != len(keys) {
+		t.Errorf("Clone(hash-only).Len: got %d; want %d", h.Len(), len(keys))
+	}
+}
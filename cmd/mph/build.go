@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ikawaha/mph"
+)
+
+// build runs "mph build".
+func build(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("build", "[flags] [keys.txt]", stderr)
+	var (
+		out       = fs.String("o", "", "write the table to `file` rather than to the standard output")
+		algorithm = fs.String("algorithm", "chd", "build with `name`: chd, bbhash, recsplit, pthash or bdz")
+		hash      = fs.String("hash", "murmur3", "hash keys with `name`: murmur3 or wyhash")
+		seed      = fs.Uint64("seed", 0, "perturb the hash with `seed`")
+		dedup     = fs.Bool("dedup", false, "drop repeated keys rather than fail")
+		trim      = fs.Bool("trim", false, "trim spaces around each key")
+		comment   = fs.String("comment", "", "skip lines that start with `prefix`")
+		verify    = fs.Bool("verify", false, "look up every key in the table before writing it")
+		parallel  = fs.Int("parallel", 1, "build with `n` goroutines, or GOMAXPROCS if 0")
+	)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return errUsage
+	}
+	opts := []mph.Option{mph.WithSeed(*seed), mph.WithParallelism(*parallel)}
+	a, err := parseAlgorithm(*algorithm)
+	if err != nil {
+		return err
+	}
+	opts = append(opts, mph.WithAlgorithm(a))
+	h, err := parseHash(*hash)
+	if err != nil {
+		return err
+	}
+	opts = append(opts, mph.WithHash(h))
+	if *dedup {
+		opts = append(opts, mph.WithDedup(nil))
+	}
+	if *trim {
+		opts = append(opts, mph.WithTrimSpace())
+	}
+	if *comment != "" {
+		opts = append(opts, mph.WithComments(*comment))
+	}
+	if *verify {
+		opts = append(opts, mph.WithVerify())
+	}
+
+	in := stdin
+	if name := fs.Arg(0); name != "" && name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	t, err := mph.BuildFromReader(in, opts...)
+	if err != nil {
+		return err
+	}
+	if *out != "" {
+		return t.WriteFile(*out)
+	}
+	w := bufio.NewWriter(stdout)
+	if _, err := t.WriteTo(w); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// parseAlgorithm returns the algorithm of the given name.
+func parseAlgorithm(name string) (mph.Algorithm, error) {
+	for _, a := range []mph.Algorithm{mph.CHD, mph.BBHash, mph.RecSplit, mph.PTHash, mph.BDZ} {
+		if strings.EqualFold(name, a.String()) {
+			return a, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown algorithm %q", name)
+}
+
+// parseHash returns the hash of the given name.
+func parseHash(name string) (mph.Hash, error) {
+	for _, h := range []mph.Hash{mph.Murmur3, mph.Wyhash} {
+		if strings.EqualFold(name, h.String()) {
+			return h, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown hash %q", name)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ikawaha/mph"
+)
+
+func TestBuild(t *testing.T) {
+	dir := t.TempDir()
+	keys := filepath.Join(dir, "keys.txt")
+	if err := os.WriteFile(keys, []byte("foo\nbar\n# comment\n baz \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dict := filepath.Join(dir, "dict.mph")
+	var stdout, stderr bytes.Buffer
+	args := []string{"build", "-o", dict, "-comment", "#", "-trim", "-hash", "wyhash", "-algorithm", "PTHash", "-seed", "7", "-verify", keys}
+	if code := run(args, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("run(%v): got status %d, %s; want 0", args, code, stderr.String())
+	}
+	table, err := mph.ReadFile(dict)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	for i, k := range []string{"foo", "bar", "baz"} {
+		if n, ok := table.Lookup(k); !ok || n != uint32(i) {
+			t.Errorf("Lookup(%s): got %d, %t; want %d, true", k, n, ok, i)
+		}
+	}
+	want, err := mph.BuildWithOptions([]string{"foo", "bar", "baz"}, mph.WithHash(mph.Wyhash), mph.WithAlgorithm(mph.PTHash), mph.WithSeed(7))
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	if !mph.Equal(table, want) {
+		t.Errorf("build: got a table other than BuildWithOptions builds")
+	}
+}
+
+func TestBuild_stdin(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"build", "-dedup"}, strings.NewReader("a\nb\na\n"), &stdout, &stderr); code != 0 {
+		t.Fatalf("run: got status %d, %s; want 0", code, stderr.String())
+	}
+	table, err := mph.LoadBytes(stdout.Bytes())
+	if err != nil {
+		t.Fatalf("LoadBytes: %v", err)
+	}
+	if table.Len() != 2 {
+		t.Errorf("build -dedup: got %d keys; want 2", table.Len())
+	}
+}
+
+func TestBuild_errors(t *testing.T) {
+	for _, tt := range []struct {
+		args  []string
+		stdin string
+		code  int
+	}{
+		{nil, "", 2},
+		{[]string{"frobnicate"}, "", 2},
+		{[]string{"build", "-nosuchflag"}, "", 2},
+		{[]string{"build", "a.txt", "b.txt"}, "", 2},
+		{[]string{"build", "-h"}, "", 0},
+		{[]string{"build", "-algorithm", "nosuch"}, "a\n", 1},
+		{[]string{"build", "-hash", "nosuch"}, "a\n", 1},
+		{[]string{"build"}, "a\na\n", 1},
+		{[]string{"build", filepath.Join(t.TempDir(), "missing.txt")}, "", 1},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := run(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr); code != tt.code {
+			t.Errorf("run(%q): got status %d; want %d", tt.args, code, tt.code)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"io"
+
+	"github.com/ikawaha/mph"
+)
+
+// dump runs "mph dump".
+func dump(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("dump", "[-csv] table.mph", stderr)
+	asCSV := fs.Bool("csv", false, "write CSV records rather than TSV lines")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	t, err := mph.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *asCSV {
+		return t.WriteCSV(stdout)
+	}
+	return t.WriteTSV(stdout)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ikawaha/mph"
+)
+
+func TestDump(t *testing.T) {
+	dir := t.TempDir()
+	dict := filepath.Join(dir, "dict.mph")
+	if err := mph.Build([]string{"foo", "bar", "a,b"}).WriteFile(dict); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	for _, tt := range []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"tsv", []string{"dump", dict}, "0\tfoo\n1\tbar\n2\ta,b\n"},
+		{"csv", []string{"dump", "-csv", dict}, "0,foo\n1,bar\n2,\"a,b\"\n"},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := run(tt.args, strings.NewReader(""), &stdout, &stderr); code != 0 {
+			t.Fatalf("run(%s): got status %d, %s; want 0", tt.name, code, stderr.String())
+		}
+		if got := stdout.String(); got != tt.want {
+			t.Errorf("run(%s): got %q; want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDump_errors(t *testing.T) {
+	dir := t.TempDir()
+	mphf := filepath.Join(dir, "mphf.mph")
+	if err := mph.Build([]string{"foo"}).WithoutKeys().WriteFile(mphf); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	for _, tt := range []struct {
+		args []string
+		code int
+	}{
+		{[]string{"dump"}, 2},
+		{[]string{"dump", mphf, mphf}, 2},
+		{[]string{"dump", filepath.Join(dir, "missing.mph")}, 1},
+		{[]string{"dump", mphf}, 1},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := run(tt.args, strings.NewReader(""), &stdout, &stderr); code != tt.code {
+			t.Errorf("run(%q): got status %d; want %d", tt.args, code, tt.code)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+
+	"github.com/ikawaha/mph"
+)
+
+// lookup runs "mph lookup".
+func lookup(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("lookup", "table.mph [key ...]", stderr)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+	t, err := mph.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(stdout)
+	if keys := fs.Args()[1:]; len(keys) > 0 {
+		for _, k := range keys {
+			writeResult(w, t, []byte(k))
+		}
+		return w.Flush()
+	}
+	br := bufio.NewReader(stdin)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			line = bytes.TrimSuffix(line, []byte("\n"))
+			writeResult(w, t, bytes.TrimSuffix(line, []byte("\r")))
+		}
+		if err == io.EOF {
+			return w.Flush()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// writeResult writes the index of key in t, or MISS, on a line of w. Write
+// errors show when w is flushed.
+func writeResult(w *bufio.Writer, t *mph.Table, key []byte) {
+	if n, ok := t.LookupBytes(key); ok {
+		w.WriteString(strconv.FormatUint(uint64(n), 10))
+	} else {
+		w.WriteString("MISS")
+	}
+	w.WriteByte('\n')
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ikawaha/mph"
+)
+
+func TestLookup(t *testing.T) {
+	dict := filepath.Join(t.TempDir(), "dict.mph")
+	if err := mph.Build([]string{"foo", "bar", "baz"}).WriteFile(dict); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	for _, tt := range []struct {
+		name  string
+		args  []string
+		stdin string
+		want  string
+	}{
+		{"args", []string{"lookup", dict, "baz", "qux", "foo"}, "", "2\nMISS\n0\n"},
+		{"stdin", []string{"lookup", dict}, "bar\r\n\nfoo", "1\nMISS\n0\n"},
+		{"empty stdin", []string{"lookup", dict}, "", ""},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := run(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr); code != 0 {
+			t.Fatalf("run(%s): got status %d, %s; want 0", tt.name, code, stderr.String())
+		}
+		if got := stdout.String(); got != tt.want {
+			t.Errorf("run(%s): got %q; want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLookup_errors(t *testing.T) {
+	for _, tt := range []struct {
+		args []string
+		code int
+	}{
+		{[]string{"lookup"}, 2},
+		{[]string{"lookup", filepath.Join(t.TempDir(), "missing.mph"), "foo"}, 1},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := run(tt.args, strings.NewReader(""), &stdout, &stderr); code != tt.code {
+			t.Errorf("run(%q): got status %d; want %d", tt.args, code, tt.code)
+		}
+	}
+}
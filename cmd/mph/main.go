@@ -0,0 +1,105 @@
+// Command mph builds and queries serialized mph tables from the command
+// line, for use from Makefiles, shell scripts and data pipelines.
+//
+// Usage:
+//
+//	mph build [flags] [keys.txt]
+//	mph lookup table.mph [key ...]
+//	mph dump [-csv] table.mph
+//
+// Build reads one key per line from the named file, or from the standard
+// input if there is none or it is "-", as mph.BuildFromReader does, and
+// writes the serialized table to the file named by -o, or to the standard
+// output if -o is not set. Run "mph build -h" for its flags.
+//
+// Lookup reads the table in the named file and prints, for each key on
+// the command line, or for each line of the standard input if there are
+// none, a line with the index of the key in the table, or MISS if it is
+// not one of its keys. A table without keys (see mph.Table.WithoutKeys)
+// cannot tell, and prints an index for every key.
+//
+// Dump reads the table in the named file and prints a line with the index
+// and the key, separated by a tab, for each of its keys in index order, as
+// mph.Table.WriteTSV does, or a CSV record with -csv, as WriteCSV does.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// A command is a subcommand of mph. It returns flag.ErrHelp if the usage
+// was printed on request.
+type command func(args []string, stdin io.Reader, stdout, stderr io.Writer) error
+
+var commands = map[string]command{
+	"build":  build,
+	"dump":   dump,
+	"lookup": lookup,
+}
+
+const usage = `usage: mph <command> [arguments]
+
+The commands are:
+
+	build   build a table from a file of keys
+	dump    list the keys of a table with their indices
+	lookup  look up keys in a table
+`
+
+// run runs the command line args and returns the exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "mph: unknown command %q\n%s", args[0], usage)
+		return 2
+	}
+	err := cmd(args[1:], stdin, stdout, stderr)
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	}
+	fmt.Fprintf(stderr, "mph %s: %v\n", args[0], err)
+	return 1
+}
+
+// errUsage is returned by a command whose arguments are wrong, once it has
+// printed why.
+var errUsage = errors.New("usage")
+
+// newFlagSet returns the flag set of the named command, whose usage line
+// is given, which prints its errors to stderr.
+func newFlagSet(name, usage string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: mph %s %s\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses args with fs, and returns flag.ErrHelp or errUsage if they
+// are not valid.
+func parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+// Package alecthomas decodes tables serialized by github.com/alecthomas/mph
+// so that they can be served by github.com/ikawaha/mph.
+//
+// The alecthomas/mph format stores its own hash function parameters, which
+// are not compatible with the hash used by this module. Read therefore
+// rebuilds an mph.Table from the stored keys. Keys keep the position they
+// had in the serialized table, so the index returned by mph.Lookup selects
+// the matching entry of the returned values.
+package alecthomas
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/ikawaha/mph"
+)
+
+// The serialized form written by (*mph.CHD).Write in alecthomas/mph is a
+// sequence of little-endian values:
+//
+//	len(r) uint32, r []uint64
+//	len(indices) uint32, indices []uint16
+//	len(keys) uint32
+//	len(key) uint32, len(value) uint32, key, value   (repeated len(keys) times)
+
+var errInvalidData = errors.New("alecthomas: invalid serialized table")
+
+// Read decodes a table in the alecthomas/mph serialized form from r and
+// returns an mph.Table over its keys along with the value stored for each
+// key, indexed like the table.
+func Read(r io.Reader) (*mph.Table, [][]byte, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return Decode(b)
+}
+
+// Decode is like Read but decodes the serialized table in b. The returned
+// keys and values are copied, so b may be reused after Decode returns.
+func Decode(b []byte) (*mph.Table, [][]byte, error) {
+	d := decoder{b: b}
+	// The hash function parameters have no use outside alecthomas/mph.
+	d.skip(8 * d.uint32())
+	d.skip(2 * d.uint32())
+	n := d.uint32()
+	if d.err != nil {
+		return nil, nil, d.err
+	}
+	// Each entry occupies at least 8 bytes, which bounds a corrupt count.
+	if uint64(n) > uint64(len(d.b))/8 {
+		return nil, nil, errInvalidData
+	}
+	keys := make([][]byte, n)
+	values := make([][]byte, n)
+	for i := range keys {
+		kl, vl := d.uint32(), d.uint32()
+		keys[i] = d.bytes(kl)
+		values[i] = d.bytes(vl)
+		if d.err != nil {
+			return nil, nil, d.err
+		}
+	}
+	if len(d.b) != 0 {
+		return nil, nil, errInvalidData
+	}
+	table, err := mph.BuildChecked(keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	return table, values, nil
+}
+
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) uint32() int {
+	if d.err != nil || len(d.b) < 4 {
+		d.err = errInvalidData
+		return 0
+	}
+	v := binary.LittleEndian.Uint32(d.b)
+	d.b = d.b[4:]
+	return int(v)
+}
+
+func (d *decoder) skip(n int) {
+	if d.err != nil || n > len(d.b) {
+		d.err = errInvalidData
+		return
+	}
+	d.b = d.b[n:]
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil || n > len(d.b) {
+		d.err = errInvalidData
+		return nil
+	}
+	v := append([]byte(nil), d.b[:n]...)
+	d.b = d.b[n:]
+	return v
+}
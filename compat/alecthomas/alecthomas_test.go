@@ -0,0 +1,66 @@
+package alecthomas
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/ikawaha/mph"
+)
+
+// write serializes keys and values the way (*mph.CHD).Write in
+// alecthomas/mph does.
+func write(keys, values []string) []byte {
+	var buf bytes.Buffer
+	w := func(v interface{}) { binary.Write(&buf, binary.LittleEndian, v) }
+	r := []uint64{0x123456789abcdef, 42}
+	indices := []uint16{1, 0, 1}
+	w(uint32(len(r)))
+	w(r)
+	w(uint32(len(indices)))
+	w(indices)
+	w(uint32(len(keys)))
+	for i := range keys {
+		w(uint32(len(keys[i])))
+		w(uint32(len(values[i])))
+		buf.WriteString(keys[i])
+		buf.WriteString(values[i])
+	}
+	return buf.Bytes()
+}
+
+func TestRead(t *testing.T) {
+	keys := []string{"foo", "bar", "baz", "quux"}
+	values := []string{"1", "", "three", "4"}
+	table, vals, err := Read(bytes.NewReader(write(keys, values)))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	for i, key := range keys {
+		n, ok := mph.Lookup(table, key)
+		if !ok || int(n) != i {
+			t.Errorf("Lookup(%s): got %d, %t; want %d, true", key, n, ok, i)
+			continue
+		}
+		if string(vals[n]) != values[i] {
+			t.Errorf("value of %s: got %q; want %q", key, vals[n], values[i])
+		}
+	}
+	if _, ok := mph.Lookup(table, "missing"); ok {
+		t.Errorf("Lookup(missing): got ok; want !ok")
+	}
+}
+
+func TestDecode_invalid(t *testing.T) {
+	data := write([]string{"foo", "bar"}, []string{"1", "2"})
+	for _, b := range [][]byte{
+		nil,
+		data[:len(data)-1],
+		append(data[:len(data):len(data)], 0),
+		write([]string{"foo", "foo"}, []string{"1", "2"}),
+	} {
+		if _, _, err := Decode(b); err == nil {
+			t.Errorf("Decode(%d bytes): got nil error", len(b))
+		}
+	}
+}
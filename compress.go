@@ -0,0 +1,67 @@
+package mph
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// WriteToCompressed is like WriteTo but writes the serialized table as a
+// gzip stream. Key pools tend to compress well, so this can shrink tables
+// shipped as files considerably. It returns the number of compressed bytes
+// written to w.
+func (t *Table) WriteToCompressed(w io.Writer) (int64, error) {
+	cw := countingWriter{w: w}
+	zw := gzip.NewWriter(&cw)
+	if _, err := t.WriteTo(zw); err != nil {
+		return cw.n, err
+	}
+	err := zw.Close()
+	return cw.n, err
+}
+
+// ReadFromCompressed reads a table written by WriteToCompressed from r and
+// replaces the contents of t. It returns the number of bytes read from r,
+// which may include data buffered beyond the end of the gzip stream.
+func (t *Table) ReadFromCompressed(r io.Reader) (int64, error) {
+	cr := countingReader{r: r}
+	zr, err := gzip.NewReader(&cr)
+	if err != nil {
+		return cr.n, err
+	}
+	zr.Multistream(false)
+	var table Table
+	if _, err := table.ReadFrom(zr); err != nil {
+		return cr.n, err
+	}
+	// Read to the end of the stream so that the gzip checksum is verified.
+	var b [1]byte
+	if n, err := zr.Read(b[:]); n > 0 {
+		return cr.n, ErrCorrupt
+	} else if err != io.EOF {
+		return cr.n, err
+	}
+	*t = table
+	return cr.n, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
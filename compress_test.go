@@ -0,0 +1,57 @@
+package mph
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strconv"
+	"testing"
+)
+
+func TestWriteToCompressed(t *testing.T) {
+	var keys, extra []string
+	for i := 0; i < 2000; i++ {
+		s := "key-" + strconv.Itoa(i)
+		if i < 1000 {
+			keys = append(keys, s)
+		} else {
+			extra = append(extra, s)
+		}
+	}
+	table := Build(keys)
+	var buf bytes.Buffer
+	n, err := table.WriteToCompressed(&buf)
+	if err != nil {
+		t.Fatalf("WriteToCompressed: %v", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteToCompressed: got n=%d; wrote %d bytes", n, buf.Len())
+	}
+	data, err := table.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	if buf.Len() >= len(data) {
+		t.Errorf("compressed size %d is not smaller than %d", buf.Len(), len(data))
+	}
+	var got Table
+	if _, err := got.ReadFromCompressed(&buf); err != nil {
+		t.Fatalf("ReadFromCompressed: %v", err)
+	}
+	checkTable(t, &got, keys, extra)
+}
+
+func TestReadFromCompressed_trailingData(t *testing.T) {
+	data, err := Build([]string{"foo", "bar", "baz"}).MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	zw.Write([]byte("junk"))
+	zw.Close()
+	var table Table
+	if _, err := table.ReadFromCompressed(&buf); err != ErrCorrupt {
+		t.Errorf("ReadFromCompressed: got err=%v; want %v", err, ErrCorrupt)
+	}
+}
@@ -0,0 +1,389 @@
+package mph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+// A DecodeOption configures how Unmarshal and ReadFile decode a table.
+type DecodeOption func(*decodeConfig)
+
+type decodeConfig struct {
+	parallelism int
+	alloc       func(size int) []byte
+}
+
+// WithDecodeParallelism makes Unmarshal and ReadFile decode a table with up
+// to n goroutines. If n is 0 or less, they use GOMAXPROCS goroutines. The
+// serialized table is split into one chunk per goroutine, and the chunks
+// are read, checksummed and validated concurrently, which shortens the
+// cold start of tables of gigabytes. The table decoded is the same as
+// without the option.
+func WithDecodeParallelism(n int) DecodeOption {
+	return func(c *decodeConfig) {
+		if n <= 0 {
+			n = runtime.GOMAXPROCS(0)
+		}
+		c.parallelism = n
+	}
+}
+
+// WithDecodeAllocator makes Unmarshal and ReadFile take the memory of the
+// table from alloc, as WithAllocator does for BuildWithOptions.
+func WithDecodeAllocator(alloc func(size int) []byte) DecodeOption {
+	return func(c *decodeConfig) {
+		c.alloc = alloc
+	}
+}
+
+func newDecodeConfig(opts []DecodeOption) decodeConfig {
+	var cfg decodeConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.parallelism < 1 {
+		cfg.parallelism = 1
+	}
+	return cfg
+}
+
+// Unmarshal is like UnmarshalBinary but returns a new table and lets opts
+// configure how it is decoded.
+func Unmarshal(data []byte, opts ...DecodeOption) (*Table, error) {
+	cfg := newDecodeConfig(opts)
+	if cfg.parallelism == 1 {
+		var t Table
+		if err := t.unmarshal(data, cfg.alloc); err != nil {
+			return nil, err
+		}
+		return &t, nil
+	}
+	return decodeAt(bytes.NewReader(data), int64(len(data)), cfg)
+}
+
+// A segment is a section of a serialized table and where it is decoded to.
+type segment struct {
+	pos   int64  // position of the section in the serialized table
+	dst   []byte // arena memory that holds the section once decoded
+	width int    // size of the values in the section
+}
+
+// decodeAt decodes the serialized table of size bytes in r with
+// cfg.parallelism goroutines. Its sections are laid out in one arena as
+// ReadFrom lays them out, but read concurrently, so the values are read in
+// place and then converted to the host byte order.
+func decodeAt(r io.ReaderAt, size int64, cfg decodeConfig) (*Table, error) {
+	workers := cfg.parallelism
+	var hb [headerSize]byte
+	if _, err := r.ReadAt(hb[:], 0); err != nil {
+		return nil, readAtError(err)
+	}
+	h, err := parseHeader(hb[:])
+	if err != nil {
+		return nil, err
+	}
+	if uint64(size) != h.size() {
+		return nil, ErrCorrupt
+	}
+	crc := crc32.Checksum(hb[:], crcTable)
+	if h.seeded() {
+		var sb [seedSize]byte
+		if _, err := r.ReadAt(sb[:], headerSize); err != nil {
+			return nil, readAtError(err)
+		}
+		if err := h.parseSeed(sb[:]); err != nil {
+			return nil, err
+		}
+		crc = crc32.Update(crc, crcTable, sb[:])
+	}
+
+	mem, err := allocArena(h.memSize(true), cfg.alloc)
+	if err != nil {
+		return nil, err
+	}
+	var segs []segment
+	start := int64(h.start())
+	pos := start
+	section := func(b []byte, width int) []byte {
+		segs = append(segs, segment{pos: pos, dst: b, width: width})
+		pos += int64(len(b))
+		return b
+	}
+	nkeys, n0 := int(h.nkeys), int(h.n0)
+	var level0 seedArray
+	mem.alignLine()
+	if h.seeds16() {
+		level0.narrow = viewUint16s(section(mem.bytes(narrowBytes(n0)), 2))[:n0]
+		level0.escapes = viewUint32s(section(mem.bytes(8*int(h.nesc)), 4))
+	} else if h.seedsCoded() {
+		level0.coded = viewUint32s(section(mem.bytes(4*int(h.nesc)), 4))
+	} else {
+		level0.wide = viewUint32s(section(mem.bytes(4*n0), 4))
+	}
+	mem.alignLine()
+	var level1 indexArray
+	if b := mem.bytes(4 * h.level1Words()); h.indices16() {
+		level1.narrow = viewUint16s(section(b, 2))[:h.n1]
+	} else {
+		level1 = h.indices(viewUint32s(section(b, 4)))
+	}
+	fp := fingerprintArray{bits: uint8(h.fingerprintBits())}
+	switch b := mem.bytes(fingerprintBytes(nkeys, int(fp.bits))); fp.bits {
+	case 8:
+		fp.b8 = section(b, 1)[:nkeys:nkeys]
+	case 16:
+		fp.b16 = viewUint16s(section(b, 2))[:nkeys]
+	}
+	var offsets []uint32
+	if !h.hashOnly() {
+		// The lengths are read into the offsets, to be summed in place.
+		b := mem.bytes(4 * (nkeys + 1))
+		section(b[4:], 4)
+		offsets = viewUint32s(b)
+		offsets[0] = 0
+	}
+	data := section(mem.bytes(int(h.keyBytes)), 1)
+
+	// Each goroutine reads and checksums one chunk of the body of the
+	// table, which starts after the header and the seed and ends before
+	// the checksum. Chunks start at multiples of 4, and so never split a
+	// value.
+	body := pos - start
+	chunk := (body/int64(workers) + 3) &^ 3
+	if chunk == 0 {
+		chunk = 4
+	}
+	crcs := make([]uint32, (body+chunk-1)/chunk)
+	err = forChunks(len(crcs), 1, func(c, _ int) error {
+		lo := start + int64(c)*chunk
+		hi := lo + chunk
+		if hi > pos {
+			hi = pos
+		}
+		var crc uint32
+		for _, s := range segs {
+			start, end := s.pos, s.pos+int64(len(s.dst))
+			if start < lo {
+				start = lo
+			}
+			if end > hi {
+				end = hi
+			}
+			if start >= end {
+				continue
+			}
+			b := s.dst[start-s.pos : end-s.pos]
+			if _, err := r.ReadAt(b, start); err != nil {
+				return readAtError(err)
+			}
+			crc = crc32.Update(crc, crcTable, b)
+			if !hostLittleEndian {
+				swapBytes(b, s.width)
+			}
+		}
+		crcs[c] = crc
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for c, v := range crcs {
+		n := chunk
+		if c == len(crcs)-1 {
+			n = body - int64(c)*chunk
+		}
+		crc = crc32Combine(crc, v, n)
+	}
+	var tb [4]byte
+	if _, err := r.ReadAt(tb[:], pos); err != nil {
+		return nil, readAtError(err)
+	}
+	if binary.LittleEndian.Uint32(tb[:]) != crc {
+		return nil, ErrCorrupt
+	}
+
+	if err := h.checkLevel0(&level0); err != nil {
+		return nil, err
+	}
+	if nkeys > 0 {
+		n1 := level1.len()
+		err := forChunks(n1, (n1+workers-1)/workers, func(lo, hi int) error {
+			for i := lo; i < hi; i++ {
+				if int(level1.get(i)) >= nkeys {
+					return ErrCorrupt
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if offsets != nil {
+		if err := sumOffsets(offsets, h.keyBytes, workers); err != nil {
+			return nil, err
+		}
+	}
+	t := h.newTable(level0, level1, fp, keyPool{data: data, offsets: offsets})
+	return &t, nil
+}
+
+// sumOffsets replaces the lengths in offsets[1:] by the offsets of the keys
+// they are the lengths of, which must end at size, with workers
+// goroutines: each sums its range of lengths, and once the sums of the
+// ranges before it are known, stores its offsets.
+func sumOffsets(offsets []uint32, size uint64, workers int) error {
+	lens := offsets[1:]
+	chunk := (len(lens) + workers - 1) / workers
+	if chunk == 0 {
+		chunk = 1
+	}
+	sums := make([]uint64, (len(lens)+chunk-1)/chunk+1)
+	forChunks(len(lens), chunk, func(lo, hi int) error {
+		var s uint64
+		for _, l := range lens[lo:hi] {
+			s += uint64(l)
+		}
+		sums[lo/chunk+1] = s
+		return nil
+	})
+	for i := 1; i < len(sums); i++ {
+		sums[i] += sums[i-1]
+	}
+	// As in ReadFrom, the offsets cannot wrap around once the total is
+	// known to fit in 32 bits.
+	if sums[len(sums)-1] != size {
+		return ErrCorrupt
+	}
+	forChunks(len(lens), chunk, func(lo, hi int) error {
+		s := sums[lo/chunk]
+		for i := lo; i < hi; i++ {
+			s += uint64(lens[i])
+			lens[i] = uint32(s)
+		}
+		return nil
+	})
+	return nil
+}
+
+// forChunks splits [0, n) into consecutive ranges of chunk elements, the
+// last of which may be shorter, and calls fn for each range in its own
+// goroutine. It returns the error of the first range that fails.
+func forChunks(n, chunk int, fn func(lo, hi int) error) error {
+	if n == 0 {
+		return nil
+	}
+	errs := make([]error, (n+chunk-1)/chunk)
+	var wg sync.WaitGroup
+	for lo := 0; lo < n; lo += chunk {
+		hi := lo + chunk
+		if hi > n {
+			hi = n
+		}
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer wg.Done()
+			errs[lo/chunk] = fn(lo, hi)
+		}(lo, hi)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readAtError returns the error to report for err from a ReadAt of a
+// section of a table: a table that ends early is corrupt.
+func readAtError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrCorrupt
+	}
+	return err
+}
+
+// viewUint32s returns b as a []uint32 in the host byte order. b must be
+// 4-byte aligned.
+func viewUint32s(b []byte) []uint32 {
+	if len(b) < 4 {
+		return []uint32{}
+	}
+	return unsafe.Slice((*uint32)(unsafe.Pointer(&b[0])), len(b)/4)
+}
+
+// viewUint16s is like viewUint32s for 16-bit values.
+func viewUint16s(b []byte) []uint16 {
+	if len(b) < 2 {
+		return []uint16{}
+	}
+	return unsafe.Slice((*uint16)(unsafe.Pointer(&b[0])), len(b)/2)
+}
+
+// swapBytes reverses the bytes of each value of the given width in b.
+func swapBytes(b []byte, width int) {
+	for i := 0; i+width <= len(b); i += width {
+		for j, k := i, i+width-1; j < k; j, k = j+1, k-1 {
+			b[j], b[k] = b[k], b[j]
+		}
+	}
+}
+
+// crc32Combine returns the checksum of a concatenation of two byte strings
+// given the checksum crc1 of the first, and the checksum crc2 and length n
+// of the second, as zlib's crc32_combine does. It appends n zero bytes to
+// the first string by repeatedly squaring the operator that appends one
+// zero bit.
+func crc32Combine(crc1, crc2 uint32, n int64) uint32 {
+	if n <= 0 {
+		return crc1
+	}
+	var even, odd [32]uint32
+	odd[0] = crc32.Castagnoli
+	row := uint32(1)
+	for i := 1; i < 32; i++ {
+		odd[i] = row
+		row <<= 1
+	}
+	gf2Square(&even, &odd) // two zero bits
+	gf2Square(&odd, &even) // four zero bits
+	for {
+		gf2Square(&even, &odd)
+		if n&1 != 0 {
+			crc1 = gf2Times(&even, crc1)
+		}
+		if n >>= 1; n == 0 {
+			break
+		}
+		gf2Square(&odd, &even)
+		if n&1 != 0 {
+			crc1 = gf2Times(&odd, crc1)
+		}
+		if n >>= 1; n == 0 {
+			break
+		}
+	}
+	return crc1 ^ crc2
+}
+
+func gf2Times(mat *[32]uint32, vec uint32) uint32 {
+	var sum uint32
+	for i := 0; vec != 0; i, vec = i+1, vec>>1 {
+		if vec&1 != 0 {
+			sum ^= mat[i]
+		}
+	}
+	return sum
+}
+
+func gf2Square(square, mat *[32]uint32) {
+	for i := range square {
+		square[i] = gf2Times(mat, mat[i])
+	}
+}
@@ -0,0 +1,120 @@
+package mph
+
+import (
+	"hash/crc32"
+	"math/rand"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestCrc32Combine(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	data := make([]byte, 5000)
+	r.Read(data)
+	for _, n := range []int{0, 1, 3, 4, 100, 4096, len(data)} {
+		a, b := data[:n], data[n:]
+		got := crc32Combine(crc32.Checksum(a, crcTable), crc32.Checksum(b, crcTable), int64(len(b)))
+		if want := crc32.Checksum(data, crcTable); got != want {
+			t.Errorf("crc32Combine(split at %d): got %#x; want %#x", n, got, want)
+		}
+	}
+}
+
+func TestUnmarshal_parallel(t *testing.T) {
+	var keys []string
+	for i := 0; i < 5000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	table := Build(keys)
+	fp8, _ := table.WithFingerprints(8)
+	fp16, _ := table.WithFingerprints(16)
+	packed, _ := BuildWithOptions(keys, WithPackedIndices())
+	exact, _ := BuildWithOptions(keys, WithExactSizes(), WithHash(Wyhash))
+	big := make([]string, 70000)
+	for i := range big {
+		big[i] = "key-" + strconv.Itoa(i)
+	}
+	for _, tt := range []struct {
+		name  string
+		table *Table
+	}{
+		{"plain", table},
+		{"empty", Build([]string{})},
+		{"hash-only", table.WithoutKeys()},
+		{"fingerprints8", fp8},
+		{"fingerprints16", fp16},
+		{"packed", packed},
+		{"exact", exact},
+		{"wide", Build(big)},
+	} {
+		data := mustMarshal(t, tt.table)
+		for _, n := range []int{1, 2, 3, 7, 64} {
+			got, err := Unmarshal(data, WithDecodeParallelism(n))
+			if err != nil {
+				t.Errorf("Unmarshal(%s, %d goroutines): %v", tt.name, n, err)
+				continue
+			}
+			if !Equal(got, tt.table) {
+				t.Errorf("Unmarshal(%s, %d goroutines): table differs", tt.name, n)
+			}
+		}
+	}
+	got, _ := Unmarshal(mustMarshal(t, table), WithDecodeParallelism(4))
+	checkTable(t, got, keys, []string{"quux"})
+	checkContiguous(t, "Unmarshal", got)
+}
+
+func TestUnmarshal_parallelCorrupt(t *testing.T) {
+	data := mustMarshal(t, Build([]string{"foo", "bar", "baz", "quux", "corge"}))
+	for i := 0; i < len(data); i++ {
+		if _, err := Unmarshal(data[:i], WithDecodeParallelism(3)); err == nil {
+			t.Errorf("Unmarshal(%d of %d bytes): got nil error", i, len(data))
+		}
+		b := append([]byte(nil), data...)
+		b[i] ^= 1
+		if _, err := Unmarshal(b, WithDecodeParallelism(3)); err == nil {
+			t.Errorf("Unmarshal(bit flipped in byte %d): got nil error", i)
+		}
+	}
+	if _, err := Unmarshal(append(data, 0), WithDecodeParallelism(3)); err != ErrCorrupt {
+		t.Errorf("Unmarshal(trailing byte): got err=%v; want %v", err, ErrCorrupt)
+	}
+}
+
+func TestReadFile_parallel(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	name := filepath.Join(t.TempDir(), "table.mph")
+	if err := Build(keys).WriteFile(name); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	table, err := ReadFile(name, WithDecodeParallelism(0))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	checkTable(t, table, keys, []string{"quux"})
+}
+
+func BenchmarkUnmarshal_parallel(b *testing.B) {
+	keys := make([]string, 1<<20)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i) + "-" + strconv.Itoa(i*7919)
+	}
+	data, err := Build(keys).MarshalBinary()
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, n := range []int{1, 4, 0} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if _, err := Unmarshal(data, WithDecodeParallelism(n)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package mph
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+// A patch produced by Diff consists of a header
+//
+//	magic         [4]byte  "MPHP"
+//	version       uint32   patchVersion
+//	old nkeys     uint32
+//	old checksum  uint32   keysChecksum of the old table
+//	new nkeys     uint32
+//	new checksum  uint32   keysChecksum of the new table
+//	flags         uint32   how the new table was built; see patchFlags
+//	seed          uint64   the seed of the new table; see WithSeed
+//	level0 slots  uint32   the level array sizes of a new CHD table
+//	level1 slots  uint32
+//	leaf size     uint32   the sizes of a new RecSplit table
+//	split bucket  uint32
+//
+// followed by a sequence of operations that produce the keys of the new
+// table in index order from those of the old one, and a CRC-32C of
+// everything before it. Each operation starts with a uvarint x:
+//
+//	x&1 == 0: copy x>>1 keys from the old table, starting at the index
+//	          given by a following uvarint
+//	x&1 == 1: append the x>>1 key bytes that follow as a new key
+//
+// All fixed-size integers are little-endian.
+
+const (
+	patchMagic      = "MPHP"
+	patchVersion    = 2
+	patchHeaderSize = 52
+)
+
+// The flags of a patch hold the hash function, algorithm and k of the new
+// table in their low three bytes, and the following bits.
+const (
+	patchPacked    = 1 << (24 + iota) // WithPackedIndices
+	patchCoded                        // WithCompressedSeeds
+	patchFront                        // WithFrontCoding
+	patchExact                        // WithExactSizes
+	patchHashOrder                    // WithHashOrder
+)
+
+// patchFlags returns the flags of a patch that rebuilds a table with cfg.
+func patchFlags(cfg *buildConfig) uint32 {
+	f := uint32(cfg.hash) | uint32(cfg.algorithm)<<8 | uint32(cfg.k)<<16
+	if cfg.packLevel1 {
+		f |= patchPacked
+	}
+	if cfg.codeSeeds {
+		f |= patchCoded
+	}
+	if cfg.frontCoding {
+		f |= patchFront
+	}
+	if cfg.exactSizes {
+		f |= patchExact
+	}
+	if cfg.hashOrder {
+		f |= patchHashOrder
+	}
+	return f
+}
+
+// patchConfig returns the configuration that the header b of a patch
+// gives for rebuilding the new table.
+func patchConfig(b []byte) *buildConfig {
+	f := binary.LittleEndian.Uint32(b[24:])
+	return &buildConfig{
+		hash:        Hash(f),
+		algorithm:   Algorithm(f >> 8),
+		k:           int(f >> 16 & 0xff),
+		packLevel1:  f&patchPacked != 0,
+		codeSeeds:   f&patchCoded != 0,
+		frontCoding: f&patchFront != 0,
+		exactSizes:  f&patchExact != 0,
+		hashOrder:   f&patchHashOrder != 0,
+		seed:        binary.LittleEndian.Uint64(b[28:]),
+		sizes:       [2]int{int(binary.LittleEndian.Uint32(b[36:])), int(binary.LittleEndian.Uint32(b[40:]))},
+		leafSize:    int(binary.LittleEndian.Uint32(b[44:])),
+		splitBucket: int(binary.LittleEndian.Uint32(b[48:])),
+	}
+}
+
+// ErrPatchMismatch is returned by Apply when the patch was not made
+// against the given table.
+var ErrPatchMismatch = errors.New("mph: patch does not apply to table")
+
+// Diff returns a patch that turns old into new when passed to Apply. Tables
+// that are rebuilt with few changes to their key set produce small patches,
+// which can be shipped instead of the full new table. The patch records how
+// new was built, so that Apply builds it the same way, except for what new
+// does not record itself: its normalizer and its weights (see WithWeights).
+func Diff(old, new *Table) ([]byte, error) {
+	if old.hashOnly || new.hashOnly {
+		return nil, ErrNoKeys
+	}
+	b := make([]byte, patchHeaderSize)
+	copy(b, patchMagic)
+	binary.LittleEndian.PutUint32(b[4:], patchVersion)
+	binary.LittleEndian.PutUint32(b[8:], uint32(old.keys.len()))
+	binary.LittleEndian.PutUint32(b[12:], keysChecksum(old.keys))
+	binary.LittleEndian.PutUint32(b[16:], uint32(new.keys.len()))
+	binary.LittleEndian.PutUint32(b[20:], keysChecksum(new.keys))
+	cfg := new.rebuildConfig()
+	binary.LittleEndian.PutUint32(b[24:], patchFlags(cfg))
+	binary.LittleEndian.PutUint64(b[28:], cfg.seed)
+	if new.algo == CHD {
+		binary.LittleEndian.PutUint32(b[36:], uint32(new.level0Slots.n))
+		binary.LittleEndian.PutUint32(b[40:], uint32(new.level1Slots.n))
+	}
+	binary.LittleEndian.PutUint32(b[44:], uint32(cfg.leafSize))
+	binary.LittleEndian.PutUint32(b[48:], uint32(cfg.splitBucket))
+
+	// Coalesce runs of keys that appear consecutively in old into a single
+	// copy operation.
+	var start, count uint32
+	flush := func() {
+		if count > 0 {
+			b = appendUvarint(b, uint64(count)<<1)
+			b = appendUvarint(b, uint64(start))
+			count = 0
+		}
+	}
+	for i := 0; i < new.keys.len(); i++ {
+		k := new.keys.key(i)
+		if n, ok := Lookup(old, k); ok {
+			if count > 0 && n == start+count {
+				count++
+				continue
+			}
+			flush()
+			start, count = n, 1
+			continue
+		}
+		flush()
+		b = appendUvarint(b, uint64(len(k))<<1|1)
+		b = append(b, k...)
+	}
+	flush()
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], crc32.Checksum(b, crcTable))
+	return append(b, sum[:]...), nil
+}
+
+// Apply applies a patch produced by Diff(old, new) to old and returns a table
+// identical to new, with the normalizer of old, unless new was built with
+// WithWeights. It returns ErrPatchMismatch if the patch was made against a
+// different table and ErrCorrupt if the patch is damaged.
+func Apply(old *Table, patch []byte) (*Table, error) {
+	if old.hashOnly {
+		return nil, ErrNoKeys
+	}
+	if len(patch) < patchHeaderSize+4 || string(patch[:4]) != patchMagic {
+		return nil, ErrFormat
+	}
+	if binary.LittleEndian.Uint32(patch[4:]) != patchVersion {
+		return nil, ErrVersion
+	}
+	body, sum := patch[:len(patch)-4], binary.LittleEndian.Uint32(patch[len(patch)-4:])
+	if crc32.Checksum(body, crcTable) != sum {
+		return nil, ErrCorrupt
+	}
+	if binary.LittleEndian.Uint32(patch[8:]) != uint32(old.keys.len()) ||
+		binary.LittleEndian.Uint32(patch[12:]) != keysChecksum(old.keys) {
+		return nil, ErrPatchMismatch
+	}
+	nkeys := binary.LittleEndian.Uint32(patch[16:])
+	newSum := binary.LittleEndian.Uint32(patch[20:])
+	ops := body[patchHeaderSize:]
+	b := NewBuilder()
+	for len(ops) > 0 {
+		x, n := binary.Uvarint(ops)
+		if n <= 0 {
+			return nil, ErrCorrupt
+		}
+		ops = ops[n:]
+		if x&1 == 1 {
+			l := x >> 1
+			if l > uint64(len(ops)) {
+				return nil, ErrCorrupt
+			}
+			b.AddBytes(ops[:l])
+			ops = ops[l:]
+			continue
+		}
+		start, n := binary.Uvarint(ops)
+		if n <= 0 {
+			return nil, ErrCorrupt
+		}
+		ops = ops[n:]
+		count := x >> 1
+		if start > uint64(old.keys.len()) || count > uint64(old.keys.len())-start {
+			return nil, ErrCorrupt
+		}
+		for i := start; i < start+count; i++ {
+			b.AddBytes(old.keys.key(int(i)))
+		}
+	}
+	if uint32(b.Len()) != nkeys || keysChecksum(b.pool) != newSum {
+		return nil, ErrCorrupt
+	}
+	t, err := buildPool(context.Background(), b.pool, patchConfig(patch))
+	if err != nil {
+		return nil, err
+	}
+	t.normalize = old.normalize
+	return t, nil
+}
+
+// keysChecksum returns a CRC-32C of keys, in order.
+func keysChecksum(keys keyPool) uint32 {
+	var crc uint32
+	var lb [binary.MaxVarintLen64]byte
+	for i := 0; i < keys.len(); i++ {
+		k := keys.key(i)
+		crc = crc32.Update(crc, crcTable, lb[:binary.PutUvarint(lb[:], uint64(len(k)))])
+		crc = crc32.Update(crc, crcTable, k)
+	}
+	return crc
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
@@ -0,0 +1,119 @@
+package mph
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	var oldKeys, newKeys []string
+	for i := 0; i < 1000; i++ {
+		oldKeys = append(oldKeys, strconv.Itoa(i))
+	}
+	// Drop a few keys, insert a few, and append a few, which is what a
+	// nightly rebuild of a dictionary with little churn looks like.
+	for i, k := range oldKeys {
+		if i%100 == 7 {
+			continue
+		}
+		if i%250 == 3 {
+			newKeys = append(newKeys, "new-"+k)
+		}
+		newKeys = append(newKeys, k)
+	}
+	newKeys = append(newKeys, "x", "y", "z")
+	old, new := Build(oldKeys), Build(newKeys)
+
+	patch, err := Diff(old, new)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	full, err := new.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	if len(patch) > len(full)/10 {
+		t.Errorf("patch is %d bytes; full table is %d", len(patch), len(full))
+	}
+	got, err := Apply(old, patch)
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	checkTable(t, got, newKeys, []string{"7", "107", "quux"})
+	data, err := got.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	if string(data) != string(full) {
+		t.Errorf("Apply did not reproduce the new table exactly")
+	}
+}
+
+func TestApply_errors(t *testing.T) {
+	old := Build([]string{"foo", "bar"})
+	other := Build([]string{"foo", "baz"})
+	patch, err := Diff(old, Build([]string{"bar", "quux"}))
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	if _, err := Apply(other, patch); err != ErrPatchMismatch {
+		t.Errorf("Apply to other table: got err=%v; want %v", err, ErrPatchMismatch)
+	}
+	bad := append([]byte(nil), patch...)
+	bad[patchHeaderSize] ^= 1
+	if _, err := Apply(old, bad); err != ErrCorrupt {
+		t.Errorf("Apply corrupt patch: got err=%v; want %v", err, ErrCorrupt)
+	}
+	if _, err := Apply(old, patch[:10]); err != ErrFormat {
+		t.Errorf("Apply truncated patch: got err=%v; want %v", err, ErrFormat)
+	}
+}
+
+func TestApply_options(t *testing.T) {
+	var oldKeys, newKeys []string
+	for i := 0; i < 1000; i++ {
+		oldKeys = append(oldKeys, strconv.Itoa(i))
+		if i%10 != 0 {
+			newKeys = append(newKeys, strconv.Itoa(i))
+		}
+	}
+	newKeys = append(newKeys, "x", "y", "z")
+	for name, opts := range map[string][]Option{
+		"BBHash":        {WithAlgorithm(BBHash)},
+		"RecSplit":      {WithAlgorithm(RecSplit), WithRecSplitSizes(6, 50)},
+		"KPerfect":      {WithKPerfect(2)},
+		"Seed":          {WithHash(Wyhash), WithSeed(42)},
+		"ExactSizes":    {WithExactSizes(), WithBucketSize(3), WithLoadFactor(0.9)},
+		"Packed":        {WithPackedIndices(), WithCompressedSeeds()},
+		"FrontCoding":   {WithFrontCoding()},
+		"PackedBBHash":  {WithAlgorithm(BBHash), WithPackedIndices()},
+		"ExactKPerfect": {WithKPerfect(3), WithExactSizes()},
+		"HashOrder":     {WithAlgorithm(RecSplit), WithHashOrder()},
+		"BDZHashOrder":  {WithAlgorithm(BDZ), WithHashOrder()},
+	} {
+		old, err := BuildWithOptions(oldKeys)
+		if err != nil {
+			t.Fatalf("BuildWithOptions(%s): %v", name, err)
+		}
+		new, err := BuildWithOptions(newKeys, opts...)
+		if err != nil {
+			t.Fatalf("BuildWithOptions(%s): %v", name, err)
+		}
+		patch, err := Diff(old, new)
+		if err != nil {
+			t.Fatalf("Diff(%s): %v", name, err)
+		}
+		got, err := Apply(old, patch)
+		if err != nil {
+			t.Fatalf("Apply(%s): %v", name, err)
+		}
+		a, errA := got.MarshalBinary()
+		b, errB := new.MarshalBinary()
+		if errA != nil || errB != nil {
+			t.Fatalf("MarshalBinary(%s): %v, %v", name, errA, errB)
+		}
+		if !Equal(got, new) || string(a) != string(b) {
+			t.Errorf("Apply(%s): did not reproduce the new table", name)
+		}
+	}
+}
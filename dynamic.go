@@ -0,0 +1,329 @@
+package mph
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// A DynamicTable is a set of keys that, unlike a Table, can change after it
+// is built. It keeps a Table of most of its keys, with the keys inserted
+// since the table was built in an overflow map and the keys deleted since
+// marked in a bitset. Once there are more of those changes than a
+// threshold, the table is rebuilt from the current keys in the background,
+// while lookups and changes go on, so that a set that changes rarely keeps
+// the lookups and memory of a Table without its callers having to rebuild
+// one themselves.
+//
+// Each key has an ID, which it keeps until it is deleted: the keys that the
+// DynamicTable is built from have their index in a Table built with the
+// same options, usually their position, and inserted keys have the IDs
+// that follow, in order. The IDs of deleted keys are not reused, so they are
+// not dense as the indices of a Table are. A DynamicTable is safe for
+// concurrent use.
+type DynamicTable struct {
+	cfg       *buildConfig
+	threshold int
+	normalize func([]byte) []byte
+
+	mu       sync.RWMutex
+	table    *Table
+	ids      []uint32 // ids[i] is the ID of index i of table, or nil for i
+	deleted  bitset   // the indices of table that are deleted
+	ndeleted int
+	overflow map[string]uint32 // the inserted keys and their IDs
+	next     uint32            // the ID of the next inserted key
+
+	// While a rebuild is in progress, done is open and log records the
+	// changes made since the rebuild started, to be replayed on the new
+	// table. err is the error of the last background rebuild that failed.
+	done chan struct{}
+	log  []dynamicChange
+	err  error
+}
+
+// A dynamicChange is an insertion of key with id, or its deletion.
+type dynamicChange struct {
+	key    string
+	id     uint32
+	delete bool
+}
+
+// defaultThreshold is the smallest default threshold of a DynamicTable:
+// smaller tables are cheap to rebuild, but not that cheap.
+const defaultThreshold = 1024
+
+// NewDynamicTable builds a DynamicTable holding keys with opts, which
+// apply to every rebuild of its table too, and returns a *DuplicateKeyError
+// as BuildWithOptions does. A rebuild starts once the keys inserted and
+// deleted since the table was built number more than threshold, or, if
+// threshold is 0 or less, a sixteenth of the keys and at least 1024. It
+// holds up lookups and changes while it gathers the keys, which it does
+// without copying those of the table, but not while it builds.
+//
+// Keys are normalized once, so a normalizer (see WithNormalizer) must
+// return normalized keys unchanged. WithDedup, WithProgress, WithWeights
+// and WithStableIndices only apply to the first build, WithBorrowedKeys
+// has no effect on rebuilds, whose tables own their keys, and WithHashOrder
+// is not supported.
+func NewDynamicTable[T ~string | ~[]byte](keys []T, threshold int, opts ...Option) (*DynamicTable, error) {
+	cfg := newBuildConfig(opts)
+	if cfg.hashOrder {
+		return nil, errors.New("mph: DynamicTable does not support WithHashOrder")
+	}
+	t, err := cfg.finish(build(context.Background(), keys, cfg))
+	if err != nil {
+		return nil, err
+	}
+	if threshold <= 0 {
+		if threshold = len(keys) / 16; threshold < defaultThreshold {
+			threshold = defaultThreshold
+		}
+	}
+	rebuild := *cfg
+	rebuild.normalize = nil
+	rebuild.removed = nil
+	rebuild.progress = nil
+	rebuild.borrowKeys = false
+	rebuild.weights = nil
+	rebuild.stable = nil
+	d := &DynamicTable{cfg: &rebuild, threshold: threshold, normalize: cfg.normalize}
+	d.reset(t, nil)
+	d.next = uint32(t.Len())
+	return d, nil
+}
+
+// reset makes t, whose indices have the given IDs, the table of d, with no
+// changes since.
+func (d *DynamicTable) reset(t *Table, ids []uint32) {
+	d.table, d.ids = t, ids
+	d.deleted = newBitset(t.Len())
+	d.ndeleted = 0
+	d.overflow = make(map[string]uint32)
+}
+
+// normalized returns s normalized as the keys of d are.
+func (d *DynamicTable) normalized(s string) string {
+	if d.normalize != nil {
+		return string(d.normalize([]byte(s)))
+	}
+	return s
+}
+
+// Len returns the number of keys in d.
+func (d *DynamicTable) Len() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.table.Len() - d.ndeleted + len(d.overflow)
+}
+
+// Lookup searches for s in d and returns its ID and whether it was found.
+func (d *DynamicTable) Lookup(s string) (id uint32, ok bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.lookup(s)
+}
+
+// lookup is Lookup with d.mu held.
+func (d *DynamicTable) lookup(s string) (id uint32, ok bool) {
+	if len(d.overflow) > 0 {
+		if id, ok := d.overflow[d.normalized(s)]; ok {
+			return id, true
+		}
+	}
+	n, ok := d.table.Lookup(s)
+	if !ok || d.deleted.has(int(n)) {
+		return 0, false
+	}
+	if d.ids != nil {
+		n = d.ids[n]
+	}
+	return n, true
+}
+
+// Insert adds s to d if it is not already in d, and returns its ID and
+// whether it was added.
+func (d *DynamicTable) Insert(s string) (id uint32, inserted bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if id, ok := d.lookup(s); ok {
+		return id, false
+	}
+	key := d.normalized(s)
+	id = d.next
+	d.next++
+	d.overflow[key] = id
+	if d.done != nil {
+		d.log = append(d.log, dynamicChange{key: key, id: id})
+	}
+	d.maybeRebuild()
+	return id, true
+}
+
+// Delete removes s from d and reports whether it was in d.
+func (d *DynamicTable) Delete(s string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	key := d.normalized(s)
+	if !d.remove(key) {
+		return false
+	}
+	if d.done != nil {
+		d.log = append(d.log, dynamicChange{key: key, delete: true})
+	}
+	d.maybeRebuild()
+	return true
+}
+
+// remove removes the normalized key from d and reports whether it was in d.
+func (d *DynamicTable) remove(key string) bool {
+	if _, ok := d.overflow[key]; ok {
+		delete(d.overflow, key)
+		return true
+	}
+	n, ok := d.table.Lookup(key)
+	if !ok || d.deleted.has(int(n)) {
+		return false
+	}
+	d.deleted.set(int(n))
+	d.ndeleted++
+	return true
+}
+
+// maybeRebuild starts a rebuild in the background if there are more
+// changes than the threshold and none is in progress.
+func (d *DynamicTable) maybeRebuild() {
+	if d.done == nil && d.ndeleted+len(d.overflow) > d.threshold {
+		keys, ids := d.snapshot()
+		go func() {
+			t, ids, err := d.rebuild(keys, ids)
+			d.finishRebuild(t, ids, err, true)
+		}()
+	}
+}
+
+// Rebuild rebuilds the table of d from its current keys, after waiting
+// for the background rebuild in progress, if any, and returns its error.
+func (d *DynamicTable) Rebuild() error {
+	d.mu.Lock()
+	for d.done != nil {
+		done := d.done
+		d.mu.Unlock()
+		<-done
+		d.mu.Lock()
+	}
+	keys, ids := d.snapshot()
+	d.mu.Unlock()
+	t, ids, err := d.rebuild(keys, ids)
+	return d.finishRebuild(t, ids, err, false)
+}
+
+// Wait waits for the background rebuild in progress, if any, to finish and
+// returns the error of the last background rebuild that failed since the
+// previous call to Wait, or nil. A failed rebuild leaves the changes in
+// the overflow map and bitset, and another is tried after the next change.
+func (d *DynamicTable) Wait() error {
+	d.mu.Lock()
+	done := d.done
+	d.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	err := d.err
+	d.err = nil
+	return err
+}
+
+// snapshot marks a rebuild as in progress and returns the keys of d and
+// their IDs: those of the table in index order, then the inserted ones in
+// the order of their IDs. d.mu must be held.
+func (d *DynamicTable) snapshot() (keys [][]byte, ids []uint32) {
+	d.done = make(chan struct{})
+	d.log = d.log[:0]
+	n := d.table.Len() - d.ndeleted + len(d.overflow)
+	keys = make([][]byte, 0, n)
+	ids = make([]uint32, 0, n)
+	for i := 0; i < d.table.Len(); i++ {
+		if !d.deleted.has(i) {
+			keys = append(keys, d.table.keys.key(i))
+			if d.ids != nil {
+				ids = append(ids, d.ids[i])
+			} else {
+				ids = append(ids, uint32(i))
+			}
+		}
+	}
+	start := len(keys)
+	for k, id := range d.overflow {
+		keys = append(keys, []byte(k))
+		ids = append(ids, id)
+	}
+	// The IDs of inserted keys increase in the order of insertion.
+	sort.Sort(byID{keys[start:], ids[start:]})
+	return keys, ids
+}
+
+// byID sorts keys by their IDs.
+type byID struct {
+	keys [][]byte
+	ids  []uint32
+}
+
+func (s byID) Len() int           { return len(s.ids) }
+func (s byID) Less(i, j int) bool { return s.ids[i] < s.ids[j] }
+func (s byID) Swap(i, j int) {
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+	s.ids[i], s.ids[j] = s.ids[j], s.ids[i]
+}
+
+// rebuild builds a table of keys, whose IDs are ids, and returns it with
+// the IDs of its indices. It does not need d.mu, since the tables of d are
+// immutable and keys and ids are its own. The table is built with the
+// options of d, which may not number the keys by their position, so the
+// IDs of its indices are found by looking the keys up.
+func (d *DynamicTable) rebuild(keys [][]byte, ids []uint32) (*Table, []uint32, error) {
+	c := *d.cfg
+	t, err := c.finish(build(context.Background(), keys, &c))
+	if err != nil {
+		return nil, nil, err
+	}
+	t.normalize = d.normalize // keys are normalized already
+	byIndex := make([]uint32, len(ids))
+	for i, k := range keys {
+		n, _ := lookupKey(t, k)
+		byIndex[n] = ids[i]
+	}
+	return t, byIndex, nil
+}
+
+// finishRebuild makes t, whose indices have the given IDs, the table of d,
+// and replays the changes made since the rebuild started on it, unless err
+// is not nil. It returns err, which it records for Wait if the rebuild ran
+// in the background.
+func (d *DynamicTable) finishRebuild(t *Table, ids []uint32, err error, background bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	defer func() {
+		close(d.done)
+		d.done = nil
+		d.log = d.log[:0]
+	}()
+	if err != nil {
+		if background {
+			d.err = err
+		}
+		return err
+	}
+	d.reset(t, ids)
+	for _, c := range d.log {
+		if c.delete {
+			d.remove(c.key)
+		} else {
+			d.overflow[c.key] = c.id
+		}
+	}
+	return nil
+}
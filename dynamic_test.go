@@ -0,0 +1,150 @@
+package mph
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// checkDynamic checks that d holds exactly the keys of want, with their IDs.
+func checkDynamic(t *testing.T, d *DynamicTable, want map[string]uint32, extra []string) {
+	t.Helper()
+	if d.Len() != len(want) {
+		t.Errorf("Len: got %d; want %d", d.Len(), len(want))
+	}
+	for k, id := range want {
+		if got, ok := d.Lookup(k); !ok || got != id {
+			t.Errorf("Lookup(%s): got %d, %t; want %d, true", k, got, ok, id)
+		}
+	}
+	for _, k := range extra {
+		if _, ok := want[k]; ok {
+			continue
+		}
+		if got, ok := d.Lookup(k); ok {
+			t.Errorf("Lookup(%s): got %d, true; want false", k, got)
+		}
+	}
+}
+
+func TestDynamicTable(t *testing.T) {
+	var keys []string
+	want := make(map[string]uint32)
+	for i := 0; i < 1000; i++ {
+		k := "key" + strconv.Itoa(i)
+		keys = append(keys, k)
+		want[k] = uint32(i)
+	}
+	d, err := NewDynamicTable(keys, 100, WithHash(Wyhash))
+	if err != nil {
+		t.Fatalf("NewDynamicTable: %v", err)
+	}
+	checkDynamic(t, d, want, []string{"new0"})
+
+	if id, ok := d.Insert("key5"); ok || id != 5 {
+		t.Errorf("Insert(key5): got %d, %t; want 5, false", id, ok)
+	}
+	if d.Delete("new0") {
+		t.Errorf("Delete(new0): got true; want false")
+	}
+	var all []string
+	for i := 0; i < 300; i++ {
+		k := "new" + strconv.Itoa(i)
+		all = append(all, k)
+		id, ok := d.Insert(k)
+		if !ok || id != uint32(1000+i) {
+			t.Fatalf("Insert(%s): got %d, %t; want %d, true", k, id, ok, 1000+i)
+		}
+		want[k] = id
+		if i%2 == 0 {
+			old := "key" + strconv.Itoa(i)
+			if !d.Delete(old) {
+				t.Fatalf("Delete(%s): got false; want true", old)
+			}
+			delete(want, old)
+			all = append(all, old)
+		}
+	}
+	if err := d.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	checkDynamic(t, d, want, all)
+
+	// A deleted key is inserted again with a new ID.
+	if id, ok := d.Insert("key0"); !ok || id != 1300 {
+		t.Errorf("Insert(key0): got %d, %t; want 1300, true", id, ok)
+	}
+	want["key0"] = 1300
+	if err := d.Rebuild(); err != nil {
+		t.Fatalf("Rebuild: %v", err)
+	}
+	if n := len(d.overflow) + d.ndeleted; n != 0 {
+		t.Errorf("Rebuild: left %d changes", n)
+	}
+	checkDynamic(t, d, want, all)
+}
+
+func TestDynamicTable_concurrent(t *testing.T) {
+	d, err := NewDynamicTable([]string{"a", "b", "c"}, 10)
+	if err != nil {
+		t.Fatalf("NewDynamicTable: %v", err)
+	}
+	var wg sync.WaitGroup
+	ids := make([][]uint32, 4)
+	for w := range ids {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				k := strconv.Itoa(w) + "/" + strconv.Itoa(i)
+				id, ok := d.Insert(k)
+				if !ok {
+					t.Errorf("Insert(%s): got false; want true", k)
+				}
+				ids[w] = append(ids[w], id)
+				if i%3 == 0 {
+					d.Delete(k)
+				}
+				d.Lookup("a")
+			}
+		}(w)
+	}
+	wg.Wait()
+	if err := d.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	want := map[string]uint32{"a": 0, "b": 1, "c": 2}
+	var extra []string
+	for w := range ids {
+		for i, id := range ids[w] {
+			k := strconv.Itoa(w) + "/" + strconv.Itoa(i)
+			if i%3 == 0 {
+				extra = append(extra, k)
+			} else {
+				want[k] = id
+			}
+		}
+	}
+	checkDynamic(t, d, want, extra)
+}
+
+func TestDynamicTable_options(t *testing.T) {
+	if _, err := NewDynamicTable([]string{"a", "b", "a"}, 0); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("NewDynamicTable(duplicates): got err=%v; want %v", err, ErrDuplicateKey)
+	}
+	d, err := NewDynamicTable([]string{"C", "b", "a"}, 1, WithNormalizer(bytes.ToLower), WithMonotone())
+	if err != nil {
+		t.Fatalf("NewDynamicTable: %v", err)
+	}
+	if id, ok := d.Insert("A"); ok || id != 0 {
+		t.Errorf("Insert(A): got %d, %t; want 0, false", id, ok)
+	}
+	d.Insert("D")
+	d.Delete("B")
+	if err := d.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	checkDynamic(t, d, map[string]uint32{"a": 0, "C": 2, "d": 3}, []string{"b"})
+}
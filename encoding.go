@@ -0,0 +1,987 @@
+package mph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+	"unsafe"
+)
+
+// The serialized form of a Table starts with a fixed-size header
+//
+//	magic     [4]byte  "MPH\x00"
+//	version   uint32   formatVersion
+//	flags     uint32   flag* bits
+//	nkeys     uint32   len(keys)
+//	n0        uint32   len(level0)
+//	n1        uint32   len(level1)
+//	keyBytes  uint64   total length of all keys
+//	headerSum uint32   CRC-32C of the preceding header fields
+//	nesc      uint32   number of seed escapes, or of words of coded seeds if flagSeedsCoded is set; zero otherwise
+//
+// followed by the table data:
+//
+//	seed                                 uint64, only if flagSeeded
+//	level0[0] ... level0[n0-1]           uint32, uint16 if flagSeeds16, or coded if flagSeedsCoded
+//	escapes[0] ... escapes[2*nesc-1]     uint32, only if flagSeeds16
+//	level1[0] ... level1[n1-1]           uint32, uint16 if flagIndices16, or packed if flagPacked
+//	fp[0] ... fp[nkeys-1]                only if flagFingerprints8 or 16
+//	len(keys[0]) ... len(keys[nkeys-1])  uint32
+//	keys[0] ... keys[nkeys-1]            raw bytes
+//	checksum                             uint32
+//
+// The key lengths and keys are omitted, and keyBytes is zero, if
+// flagHashOnly is set. The keys are one contiguous region, so that a
+// table loaded in place can use them in place too; a writer that streams
+// its keys writes their lengths first, which takes one pass over the keys
+// and no memory that grows with them.
+//
+// If flagSeeds16 is set, level0 is padded with a zero uint16 to a multiple
+// of 4 bytes, and each seed of 0xffff is an escape: its value is found in
+// the escapes, which are pairs of a level0 index and a seed, in increasing
+// order of index.
+//
+// If flagSeedsCoded is set, level0 holds the nesc words of the serialized
+// form of the n0 seeds entropy coded, described with the seedCodes type.
+//
+// If flagPacked is set, the level1 indices are packed in the fewest bits w
+// that can hold nkeys-1, index i taking bits [i*w, (i+1)*w) of a sequence
+// of uint32 words read as a little-endian bit string, followed by one zero
+// word. At least one word precedes the zero word, even if w is 0. If
+// flagIndices16 is set instead, level1 is padded with a zero uint16 to a
+// multiple of 4 bytes.
+//
+// The four bits of flags from kShift hold k-1 for a k-perfect table built
+// with CHD, whose level1 holds k entries for each of n1/k slots; see
+// placeK. The number of slots stands for n1 in what follows.
+//
+// n0 and n1 are powers of 2 unless flagExactSizes is set, in which case at
+// least one is not. A hash selects a slot of a level array of n slots by
+// its low bits if n is a power of 2, and as (hash*n)>>32 otherwise.
+//
+// If flagWyhash is set, keys are hashed with Wyhash rather than Murmur3.
+// If flagSeeded is set, the hash is perturbed by the seed, which is not
+// zero; see WithSeed.
+//
+// The four bits of flags from algorithmShift hold the Algorithm that built
+// the table. Unless it is CHD, level0 holds the n0 words of the serialized
+// form of the hash function of the algorithm rather than seeds, described
+// with the cascade type for BBHash, the recsplit type for RecSplit, the
+// pilots type for PTHash and the hypergraph type for BDZ, or returned by
+// the Marshal method of the function of a registered Backend, and level1
+// maps the number the function gives each key to its index, unless
+// flagHashOrder is set, in which case that number is the index and n1 is
+// zero; see WithHashOrder. A table built with a backend can only be
+// decoded once the backend is registered.
+//
+// A hash-only table may set one of flagFingerprints8 and flagFingerprints16,
+// in which case the fingerprint of each key follows level1 as a uint8 or
+// uint16, padded with zero bytes to a multiple of 4 bytes.
+//
+// The checksum is the CRC-32C of everything that precedes it. The header has
+// a checksum of its own so that a corrupt section size is caught before
+// the sections are read. A checksum is no defense against a crafted
+// header, though, so a reader only allocates the table up front if the
+// input is known to hold the sizes the header claims. All integers
+// are little-endian regardless of the host byte order, so a table written on
+// one architecture can be read on any other. The header is a multiple of 8
+// bytes so that the level arrays of a suitably aligned buffer can be used in
+// place.
+
+const (
+	magic         = "MPH\x00"
+	formatVersion = 1
+	headerSize    = 40
+)
+
+// Header flags.
+const (
+	flagHashOnly       = 1 << iota // the table does not store its keys
+	flagSeeds16                    // level0 holds 16-bit seeds and escapes
+	flagPacked                     // level1 holds bit-packed indices
+	flagWyhash                     // keys are hashed with Wyhash
+	flagFingerprints8              // 8-bit fingerprints follow level1
+	flagFingerprints16             // 16-bit fingerprints follow level1
+	flagIndices16                  // level1 holds 16-bit indices
+	flagExactSizes                 // level0 or level1 does not have a power of 2 size
+
+	algorithmShift = 8                     // the algorithm is in the bits of flags from here
+	flagAlgorithm  = 0xf << algorithmShift // the bits of the algorithm
+	flagSeedsCoded = 1 << 12               // level0 holds entropy-coded seeds
+	kShift         = 13                    // k-1 of a k-perfect table is in the bits of flags from here
+	flagK          = 0xf << kShift         // the bits of k-1
+	flagSeeded     = 1 << 17               // a seed perturbs the hash
+	flagHashOrder  = 1 << 18               // the hash function numbers the keys, and level1 is empty
+
+	knownFlags = flagHashOnly | flagSeeds16 | flagPacked | flagWyhash | flagFingerprints8 | flagFingerprints16 | flagIndices16 | flagExactSizes | flagAlgorithm | flagSeedsCoded | flagK | flagSeeded | flagHashOrder
+)
+
+var (
+	// ErrFormat is returned when decoding data that is not a serialized
+	// table.
+	ErrFormat = errors.New("mph: not a serialized table")
+	// ErrVersion is returned when decoding a serialized table written with a
+	// format version or features that this package does not support.
+	ErrVersion = errors.New("mph: unsupported serialized table version")
+	// ErrCorrupt is returned when decoding a serialized table whose
+	// checksum does not match or whose contents are inconsistent.
+	ErrCorrupt = errors.New("mph: corrupt serialized table")
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// A header describes the sections of a serialized table.
+type header struct {
+	version  uint32
+	flags    uint32
+	nkeys    uint32
+	n0       uint32
+	n1       uint32
+	keyBytes uint64
+	nesc     uint32
+	seed     uint64 // follows the header if flagSeeded
+}
+
+func (t *Table) header() header {
+	var flags uint32
+	if t.hashOnly {
+		flags |= flagHashOnly
+	}
+	if t.level0.narrow != nil {
+		flags |= flagSeeds16
+	}
+	if t.level0.coded != nil {
+		flags |= flagSeedsCoded
+	}
+	if t.level1.words != nil {
+		flags |= flagPacked
+	}
+	if t.level1.narrow != nil {
+		flags |= flagIndices16
+	}
+	if !isPow2(t.level0.len()) || !isPow2(t.level1.len()/t.K()) {
+		flags |= flagExactSizes
+	}
+	if t.hash == Wyhash {
+		flags |= flagWyhash
+	}
+	if t.seed != 0 {
+		flags |= flagSeeded
+	}
+	if t.hashOrder {
+		flags |= flagHashOrder
+	}
+	flags |= uint32(t.algo) << algorithmShift
+	flags |= uint32(t.K()-1) << kShift
+	switch t.fingerprints.bits {
+	case 8:
+		flags |= flagFingerprints8
+	case 16:
+		flags |= flagFingerprints16
+	}
+	return header{
+		version:  formatVersion,
+		flags:    flags,
+		nkeys:    uint32(t.Len()),
+		n0:       uint32(t.level0.len()),
+		n1:       uint32(t.level1.len()),
+		keyBytes: uint64(t.keys.size()),
+		nesc:     uint32(len(t.level0.escapes)/2 + len(t.level0.coded)),
+		seed:     t.seed,
+	}
+}
+
+func (h *header) marshal(b []byte) {
+	copy(b, magic)
+	binary.LittleEndian.PutUint32(b[4:], h.version)
+	binary.LittleEndian.PutUint32(b[8:], h.flags)
+	binary.LittleEndian.PutUint32(b[12:], h.nkeys)
+	binary.LittleEndian.PutUint32(b[16:], h.n0)
+	binary.LittleEndian.PutUint32(b[20:], h.n1)
+	binary.LittleEndian.PutUint64(b[24:], h.keyBytes)
+	binary.LittleEndian.PutUint32(b[32:], crc32.Checksum(b[:32], crcTable))
+	binary.LittleEndian.PutUint32(b[36:], h.nesc)
+}
+
+// parseHeader decodes and validates the header at the start of b, which
+// must be at least headerSize bytes long.
+func parseHeader(b []byte) (header, error) {
+	if string(b[:4]) != magic {
+		return header{}, ErrFormat
+	}
+	// Check the version first: a later version may lay out its header
+	// differently.
+	if binary.LittleEndian.Uint32(b[4:]) != formatVersion {
+		return header{}, ErrVersion
+	}
+	if binary.LittleEndian.Uint32(b[32:]) != crc32.Checksum(b[:32], crcTable) {
+		return header{}, ErrCorrupt
+	}
+	h := header{
+		version:  binary.LittleEndian.Uint32(b[4:]),
+		flags:    binary.LittleEndian.Uint32(b[8:]),
+		nkeys:    binary.LittleEndian.Uint32(b[12:]),
+		n0:       binary.LittleEndian.Uint32(b[16:]),
+		n1:       binary.LittleEndian.Uint32(b[20:]),
+		keyBytes: binary.LittleEndian.Uint64(b[24:]),
+		nesc:     binary.LittleEndian.Uint32(b[36:]),
+	}
+	if h.flags&^knownFlags != 0 || (!h.seeds16() && !h.seedsCoded() && h.nesc != 0) || !h.algorithm().known() {
+		return header{}, ErrVersion
+	}
+	if h.seeds16() && h.nesc > h.n0 || h.seedsCoded() && (h.seeds16() || h.nesc < 3) {
+		return header{}, ErrCorrupt
+	}
+	if k := uint32(h.k()); k > 1 && (h.algorithm() != CHD || h.n1%k != 0) {
+		return header{}, ErrCorrupt
+	}
+	if pow2 := isPow2(int(h.n0)) && isPow2(int(h.n1)/h.k()); pow2 == (h.flags&flagExactSizes != 0) {
+		return header{}, ErrCorrupt
+	}
+	if h.hashOrder() {
+		if h.algorithm() == CHD || h.n1 != 0 || h.packed() || h.indices16() {
+			return header{}, ErrCorrupt
+		}
+	} else if h.n1 == 0 || h.n1 < h.nkeys {
+		return header{}, ErrCorrupt
+	}
+	if h.n0 == 0 || h.keyBytes > math.MaxUint32 {
+		return header{}, ErrCorrupt
+	}
+	if h.hashOnly() && h.keyBytes != 0 {
+		return header{}, ErrCorrupt
+	}
+	if h.packed() && h.indices16() || h.algorithm() != CHD && (h.seeds16() || h.seedsCoded()) {
+		return header{}, ErrCorrupt
+	}
+	if fp := h.flags & (flagFingerprints8 | flagFingerprints16); fp != 0 && (!h.hashOnly() || fp == flagFingerprints8|flagFingerprints16) {
+		return header{}, ErrCorrupt
+	}
+	return h, nil
+}
+
+// parseSeed decodes the seed, which must be seedSize bytes long, of the
+// table described by h.
+func (h *header) parseSeed(b []byte) error {
+	if h.seed = binary.LittleEndian.Uint64(b); h.seed == 0 {
+		return ErrCorrupt
+	}
+	return nil
+}
+
+// seedSize is the size of the seed of a table with flagSeeded.
+const seedSize = 8
+
+func (h *header) seeded() bool {
+	return h.flags&flagSeeded != 0
+}
+
+// start returns the position of level0 in the serialized table described
+// by h, after the header and the seed.
+func (h *header) start() uint64 {
+	if h.seeded() {
+		return headerSize + seedSize
+	}
+	return headerSize
+}
+
+func (h *header) hashOrder() bool {
+	return h.flags&flagHashOrder != 0
+}
+
+func (h *header) hashOnly() bool {
+	return h.flags&flagHashOnly != 0
+}
+
+func (h *header) seeds16() bool {
+	return h.flags&flagSeeds16 != 0
+}
+
+func (h *header) seedsCoded() bool {
+	return h.flags&flagSeedsCoded != 0
+}
+
+func (h *header) packed() bool {
+	return h.flags&flagPacked != 0
+}
+
+func (h *header) indices16() bool {
+	return h.flags&flagIndices16 != 0
+}
+
+func (h *header) algorithm() Algorithm {
+	return Algorithm(h.flags & flagAlgorithm >> algorithmShift)
+}
+
+// k returns the number of keys per level1 slot.
+func (h *header) k() int {
+	return int(h.flags&flagK>>kShift) + 1
+}
+
+// checkLevel0 returns an error unless level0 is valid for the table
+// described by h.
+func (h *header) checkLevel0(level0 *seedArray) error {
+	if a := h.algorithm(); a != CHD {
+		return checkLevel0(a, level0, int(h.nkeys))
+	}
+	if h.seedsCoded() {
+		return checkSeedCodes(level0.coded, int(h.n0))
+	}
+	return level0.check()
+}
+
+// fingerprintBits returns the width of the fingerprints, or 0.
+func (h *header) fingerprintBits() int {
+	switch {
+	case h.flags&flagFingerprints8 != 0:
+		return 8
+	case h.flags&flagFingerprints16 != 0:
+		return 16
+	}
+	return 0
+}
+
+func (h *header) hash() Hash {
+	if h.flags&flagWyhash != 0 {
+		return Wyhash
+	}
+	return Murmur3
+}
+
+// level1Words returns the number of uint32 words of the serialized level1.
+func (h *header) level1Words() int {
+	if h.packed() {
+		return packedWords(int(h.n1), packedWidth(int(h.nkeys)))
+	}
+	if h.indices16() {
+		return narrowBytes(int(h.n1)) / 4
+	}
+	return int(h.n1)
+}
+
+// level0Size returns the size of the serialized level0, including any
+// padding and escapes.
+func (h *header) level0Size() uint64 {
+	if h.seeds16() {
+		return uint64(narrowBytes(int(h.n0))) + 8*uint64(h.nesc)
+	}
+	if h.seedsCoded() {
+		return 4 * uint64(h.nesc)
+	}
+	return 4 * uint64(h.n0)
+}
+
+// numLens returns the number of key lengths stored in the table described
+// by h.
+func (h *header) numLens() int {
+	if h.hashOnly() {
+		return 0
+	}
+	return int(h.nkeys)
+}
+
+// memSize returns the size of the arena that holds the arrays of the table
+// described by h, not counting the key bytes unless withKeys.
+func (h *header) memSize(withKeys bool) int {
+	size := h.size() - h.start() - h.keyBytes - 4 // minus the checksum
+	size += 2 * lineSlack                         // to align the level arrays
+	if !h.hashOnly() {
+		size += 4 // the offsets have one more entry than the lengths
+	}
+	if withKeys {
+		size += h.keyBytes
+	}
+	return int(size)
+}
+
+// size returns the total length of the serialized table described by h.
+func (h *header) size() uint64 {
+	return h.start() + h.level0Size() + 4*(uint64(h.level1Words())+uint64(h.numLens())) +
+		uint64(fingerprintBytes(int(h.nkeys), h.fingerprintBits())) + h.keyBytes + 4
+}
+
+// newTable returns a table with the given contents as described by h.
+func (h *header) newTable(level0 seedArray, level1 indexArray, fp fingerprintArray, keys keyPool) Table {
+	t := Table{
+		keys:        keys,
+		keyWidth:    keys.width(),
+		level0:      level0,
+		level0Slots: newSlotMap(level0.len()),
+		level1:      level1,
+		level1Slots: newSlotMap(level1.len() / h.k()),
+		hash:        h.hash(),
+		seed:        h.seed,
+	}
+	t.algo = h.algorithm()
+	t.hashOrder = h.hashOrder()
+	if k := h.k(); k > 1 {
+		t.slotKeys = k
+	}
+	if h.hashOnly() {
+		t.keys = keyPool{}
+		t.keyWidth = 0
+		t.hashOnly = true
+		t.nkeys = int(h.nkeys)
+		t.fingerprints = fp
+	}
+	t.viewLevel0()
+	return t
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (t *Table) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	h := t.header()
+	buf.Grow(int(h.size()))
+	if _, err := t.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. The key bytes are
+// copied, so data may be reused after UnmarshalBinary returns.
+func (t *Table) UnmarshalBinary(data []byte) error {
+	return t.unmarshal(data, nil)
+}
+
+// unmarshal is UnmarshalBinary with the arena of t from alloc.
+func (t *Table) unmarshal(data []byte, alloc func(size int) []byte) error {
+	r := bytes.NewReader(data)
+	if _, err := t.readFrom(r, int64(len(data)), alloc); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = ErrCorrupt
+		}
+		return err
+	}
+	if r.Len() != 0 {
+		return ErrCorrupt
+	}
+	return nil
+}
+
+// indices returns the level1 of the table described by h, whose words
+// are read from its serialized form.
+func (h *header) indices(words []uint32) indexArray {
+	if h.packed() {
+		return indexArray{words: words, width: packedWidth(int(h.nkeys)), n: int(h.n1)}
+	}
+	return indexArray{wide: words}
+}
+
+func isPow2(n int) bool {
+	return n > 0 && n&(n-1) == 0
+}
+
+// WriteTo implements io.WriterTo. It writes the same serialized form as
+// MarshalBinary using a small fixed-size buffer.
+func (t *Table) WriteTo(w io.Writer) (int64, error) {
+	e := encoder{w: w, buf: make([]byte, headerSize, encodeBufSize)}
+	t.encodeLevels(&e, t.header())
+	if borrowed := t.keys.borrowed; borrowed != nil {
+		for _, k := range borrowed {
+			e.uint32(uint32(len(k)))
+		}
+		for _, k := range borrowed {
+			e.bytes(k)
+		}
+		return e.finish()
+	}
+	if p := &t.keys; !p.plain() {
+		for i := 0; i < p.len(); i++ {
+			e.uint32(uint32(len(p.key(i))))
+		}
+		for i := 0; i < p.len(); i++ {
+			e.bytes(p.key(i))
+		}
+		return e.finish()
+	}
+	offsets := t.keys.offsets
+	for i := 1; i < len(offsets); i++ {
+		e.uint32(offsets[i] - offsets[i-1])
+	}
+	e.bytes(t.keys.data[:t.keys.size()])
+	return e.finish()
+}
+
+// encodeLevels writes h, the level arrays, and the fingerprints of t to e,
+// whose buffer must have room for the header.
+func (t *Table) encodeLevels(e *encoder, h header) {
+	h.marshal(e.buf)
+	if h.seeded() {
+		e.uint32(uint32(h.seed))
+		e.uint32(uint32(h.seed >> 32))
+	}
+	if narrow := t.level0.narrow; narrow != nil {
+		for _, v := range narrow {
+			e.uint16(v)
+		}
+		if len(narrow)%2 == 1 {
+			e.uint16(0)
+		}
+		for _, v := range t.level0.escapes {
+			e.uint32(v)
+		}
+	} else if coded := t.level0.coded; coded != nil {
+		for _, v := range coded {
+			e.uint32(v)
+		}
+	} else {
+		for _, v := range t.level0.wide {
+			e.uint32(v)
+		}
+	}
+	for _, v := range t.level1.wide {
+		e.uint32(v)
+	}
+	if narrow := t.level1.narrow; narrow != nil {
+		for _, v := range narrow {
+			e.uint16(v)
+		}
+		if len(narrow)%2 == 1 {
+			e.uint16(0)
+		}
+	}
+	for _, v := range t.level1.words {
+		e.uint32(v)
+	}
+	if fp := &t.fingerprints; fp.bits != 0 {
+		e.bytes(fp.b8)
+		for _, v := range fp.b16 {
+			e.uint16(v)
+		}
+		for n := fp.size(); n%4 != 0; n++ {
+			e.bytes([]byte{0})
+		}
+	}
+}
+
+// ReadFrom implements io.ReaderFrom. It reads a table in the form written by
+// WriteTo or MarshalBinary and replaces the contents of t. If r has a Len
+// method, as a *bytes.Reader does, that tells how many bytes are left, the
+// memory of the table is allocated once the header is read; otherwise it
+// grows as the data arrives, and the table is copied into place at the
+// end, so that a header that claims more than r holds cannot force a large
+// allocation.
+func (t *Table) ReadFrom(r io.Reader) (int64, error) {
+	size := int64(-1)
+	if l, ok := r.(interface{ Len() int }); ok {
+		size = int64(l.Len())
+	}
+	return t.readFrom(r, size, nil)
+}
+
+// readFrom is ReadFrom with the arena of t from alloc, from r, which holds
+// size bytes, or an unknown number if size is negative.
+func (t *Table) readFrom(r io.Reader, size int64, alloc func(size int) []byte) (int64, error) {
+	d := decoder{r: r, buf: make([]byte, encodeBufSize), size: size, alloc: alloc}
+	h, level0, level1, fp, err := d.index(true)
+	if err != nil {
+		return d.n, err
+	}
+	keys := d.keys(&h, true)
+	crc := d.crc
+	if !d.read(d.buf[:4]) {
+		return d.n, d.err
+	}
+	if binary.LittleEndian.Uint32(d.buf) != crc {
+		return d.n, ErrCorrupt
+	}
+	nt := h.newTable(level0, level1, fp, keys)
+	if !d.sized {
+		// The table was read into memory that grew as the data arrived.
+		// Now that the data is known to be there, lay the table out in
+		// one arena as if it had been allocated up front.
+		a, err := allocArena(nt.arenaSize(true), alloc)
+		if err != nil {
+			return d.n, err
+		}
+		nt.compactInto(&a, true)
+	}
+	*t = nt
+	return d.n, nil
+}
+
+// index reads and validates the header, the level arrays and the
+// fingerprints of a serialized table, which precede its keys. If the
+// input is known to hold the table, they are allocated from one arena,
+// which if withKeys also has room for the key bytes, for d.keys to read
+// into next; otherwise they grow as the data arrives, so that a crafted
+// header cannot force a huge allocation.
+func (d *decoder) index(withKeys bool) (h header, level0 seedArray, level1 indexArray, fp fingerprintArray, err error) {
+	if !d.read(d.buf[:headerSize]) {
+		return h, level0, level1, fp, d.err
+	}
+	if h, err = parseHeader(d.buf); err != nil {
+		return h, level0, level1, fp, err
+	}
+	if h.seeded() {
+		if !d.read(d.buf[:seedSize]) {
+			return h, level0, level1, fp, d.err
+		}
+		if err = h.parseSeed(d.buf); err != nil {
+			return h, level0, level1, fp, err
+		}
+	}
+	if d.size >= 0 {
+		if h.size() > uint64(d.size) {
+			return h, level0, level1, fp, io.ErrUnexpectedEOF
+		}
+		if d.mem, err = allocArena(h.memSize(withKeys), d.alloc); err != nil {
+			return h, level0, level1, fp, err
+		}
+		d.sized = true
+	}
+	d.mem.alignLine()
+	if h.seeds16() {
+		if level0.narrow = d.uint16s(narrowBytes(int(h.n0)) / 2); level0.narrow != nil {
+			level0.narrow = level0.narrow[:h.n0] // drop the padding
+		}
+		level0.escapes = d.uint32s(2 * int(h.nesc))
+	} else if h.seedsCoded() {
+		level0.coded = d.uint32s(int(h.nesc))
+	} else {
+		level0.wide = d.uint32s(int(h.n0))
+	}
+	d.mem.alignLine()
+	if h.indices16() {
+		if level1.narrow = d.uint16s(narrowBytes(int(h.n1)) / 2); level1.narrow != nil {
+			level1.narrow = level1.narrow[:h.n1] // drop the padding
+		}
+	} else {
+		level1 = h.indices(d.uint32s(h.level1Words()))
+	}
+	if bits := h.fingerprintBits(); bits != 0 {
+		fp = h.fingerprints(d.bytes(fingerprintBytes(int(h.nkeys), bits)))
+	}
+	if d.err != nil {
+		return h, level0, level1, fp, d.err
+	}
+	if err := h.checkLevel0(&level0); err != nil {
+		return h, level0, level1, fp, err
+	}
+	if err := level1.check(int(h.nkeys)); err != nil {
+		return h, level0, level1, fp, err
+	}
+	return h, level0, level1, fp, nil
+}
+
+// keys reads the key lengths of the table described by h and, if
+// withKeys, the keys, into a pool; without withKeys, the pool has offsets
+// but no data. d.err is set if they are corrupt.
+func (d *decoder) keys(h *header, withKeys bool) keyPool {
+	if h.hashOnly() {
+		return keyPool{}
+	}
+	var offsets []uint32
+	if d.sized {
+		offsets = d.mem.uint32s(h.numLens() + 1)[:1]
+		offsets[0] = 0
+	} else {
+		offsets = []uint32{0}
+	}
+	// Read the lengths into the offsets, to be summed in place.
+	offsets = d.appendUint32s(offsets, h.numLens())
+	if d.err != nil {
+		return keyPool{}
+	}
+	// The offsets cannot wrap around: they only grow, up to at most
+	// h.keyBytes, which fits in 32 bits.
+	var size uint64
+	for i := 1; i < len(offsets); i++ {
+		size += uint64(offsets[i])
+		offsets[i] = uint32(size)
+	}
+	if size != h.keyBytes {
+		d.err = ErrCorrupt
+		return keyPool{}
+	}
+	if !withKeys {
+		return keyPool{offsets: offsets}
+	}
+	data := d.bytes(int(h.keyBytes))
+	if d.err != nil {
+		return keyPool{}
+	}
+	return keyPool{data: data, offsets: offsets}
+}
+
+// fingerprints returns the fingerprints of the table described by h, whose
+// serialized form, with its padding, is b. The result may alias b.
+func (h *header) fingerprints(b []byte) fingerprintArray {
+	fp := fingerprintArray{bits: uint8(h.fingerprintBits())}
+	if fp.bits == 0 || b == nil {
+		return fp
+	}
+	if fp.bits == 8 {
+		fp.b8 = b[:h.nkeys:h.nkeys]
+	} else {
+		fp.b16 = uint16sInPlace(b)[:h.nkeys]
+	}
+	return fp
+}
+
+const encodeBufSize = 4096
+
+// An encoder buffers little-endian writes to w and maintains the checksum
+// of the bytes written so far. The first error is recorded in err and
+// subsequent writes are dropped.
+type encoder struct {
+	w   io.Writer
+	buf []byte
+	n   int64
+	crc uint32
+	err error
+}
+
+func (e *encoder) uint32(v uint32) {
+	if len(e.buf)+4 > cap(e.buf) {
+		e.flush()
+	}
+	e.buf = e.buf[:len(e.buf)+4]
+	binary.LittleEndian.PutUint32(e.buf[len(e.buf)-4:], v)
+}
+
+func (e *encoder) uint16(v uint16) {
+	if len(e.buf)+2 > cap(e.buf) {
+		e.flush()
+	}
+	e.buf = e.buf[:len(e.buf)+2]
+	binary.LittleEndian.PutUint16(e.buf[len(e.buf)-2:], v)
+}
+
+func (e *encoder) bytes(b []byte) {
+	for len(b) > 0 {
+		if len(e.buf) == cap(e.buf) {
+			e.flush()
+		}
+		n := copy(e.buf[len(e.buf):cap(e.buf)], b)
+		e.buf = e.buf[:len(e.buf)+n]
+		b = b[n:]
+	}
+}
+
+// finish writes the checksum and flushes e, and returns the number of bytes
+// written and the first error.
+func (e *encoder) finish() (int64, error) {
+	e.flush()
+	e.uint32(e.crc)
+	e.flush()
+	return e.n, e.err
+}
+
+func (e *encoder) flush() {
+	if e.err == nil && len(e.buf) > 0 {
+		e.crc = crc32.Update(e.crc, crcTable, e.buf)
+		var n int
+		n, e.err = e.w.Write(e.buf)
+		e.n += int64(n)
+	}
+	e.buf = e.buf[:0]
+}
+
+// A decoder reads little-endian values from r and maintains the checksum
+// of the bytes read so far. The first error is recorded in err and
+// subsequent reads return zero values.
+type decoder struct {
+	r     io.Reader
+	buf   []byte
+	size  int64                 // number of bytes r holds, or -1 if unknown
+	sized bool                  // whether r is known to hold the table, and mem to have room for it
+	mem   arena                 // where the values read are allocated, if sized
+	alloc func(size int) []byte // allocates mem, if not nil
+	n     int64
+	crc   uint32
+	err   error
+}
+
+func (d *decoder) read(b []byte) bool {
+	if d.err != nil {
+		return false
+	}
+	n, err := io.ReadFull(d.r, b)
+	d.n += int64(n)
+	d.crc = crc32.Update(d.crc, crcTable, b[:n])
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		d.err = err
+		return false
+	}
+	return true
+}
+
+// uint32s reads n values. They are allocated from the arena if the input
+// is known to hold them, and otherwise grow as they are read.
+func (d *decoder) uint32s(n int) []uint32 {
+	vs := []uint32{}
+	if d.sized {
+		vs = d.mem.uint32s(n)[:0]
+	}
+	if vs = d.appendUint32s(vs, n); d.err != nil {
+		return nil
+	}
+	return vs
+}
+
+// appendUint32s reads n values and appends them to vs, at most one buffer
+// at a time, so that vs grows no faster than the data arrives.
+func (d *decoder) appendUint32s(vs []uint32, n int) []uint32 {
+	for n > 0 && d.err == nil {
+		b := d.buf
+		if 4*n < len(b) {
+			b = b[:4*n]
+		}
+		if !d.read(b) {
+			break
+		}
+		for ; len(b) > 0; b = b[4:] {
+			vs = append(vs, binary.LittleEndian.Uint32(b))
+			n--
+		}
+	}
+	return vs
+}
+
+// uint16s is like uint32s for 16-bit values.
+func (d *decoder) uint16s(n int) []uint16 {
+	vs := []uint16{}
+	if d.sized {
+		vs = d.mem.uint16s(n)[:0]
+	}
+	for n > 0 && d.err == nil {
+		b := d.buf
+		if 2*n < len(b) {
+			b = b[:2*n]
+		}
+		if !d.read(b) {
+			break
+		}
+		for ; len(b) > 0; b = b[2:] {
+			vs = append(vs, binary.LittleEndian.Uint16(b))
+			n--
+		}
+	}
+	if d.err != nil {
+		return nil
+	}
+	return vs
+}
+
+// bytes is like uint32s for bytes.
+func (d *decoder) bytes(n int) []byte {
+	data := []byte{}
+	if d.sized {
+		data = d.mem.bytes(n)[:0]
+	}
+	if data = d.appendBytes(data, n); d.err != nil {
+		return nil
+	}
+	return data
+}
+
+// maxGrowth is the most that appendBytes grows a slice by before reading
+// the data that fills it.
+const maxGrowth = 1 << 20
+
+// appendBytes reads n bytes and appends them to data, at most maxGrowth
+// bytes at a time.
+func (d *decoder) appendBytes(data []byte, n int) []byte {
+	for n > 0 && d.err == nil {
+		m := n
+		if m > maxGrowth {
+			m = maxGrowth
+		}
+		l := len(data)
+		if cap(data)-l < m {
+			data = append(data, make([]byte, m)...)
+		}
+		data = data[:l+m]
+		d.read(data[l:])
+		n -= m
+	}
+	return data
+}
+
+// LoadBytes decodes a table in the form written by WriteTo or MarshalBinary
+// without copying it: the level arrays and keys of the returned Table alias
+// data, so startup cost and memory stay flat regardless of the table size.
+// This makes LoadBytes suitable for tables embedded with go:embed. The
+// caller must not modify data while the table is in use.
+//
+// The level arrays can only be used in place if data is 4-byte aligned;
+// otherwise they are copied. To keep loading cheap, LoadBytes validates the
+// structure of data but does not verify its checksum.
+func LoadBytes(data []byte) (*Table, error) {
+	if len(data) < headerSize {
+		return nil, ErrFormat
+	}
+	h, err := parseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) != h.size() {
+		return nil, ErrCorrupt
+	}
+	if h.seeded() {
+		if err := h.parseSeed(data[headerSize:h.start()]); err != nil {
+			return nil, err
+		}
+	}
+	nkeys, n0, nlens := int(h.nkeys), int(h.n0), h.numLens()
+	data = data[h.start():]
+	var level0 seedArray
+	if h.seeds16() {
+		nb, nesc := narrowBytes(n0), 2*int(h.nesc)
+		level0.narrow, data = uint16sInPlace(data[:nb])[:n0], data[nb:]
+		level0.escapes, data = uint32sInPlace(data[:4*nesc]), data[4*nesc:]
+	} else if h.seedsCoded() {
+		nw := int(h.nesc)
+		level0.coded, data = uint32sInPlace(data[:4*nw]), data[4*nw:]
+	} else {
+		level0.wide, data = uint32sInPlace(data[:4*n0]), data[4*n0:]
+	}
+	if err := h.checkLevel0(&level0); err != nil {
+		return nil, err
+	}
+	var level1 indexArray
+	if w1 := h.level1Words(); h.indices16() {
+		level1.narrow, data = uint16sInPlace(data[:4*w1])[:h.n1], data[4*w1:]
+	} else {
+		level1, data = h.indices(uint32sInPlace(data[:4*w1])), data[4*w1:]
+	}
+	if err := level1.check(nkeys); err != nil {
+		return nil, err
+	}
+	nfp := fingerprintBytes(nkeys, h.fingerprintBits())
+	fp, data := h.fingerprints(data[:nfp]), data[nfp:]
+	lens, data := uint32sInPlace(data[:4*nlens]), data[4*nlens:len(data)-4]
+	pool, ok := poolFromLens(data, lens)
+	if !ok {
+		return nil, ErrCorrupt
+	}
+	t := h.newTable(level0, level1, fp, pool)
+	return &t, nil
+}
+
+// uint32sInPlace interprets b as a little-endian []uint32. The result
+// aliases b when the host byte order and the alignment of b permit it;
+// otherwise the values are copied.
+func uint32sInPlace(b []byte) []uint32 {
+	n := len(b) / 4
+	if n == 0 {
+		return []uint32{}
+	}
+	if hostLittleEndian && uintptr(unsafe.Pointer(&b[0]))%4 == 0 {
+		return unsafe.Slice((*uint32)(unsafe.Pointer(&b[0])), n)
+	}
+	vs := make([]uint32, n)
+	for i := range vs {
+		vs[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+	return vs
+}
@@ -0,0 +1,344 @@
+package mph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"io"
+	"runtime"
+	"strconv"
+	"testing"
+	"testing/iotest"
+	"unsafe"
+)
+
+func TestMarshalBinary(t *testing.T) {
+	var keys, extra []string
+	for i := 0; i < 2000; i++ {
+		s := strconv.Itoa(i)
+		if i < 1000 {
+			keys = append(keys, s)
+		} else {
+			extra = append(extra, s)
+		}
+	}
+	data, err := Build(keys).MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	var table Table
+	if err := table.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	checkTable(t, &table, keys, extra)
+}
+
+func TestUnmarshalBinary_invalid(t *testing.T) {
+	data, err := Build([]string{"foo", "bar", "baz"}).MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	for _, b := range [][]byte{
+		nil,
+		data[:headerSize-1],
+		data[:len(data)-1],
+		append(data[:len(data):len(data)], 0),
+	} {
+		var table Table
+		if err := table.UnmarshalBinary(b); err == nil {
+			t.Errorf("UnmarshalBinary(%d bytes): got nil error", len(b))
+		}
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	keys := []string{"foo", "foo2", "bar", "baz"}
+	table := Build(keys)
+	var buf bytes.Buffer
+	n, err := table.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo: got n=%d; wrote %d bytes", n, buf.Len())
+	}
+	data, err := table.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("WriteTo and MarshalBinary disagree")
+	}
+	var got Table
+	m, err := got.ReadFrom(iotest.OneByteReader(&buf))
+	if err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+	if m != n {
+		t.Errorf("ReadFrom: got n=%d; want %d", m, n)
+	}
+	checkTable(t, &got, keys, []string{"quux"})
+}
+
+func TestReadFrom_truncated(t *testing.T) {
+	data, err := Build([]string{"foo", "bar", "baz"}).MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	for i := 0; i < len(data); i++ {
+		var table Table
+		if _, err := table.ReadFrom(bytes.NewReader(data[:i])); err != io.ErrUnexpectedEOF {
+			t.Errorf("ReadFrom(%d of %d bytes): got err=%v; want %v", i, len(data), err, io.ErrUnexpectedEOF)
+		}
+	}
+}
+
+func TestLoadBytes(t *testing.T) {
+	keys := []string{"foo", "foo2", "bar", "baz"}
+	data, err := Build(keys).MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	table, err := LoadBytes(data)
+	if err != nil {
+		t.Fatalf("LoadBytes: %v", err)
+	}
+	checkTable(t, table, keys, []string{"quux"})
+	if hostLittleEndian && &table.level0.narrow[0] != (*uint16)(unsafe.Pointer(&data[headerSize])) {
+		t.Errorf("LoadBytes: level0 does not alias data")
+	}
+	last := table.keys.key(table.keys.len() - 1)
+	if &last[0] != &data[len(data)-4-len(last)] {
+		t.Errorf("LoadBytes: keys do not alias data")
+	}
+
+	// An unaligned copy of data must still load correctly.
+	unaligned := append(make([]byte, 1, len(data)+1), data...)[1:]
+	table, err = LoadBytes(unaligned)
+	if err != nil {
+		t.Fatalf("LoadBytes(unaligned): %v", err)
+	}
+	checkTable(t, table, keys, []string{"quux"})
+}
+
+func TestUnmarshalBinary_header(t *testing.T) {
+	data, err := Build([]string{"foo", "bar", "baz"}).MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	for _, tt := range []struct {
+		name   string
+		offset int
+		value  byte
+		want   error
+	}{
+		{"magic", 0, 'X', ErrFormat},
+		{"version", 4, formatVersion + 1, ErrVersion},
+		{"flags", 9, 0xff, ErrVersion},
+		{"escapes", 36, 1, ErrCorrupt},
+		{"escapes", 36, 2, ErrCorrupt},
+	} {
+		b := append([]byte(nil), data...)
+		b[tt.offset] = tt.value
+		binary.LittleEndian.PutUint32(b[32:], crc32.Checksum(b[:32], crcTable))
+		var table Table
+		if err := table.UnmarshalBinary(b); err != tt.want {
+			t.Errorf("UnmarshalBinary(bad %s): got err=%v; want %v", tt.name, err, tt.want)
+		}
+		if _, err := LoadBytes(b); err != tt.want {
+			t.Errorf("LoadBytes(bad %s): got err=%v; want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestReadFrom_checksum(t *testing.T) {
+	data, err := Build([]string{"foo", "bar", "baz"}).MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	// Flip a bit in the last key byte, which no structural check covers.
+	data[len(data)-5] ^= 1
+	var table Table
+	if _, err := table.ReadFrom(bytes.NewReader(data)); err != ErrCorrupt {
+		t.Errorf("ReadFrom: got err=%v; want %v", err, ErrCorrupt)
+	}
+	if err := table.UnmarshalBinary(data); err != ErrCorrupt {
+		t.Errorf("UnmarshalBinary: got err=%v; want %v", err, ErrCorrupt)
+	}
+}
+
+// The serialized form is canonical: the same keys produce the same bytes on
+// every architecture, regardless of the host byte order.
+const goldenTable = "4d504800010000004200000003000000010000000400000009000000000000006c4a8f5b00000000000000000000010002000000030000000300000003000000666f6f62617262617ad0021ea7"
+
+// goldenWide is goldenTable with 32-bit level1 indices, as written before
+// small tables had 16-bit ones, which must still load.
+const goldenWide = "4d5048000100000002000000030000000100000004000000090000000000000062b6fb46000000000000000000000000010000000200000000000000030000000300000003000000666f6f62617262617a2e1b06b3"
+
+func TestMarshalBinary_golden(t *testing.T) {
+	keys := []string{"foo", "bar", "baz"}
+	data, err := Build(keys).MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	if got := hex.EncodeToString(data); got != goldenTable {
+		t.Errorf("MarshalBinary:\ngot  %s\nwant %s", got, goldenTable)
+	}
+	for _, s := range []string{goldenTable, goldenWide} {
+		golden, _ := hex.DecodeString(s)
+		table, err := LoadBytes(golden)
+		if err != nil {
+			t.Fatalf("LoadBytes: %v", err)
+		}
+		checkTable(t, table, keys, []string{"quux"})
+	}
+}
+
+func TestMarshalBinary_hashOnly(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	full, err := Build(keys).MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	data, err := Build(keys).WithoutKeys().MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	if len(data) >= len(full) {
+		t.Errorf("hash-only size %d is not smaller than %d", len(data), len(full))
+	}
+	var table Table
+	if err := table.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	loaded, err := LoadBytes(data)
+	if err != nil {
+		t.Fatalf("LoadBytes: %v", err)
+	}
+	for _, tb := range []*Table{&table, loaded} {
+		for i, key := range keys {
+			n, ok := Lookup(tb, key)
+			if !ok || int(n) != i {
+				t.Errorf("Lookup(%s): got %d, %t; want %d, true", key, n, ok, i)
+			}
+		}
+		if _, _, err := LookupChecked(tb, keys[0]); err != ErrNoKeys {
+			t.Errorf("LookupChecked: got err=%v; want %v", err, ErrNoKeys)
+		}
+	}
+	if _, err := NewLazyTable(bytes.NewReader(data)); err != ErrNoKeys {
+		t.Errorf("NewLazyTable: got err=%v; want %v", err, ErrNoKeys)
+	}
+}
+
+func TestReadFrom_headerChecksum(t *testing.T) {
+	data, err := Build([]string{"foo", "bar", "baz"}).MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	// A corrupt key count must be caught before anything is allocated.
+	data[15] = 0x7f
+	var table Table
+	if _, err := table.ReadFrom(bytes.NewReader(data)); err != ErrCorrupt {
+		t.Errorf("ReadFrom: got err=%v; want %v", err, ErrCorrupt)
+	}
+}
+
+func TestWriteTo_allocs(t *testing.T) {
+	var keys []string
+	for i := 0; i < 10000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	table := Build(keys)
+	allocs := testing.AllocsPerRun(10, func() {
+		table.WriteTo(io.Discard)
+	})
+	if allocs > 2 {
+		t.Errorf("WriteTo: got %v allocs; want at most 2", allocs)
+	}
+}
+
+func TestLoadBytes_large(t *testing.T) {
+	var keys []string
+	for i := 0; i < 70000; i++ {
+		keys = append(keys, "key"+strconv.Itoa(i))
+	}
+	table := Build(keys)
+	data := mustMarshal(t, table)
+	loaded, err := LoadBytes(data)
+	if err != nil {
+		t.Fatalf("LoadBytes: %v", err)
+	}
+	lo, hi := span(data)
+	for i := range keys {
+		k, ok := loaded.Key(uint32(i))
+		if !ok || string(k) != keys[i] {
+			t.Fatalf("Key(%d): got %q, %t; want %q, true", i, k, ok, keys[i])
+		}
+		if p := uintptr(unsafe.Pointer(&k[0])); p < lo || p >= hi {
+			t.Fatalf("Key(%d): does not alias data", i)
+		}
+	}
+
+	var read, streamed Table
+	if err := read.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	// A reader that does not tell its size is read without an arena up
+	// front.
+	if _, err := streamed.ReadFrom(struct{ io.Reader }{bytes.NewReader(data)}); err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+	for name, got := range map[string]*Table{"LoadBytes": loaded, "UnmarshalBinary": &read, "ReadFrom": &streamed} {
+		if !Equal(got, table) {
+			t.Errorf("%s: got a different table", name)
+		}
+	}
+	checkContiguous(t, "ReadFrom", &streamed)
+	lazy, err := NewLazyTable(struct{ io.ReaderAt }{bytes.NewReader(data)})
+	if err != nil {
+		t.Fatalf("NewLazyTable: %v", err)
+	}
+	for _, i := range []int{0, 65535, 65536, len(keys) - 1} {
+		if n, ok, err := lazy.Lookup(keys[i]); err != nil || !ok || n != uint32(i) {
+			t.Errorf("NewLazyTable.Lookup(%s): got %d, %t, %v; want %d, true, <nil>", keys[i], n, ok, err, i)
+		}
+	}
+}
+
+func TestReadFrom_craftedHeader(t *testing.T) {
+	data := mustMarshal(t, Build([]string{"foo", "bar", "baz"}))
+	// A header with a valid checksum may still claim sizes that the data
+	// does not have.
+	for _, off := range []int{12, 16, 20} {
+		binary.LittleEndian.PutUint32(data[off:], 1<<28)
+	}
+	binary.LittleEndian.PutUint64(data[24:], 1<<31)
+	binary.LittleEndian.PutUint32(data[32:], crc32.Checksum(data[:32], crcTable))
+	if _, err := parseHeader(data); err != nil {
+		t.Fatalf("parseHeader: %v", err)
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	var table Table
+	if _, err := table.ReadFrom(struct{ io.Reader }{bytes.NewReader(data)}); err != io.ErrUnexpectedEOF {
+		t.Errorf("ReadFrom: got err=%v; want %v", err, io.ErrUnexpectedEOF)
+	}
+	if _, err := table.ReadFrom(bytes.NewReader(data)); err != io.ErrUnexpectedEOF {
+		t.Errorf("ReadFrom(bytes.Reader): got err=%v; want %v", err, io.ErrUnexpectedEOF)
+	}
+	if err := table.UnmarshalBinary(data); err != ErrCorrupt {
+		t.Errorf("UnmarshalBinary: got err=%v; want %v", err, ErrCorrupt)
+	}
+	if _, err := NewLazyTable(struct{ io.ReaderAt }{bytes.NewReader(data)}); err != io.ErrUnexpectedEOF {
+		t.Errorf("NewLazyTable: got err=%v; want %v", err, io.ErrUnexpectedEOF)
+	}
+	runtime.ReadMemStats(&after)
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<22 {
+		t.Errorf("decoding allocated %d bytes; want at most %d", n, 1<<22)
+	}
+}
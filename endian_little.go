@@ -0,0 +1,8 @@
+//go:build !(armbe || arm64be || m68k || mips || mips64 || mips64p32 || ppc || ppc64 || s390 || s390x || shbe || sparc || sparc64)
+
+package mph
+
+// hostLittleEndian reports whether the host stores integers in little-endian
+// byte order, which is the order used by the hash function and the
+// serialized format.
+const hostLittleEndian = true
@@ -0,0 +1,29 @@
+package mph
+
+// Equal reports whether a and b are structurally identical: they have the
+// same keys and level arrays, and so the same serialized form. Two nil
+// tables are equal; a nil table is not equal to a non-nil one.
+func Equal(a, b *Table) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.hashOnly != b.hashOnly || a.hash != b.hash || a.seed != b.seed || a.algo != b.algo || a.hashOrder != b.hashOrder || a.K() != b.K() || a.Len() != b.Len() {
+		return false
+	}
+	if !a.level0.equal(&b.level0) || !a.level1.equal(&b.level1) || !a.fingerprints.equal(&b.fingerprints) {
+		return false
+	}
+	return a.keys.equal(&b.keys)
+}
+
+func equalUint32s(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, v := range a {
+		if v != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,35 @@
+package mph
+
+import "testing"
+
+func TestEqual(t *testing.T) {
+	keys := []string{"foo", "foo2", "bar", "baz"}
+	table := Build(keys)
+	data, err := table.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	loaded, err := LoadBytes(data)
+	if err != nil {
+		t.Fatalf("LoadBytes: %v", err)
+	}
+	for _, tt := range []struct {
+		name string
+		a, b *Table
+		want bool
+	}{
+		{"rebuilt", table, Build(keys), true},
+		{"loaded", table, loaded, true},
+		{"clone", table, table.Clone(), true},
+		{"hash-only", table.WithoutKeys(), loaded.WithoutKeys(), true},
+		{"nil", nil, nil, true},
+		{"one nil", table, nil, false},
+		{"keys vs hash-only", table, table.WithoutKeys(), false},
+		{"other keys", table, Build([]string{"foo", "foo2", "bar", "quux"}), false},
+		{"other order", table, Build([]string{"foo2", "foo", "bar", "baz"}), false},
+	} {
+		if got := Equal(tt.a, tt.b); got != tt.want {
+			t.Errorf("Equal(%s): got %t; want %t", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package mph
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// WriteTSV writes one "index<TAB>key" line for each key in t, in index
+// order. TSV has no escaping, so WriteTSV returns an error if a key
+// contains a tab or newline; use WriteCSV for such keys.
+func (t *Table) WriteTSV(w io.Writer) error {
+	if t.hashOnly {
+		return ErrNoKeys
+	}
+	bw := bufio.NewWriter(w)
+	var num []byte
+	for i := 0; i < t.keys.len(); i++ {
+		k := t.keys.key(i)
+		if bytes.ContainsAny(k, "\t\r\n") {
+			return fmt.Errorf("mph: key %d (%q) cannot be written as TSV", i, k)
+		}
+		num = strconv.AppendInt(num[:0], int64(i), 10)
+		bw.Write(num)
+		bw.WriteByte('\t')
+		bw.Write(k)
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// WriteCSV writes one "index,key" record for each key in t, in index order,
+// quoting keys as needed.
+func (t *Table) WriteCSV(w io.Writer) error {
+	if t.hashOnly {
+		return ErrNoKeys
+	}
+	cw := csv.NewWriter(w)
+	for i := 0; i < t.keys.len(); i++ {
+		if err := cw.Write([]string{strconv.Itoa(i), string(t.keys.key(i))}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,31 @@
+package mph
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteTSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Build([]string{"foo", "bar baz", ""}).WriteTSV(&buf); err != nil {
+		t.Fatalf("WriteTSV: %v", err)
+	}
+	want := "0\tfoo\n1\tbar baz\n2\t\n"
+	if buf.String() != want {
+		t.Errorf("WriteTSV: got %q; want %q", buf.String(), want)
+	}
+	if err := Build([]string{"foo", "a\tb"}).WriteTSV(&buf); err == nil {
+		t.Errorf("WriteTSV with tab in key: got nil error")
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Build([]string{"foo", "a,b", "c\"d"}).WriteCSV(&buf); err != nil {
+		t.Fatalf("WriteCSV: %v", err)
+	}
+	want := "0,foo\n1,\"a,b\"\n2,\"c\"\"d\"\n"
+	if buf.String() != want {
+		t.Errorf("WriteCSV: got %q; want %q", buf.String(), want)
+	}
+}
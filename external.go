@@ -0,0 +1,525 @@
+package mph
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// BuildExternal builds a table from the lines of r, as BuildFromReader
+// does, and writes its serialized form to w without holding the keys in
+// memory. The keys are spilled to temporary files in dir, or in the default
+// directory for temporary files if dir is empty, and split into partitions
+// of consecutive level0 buckets, which are read back one at a time to find
+// the seeds. Only the level arrays, a few bytes per key, stay in memory
+// throughout. The table written is the same as BuildFromReader would build.
+//
+// WithDedup, WithVerify, WithMonotone, WithKPerfect, WithWeights,
+// WithStableIndices and WithRetries are not supported, nor are other
+// algorithms than CHD, and WithParallelism has no effect.
+func BuildExternal(w io.Writer, r io.Reader, dir string, opts ...Option) error {
+	return BuildExternalContext(context.Background(), w, r, dir, opts...)
+}
+
+// BuildExternalContext is like BuildExternal but may be canceled through
+// ctx, as for BuildContext.
+func BuildExternalContext(ctx context.Context, w io.Writer, r io.Reader, dir string, opts ...Option) error {
+	cfg := newBuildConfig(opts)
+	if cfg.dedup || cfg.verify || cfg.monotone {
+		return errors.New("mph: BuildExternal does not support WithDedup, WithVerify or WithMonotone")
+	}
+	if cfg.algorithm != CHD {
+		return fmt.Errorf("mph: BuildExternal does not support the %v algorithm", cfg.algorithm)
+	}
+	if cfg.k > 1 {
+		return errors.New("mph: BuildExternal does not support k-perfect tables")
+	}
+	if cfg.weights != nil || cfg.stable != nil || cfg.retries > 0 {
+		return errors.New("mph: BuildExternal does not support WithWeights, WithStableIndices or WithRetries")
+	}
+	if err := cfg.check(); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(dir, "mph-build-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	x := externalBuild{cfg: cfg, dir: tmp}
+	if err := x.spill(r); err != nil {
+		return err
+	}
+	if err := x.partition(ctx); err != nil {
+		return err
+	}
+	t, err := x.place(ctx)
+	if err != nil {
+		return err
+	}
+	return x.write(w, t)
+}
+
+// externalPartitionKeys is the number of keys that BuildExternal aims to
+// put in each partition. It is a variable so that tests can exercise many
+// partitions with few keys.
+var externalPartitionKeys = 1 << 20
+
+// maxExternalPartitions bounds the number of partition files that are open
+// at once.
+const maxExternalPartitions = 256
+
+// An externalBuild holds the state of BuildExternal. Each partition file
+// holds the buckets of the partition, largest first and in slot order among
+// buckets of the same size, as records of
+//
+//	slot  uint32
+//	then, for each key of the bucket:
+//	index uint32
+//	hash  uint64
+//	len   uint32  only if keys are stored
+//	key   []byte  only if keys are stored
+//
+// Keys are only stored for hashes that need them to place a bucket.
+type externalBuild struct {
+	cfg  *buildConfig
+	dir  string
+	n    int    // number of keys
+	size uint64 // total length of the keys
+
+	n0, n1  int
+	parts   []string   // partition file names
+	classes [][]extent // classes[p][s] locates the buckets of s keys in parts[p]
+	maxSize int        // largest bucket size
+	nonzero int        // number of non-empty buckets
+}
+
+// An extent is a range of bytes in a file.
+type extent struct {
+	off, len int64
+}
+
+func (x *externalBuild) path(name string) string {
+	return filepath.Join(x.dir, name)
+}
+
+func (x *externalBuild) storesKeys() bool {
+	return x.cfg.hash != Wyhash
+}
+
+// spill copies the keys on the lines of r to the files "lens" and "keys",
+// which hold the key lengths and key bytes in the serialized form.
+func (x *externalBuild) spill(r io.Reader) error {
+	lens, err := newSpillFile(x.path("lens"))
+	if err != nil {
+		return err
+	}
+	defer lens.f.Close()
+	keys, err := newSpillFile(x.path("keys"))
+	if err != nil {
+		return err
+	}
+	defer keys.f.Close()
+	err = x.cfg.readLines(r, func(key []byte) error {
+		if x.cfg.normalize != nil {
+			key = x.cfg.normalize(append([]byte(nil), key...))
+		}
+		x.n++
+		if uint64(x.n) >= math.MaxUint32 {
+			return errTooManyKeys
+		}
+		x.size += uint64(len(key))
+		if x.size > math.MaxUint32 {
+			return errPoolTooLarge
+		}
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], uint32(len(key)))
+		lens.w.Write(b[:])
+		_, err := keys.w.Write(key)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := lens.close(); err != nil {
+		return err
+	}
+	return keys.close()
+}
+
+// A spillFile is a temporary file being written.
+type spillFile struct {
+	f *os.File
+	w *bufio.Writer
+}
+
+func newSpillFile(name string) (*spillFile, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &spillFile{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+func (s *spillFile) close() error {
+	if err := s.w.Flush(); err != nil {
+		s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
+
+// eachKey calls fn with the index and bytes of each spilled key. The key is
+// only valid until fn returns.
+func (x *externalBuild) eachKey(fn func(i int, key []byte) error) error {
+	lf, err := os.Open(x.path("lens"))
+	if err != nil {
+		return err
+	}
+	defer lf.Close()
+	kf, err := os.Open(x.path("keys"))
+	if err != nil {
+		return err
+	}
+	defer kf.Close()
+	lr, kr := bufio.NewReader(lf), bufio.NewReader(kf)
+	var b [4]byte
+	var key []byte
+	for i := 0; i < x.n; i++ {
+		if _, err := io.ReadFull(lr, b[:]); err != nil {
+			return err
+		}
+		l := int(binary.LittleEndian.Uint32(b[:]))
+		if cap(key) < l {
+			key = make([]byte, l)
+		}
+		key = key[:l]
+		if _, err := io.ReadFull(kr, key); err != nil {
+			return err
+		}
+		if err := fn(i, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// partition hashes the spilled keys into partition files of consecutive
+// level0 buckets, checks each for duplicates, and sorts its buckets.
+func (x *externalBuild) partition(ctx context.Context) error {
+	x.n0, x.n1 = x.cfg.level0Len(x.n), x.cfg.level1Len(x.n)
+	nparts := nextPow2((x.n + externalPartitionKeys - 1) / externalPartitionKeys)
+	if nparts > maxExternalPartitions {
+		nparts = maxExternalPartitions
+	}
+	if nparts > x.n0 {
+		nparts = x.n0
+	}
+	// The last partition is short if nparts does not divide x.n0, which
+	// is only a power of 2 by default.
+	perPart := (x.n0 + nparts - 1) / nparts
+	nparts = (x.n0 + perPart - 1) / perPart
+	files := make([]*spillFile, nparts)
+	defer func() {
+		for _, f := range files {
+			if f != nil {
+				f.f.Close()
+			}
+		}
+	}()
+	for p := range files {
+		var err error
+		if files[p], err = newSpillFile(x.path("raw" + strconv.Itoa(p))); err != nil {
+			return err
+		}
+	}
+	slots0 := newSlotMap(x.n0)
+	err := x.eachKey(func(i int, key []byte) error {
+		if i%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		kh := keyHash(x.cfg.hash, x.cfg.seed, key)
+		var b [16]byte
+		binary.LittleEndian.PutUint64(b[:], kh)
+		binary.LittleEndian.PutUint32(b[8:], uint32(i))
+		binary.LittleEndian.PutUint32(b[12:], uint32(len(key)))
+		w := files[slots0.slot(uint32(kh))/perPart].w
+		w.Write(b[:])
+		_, err := w.Write(key)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for p, f := range files {
+		files[p] = nil
+		if err := f.close(); err != nil {
+			return err
+		}
+	}
+
+	var first *DuplicateKeyError
+	for p := 0; p < nparts; p++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n := perPart
+		if rest := x.n0 - p*perPart; rest < n {
+			n = rest
+		}
+		dup, err := x.sortPartition(p, p*perPart, n)
+		if err != nil {
+			return err
+		}
+		if dup != nil && (first == nil || dup.Second < first.Second) {
+			first = dup
+		}
+	}
+	if first != nil {
+		return first
+	}
+	return nil
+}
+
+// sortPartition reads the raw records of partition p, whose buckets are the
+// n level0 buckets from base on, and writes them as buckets to the
+// partition file. It returns the duplicate key with the smallest second
+// position in the partition, if any.
+func (x *externalBuild) sortPartition(p, base, n int) (*DuplicateKeyError, error) {
+	raw := x.path("raw" + strconv.Itoa(p))
+	data, err := os.ReadFile(raw)
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(raw)
+	var (
+		hashes []uint64
+		index  []uint32
+		keys   [][]byte
+		slots  []uint32
+	)
+	slots0 := newSlotMap(x.n0)
+	for len(data) > 0 {
+		kh := binary.LittleEndian.Uint64(data)
+		l := binary.LittleEndian.Uint32(data[12:])
+		hashes = append(hashes, kh)
+		index = append(index, binary.LittleEndian.Uint32(data[8:]))
+		keys = append(keys, data[16:16+l:16+l])
+		slots = append(slots, uint32(slots0.slot(uint32(kh))-base))
+		data = data[16+l:]
+	}
+	buckets := newBucketIndex(slots, n)
+
+	// Keys are in index order in each bucket, so this finds the same
+	// duplicates as the duplicates function.
+	var dup *DuplicateKeyError
+	for b := 0; b < n; b++ {
+		vals := buckets.bucket(b)
+		for j, v := range vals {
+			for _, u := range vals[:j] {
+				if string(keys[u]) == string(keys[v]) {
+					if dup == nil || int(index[v]) < dup.Second {
+						dup = &DuplicateKeyError{Key: keys[v], First: int(index[u]), Second: int(index[v])}
+					}
+					break
+				}
+			}
+		}
+	}
+	if dup != nil {
+		return dup, nil
+	}
+
+	name := x.path("part" + strconv.Itoa(p))
+	f, err := newSpillFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var classes []extent
+	var off int64
+	var b [16]byte
+	for _, bucket := range buckets.bySize(nil) {
+		size := len(bucket.vals)
+		for len(classes) <= size {
+			classes = append(classes, extent{})
+		}
+		if classes[size].len == 0 {
+			classes[size].off = off // the first bucket of its size
+		}
+		binary.LittleEndian.PutUint32(b[:], uint32(base+bucket.n))
+		f.w.Write(b[:4])
+		off += 4
+		for _, v := range bucket.vals {
+			binary.LittleEndian.PutUint32(b[:], index[v])
+			binary.LittleEndian.PutUint64(b[4:], hashes[v])
+			f.w.Write(b[:12])
+			off += 12
+			if x.storesKeys() {
+				binary.LittleEndian.PutUint32(b[:], uint32(len(keys[v])))
+				f.w.Write(b[:4])
+				f.w.Write(keys[v])
+				off += 4 + int64(len(keys[v]))
+			}
+		}
+		classes[size].len = off - classes[size].off
+		x.nonzero++
+	}
+	if err := f.close(); err != nil {
+		return nil, err
+	}
+	if len(classes)-1 > x.maxSize {
+		x.maxSize = len(classes) - 1
+	}
+	x.parts = append(x.parts, name)
+	x.classes = append(x.classes, classes)
+	return nil, nil
+}
+
+// place finds the seeds of all buckets in the same order as the place
+// function: for each bucket size, largest first, it reads the buckets of
+// that size from every partition in turn.
+func (x *externalBuild) place(ctx context.Context) (*Table, error) {
+	level0 := make([]uint32, x.n0)
+	level1 := make([]uint32, x.n1)
+	occ := newBitset(x.n1)
+	slots1 := newSlotMap(x.n1)
+	limit := x.cfg.seedLimit()
+
+	var (
+		buf    []byte
+		index  []uint32
+		hashes []uint64
+		keys   [][]byte
+		vals   []uint32
+		slots  []int
+		done   int
+	)
+	hash := func(i int, seed uint32) uint32 {
+		return level1Hash(x.cfg.hash, hashes[i], seed, keys[i])
+	}
+	for size := x.maxSize; size > 0; size-- {
+		vals = vals[:0]
+		for i := 0; i < size; i++ {
+			vals = append(vals, uint32(i))
+		}
+		index, hashes, keys = make([]uint32, size), make([]uint64, size), make([][]byte, size)
+		for p, name := range x.parts {
+			if size >= len(x.classes[p]) || x.classes[p][size].len == 0 {
+				continue
+			}
+			var err error
+			if buf, err = readExtent(name, x.classes[p][size], buf); err != nil {
+				return nil, err
+			}
+			for data := buf; len(data) > 0; {
+				if done%ctxCheckInterval == 0 {
+					if err := ctx.Err(); err != nil {
+						return nil, err
+					}
+				}
+				slot := binary.LittleEndian.Uint32(data)
+				data = data[4:]
+				for i := 0; i < size; i++ {
+					index[i] = binary.LittleEndian.Uint32(data)
+					hashes[i] = binary.LittleEndian.Uint64(data[4:])
+					data = data[12:]
+					if x.storesKeys() {
+						l := binary.LittleEndian.Uint32(data)
+						keys[i] = data[4 : 4+l]
+						data = data[4+l:]
+					}
+				}
+				var seed uint64
+				seed, slots = findSeed(occ, slots1, vals, hash, 0, limit, slots)
+				if seed == limit {
+					return nil, ErrBuildFailed
+				}
+				for i, n := range slots {
+					occ.set(n)
+					level1[n] = index[i]
+				}
+				level0[slot] = uint32(seed)
+				done++
+				if x.cfg.progress != nil {
+					x.cfg.progress(done, x.nonzero)
+				}
+			}
+		}
+	}
+	t := &Table{
+		level0:      x.cfg.seeds(level0),
+		level0Slots: newSlotMap(x.n0),
+		level1:      x.cfg.indices(level1, x.n),
+		level1Slots: slots1,
+		hash:        x.cfg.hash,
+		seed:        x.cfg.seed,
+	}
+	a, err := allocArena(t.arenaSize(true), x.cfg.alloc)
+	if err != nil {
+		return nil, err
+	}
+	t.compactInto(&a, true)
+	return t, nil
+}
+
+// readExtent reads e from the named file into buf, which it grows as
+// needed and returns.
+func readExtent(name string, e extent, buf []byte) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if int64(cap(buf)) < e.len {
+		buf = make([]byte, e.len)
+	}
+	buf = buf[:e.len]
+	if _, err := f.ReadAt(buf, e.off); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// write writes t, which holds the level arrays, to w with the spilled keys.
+func (x *externalBuild) write(w io.Writer, t *Table) error {
+	h := t.header()
+	h.nkeys = uint32(x.n)
+	h.keyBytes = x.size
+	e := encoder{w: w, buf: make([]byte, headerSize, encodeBufSize)}
+	t.encodeLevels(&e, h)
+	for _, name := range []string{"lens", "keys"} {
+		if err := e.copyFile(x.path(name)); err != nil {
+			return err
+		}
+	}
+	_, err := e.finish()
+	return err
+}
+
+// copyFile writes the contents of the named file to e.
+func (e *encoder) copyFile(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var buf [encodeBufSize]byte
+	for {
+		n, err := f.Read(buf[:])
+		e.bytes(buf[:n])
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package mph
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestBuildExternal(t *testing.T) {
+	defer func(n int) { externalPartitionKeys = n }(externalPartitionKeys)
+	externalPartitionKeys = 100
+
+	var lines strings.Builder
+	for i := 0; i < 5000; i++ {
+		lines.WriteString(strings.Repeat("x", i%7) + strconv.Itoa(i) + "\n")
+	}
+	lines.WriteString(" spaced \n# comment\n")
+	for _, tt := range []struct {
+		name string
+		opts []Option
+	}{
+		{"default", nil},
+		{"wyhash", []Option{WithHash(Wyhash)}},
+		{"packed", []Option{WithPackedIndices(), WithLoadFactor(0.8)}},
+		{"normalized", []Option{WithNormalizer(bytes.ToUpper)}},
+		{"exact", []Option{WithExactSizes(), WithBucketSize(3)}},
+		{"seeded", []Option{WithSeed(42)}},
+		{"compressed", []Option{WithCompressedSeeds()}},
+		{"front coded", []Option{WithFrontCoding()}},
+		{"borrowed", []Option{WithBorrowedKeys()}},
+		{"lines", []Option{WithTrimSpace(), WithComments("#")}},
+		{"max seeds", []Option{WithMaxSeedAttempts(1 << 20)}},
+		{"parallel", []Option{WithParallelism(4)}},
+		{"allocator", []Option{WithAllocator(func(size int) []byte { return make([]byte, size) })}},
+	} {
+		var wantProgress int
+		wantOpts := append(tt.opts, WithProgress(func(done, total int) { wantProgress = total }))
+		want, err := BuildFromReader(strings.NewReader(lines.String()), wantOpts...)
+		if err != nil {
+			t.Fatalf("%s: BuildFromReader: %v", tt.name, err)
+		}
+		wantData, err := want.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%s: MarshalBinary: %v", tt.name, err)
+		}
+		var progress int
+		opts := append(tt.opts, WithProgress(func(done, total int) { progress = done }))
+		var buf bytes.Buffer
+		if err := BuildExternal(&buf, strings.NewReader(lines.String()), t.TempDir(), opts...); err != nil {
+			t.Fatalf("%s: BuildExternal: %v", tt.name, err)
+		}
+		if !bytes.Equal(buf.Bytes(), wantData) {
+			t.Errorf("%s: BuildExternal differs from BuildFromReader", tt.name)
+		}
+		if progress != wantProgress {
+			t.Errorf("%s: progress ended at %d; want %d", tt.name, progress, wantProgress)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := BuildExternal(&buf, strings.NewReader(""), t.TempDir()); err != nil {
+		t.Fatalf("BuildExternal(empty): %v", err)
+	}
+	if table, err := LoadBytes(buf.Bytes()); err != nil || table.Len() != 0 {
+		t.Errorf("BuildExternal(empty): got %v, %v; want an empty table", table, err)
+	}
+}
+
+func TestBuildExternal_errors(t *testing.T) {
+	defer func(n int) { externalPartitionKeys = n }(externalPartitionKeys)
+	externalPartitionKeys = 2
+
+	input := "a\nb\nc\nd\nb\ne\na\n"
+	_, want := BuildFromReader(strings.NewReader(input))
+	err := BuildExternal(new(bytes.Buffer), strings.NewReader(input), t.TempDir())
+	var dup *DuplicateKeyError
+	if !errors.As(err, &dup) || err.Error() != want.Error() {
+		t.Errorf("BuildExternal with duplicates: got err=%v; want %v", err, want)
+	}
+	prev := Build([]string{"a"})
+	for name, opt := range map[string]Option{
+		"WithDedup":         WithDedup(nil),
+		"WithWeights":       WithWeights([]float64{1}),
+		"WithStableIndices": WithStableIndices(prev),
+		"WithRetries":       WithRetries(1),
+	} {
+		if err := BuildExternal(new(bytes.Buffer), strings.NewReader("a\n"), t.TempDir(), opt); err == nil {
+			t.Errorf("BuildExternal(%s): got nil error", name)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := BuildExternalContext(ctx, new(bytes.Buffer), strings.NewReader(input), t.TempDir()); err != context.Canceled {
+		t.Errorf("BuildExternalContext(canceled): got err=%v; want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,43 @@
+package mph
+
+// A slotMap maps 32-bit hashes onto the slots of a level array. If the
+// array has a power of 2 size, the low bits of a hash select the slot;
+// otherwise the slot is the high half of the 64-bit product of the hash
+// and the size, which is Lemire's multiply-shift reduction ("fastrange")
+// and costs one multiplication instead of a division.
+type slotMap struct {
+	mask int    // n-1 if n is a power of 2, or -1
+	n    uint64 // number of slots
+}
+
+func newSlotMap(n int) slotMap {
+	m := slotMap{mask: -1, n: uint64(n)}
+	if isPow2(n) {
+		m.mask = n - 1
+	}
+	return m
+}
+
+// slot returns the slot of h.
+func (m slotMap) slot(h uint32) int {
+	if m.mask >= 0 {
+		return int(h) & m.mask
+	}
+	return int(uint64(h) * m.n >> 32)
+}
+
+// WithExactSizes makes BuildWithOptions size level0 and level1 exactly,
+// at nkeys/keysPerBucket and nkeys/loadFactor slots (see WithBucketSize and
+// WithLoadFactor), instead of rounding them up to powers of 2, which can
+// nearly double the size of a table whose number of keys is just above a
+// power of 2. By default level1 then has exactly one slot per key. Slots
+// of an array whose size is not a power of 2 are selected by a
+// multiplication rather than a mask; for 69632 keys, the table shrinks
+// from 68 to 36 bits per key and lookups are no slower, since the smaller
+// arrays miss the cache less (see BenchmarkLookup_exactSizes). Code
+// generated by GenC only masks, so GenC refuses such tables.
+func WithExactSizes() Option {
+	return func(c *buildConfig) {
+		c.exactSizes = true
+	}
+}
@@ -0,0 +1,124 @@
+package mph
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"testing"
+)
+
+func TestSlotMap(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 1000, 1 << 20, 1<<20 + 1} {
+		m := newSlotMap(n)
+		if pow2 := m.mask >= 0; pow2 != isPow2(n) {
+			t.Errorf("newSlotMap(%d): got mask %d", n, m.mask)
+		}
+		var seen []bool
+		if n <= 1000 {
+			seen = make([]bool, n)
+		}
+		for i := uint64(0); i < 1<<32; i += 1<<32/4096 + 7 {
+			s := m.slot(uint32(i))
+			if s < 0 || s >= n {
+				t.Fatalf("newSlotMap(%d).slot(%d) = %d; want < %d", n, i, s, n)
+			}
+			if seen != nil {
+				seen[s] = true
+			}
+		}
+		if got := m.slot(1<<32 - 1); got != n-1 {
+			t.Errorf("newSlotMap(%d).slot(max) = %d; want %d", n, got, n-1)
+		}
+		for s, ok := range seen {
+			if !ok {
+				t.Errorf("newSlotMap(%d): slot %d is never selected", n, s)
+			}
+		}
+	}
+}
+
+func TestWithExactSizes(t *testing.T) {
+	keys := make([]string, 1100)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+	}
+	for _, tt := range []struct {
+		name      string
+		opts      []Option
+		want0, n1 int
+	}{
+		{"default", nil, 275, 1100},
+		{"wyhash", []Option{WithHash(Wyhash)}, 275, 1100},
+		{"parallel", []Option{WithParallelism(4)}, 275, 1100},
+		{"sized", []Option{WithBucketSize(5), WithLoadFactor(0.9)}, 220, 1223},
+	} {
+		table, err := BuildWithOptions(keys, append(tt.opts, WithExactSizes())...)
+		if err != nil {
+			t.Fatalf("%s: BuildWithOptions: %v", tt.name, err)
+		}
+		s := table.Stats()
+		if s.Level0Len != tt.want0 || s.Level1Len != tt.n1 {
+			t.Errorf("%s: got levels of %d and %d; want %d and %d", tt.name, s.Level0Len, s.Level1Len, tt.want0, tt.n1)
+		}
+		checkTable(t, table, keys, []string{"quux", "key1100"})
+
+		data := mustMarshal(t, table)
+		loaded, err := LoadBytes(data)
+		if err != nil {
+			t.Fatalf("%s: LoadBytes: %v", tt.name, err)
+		}
+		var read Table
+		if _, err := read.ReadFrom(bytes.NewReader(data)); err != nil {
+			t.Fatalf("%s: ReadFrom: %v", tt.name, err)
+		}
+		for _, got := range []*Table{loaded, &read} {
+			if !Equal(got, table) {
+				t.Errorf("%s: decoded table differs", tt.name)
+			}
+			checkTable(t, got, keys, []string{"quux"})
+		}
+	}
+
+	plain := Build(keys)
+	exact, err := BuildWithOptions(keys, WithExactSizes())
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	if got, want := exact.Stats().Size, plain.Stats().Size; got >= want {
+		t.Errorf("Stats: exact size %d is not smaller than %d", got, want)
+	}
+	if err := exact.GenC(io.Discard, "t"); err == nil {
+		t.Errorf("GenC(exact sizes): got nil error")
+	}
+	empty, err := BuildWithOptions([]string{}, WithExactSizes())
+	if err != nil {
+		t.Fatalf("BuildWithOptions(empty): %v", err)
+	}
+	if _, ok := empty.Lookup("foo"); ok {
+		t.Errorf("Lookup(foo) in an empty table: got ok")
+	}
+}
+
+func BenchmarkLookup_exactSizes(b *testing.B) {
+	// Just above a power of 2, where rounding up costs the most.
+	keys := make([]string, 1<<16+1<<12)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+	}
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{{"pow2", nil}, {"exact", []Option{WithExactSizes()}}} {
+		table, err := BuildWithOptions(keys, bc.opts...)
+		if err != nil {
+			b.Fatal(err)
+		}
+		s := table.Stats()
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportMetric(s.BitsPerKey, "bits/key")
+			for i := 0; i < b.N; i++ {
+				table.Lookup(keys[i%len(keys)])
+			}
+		})
+	}
+}
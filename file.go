@@ -0,0 +1,145 @@
+package mph
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// WriteFile writes the serialized form of t to the named file. The table is
+// written to a temporary file in the same directory, synced to disk, and
+// then renamed to name, so a crash or a concurrent reader never observes a
+// partially written table.
+//
+// A file that replaces an existing one keeps its permissions. A new file is
+// created with mode 0666, before umask, as by os.Create.
+func (t *Table) WriteFile(name string) (err error) {
+	dir, base := filepath.Split(name)
+	if dir == "" {
+		dir = "."
+	}
+	perm, keep := fs.FileMode(0o666), false
+	if fi, err := os.Stat(name); err == nil {
+		perm, keep = fi.Mode().Perm(), true
+	}
+	f, err := createTemp(dir, base+".tmp", perm)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	w := bufio.NewWriter(f)
+	if _, err := t.WriteTo(w); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if keep {
+		// The umask applied by createTemp may have cleared some of the
+		// bits of the file being replaced.
+		if err := f.Chmod(perm); err != nil {
+			return err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), name); err != nil {
+		return err
+	}
+	// Sync the directory so that the rename itself is durable. Not every
+	// platform supports this, so failures are ignored.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// createTemp creates a new file in dir whose name begins with prefix, with
+// mode perm before umask. Unlike os.CreateTemp, which always uses 0600, it
+// lets WriteFile give a new table the mode os.Create would.
+func createTemp(dir, prefix string, perm fs.FileMode) (*os.File, error) {
+	for try := 0; ; try++ {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10))
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if errors.Is(err, fs.ErrExist) && try < 10000 {
+			continue
+		}
+		return f, err
+	}
+}
+
+// ReadFile reads the table stored in the named file, as written by WriteFile
+// or WriteTo. The options configure how the table is decoded; see
+// WithDecodeParallelism and WithDecodeAllocator.
+func ReadFile(name string, opts ...DecodeOption) (*Table, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cfg := newDecodeConfig(opts)
+	if cfg.parallelism > 1 {
+		fi, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		return decodeAt(f, fi.Size(), cfg)
+	}
+	return readTable(f, fileSize(f), cfg.alloc)
+}
+
+// Load reads the table stored in the named file of fsys, as written by
+// WriteFile or WriteTo. It allows tables to be loaded uniformly from
+// embed.FS, zip archives, or test fixtures.
+func Load(fsys fs.FS, name string) (*Table, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readTable(f, fileSize(f), nil)
+}
+
+// fileSize returns the size of f, or -1 if it is not known, as for a pipe.
+func fileSize(f fs.File) int64 {
+	if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+		return fi.Size()
+	}
+	return -1
+}
+
+// readTable reads a table from f, which holds size bytes, or an unknown
+// number if size is negative, and must hold nothing else, with its arena
+// from alloc.
+func readTable(f io.Reader, size int64, alloc func(size int) []byte) (*Table, error) {
+	r := bufio.NewReader(f)
+	var t Table
+	if _, err := t.readFrom(r, size, alloc); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = ErrCorrupt
+		}
+		return nil, err
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		if err == nil {
+			err = ErrCorrupt
+		}
+		return nil, err
+	}
+	return &t, nil
+}
@@ -0,0 +1,120 @@
+package mph
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWriteFile(t *testing.T) {
+	keys := []string{"foo", "foo2", "bar", "baz"}
+	dir := t.TempDir()
+	name := filepath.Join(dir, "table.mph")
+	if err := os.WriteFile(name, []byte("old contents"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Build(keys).WriteFile(name); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	table, err := ReadFile(name)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	checkTable(t, table, keys, []string{"quux"})
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("WriteFile left %d files in the directory; want 1", len(entries))
+	}
+}
+
+func TestWriteFile_mode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not supported on windows")
+	}
+	dir := t.TempDir()
+	table := Build([]string{"foo", "bar"})
+	mode := func(name string) fs.FileMode {
+		t.Helper()
+		fi, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi.Mode().Perm()
+	}
+
+	// A new file gets the mode os.Create would give it.
+	ref := filepath.Join(dir, "ref")
+	f, err := os.Create(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	name := filepath.Join(dir, "new.mph")
+	if err := table.WriteFile(name); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if got, want := mode(name), mode(ref); got != want {
+		t.Errorf("WriteFile(new): got mode %v; want %v", got, want)
+	}
+
+	// A replaced file keeps its mode.
+	for _, perm := range []fs.FileMode{0o600, 0o640, 0o755} {
+		name := filepath.Join(dir, "old.mph")
+		if err := os.WriteFile(name, []byte("old contents"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(name, perm); err != nil {
+			t.Fatal(err)
+		}
+		if err := table.WriteFile(name); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		if got := mode(name); got != perm {
+			t.Errorf("WriteFile(%v): got mode %v; want %v", perm, got, perm)
+		}
+	}
+}
+
+func TestReadFile_trailingData(t *testing.T) {
+	data, err := Build([]string{"foo", "bar"}).MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	name := filepath.Join(t.TempDir(), "table.mph")
+	if err := os.WriteFile(name, append(data, 0), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadFile(name); err != ErrCorrupt {
+		t.Errorf("ReadFile: got err=%v; want %v", err, ErrCorrupt)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	keys := []string{"foo", "foo2", "bar", "baz"}
+	data, err := Build(keys).MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	fsys := fstest.MapFS{
+		"dict/words.mph": &fstest.MapFile{Data: data},
+		"dict/bad.mph":   &fstest.MapFile{Data: data[:len(data)-1]},
+	}
+	table, err := Load(fsys, "dict/words.mph")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	checkTable(t, table, keys, []string{"quux"})
+	if _, err := Load(fsys, "dict/bad.mph"); err != ErrCorrupt {
+		t.Errorf("Load(bad): got err=%v; want %v", err, ErrCorrupt)
+	}
+	if _, err := Load(fsys, "dict/missing.mph"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Load(missing): got err=%v; want %v", err, fs.ErrNotExist)
+	}
+}
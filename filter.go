@@ -0,0 +1,337 @@
+package mph
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// A Filter is a binary fuse filter, as in "Binary Fuse Filters: Fast and
+// Smaller Than Xor Filters" (Graf and Lemire, 2022), of the keys of a
+// Table: an approximate set that finds every key it was built from, and
+// finds any other key with probability about 2^-bits, for bits bits per
+// fingerprint, 8 or 16, in 1.125 times that many bits per key for large
+// sets, and a little more for smaller ones, with three loads that do not
+// depend on one another. Unlike a table, it has no
+// indices and does not store the keys, so it can stand in for the table
+// where most queries miss, or be shipped to where the table is not.
+//
+// A Filter is immutable and safe for concurrent use.
+type Filter struct {
+	hash      Hash
+	normalize func([]byte) []byte
+	nkeys     int
+	seed      uint64
+	segLen    uint32 // a power of 2
+	segCount  uint32 // number of segments that the first probe falls in
+	b8        []uint8
+	b16       []uint16
+}
+
+// Bounds on the layout of a Filter. Larger segments make no difference to
+// the build beyond maxFilterSegment; maxFilterAttempts bounds the seeds
+// tried, each of which fails with tiny probability.
+const (
+	maxFilterSegment  = 1 << 18
+	maxFilterAttempts = 100
+)
+
+// BuildWithFilter is like BuildWithOptions but also returns a Filter of the
+// keys, with fingerprints of bits bits, as Table.Filter builds it.
+func BuildWithFilter[T ~string | ~[]byte](keys []T, bits int, opts ...Option) (*Table, *Filter, error) {
+	t, err := BuildWithOptions(keys, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := t.Filter(bits)
+	if err != nil {
+		return nil, nil, err
+	}
+	return t, f, nil
+}
+
+// Filter returns a binary fuse filter of the keys of t with fingerprints of
+// bits bits, which must be 8 or 16. The filter hashes and normalizes keys
+// as t does. Filter returns ErrNoKeys if t is hash-only.
+func (t *Table) Filter(bits int) (*Filter, error) {
+	if t.hashOnly {
+		return nil, ErrNoKeys
+	}
+	if bits != 8 && bits != 16 {
+		return nil, errors.New("mph: filter fingerprints must have 8 or 16 bits")
+	}
+	hashes := make([]uint64, t.keys.len())
+	for i := range hashes {
+		k := t.keys.key(i)
+		hashes[i] = wideKeyHash(t.hash, keyHash(t.hash, 0, k), k)
+	}
+	// Distinct keys whose hashes collide need, and get, only one entry.
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+	n := 0
+	for i, h := range hashes {
+		if i == 0 || h != hashes[n-1] {
+			hashes[n] = h
+			n++
+		}
+	}
+	f := newFilter(n)
+	f.hash, f.normalize, f.nkeys = t.hash, t.normalize, t.keys.len()
+	fps, err := f.populate(hashes[:n])
+	if err != nil {
+		return nil, err
+	}
+	if bits == 8 {
+		f.b8 = make([]uint8, len(fps))
+		for i, v := range fps {
+			f.b8[i] = uint8(v)
+		}
+	} else {
+		f.b16 = fps
+	}
+	return f, nil
+}
+
+// newFilter returns a Filter laid out for n hashes, with no fingerprints.
+// The sizes are those of the reference implementation, for arity 3.
+func newFilter(n int) *Filter {
+	f := &Filter{segLen: 4}
+	if n > 0 {
+		f.segLen = 1 << int(math.Floor(math.Log(float64(n))/math.Log(3.33)+2.25))
+	}
+	if f.segLen > maxFilterSegment {
+		f.segLen = maxFilterSegment
+	}
+	capacity := 0
+	if n > 1 {
+		factor := math.Max(1.125, 0.875+0.25*math.Log(1e6)/math.Log(float64(n)))
+		capacity = int(math.Round(float64(n) * factor))
+	}
+	segs := (capacity+int(f.segLen)-1)/int(f.segLen) - 2
+	if segs < 1 {
+		segs = 1
+	}
+	f.segCount = uint32(segs)
+	return f
+}
+
+// arrayLen returns the number of fingerprints of f.
+func (f *Filter) arrayLen() int {
+	return (int(f.segCount) + 2) * int(f.segLen)
+}
+
+// fuseHash returns the hash of f of the key whose wide key hash is h.
+func (f *Filter) fuseHash(h uint64) uint64 {
+	return fmix64(h + f.seed)
+}
+
+// fmix64 is the finalizer of the 64-bit Murmur3 hash.
+func fmix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// probes returns the three fingerprints that the key whose hash of f is h
+// maps to: one in each of three consecutive segments.
+func (f *Filter) probes(h uint64) [3]uint32 {
+	hi, _ := bits.Mul64(h, uint64(f.segCount)*uint64(f.segLen))
+	h0 := uint32(hi)
+	h1 := h0 + f.segLen
+	h2 := h1 + f.segLen
+	mask := f.segLen - 1
+	return [3]uint32{h0, h1 ^ uint32(h>>18)&mask, h2 ^ uint32(h)&mask}
+}
+
+// fingerprint returns the fingerprint of the key whose hash of f is h.
+func fingerprint(h uint64) uint16 {
+	return uint16(h ^ h>>32)
+}
+
+// populate finds a seed for f with which each of hashes can be given one
+// of its three fingerprints, so that the three xor to the fingerprint of
+// the hash, and returns the fingerprints. hashes must be distinct.
+func (f *Filter) populate(hashes []uint64) ([]uint16, error) {
+	size := f.arrayLen()
+	// count[i] holds four times the number of hashes that map to
+	// fingerprint i, plus the xor of which of its three probes i is for
+	// each of them, and xor the xor of their hashes. Once a fingerprint is
+	// left with one hash, these say which hash and which probe.
+	count := make([]uint32, size)
+	xor := make([]uint64, size)
+	queue := make([]uint32, 0, size)
+	order := make([]uint64, 0, len(hashes)) // hashes in peeling order
+	which := make([]uint8, 0, len(hashes))
+	rng := uint64(0x726b2b9d438b9d4d)
+	for attempt := 0; attempt < maxFilterAttempts; attempt++ {
+		rng += 0x9e3779b97f4a7c15
+		f.seed = fmix64(rng)
+		for i := range count {
+			count[i], xor[i] = 0, 0
+		}
+		for _, kh := range hashes {
+			h := f.fuseHash(kh)
+			for j, p := range f.probes(h) {
+				count[p] += 4
+				count[p] ^= uint32(j)
+				xor[p] ^= h
+			}
+		}
+		queue, order, which = queue[:0], order[:0], which[:0]
+		for i, c := range count {
+			if c>>2 == 1 {
+				queue = append(queue, uint32(i))
+			}
+		}
+		for len(queue) > 0 {
+			i := queue[len(queue)-1]
+			queue = queue[:len(queue)-1]
+			if count[i]>>2 != 1 {
+				continue
+			}
+			h, j := xor[i], count[i]&3
+			order = append(order, h)
+			which = append(which, uint8(j))
+			for k, p := range f.probes(h) {
+				if uint32(k) == j {
+					continue
+				}
+				count[p] -= 4
+				count[p] ^= uint32(k)
+				xor[p] ^= h
+				if count[p]>>2 == 1 {
+					queue = append(queue, p)
+				}
+			}
+		}
+		if len(order) < len(hashes) {
+			continue
+		}
+		fps := make([]uint16, size)
+		for i := len(order) - 1; i >= 0; i-- {
+			h, j := order[i], which[i]
+			p := f.probes(h)
+			fps[p[j]] = fingerprint(h) ^ fps[p[(j+1)%3]] ^ fps[p[(j+2)%3]]
+		}
+		return fps, nil
+	}
+	return nil, ErrBuildFailed
+}
+
+// Contains reports whether key may be one of the keys that f was built
+// from. It is true for all of them.
+func (f *Filter) Contains(key string) bool {
+	return filterContains(f, key)
+}
+
+// ContainsBytes is like Contains but takes the key as a byte slice.
+func (f *Filter) ContainsBytes(key []byte) bool {
+	return filterContains(f, key)
+}
+
+func filterContains[T ~string | ~[]byte](f *Filter, s T) bool {
+	if f.normalize != nil {
+		k := f.normalize(append([]byte(nil), s...))
+		return f.containsHash(wideKeyHash(f.hash, keyHash(f.hash, 0, k), k))
+	}
+	return f.containsHash(wideKeyHash(f.hash, keyHash(f.hash, 0, s), s))
+}
+
+// containsHash reports whether the key whose wide key hash is kh may be in
+// f.
+func (f *Filter) containsHash(kh uint64) bool {
+	h := f.fuseHash(kh)
+	p := f.probes(h)
+	if f.b8 != nil {
+		return uint8(fingerprint(h))^f.b8[p[0]]^f.b8[p[1]]^f.b8[p[2]] == 0
+	}
+	return fingerprint(h)^f.b16[p[0]]^f.b16[p[1]]^f.b16[p[2]] == 0
+}
+
+// Len returns the number of keys that f was built from.
+func (f *Filter) Len() int {
+	return f.nkeys
+}
+
+// Bits returns the number of bits of the fingerprints of f, 8 or 16.
+func (f *Filter) Bits() int {
+	if f.b8 != nil {
+		return 8
+	}
+	return 16
+}
+
+// Size returns the memory used by the fingerprints of f, in bytes.
+func (f *Filter) Size() int {
+	return len(f.b8) + 2*len(f.b16)
+}
+
+// filterMagic starts the serialized form of a Filter.
+const filterMagic = "MPHB"
+
+// filterHeaderSize is the size of the header of a serialized Filter.
+const filterHeaderSize = 28
+
+// MarshalBinary implements encoding.BinaryMarshaler. The serialized form is
+// a header of the magic string "MPHB", the number of bits of the
+// fingerprints and the hash function of the keys, one byte each, two zero
+// bytes, the number of keys, the segment length, and the segment count, as
+// little-endian uint32 values, and the seed, as a little-endian uint64,
+// followed by the fingerprints, little-endian. The normalizer of the table
+// is not serialized.
+func (f *Filter) MarshalBinary() ([]byte, error) {
+	b := make([]byte, filterHeaderSize, filterHeaderSize+f.Size())
+	copy(b, filterMagic)
+	b[4], b[5] = uint8(f.Bits()), uint8(f.hash)
+	binary.LittleEndian.PutUint32(b[8:], uint32(f.nkeys))
+	binary.LittleEndian.PutUint32(b[12:], f.segLen)
+	binary.LittleEndian.PutUint32(b[16:], f.segCount)
+	binary.LittleEndian.PutUint64(b[20:], f.seed)
+	if f.b8 != nil {
+		return append(b, f.b8...), nil
+	}
+	for _, v := range f.b16 {
+		b = append(b, uint8(v), uint8(v>>8))
+	}
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. It does not retain
+// data.
+func (f *Filter) UnmarshalBinary(data []byte) error {
+	if len(data) < filterHeaderSize || string(data[:4]) != filterMagic {
+		return ErrFormat
+	}
+	g := Filter{
+		hash:     Hash(data[5]),
+		nkeys:    int(binary.LittleEndian.Uint32(data[8:])),
+		segLen:   binary.LittleEndian.Uint32(data[12:]),
+		segCount: binary.LittleEndian.Uint32(data[16:]),
+		seed:     binary.LittleEndian.Uint64(data[20:]),
+	}
+	bits := int(data[4])
+	if (bits != 8 && bits != 16) || (g.hash != Murmur3 && g.hash != Wyhash) || data[6] != 0 || data[7] != 0 {
+		return ErrVersion
+	}
+	if !isPow2(int(g.segLen)) || g.segLen > maxFilterSegment || g.segCount == 0 || g.segCount > math.MaxUint32/g.segLen-2 {
+		return ErrCorrupt
+	}
+	fps := data[filterHeaderSize:]
+	if uint64(len(fps)) != uint64(bits/8)*uint64(g.arrayLen()) {
+		return ErrCorrupt
+	}
+	if bits == 8 {
+		g.b8 = append([]uint8(nil), fps...)
+	} else {
+		g.b16 = make([]uint16, len(fps)/2)
+		for i := range g.b16 {
+			g.b16[i] = binary.LittleEndian.Uint16(fps[2*i:])
+		}
+	}
+	*f = g
+	return nil
+}
@@ -0,0 +1,137 @@
+package mph
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestBuildWithFilter(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 3, 100, 100000} {
+		var keys []string
+		for i := 0; i < n; i++ {
+			keys = append(keys, "key"+strconv.Itoa(i))
+		}
+		for _, h := range []Hash{Murmur3, Wyhash} {
+			for _, bits := range []int{8, 16} {
+				table, f, err := BuildWithFilter(keys, bits, WithHash(h))
+				if err != nil {
+					t.Fatalf("BuildWithFilter(n=%d, %v, %d): %v", n, h, bits, err)
+				}
+				if table.Len() != n || f.Len() != n || f.Bits() != bits {
+					t.Errorf("BuildWithFilter(n=%d): got Len %d, %d and Bits %d; want %d, %d, %d", n, table.Len(), f.Len(), f.Bits(), n, n, bits)
+				}
+				for _, k := range keys {
+					if !f.Contains(k) || !f.ContainsBytes([]byte(k)) {
+						t.Fatalf("Contains(%s): got false; want true", k)
+					}
+				}
+				if n < 100000 {
+					continue
+				}
+				if perKey := float64(8*f.Size()) / float64(n); perKey > 1.2*float64(bits) {
+					t.Errorf("Size(%v, %d): got %.2f bits per key; want at most %.2f", h, bits, perKey, 1.2*float64(bits))
+				}
+				fp := 0
+				const misses = 1 << 20
+				for i := 0; i < misses; i++ {
+					if f.Contains("miss" + strconv.Itoa(i)) {
+						fp++
+					}
+				}
+				if rate, want := float64(fp)/misses, 1.5/float64(int(1)<<bits); rate > want {
+					t.Errorf("Contains(%v, %d): got false-positive rate %.5f; want at most %.5f", h, bits, rate, want)
+				}
+			}
+		}
+	}
+}
+
+func TestFilter_errors(t *testing.T) {
+	table := Build([]string{"foo", "bar"})
+	if _, err := table.WithoutKeys().Filter(8); !errors.Is(err, ErrNoKeys) {
+		t.Errorf("Filter(hash-only): got err=%v; want %v", err, ErrNoKeys)
+	}
+	for _, bits := range []int{0, 4, 32} {
+		if _, err := table.Filter(bits); err == nil {
+			t.Errorf("Filter(%d): got no error", bits)
+		}
+	}
+}
+
+func TestFilter_normalizer(t *testing.T) {
+	_, f, err := BuildWithFilter([]string{"Foo", "BAR"}, 16, WithNormalizer(bytes.ToLower))
+	if err != nil {
+		t.Fatalf("BuildWithFilter: %v", err)
+	}
+	for _, k := range []string{"foo", "FOO", "bar"} {
+		if !f.Contains(k) {
+			t.Errorf("Contains(%s): got false; want true", k)
+		}
+	}
+}
+
+func TestFilter_marshal(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	for _, bits := range []int{8, 16} {
+		_, f, err := BuildWithFilter(keys, bits, WithHash(Wyhash))
+		if err != nil {
+			t.Fatalf("BuildWithFilter: %v", err)
+		}
+		data, err := f.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary: %v", err)
+		}
+		var g Filter
+		if err := g.UnmarshalBinary(data); err != nil {
+			t.Fatalf("UnmarshalBinary: %v", err)
+		}
+		if g.Len() != f.Len() || g.Bits() != bits || g.Size() != f.Size() {
+			t.Errorf("UnmarshalBinary: got Len %d, Bits %d, Size %d; want %d, %d, %d", g.Len(), g.Bits(), g.Size(), f.Len(), bits, f.Size())
+		}
+		for i := 0; i < 2000; i++ {
+			k := strconv.Itoa(i)
+			if g.Contains(k) != f.Contains(k) {
+				t.Errorf("Contains(%s): got %t after UnmarshalBinary; want %t", k, g.Contains(k), f.Contains(k))
+			}
+		}
+
+		for _, tt := range []struct {
+			name string
+			edit func(b []byte) []byte
+			want error
+		}{
+			{"magic", func(b []byte) []byte { b[0] = 'X'; return b }, ErrFormat},
+			{"short", func(b []byte) []byte { return b[:10] }, ErrFormat},
+			{"bits", func(b []byte) []byte { b[4] = 12; return b }, ErrVersion},
+			{"hash", func(b []byte) []byte { b[5] = 9; return b }, ErrVersion},
+			{"segment length", func(b []byte) []byte { b[12]++; return b }, ErrCorrupt},
+			{"segment count", func(b []byte) []byte { b[16]++; return b }, ErrCorrupt},
+			{"truncated", func(b []byte) []byte { return b[:len(b)-1] }, ErrCorrupt},
+		} {
+			b := tt.edit(append([]byte(nil), data...))
+			if err := new(Filter).UnmarshalBinary(b); !errors.Is(err, tt.want) {
+				t.Errorf("UnmarshalBinary(%s): got err=%v; want %v", tt.name, err, tt.want)
+			}
+		}
+	}
+}
+
+func BenchmarkFilter(b *testing.B) {
+	var keys []string
+	for i := 0; i < 1000000; i++ {
+		keys = append(keys, "key"+strconv.Itoa(i))
+	}
+	_, f, err := BuildWithFilter(keys, 8, WithHash(Wyhash))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.Contains(keys[i%len(keys)])
+	}
+}
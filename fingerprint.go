@@ -0,0 +1,115 @@
+package mph
+
+import "errors"
+
+// A fingerprintArray holds a short hash of each key of a hash-only table,
+// indexed by key index, against which lookups are checked in place of the
+// keys themselves.
+type fingerprintArray struct {
+	bits uint8 // 0 if there are no fingerprints, 8, or 16
+	b8   []uint8
+	b16  []uint16
+}
+
+// fingerprintSeed seeds the Murmur3 hash from which the fingerprints of
+// Murmur3 tables are taken.
+const fingerprintSeed = 0x3c6ef372
+
+// fingerprintHash returns a hash of s, whose keyHash under h is kh, that
+// is independent of the slots s hashes to. Its low bits are the fingerprint
+// of s. For Wyhash, the high half of kh serves, so s is still hashed once.
+func fingerprintHash[T ~string | ~[]byte](h Hash, kh uint64, s T) uint64 {
+	if h == Wyhash {
+		return kh >> 32
+	}
+	return uint64(murmurHash(murmurSeed(fingerprintSeed), s))
+}
+
+// matchFingerprint reports whether s, whose key hash is kh, may be key n
+// of the hash-only table t, which is whether s is in its key set if it has
+// one. It is always true if t has neither fingerprints nor a key set.
+func matchFingerprint[T ~string | ~[]byte](t *Table, n uint32, kh uint64, s T) bool {
+	if t.keySet != nil {
+		return containsKey(t, s)
+	}
+	f := &t.fingerprints
+	if f.bits == 0 {
+		return true
+	}
+	fp := fingerprintHash(t.hash, kh, s)
+	if f.bits == 8 {
+		return f.b8[n] == uint8(fp)
+	}
+	return f.b16[n] == uint16(fp)
+}
+
+// size returns the size of the fingerprints in bytes.
+func (f *fingerprintArray) size() int {
+	return len(f.b8) + 2*len(f.b16)
+}
+
+func (f *fingerprintArray) equal(g *fingerprintArray) bool {
+	if f.bits != g.bits || len(f.b8) != len(g.b8) || len(f.b16) != len(g.b16) {
+		return false
+	}
+	if string(f.b8) != string(g.b8) {
+		return false
+	}
+	for i, v := range f.b16 {
+		if v != g.b16[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// fingerprintBytes returns the size of n fingerprints of the given width
+// in the serialized form, which pads them to a multiple of 4 bytes.
+func fingerprintBytes(n, bits int) int {
+	return (n*bits/8 + 3) &^ 3
+}
+
+// WithFingerprints returns a hash-only table that shares the level arrays
+// of t and stores a fingerprint of bits bits, which must be 8 or 16, for
+// each key instead of the key itself. Lookup in the returned table
+// compares the fingerprint of the queried key with that of its candidate,
+// so it answers membership approximately: a key that is not in the table
+// is reported as found, with an arbitrary index, with probability 2^-bits,
+// that is about 0.4% for 8 bits and 0.0015% for 16 bits. Members are always
+// found. The fingerprints cost bits bits per key, and a miss is usually
+// rejected without the load from the key pool that a full comparison makes.
+//
+// WithFingerprints returns ErrNoKeys if t is hash-only.
+func (t *Table) WithFingerprints(bits int) (*Table, error) {
+	if t.hashOnly {
+		return nil, ErrNoKeys
+	}
+	if bits != 8 && bits != 16 {
+		return nil, errors.New("mph: fingerprints must have 8 or 16 bits")
+	}
+	c := t.withoutKeys()
+	c.fingerprints = t.fingerprintArray(bits)
+	return c, nil
+}
+
+// fingerprintArray returns the fingerprints of bits bits of the keys of t,
+// which must store them.
+func (t *Table) fingerprintArray(bits int) fingerprintArray {
+	fp := fingerprintArray{bits: uint8(bits)}
+	n := t.keys.len()
+	if bits == 8 {
+		fp.b8 = make([]uint8, n)
+	} else {
+		fp.b16 = make([]uint16, n)
+	}
+	for i := 0; i < n; i++ {
+		k := t.keys.key(i)
+		h := fingerprintHash(t.hash, keyHash(t.hash, t.seed, k), k)
+		if bits == 8 {
+			fp.b8[i] = uint8(h)
+		} else {
+			fp.b16[i] = uint16(h)
+		}
+	}
+	return fp
+}
@@ -0,0 +1,102 @@
+package mph
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestWithFingerprints(t *testing.T) {
+	keys := make([]string, 5000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%d", i)
+	}
+	for _, h := range []Hash{Murmur3, Wyhash} {
+		for _, bits := range []int{8, 16} {
+			table, err := BuildWithOptions(keys, WithHash(h))
+			if err != nil {
+				t.Fatalf("BuildWithOptions(%s): %v", h, err)
+			}
+			fp, err := table.WithFingerprints(bits)
+			if err != nil {
+				t.Fatalf("WithFingerprints(%d): %v", bits, err)
+			}
+			for i, k := range keys {
+				if n, ok := fp.Lookup(k); !ok || n != uint32(i) {
+					t.Errorf("%s/%d: Lookup(%s): got %d, %v; want %d, true", h, bits, k, n, ok, i)
+				}
+			}
+			const misses = 200000
+			found := 0
+			for i := 0; i < misses; i++ {
+				if _, ok := fp.Lookup(fmt.Sprintf("miss%d", i)); ok {
+					found++
+				}
+			}
+			want := misses >> bits
+			if found > 2*want+10 {
+				t.Errorf("%s/%d: %d false positives in %d misses; want about %d", h, bits, found, misses, want)
+			}
+		}
+	}
+}
+
+func TestWithFingerprintsErrors(t *testing.T) {
+	table := Build([]string{"foo", "bar"})
+	if _, err := table.WithFingerprints(12); err == nil {
+		t.Errorf("WithFingerprints(12): got nil error")
+	}
+	if _, err := table.WithoutKeys().WithFingerprints(8); err != ErrNoKeys {
+		t.Errorf("WithFingerprints(hash-only): got %v; want %v", err, ErrNoKeys)
+	}
+}
+
+func TestFingerprintsEncoding(t *testing.T) {
+	keys := []string{"foo", "foo2", "bar", "baz", "quux"}
+	for _, bits := range []int{8, 16} {
+		fp, err := Build(keys).WithFingerprints(bits)
+		if err != nil {
+			t.Fatalf("WithFingerprints(%d): %v", bits, err)
+		}
+		data, err := fp.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary: %v", err)
+		}
+		loaded, err := LoadBytes(data)
+		if err != nil {
+			t.Fatalf("LoadBytes: %v", err)
+		}
+		var read Table
+		if _, err := read.ReadFrom(bytes.NewReader(data)); err != nil {
+			t.Fatalf("ReadFrom: %v", err)
+		}
+		for _, got := range []*Table{loaded, &read, fp.Clone()} {
+			if !Equal(got, fp) {
+				t.Errorf("%d bits: round trip is not Equal to the original", bits)
+			}
+			for i, k := range keys {
+				if n, ok := got.Lookup(k); !ok || n != uint32(i) {
+					t.Errorf("Lookup(%s): got %d, %v; want %d, true", k, n, ok, i)
+				}
+			}
+		}
+		if Equal(fp, Build(keys).WithoutKeys()) {
+			t.Errorf("%d bits: Equal to the table without fingerprints", bits)
+		}
+	}
+}
+
+func TestFingerprintsLookupAll(t *testing.T) {
+	keys := []string{"foo", "foo2", "bar", "baz", "quux"}
+	fp, err := Build(keys).WithFingerprints(16)
+	if err != nil {
+		t.Fatalf("WithFingerprints: %v", err)
+	}
+	out := make([]uint32, len(keys))
+	LookupAll(fp, keys, out)
+	for i, n := range out {
+		if n != uint32(i) {
+			t.Errorf("LookupAll: out[%d] = %d; want %d", i, n, i)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package mph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+)
+
+// WithFrontCoding makes BuildWithOptions store the keys of the table front
+// coded: sorted, in blocks of frontBlock keys, each key after the first of
+// its block stored as the length of the prefix it shares with the key
+// before it and the rest of its bytes. Keys that share long prefixes, such
+// as URLs, paths, or words of a dictionary, then take a fraction of their
+// length. A lookup decodes only the block of its one candidate key, up to
+// that key, so it is slower than with the keys stored as is, and Key and
+// Keys allocate a copy of each key.
+//
+// Unless the keys are already sorted, as with WithMonotone, the table keeps
+// the sorted rank of each key, bit-packed, in place of the offsets it would
+// otherwise keep. Front coding applies to the table in memory: serializing
+// it writes the keys as usual, and decoding gives a table that does not
+// front code them. It has no effect on hash-only tables, and BuildExternal
+// and GenerateGo ignore it.
+func WithFrontCoding() Option {
+	return func(c *buildConfig) {
+		c.frontCoding = true
+	}
+}
+
+// frontBlock is the number of keys of a block of a frontPool. Larger blocks
+// take less space, and longer to decode.
+const frontBlock = 16
+
+// A frontPool stores keys front coded, in blocks of frontBlock keys in
+// sorted order. Each key is stored as two uvarints, the length of the prefix
+// it shares with the key before it, 0 for the first key of a block, and the
+// length of the rest, followed by the rest.
+type frontPool struct {
+	data   []byte
+	blocks []uint32   // block b is data[blocks[b]:blocks[b+1]]
+	ranks  indexArray // sorted rank of each key; empty if the keys are sorted
+	n      int
+	nbytes int // total length of the keys
+}
+
+// frontCode replaces the keys of t, if it stores any, with a frontPool.
+func (t *Table) frontCode() {
+	if t.hashOnly || t.keys.len() == 0 {
+		return
+	}
+	p := &t.keys
+	n := p.len()
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sorted := sort.SliceIsSorted(order, func(i, j int) bool {
+		return bytes.Compare(p.key(i), p.key(j)) < 0
+	})
+	f := &frontPool{n: n, nbytes: p.size(), blocks: make([]uint32, 0, (n+frontBlock-1)/frontBlock+1)}
+	if !sorted {
+		sort.Slice(order, func(i, j int) bool {
+			return bytes.Compare(p.key(order[i]), p.key(order[j])) < 0
+		})
+		ranks := make([]uint32, n)
+		for r, i := range order {
+			ranks[i] = uint32(r)
+		}
+		f.ranks = packIndices(ranks, n)
+	}
+	var buf [2 * binary.MaxVarintLen64]byte
+	var prev []byte
+	for r, i := range order {
+		k := p.key(i)
+		shared := 0
+		if r%frontBlock == 0 {
+			f.blocks = append(f.blocks, uint32(len(f.data)))
+		} else {
+			for shared < len(k) && shared < len(prev) && k[shared] == prev[shared] {
+				shared++
+			}
+		}
+		w := binary.PutUvarint(buf[:], uint64(shared))
+		w += binary.PutUvarint(buf[w:], uint64(len(k)-shared))
+		f.data = append(append(f.data, buf[:w]...), k[shared:]...)
+		prev = k
+	}
+	f.blocks = append(f.blocks, uint32(len(f.data)))
+	*p = keyPool{front: f}
+	t.keyWidth = 0
+}
+
+// rank returns the position of key i among the sorted keys.
+func (f *frontPool) rank(i int) int {
+	if f.ranks.len() == 0 {
+		return i
+	}
+	return int(f.ranks.get(i))
+}
+
+// uvarint returns the uvarint at the start of data and the rest of data.
+// Lengths of keys are small, so most take one byte.
+func uvarint(data []byte) (int, []byte) {
+	if data[0] < 0x80 {
+		return int(data[0]), data[1:]
+	}
+	v, w := binary.Uvarint(data)
+	return int(v), data[w:]
+}
+
+// key returns a copy of key i.
+func (f *frontPool) key(i int) []byte {
+	r := f.rank(i)
+	b := r / frontBlock
+	data := f.data[f.blocks[b]:f.blocks[b+1]]
+	var k []byte
+	for j := 0; j <= r%frontBlock; j++ {
+		var shared, rest int
+		shared, data = uvarint(data)
+		rest, data = uvarint(data)
+		k = append(k[:shared], data[:rest]...)
+		data = data[rest:]
+	}
+	return k[:len(k):len(k)]
+}
+
+// frontEqual reports whether s equals key i of f. It decodes the keys of
+// the block up to key i without copying them, keeping only the length of
+// the prefix that s shares with each.
+func frontEqual[T ~string | ~[]byte](f *frontPool, i int, s T) bool {
+	r := f.rank(i)
+	b := r / frontBlock
+	data := f.data[f.blocks[b]:f.blocks[b+1]]
+	m, n := 0, 0 // the length of the prefix s shares with the key, and its length
+	for j := 0; j <= r%frontBlock; j++ {
+		var shared, rest int
+		shared, data = uvarint(data)
+		rest, data = uvarint(data)
+		// A key that differs from s within the prefix it shares with the
+		// key before it differs from s at the same byte.
+		if m >= shared {
+			m = shared
+			for m < len(s) && m-shared < rest && s[m] == data[m-shared] {
+				m++
+			}
+		}
+		n = shared + rest
+		data = data[rest:]
+	}
+	return m == n && n == len(s)
+}
+
+// size returns the memory used by f, in bytes.
+func (f *frontPool) size() int {
+	return len(f.data) + 4*len(f.blocks) + f.ranks.size()
+}
+
+// copyInto returns a copy of f in the arena a, which must have room for
+// f.size() bytes, rounded up to a multiple of 4.
+func (f *frontPool) copyInto(a *arena) *frontPool {
+	c := *f
+	c.blocks = copyUint32s(a, f.blocks)
+	if w := f.ranks.words; w != nil {
+		c.ranks.words = copyUint32s(a, w)
+	}
+	c.data = append(a.bytes(len(f.data))[:0], f.data...)
+	return &c
+}
@@ -0,0 +1,119 @@
+package mph
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// urlKeys returns n keys that share long prefixes, in no particular order.
+func urlKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		j := i * 7919 % n
+		keys[i] = "https://example.com/dictionary/" + strconv.Itoa(j/100) + "/entry-" + strconv.Itoa(j)
+	}
+	return keys
+}
+
+func TestWithFrontCoding(t *testing.T) {
+	keys := urlKeys(1000)
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	extra := []string{"", "https://example.com/", "https://example.com/dictionary/0/entry-", keys[0] + "x", keys[0][:len(keys[0])-1]}
+	for _, a := range []Algorithm{CHD, BBHash, RecSplit, PTHash, BDZ} {
+		table, err := BuildWithOptions(keys, WithFrontCoding(), WithAlgorithm(a))
+		if err != nil {
+			t.Fatalf("BuildWithOptions(%v): %v", a, err)
+		}
+		checkTable(t, table, keys, extra)
+		for i, key := range keys {
+			if k, _ := table.Key(uint32(i)); string(k) != key {
+				t.Errorf("Key(%d): got %q; want %q", i, k, key)
+			}
+		}
+	}
+
+	plain := Build(keys)
+	table, err := BuildWithOptions(keys, WithFrontCoding())
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	if got, want := table.Stats().Size, plain.Stats().Size; got >= want*3/4 {
+		t.Errorf("Stats: got Size %d; want less than 3/4 of %d", got, want)
+	}
+	if s := table.Stats(); s.KeyBytes != plain.Stats().KeyBytes {
+		t.Errorf("Stats: got KeyBytes %d; want %d", s.KeyBytes, plain.Stats().KeyBytes)
+	}
+	out := make([]uint32, len(keys))
+	if n := LookupAll(table, keys, out); n != len(keys) {
+		t.Errorf("LookupAll: found %d keys; want %d", n, len(keys))
+	}
+	if !Equal(table, plain) || !Equal(table.Clone(), plain) {
+		t.Errorf("Equal: got false; want true")
+	}
+	data, err := table.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	want, _ := plain.MarshalBinary()
+	if !bytes.Equal(data, want) {
+		t.Errorf("MarshalBinary: got a different encoding than without front coding")
+	}
+
+	// Sorted keys need no ranks.
+	monotone, err := BuildWithOptions(keys, WithFrontCoding(), WithMonotone())
+	if err != nil {
+		t.Fatalf("BuildWithOptions(WithMonotone): %v", err)
+	}
+	checkTable(t, monotone, sorted, extra)
+	if got, want := monotone.Stats().Size, table.Stats().Size; got >= want {
+		t.Errorf("Stats(WithMonotone): got Size %d; want less than %d", got, want)
+	}
+}
+
+func TestWithFrontCoding_edges(t *testing.T) {
+	for _, keys := range [][]string{
+		nil,
+		{""},
+		{"", "a", "aa", "aaa", "ab", "b"},
+		{"abc", "abc\x00", "ab", "b", "abd", ""},
+	} {
+		table, err := BuildWithOptions(keys, WithFrontCoding())
+		if err != nil {
+			t.Fatalf("BuildWithOptions(%q): %v", keys, err)
+		}
+		checkTable(t, table, keys, []string{"abcd", "c", "a\x00"})
+	}
+	var long []string
+	for i := 0; i < 100; i++ {
+		long = append(long, string(bytes.Repeat([]byte{'x'}, 200+i%7))+strconv.Itoa(i))
+	}
+	table, err := BuildWithOptions(long, WithFrontCoding())
+	if err != nil {
+		t.Fatalf("BuildWithOptions(long): %v", err)
+	}
+	checkTable(t, table, long, []string{long[0][:150]})
+}
+
+func TestWithFrontCoding_allocs(t *testing.T) {
+	keys := urlKeys(100)
+	table, err := BuildWithOptions(keys, WithFrontCoding())
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	hit, miss := []byte(keys[50]), []byte(keys[50]+"!")
+	for _, tt := range []struct {
+		name string
+		fn   func()
+	}{
+		{"Lookup", func() { table.Lookup(keys[50]) }},
+		{"LookupBytes hit", func() { table.LookupBytes(hit) }},
+		{"LookupBytes miss", func() { table.LookupBytes(miss) }},
+	} {
+		if allocs := testing.AllocsPerRun(100, tt.fn); allocs != 0 {
+			t.Errorf("%s: got %v allocs; want 0", tt.name, allocs)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package mph
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"io"
+	"strconv"
+)
+
+// Gen writes Go source code for a file in package pkg that declares a
+// package-level variable named varName holding t. Compiling the table into a
+// binary this way avoids any file I/O or rebuilding at startup, which suits
+// small and medium-sized tables. Gen returns ErrNoKeys if t is hash-only,
+// and an error if t does not use the Murmur3 hash and the CHD algorithm,
+// or has a seed (see WithSeed) or is k-perfect.
+func (t *Table) Gen(w io.Writer, pkg, varName string) error {
+	if t.hashOnly {
+		return ErrNoKeys
+	}
+	if t.hash != Murmur3 {
+		return fmt.Errorf("mph: Gen does not support the %v hash", t.hash)
+	}
+	if a := t.algorithm(); a != CHD {
+		return fmt.Errorf("mph: Gen does not support the %v algorithm", a)
+	}
+	if t.seed != 0 {
+		return errors.New("mph: Gen does not support tables with a seed")
+	}
+	if t.K() > 1 {
+		return errors.New("mph: Gen does not support k-perfect tables")
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by github.com/ikawaha/mph; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	fmt.Fprintf(&buf, "import \"github.com/ikawaha/mph\"\n\n")
+	fmt.Fprintf(&buf, "var %s = func() *mph.Table {\n", varName)
+	fmt.Fprintf(&buf, "t, err := mph.New(\n")
+	genUint32s(&buf, t.level0.uint32s())
+	genUint32s(&buf, t.level1.uint32s())
+	buf.WriteString("[]string{\n")
+	for i := 0; i < t.keys.len(); i++ {
+		buf.WriteString(strconv.Quote(string(t.keys.key(i))))
+		buf.WriteString(",\n")
+	}
+	buf.WriteString("},\n)\n")
+	buf.WriteString("if err != nil {\npanic(err)\n}\nreturn t\n}()\n")
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+func genUint32s(buf *bytes.Buffer, vs []uint32) {
+	buf.WriteString("[]uint32{")
+	for i, v := range vs {
+		if i%16 == 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString(strconv.FormatUint(uint64(v), 10))
+		buf.WriteString(", ")
+	}
+	buf.WriteString("\n},\n")
+}
+
+// New returns a Table made of the given level arrays and keys, as written
+// by Gen. It is intended for generated code; use Build to construct a table
+// from a set of keys. The keys are copied into the key pool of the table.
+func New(level0, level1 []uint32, keys []string) (*Table, error) {
+	if len(level0) == 0 || len(level1) == 0 || len(level1) < len(keys) {
+		return nil, ErrCorrupt
+	}
+	indices := new(buildConfig).indices(level1, len(keys))
+	if err := indices.check(len(keys)); err != nil {
+		return nil, err
+	}
+	pool, err := newKeyPool(keys)
+	if err != nil {
+		return nil, err
+	}
+	t := &Table{
+		keys:        pool,
+		keyWidth:    pool.width(),
+		level0:      newSeedArray(level0),
+		level0Slots: newSlotMap(len(level0)),
+		level1:      indices,
+		level1Slots: newSlotMap(len(level1)),
+	}
+	t.compact(true)
+	return t, nil
+}
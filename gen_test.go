@@ -0,0 +1,43 @@
+package mph
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func TestGen(t *testing.T) {
+	table := Build([]string{"foo", "foo2", "bar", "baz", "a\"b\n"})
+	var buf bytes.Buffer
+	if err := table.Gen(&buf, "dict", "Words"); err != nil {
+		t.Fatalf("Gen: %v", err)
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), "words.go", buf.Bytes(), 0)
+	if err != nil {
+		t.Fatalf("generated code does not parse: %v\n%s", err, buf.Bytes())
+	}
+	if f.Name.Name != "dict" {
+		t.Errorf("generated package: got %s; want dict", f.Name.Name)
+	}
+	if f.Scope.Lookup("Words") == nil {
+		t.Errorf("generated code does not declare Words:\n%s", buf.Bytes())
+	}
+}
+
+func TestNew(t *testing.T) {
+	keys := []string{"foo", "foo2", "bar", "baz"}
+	table := Build(keys)
+	got, err := New(table.level0.uint32s(), table.level1.uint32s(), keys)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	checkTable(t, got, keys, []string{"quux"})
+
+	if _, err := New(table.level0.uint32s(), table.level1.uint32s(), keys[:1]); err == nil {
+		t.Errorf("New with missing keys: got nil error")
+	}
+	if _, err := New(table.level0.uint32s()[:0], table.level1.uint32s(), keys); err == nil {
+		t.Errorf("New with empty level0: got nil error")
+	}
+}
@@ -0,0 +1,165 @@
+package mph
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// GenC writes a C header that embeds t for use by C programs and firmware.
+// Every identifier in the header starts with prefix, which must be a valid C
+// identifier. The header declares the level arrays, the concatenated keys
+// with their offsets, and a static function
+//
+//	int <prefix>_lookup(const void *key, size_t len, uint32_t *index);
+//
+// which returns 1 and stores the index of key if it is in the table, and
+// returns 0 otherwise. GenC returns ErrNoKeys if t is hash-only, and an
+// error if t does not use the Murmur3 hash and the CHD algorithm, or was
+// built WithExactSizes, WithSeed or WithKPerfect.
+func (t *Table) GenC(w io.Writer, prefix string) error {
+	if t.hashOnly {
+		return ErrNoKeys
+	}
+	if t.hash != Murmur3 {
+		return fmt.Errorf("mph: GenC does not support the %v hash", t.hash)
+	}
+	if a := t.algorithm(); a != CHD {
+		return fmt.Errorf("mph: GenC does not support the %v algorithm", a)
+	}
+	if t.seed != 0 {
+		return errors.New("mph: GenC does not support tables with a seed")
+	}
+	if t.K() > 1 {
+		return errors.New("mph: GenC does not support k-perfect tables")
+	}
+	if t.level0Slots.mask < 0 || t.level1Slots.mask < 0 {
+		return errors.New("mph: GenC does not support exact sizes")
+	}
+	if !isCIdent(prefix) {
+		return fmt.Errorf("mph: invalid C identifier %q", prefix)
+	}
+	bw := bufio.NewWriter(w)
+	upper := strings.ToUpper(prefix)
+	// Named substitutions keep the C templates readable.
+	r := strings.NewReplacer("PREFIX", prefix, "UPPER", upper)
+	p := func(tmpl string) { r.WriteString(bw, tmpl) }
+	p(`/* Code generated by github.com/ikawaha/mph; DO NOT EDIT. */
+
+#ifndef UPPER_MPH_H
+#define UPPER_MPH_H
+
+#include <stddef.h>
+#include <stdint.h>
+#include <string.h>
+
+`)
+	fmt.Fprintf(bw, "#define %s_NUM_KEYS %d\n\n", upper, t.keys.len())
+	genCUint32s(bw, prefix+"_level0", t.level0.uint32s())
+	genCUint32s(bw, prefix+"_level1", t.level1.uint32s())
+	pool := t.keys.owned()
+	offsets := pool.offsets
+	if len(offsets) == 0 {
+		offsets = []uint32{0}
+	}
+	genCUint32s(bw, prefix+"_key_offsets", offsets)
+	fmt.Fprintf(bw, "static const char %s_keys[] =\n", prefix)
+	for i := 0; i < t.keys.len(); i++ {
+		bw.WriteString("\t\"")
+		writeCString(bw, t.keys.key(i))
+		bw.WriteString("\"\n")
+	}
+	bw.WriteString("\t\"\";\n\n")
+	p(`/* Murmur3 (32-bit) of key with the given seed. Blocks are read as
+ * little-endian words on every host. */
+static uint32_t PREFIX_hash(uint32_t seed, const unsigned char *key, size_t len) {
+	uint32_t h = seed, k;
+	size_t i, nblocks = len / 4;
+	for (i = 0; i < nblocks; i++) {
+		const unsigned char *b = key + 4*i;
+		k = (uint32_t)b[0] | (uint32_t)b[1] << 8 | (uint32_t)b[2] << 16 | (uint32_t)b[3] << 24;
+		k *= 0xcc9e2d51; k = (k << 15) | (k >> 17); k *= 0x1b873593;
+		h ^= k; h = (h << 13) | (h >> 19); h = h*5 + 0xe6546b64;
+	}
+	k = 0;
+	key += 4*nblocks;
+	switch (len & 3) {
+	case 3: k ^= (uint32_t)key[2] << 16; /* fall through */
+	case 2: k ^= (uint32_t)key[1] << 8;  /* fall through */
+	case 1: k ^= (uint32_t)key[0];
+		k *= 0xcc9e2d51; k = (k << 15) | (k >> 17); k *= 0x1b873593;
+		h ^= k;
+	}
+	h ^= (uint32_t)len;
+	h ^= h >> 16; h *= 0x85ebca6b; h ^= h >> 13; h *= 0xc2b2ae35; h ^= h >> 16;
+	return h;
+}
+
+/* Lookup hashes key with seed 0 to select a seed in level0, hashes it again
+ * with that seed to select a candidate index in level1, and compares key with
+ * the candidate. */
+static int PREFIX_lookup(const void *key, size_t len, uint32_t *index) {
+	const size_t mask0 = sizeof(PREFIX_level0)/sizeof(PREFIX_level0[0]) - 1;
+	const size_t mask1 = sizeof(PREFIX_level1)/sizeof(PREFIX_level1[0]) - 1;
+	uint32_t seed = PREFIX_level0[PREFIX_hash(0, key, len) & mask0];
+	uint32_t n = PREFIX_level1[PREFIX_hash(seed, key, len) & mask1];
+	uint32_t off = PREFIX_key_offsets[n];
+	if (n >= UPPER_NUM_KEYS || PREFIX_key_offsets[n+1] - off != len ||
+	    memcmp(PREFIX_keys + off, key, len) != 0) {
+		return 0;
+	}
+	*index = n;
+	return 1;
+}
+
+#endif /* UPPER_MPH_H */
+`)
+	return bw.Flush()
+}
+
+func genCUint32s(w *bufio.Writer, name string, vs []uint32) {
+	fmt.Fprintf(w, "static const uint32_t %s[%d] = {", name, len(vs))
+	for i, v := range vs {
+		if i%8 == 0 {
+			w.WriteString("\n\t")
+		} else {
+			w.WriteString(" ")
+		}
+		fmt.Fprintf(w, "%d,", v)
+	}
+	w.WriteString("\n};\n\n")
+}
+
+// writeCString writes b as the contents of a C string literal. Anything
+// other than printable ASCII is written as a three-digit octal escape,
+// which cannot run into the characters that follow it.
+func writeCString(w *bufio.Writer, b []byte) {
+	for _, c := range b {
+		switch {
+		case c == '"' || c == '\\' || c == '?':
+			w.WriteByte('\\')
+			w.WriteByte(c)
+		case c >= 0x20 && c < 0x7f:
+			w.WriteByte(c)
+		default:
+			fmt.Fprintf(w, "\\%03o", c)
+		}
+	}
+}
+
+func isCIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c == '_', 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case i > 0 && '0' <= c && c <= '9':
+		default:
+			return false
+		}
+	}
+	return true
+}
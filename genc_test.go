@@ -0,0 +1,74 @@
+package mph
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenC(t *testing.T) {
+	keys := []string{"foo", "bar", "baz", "a\"b?\x00\xff", "ππππ", ""}
+	var buf bytes.Buffer
+	if err := Build(keys).GenC(&buf, "dict"); err != nil {
+		t.Fatalf("GenC: %v", err)
+	}
+	for _, want := range []string{
+		"#define DICT_NUM_KEYS 6",
+		`"a\"b\?\000\377"`,
+		"static int dict_lookup(const void *key, size_t len, uint32_t *index)",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("GenC output does not contain %q", want)
+		}
+	}
+	if err := Build(keys).GenC(&buf, "1dict"); err == nil {
+		t.Errorf("GenC with invalid prefix: got nil error")
+	}
+}
+
+// TestGenC_compile checks the generated lookup function against Lookup using
+// the host C compiler, if there is one.
+func TestGenC_compile(t *testing.T) {
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no C compiler available")
+	}
+	keys := []string{"foo", "foo2", "bar", "baz", "ππππ longer key", ""}
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	if err := Build(keys).GenC(&buf, "dict"); err != nil {
+		t.Fatalf("GenC: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "dict.h"), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	main := `#include <stdio.h>
+#include "dict.h"
+int main(int argc, char **argv) {
+	uint32_t n;
+	for (int i = 1; i < argc; i++) {
+		if (dict_lookup(argv[i], strlen(argv[i]), &n)) printf("%u\n", n);
+		else printf("MISS\n");
+	}
+	return 0;
+}
+`
+	if err := os.WriteFile(filepath.Join(dir, "main.c"), []byte(main), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bin := filepath.Join(dir, "main")
+	if out, err := exec.Command(cc, "-std=c99", "-Wall", "-Werror", "-o", bin, filepath.Join(dir, "main.c")).CombinedOutput(); err != nil {
+		t.Fatalf("compiling generated header: %v\n%s", err, out)
+	}
+	out, err := exec.Command(bin, append(keys, "quux")...).Output()
+	if err != nil {
+		t.Fatalf("running lookup program: %v", err)
+	}
+	want := "0\n1\n2\n3\n4\n5\nMISS\n"
+	if string(out) != want {
+		t.Errorf("C lookups: got\n%s\nwant\n%s", out, want)
+	}
+}
@@ -0,0 +1,68 @@
+package mph
+
+import "strconv"
+
+// A Hash identifies the hash function that a Table applies to keys. The
+// hash is recorded in the serialized form of a table, so a loaded table
+// looks keys up with the hash it was built with.
+type Hash uint8
+
+const (
+	// Murmur3 is the 32-bit Murmur3 hash. It is the default.
+	Murmur3 Hash = iota
+	// Wyhash is the 64-bit wyhash. It reads keys eight bytes at a time,
+	// and a lookup hashes the key once rather than twice, which makes it
+	// faster than Murmur3 on keys longer than a few dozen bytes.
+	Wyhash
+)
+
+func (h Hash) String() string {
+	switch h {
+	case Murmur3:
+		return "murmur3"
+	case Wyhash:
+		return "wyhash"
+	}
+	return "Hash(" + strconv.Itoa(int(h)) + ")"
+}
+
+// keyHash returns the hash of s under h, perturbed by the base seed of the
+// table (see WithSeed), whose low 32 bits select the level0 bucket of s.
+// Murmur3 has 32 bits of state, so it folds the seed to 32 bits.
+func keyHash[T ~string | ~[]byte](h Hash, seed uint64, s T) uint64 {
+	if h == Wyhash {
+		return wyhash(seed, s)
+	}
+	return uint64(murmurHash(murmurSeed(uint32(seed)^uint32(seed>>32)), s))
+}
+
+// wideSeed is the seed of the second Murmur3 hash of wideKeyHash. Murmur3
+// hashes that collide under seed 0 often collide under nearby seeds too,
+// such as 1, so it is far from 0.
+const wideSeed = 0x9e3779b9
+
+// wideKeyHash returns the 64-bit hash of s under h, where kh is
+// keyHash(h, s), for the algorithms that need more bits than a 32-bit
+// Murmur3 hash gives. Murmur3 hashes s a second time with another seed;
+// Wyhash gives 64 bits already.
+func wideKeyHash[T ~string | ~[]byte](h Hash, kh uint64, s T) uint64 {
+	if h == Wyhash {
+		return kh
+	}
+	return kh | uint64(murmurHash(wideSeed, s))<<32
+}
+
+// level1Hash returns the hash under h that selects the level1 slot of s for
+// the given bucket seed, where kh is keyHash(h, s). Murmur3 hashes s again
+// with the seed. Wyhash instead derives the slot from the 64 bits of kh, so
+// that a lookup reads the key only once, which matters for long keys.
+func level1Hash[T ~string | ~[]byte](h Hash, kh uint64, seed uint32, s T) uint32 {
+	if h == Wyhash {
+		return wyslot(kh, seed)
+	}
+	return murmurHash(murmurSeed(seed), s)
+}
+
+func wyslot(kh uint64, seed uint32) uint32 {
+	return uint32(wymix(kh^wyp1, uint64(seed)*wyp3^wyp2))
+}
@@ -0,0 +1,116 @@
+package mph
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWithHash(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, strings.Repeat("k", i%100)+strconv.Itoa(i))
+	}
+	table, err := BuildWithOptions(keys, WithHash(Wyhash), WithVerify())
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	checkTable(t, table, keys, []string{"x", "quux"})
+	if Equal(table, Build(keys)) {
+		t.Errorf("Equal(Wyhash table, Murmur3 table): got true")
+	}
+	parallel, err := BuildWithOptions(keys, WithHash(Wyhash), WithParallelism(4))
+	if err != nil {
+		t.Fatalf("BuildWithOptions(WithParallelism): %v", err)
+	}
+	if !Equal(table, parallel) {
+		t.Errorf("parallel Wyhash build differs from sequential build")
+	}
+
+	data, err := table.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	loaded, err := LoadBytes(data)
+	if err != nil {
+		t.Fatalf("LoadBytes: %v", err)
+	}
+	if !Equal(table, loaded) {
+		t.Errorf("LoadBytes(MarshalBinary(t)) is not equal to t")
+	}
+	checkTable(t, loaded, keys, []string{"x"})
+	lazy, err := NewLazyTable(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewLazyTable: %v", err)
+	}
+	for i, k := range keys {
+		if n, ok, err := lazy.Lookup(k); err != nil || !ok || n != uint32(i) {
+			t.Errorf("LazyTable.Lookup(%s): got %d, %t, %v; want %d, true, nil", k, n, ok, err, i)
+		}
+	}
+
+	if err := table.Gen(new(bytes.Buffer), "p", "v"); err == nil {
+		t.Errorf("Gen of a Wyhash table: got nil error")
+	}
+	if err := table.GenC(new(bytes.Buffer), "p"); err == nil {
+		t.Errorf("GenC of a Wyhash table: got nil error")
+	}
+	if _, err := BuildWithOptions(keys, WithHash(Wyhash+1)); err == nil {
+		t.Errorf("BuildWithOptions with an unknown hash: got nil error")
+	}
+}
+
+func TestHashString(t *testing.T) {
+	for _, tt := range []struct {
+		h    Hash
+		want string
+	}{
+		{Murmur3, "murmur3"},
+		{Wyhash, "wyhash"},
+		{7, "Hash(7)"},
+	} {
+		if got := tt.h.String(); got != tt.want {
+			t.Errorf("Hash(%d).String(): got %q; want %q", tt.h, got, tt.want)
+		}
+	}
+}
+
+func BenchmarkLookup_hash(b *testing.B) {
+	for _, h := range []Hash{Murmur3, Wyhash} {
+		for _, size := range []int{8, 64, 512} {
+			b.Run(h.String()+"/"+strconv.Itoa(size), func(b *testing.B) {
+				keys := make([]string, 1000)
+				for i := range keys {
+					s := strconv.Itoa(i)
+					keys[i] = strings.Repeat("k", size-len(s)) + s
+				}
+				table, err := BuildWithOptions(keys, WithHash(h))
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					table.Lookup(keys[i%len(keys)])
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkBuild_hash(b *testing.B) {
+	keys := make([]string, 1<<20)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+	}
+	for _, h := range []Hash{Murmur3, Wyhash} {
+		b.Run(h.String(), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := BuildWithOptions(keys, WithHash(h)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
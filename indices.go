@@ -0,0 +1,135 @@
+package mph
+
+import "math/bits"
+
+// An indexArray holds the level1 key indices of a table, either as plain
+// uint32 values, as uint16 values for tables of at most 1<<16 keys, or
+// bit-packed in the fewest bits that can hold any index.
+type indexArray struct {
+	wide   []uint32 // all indices, if they are stored in 32 bits
+	narrow []uint16 // all indices, if they are stored in 16 bits
+
+	// If the indices are packed, index i is held in bits
+	// [i*width, (i+1)*width) of words, taken as a little-endian bit
+	// string. One extra word at the end lets get read two words at once.
+	words []uint32
+	width uint
+	n     int
+}
+
+// packedWidth returns the number of bits needed for the indices of a table
+// of nkeys keys.
+func packedWidth(nkeys int) uint {
+	if nkeys == 0 {
+		return 0
+	}
+	return uint(bits.Len32(uint32(nkeys) - 1))
+}
+
+// packedWords returns the number of words of n packed indices of the given
+// width, including the extra word. Indices of width 0 still take a word, so
+// that get can read index 0.
+func packedWords(n int, width uint) int {
+	words := int((uint64(n)*uint64(width) + 31) / 32)
+	if words == 0 {
+		words = 1
+	}
+	return words + 1
+}
+
+// packIndices returns a packed indexArray holding level1, whose values must
+// be less than nkeys.
+func packIndices(level1 []uint32, nkeys int) indexArray {
+	a := indexArray{width: packedWidth(nkeys), n: len(level1)}
+	a.words = make([]uint32, packedWords(a.n, a.width))
+	for i, v := range level1 {
+		p := uint64(i) * uint64(a.width)
+		w, off := p/32, p%32
+		x := uint64(v) << off
+		a.words[w] |= uint32(x)
+		a.words[w+1] |= uint32(x >> 32)
+	}
+	return a
+}
+
+// maxNarrowKeys is the largest number of keys whose indices fit in 16 bits.
+const maxNarrowKeys = 1 << 16
+
+// narrowIndices returns an indexArray holding level1 in 16 bits per index.
+// The values must be less than maxNarrowKeys.
+func narrowIndices(level1 []uint32) indexArray {
+	a := indexArray{narrow: make([]uint16, len(level1))}
+	for i, v := range level1 {
+		a.narrow[i] = uint16(v)
+	}
+	return a
+}
+
+func (a *indexArray) len() int {
+	switch {
+	case a.words != nil:
+		return a.n
+	case a.narrow != nil:
+		return len(a.narrow)
+	}
+	return len(a.wide)
+}
+
+// get returns index i.
+func (a *indexArray) get(i int) uint32 {
+	if a.narrow != nil {
+		return uint32(a.narrow[i])
+	}
+	if a.words == nil {
+		return a.wide[i]
+	}
+	p := uint64(i) * uint64(a.width)
+	w, off := p/32, p%32
+	x := uint64(a.words[w]) | uint64(a.words[w+1])<<32
+	return uint32(x>>off) & (1<<a.width - 1)
+}
+
+// uint32s returns all the indices as plain values. The result must not be
+// modified.
+func (a *indexArray) uint32s() []uint32 {
+	if a.wide != nil {
+		return a.wide
+	}
+	vs := make([]uint32, a.len())
+	for i := range vs {
+		vs[i] = a.get(i)
+	}
+	return vs
+}
+
+// size returns the memory used by the indices, in bytes.
+func (a *indexArray) size() int {
+	return 4*(len(a.wide)+len(a.words)) + 2*len(a.narrow)
+}
+
+// equal reports whether a and b hold the same indices in the same form.
+func (a *indexArray) equal(b *indexArray) bool {
+	if a.n != b.n || a.width != b.width || !equalUint32s(a.wide, b.wide) || !equalUint32s(a.words, b.words) || len(a.narrow) != len(b.narrow) {
+		return false
+	}
+	for i, v := range a.narrow {
+		if v != b.narrow[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// check returns ErrCorrupt unless every index is less than nkeys. Any
+// index is valid in a table without keys, whose lookups fail anyway.
+func (a *indexArray) check(nkeys int) error {
+	if nkeys == 0 {
+		return nil
+	}
+	for i := 0; i < a.len(); i++ {
+		if int(a.get(i)) >= nkeys {
+			return ErrCorrupt
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package mph
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestPackIndices(t *testing.T) {
+	for _, nkeys := range []int{1, 2, 3, 1000, 1 << 20, 1<<32 - 1} {
+		level1 := make([]uint32, 64)
+		for i := range level1 {
+			level1[i] = uint32((uint64(i) * 2654435761) % uint64(nkeys))
+		}
+		a := packIndices(level1, nkeys)
+		if a.len() != len(level1) {
+			t.Errorf("packIndices(%d keys): got len %d; want %d", nkeys, a.len(), len(level1))
+		}
+		for i, v := range level1 {
+			if got := a.get(i); got != v {
+				t.Errorf("packIndices(%d keys): get(%d) = %d; want %d", nkeys, i, got, v)
+			}
+		}
+	}
+}
+
+func TestWithPackedIndices(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	table, err := BuildWithOptions(keys, WithPackedIndices())
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	checkTable(t, table, keys, []string{"x", "1000"})
+	plain := Build(keys)
+	if got, want := table.Stats().Size, plain.Stats().Size; got >= want {
+		t.Errorf("Stats: packed size %d is not smaller than %d", got, want)
+	}
+
+	data, err := table.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	var got Table
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	loaded, err := LoadBytes(data)
+	if err != nil {
+		t.Fatalf("LoadBytes: %v", err)
+	}
+	for _, tb := range []*Table{&got, loaded, table.WithoutKeys()} {
+		for i, key := range keys {
+			if n, ok := tb.Lookup(key); !ok || int(n) != i {
+				t.Errorf("Lookup(%s): got %d, %t; want %d, true", key, n, ok, i)
+			}
+		}
+	}
+	if !Equal(&got, table) {
+		t.Errorf("UnmarshalBinary: decoded table differs")
+	}
+
+	// 1000 keys take 10 bits, which can hold indices out of range.
+	table.level1.words[0] |= 1<<10 - 1
+	if _, err := LoadBytes(mustMarshal(t, table)); err != ErrCorrupt {
+		t.Errorf("LoadBytes(index out of range): got err=%v; want %v", err, ErrCorrupt)
+	}
+}
+
+func mustMarshal(t *testing.T, table *Table) []byte {
+	t.Helper()
+	data, err := table.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	return data
+}
+
+func TestNarrowIndices(t *testing.T) {
+	for _, nkeys := range []int{1, 3, maxNarrowKeys, maxNarrowKeys + 1} {
+		keys := make([]string, nkeys)
+		for i := range keys {
+			keys[i] = strconv.Itoa(i)
+		}
+		table := Build(keys)
+		if narrow := table.level1.narrow != nil; narrow != (nkeys <= maxNarrowKeys) {
+			t.Errorf("Build(%d keys): got narrow indices %t; want %t", nkeys, narrow, !narrow)
+		}
+		data := mustMarshal(t, table)
+		loaded, err := LoadBytes(data)
+		if err != nil {
+			t.Fatalf("LoadBytes: %v", err)
+		}
+		var read Table
+		if err := read.UnmarshalBinary(data); err != nil {
+			t.Fatalf("UnmarshalBinary: %v", err)
+		}
+		for _, tb := range []*Table{loaded, &read} {
+			if !Equal(tb, table) {
+				t.Errorf("%d keys: decoded table differs", nkeys)
+			}
+			for i, key := range keys {
+				if n, ok := tb.Lookup(key); !ok || int(n) != i {
+					t.Errorf("Lookup(%s): got %d, %t; want %d, true", key, n, ok, i)
+				}
+			}
+		}
+	}
+}
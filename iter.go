@@ -0,0 +1,54 @@
+//go:build go1.23
+
+package mph
+
+import "iter"
+
+// BuildSeq is like BuildWithOptions but takes the keys from seq, so that
+// keys from scanners, database cursors, or map iteration can be used without
+// collecting them into a slice first. A key's index is the number of keys
+// that seq yielded before it.
+func BuildSeq[T ~string | ~[]byte](seq iter.Seq[T], opts ...Option) (*Table, error) {
+	b := NewBuilder(opts...)
+	for key := range seq {
+		add(b, key)
+	}
+	return b.Build()
+}
+
+// All returns an iterator over the indices and keys of t, in index order.
+// The keys must not be modified. A hash-only table yields nothing.
+func (t *Table) All() iter.Seq2[uint32, []byte] {
+	return func(yield func(uint32, []byte) bool) {
+		for i := 0; i < t.keys.len(); i++ {
+			if !yield(uint32(i), t.keys.key(i)) {
+				return
+			}
+		}
+	}
+}
+
+// Candidates returns an iterator over the candidates of s in t, the keys
+// that s can be equal to, as listed by AppendCandidates.
+func (t *Table) Candidates(s string) iter.Seq[uint32] {
+	return func(yield func(uint32) bool) {
+		var buf [maxK]uint32
+		for _, n := range AppendCandidates(buf[:0], t, s) {
+			if !yield(n) {
+				return
+			}
+		}
+	}
+}
+
+// All returns an iterator over the keys and values of m, in the index order
+// of its Table. The keys must not be modified.
+func (m *Map[V]) All() iter.Seq2[[]byte, V] {
+	return func(yield func([]byte, V) bool) {
+		for i, v := range m.values {
+			if !yield(m.table.keys.key(i), v) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+//go:build go1.23
+
+package mph
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestAll(t *testing.T) {
+	keys := []string{"foo", "foo2", "bar", "baz"}
+	table := Build(keys)
+	var got []string
+	for i, k := range table.All() {
+		if int(i) != len(got) {
+			t.Errorf("All: got index %d; want %d", i, len(got))
+		}
+		got = append(got, string(k))
+	}
+	if len(got) != len(keys) {
+		t.Fatalf("All: got %d keys; want %d", len(got), len(keys))
+	}
+	for i := range keys {
+		if got[i] != keys[i] {
+			t.Errorf("All: key %d: got %q; want %q", i, got[i], keys[i])
+		}
+	}
+	for i := range table.All() {
+		if i != 0 {
+			t.Errorf("All: iteration continued after break")
+		}
+		break
+	}
+}
+
+func TestMap_All(t *testing.T) {
+	keys := []string{"foo", "foo2", "bar", "baz"}
+	m, err := BuildMap(keys, []int{0, 1, 2, 3})
+	if err != nil {
+		t.Fatalf("BuildMap: %v", err)
+	}
+	var n int
+	for k, v := range m.All() {
+		if string(k) != keys[v] {
+			t.Errorf("All: got %q => %d; want %q => %d", k, v, keys[v], v)
+		}
+		n++
+	}
+	if n != len(keys) {
+		t.Errorf("All: got %d entries; want %d", n, len(keys))
+	}
+}
+
+func TestBuildSeq(t *testing.T) {
+	keys := []string{"foo", "foo2", "bar", "baz"}
+	table, err := BuildSeq(slices.Values(keys))
+	if err != nil {
+		t.Fatalf("BuildSeq: %v", err)
+	}
+	checkTable(t, table, keys, []string{"quux"})
+
+	byteKeys := [][]byte{[]byte("a"), []byte("b"), []byte("a")}
+	if _, err := BuildSeq(slices.Values(byteKeys)); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("BuildSeq: got err=%v; want %v", err, ErrDuplicateKey)
+	}
+}
+
+func TestCandidates(t *testing.T) {
+	keys := []string{"foo", "foo2", "bar", "baz", "quux"}
+	table, err := BuildWithOptions(keys, WithKPerfect(2))
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	for i, key := range keys {
+		got := slices.Collect(table.Candidates(key))
+		if want := AppendCandidates(nil, table, key); !slices.Equal(got, want) || !slices.Contains(got, uint32(i)) {
+			t.Errorf("Candidates(%s): got %v; want %v including %d", key, got, want, i)
+		}
+	}
+	for range table.Candidates("foo") {
+		break
+	}
+}
@@ -0,0 +1,57 @@
+package mph
+
+import (
+	"encoding/json"
+)
+
+// jsonTable is the JSON representation of a Table.
+type jsonTable struct {
+	Len       int      `json:"len"`
+	Hash      string   `json:"hash,omitempty"`      // omitted for Murmur3
+	Seed      uint64   `json:"seed,omitempty"`      // omitted for no seed
+	Algorithm string   `json:"algorithm,omitempty"` // omitted for CHD
+	K         int      `json:"k,omitempty"`         // omitted unless k-perfect
+	Level0    []uint32 `json:"level0"`
+	Level1    []uint32 `json:"level1"`
+	Keys      []string `json:"keys,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler. The JSON form exposes the internal
+// layout of t (the displacement seeds in level0, or the serialized hash
+// function of another algorithm than CHD, the key indices in level1, and
+// the keys) for debugging
+// and inspection; it cannot be used to restore a table.
+func (t *Table) MarshalJSON() ([]byte, error) {
+	return t.marshalJSON(true)
+}
+
+// MarshalJSONWithoutKeys is like MarshalJSON but omits the keys, which
+// dominate the output for large tables.
+func (t *Table) MarshalJSONWithoutKeys() ([]byte, error) {
+	return t.marshalJSON(false)
+}
+
+func (t *Table) marshalJSON(withKeys bool) ([]byte, error) {
+	jt := jsonTable{
+		Len:    t.Len(),
+		Level0: t.level0.uint32s(),
+		Level1: t.level1.uint32s(),
+	}
+	if t.hash != Murmur3 {
+		jt.Hash = t.hash.String()
+	}
+	jt.Seed = t.seed
+	if a := t.algorithm(); a != CHD {
+		jt.Algorithm = a.String()
+	}
+	if k := t.K(); k > 1 {
+		jt.K = k
+	}
+	if withKeys {
+		jt.Keys = make([]string, t.keys.len())
+		for i := range jt.Keys {
+			jt.Keys[i] = string(t.keys.key(i))
+		}
+	}
+	return json.Marshal(jt)
+}
@@ -0,0 +1,38 @@
+package mph
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	keys := []string{"foo", "foo2", "bar", "baz"}
+	table := Build(keys)
+	for _, tt := range []struct {
+		name     string
+		marshal  func() ([]byte, error)
+		wantKeys []string
+	}{
+		{"MarshalJSON", table.MarshalJSON, keys},
+		{"MarshalJSONWithoutKeys", table.MarshalJSONWithoutKeys, nil},
+	} {
+		b, err := tt.marshal()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got jsonTable
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatalf("%s: invalid JSON: %v", tt.name, err)
+		}
+		want := jsonTable{
+			Len:    len(keys),
+			Level0: table.level0.uint32s(),
+			Level1: table.level1.uint32s(),
+			Keys:   tt.wantKeys,
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %+v; want %+v", tt.name, got, want)
+		}
+	}
+}
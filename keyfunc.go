@@ -0,0 +1,28 @@
+package mph
+
+// A KeyEncoder appends the byte encoding of key to dst and returns the
+// extended slice, in the manner of strconv.AppendInt. Distinct keys must
+// have distinct encodings, and equal keys equal ones.
+type KeyEncoder[K any] func(dst []byte, key K) []byte
+
+// BuildFunc builds a Table from keys of any type, such as structs, using
+// encode to turn each key into the bytes that are hashed and stored. The
+// encodings are written into one shared buffer, so no slice is allocated
+// per key. Otherwise BuildFunc is like BuildWithOptions.
+func BuildFunc[K any](keys []K, encode KeyEncoder[K], opts ...Option) (*Table, error) {
+	b := NewBuilder(opts...)
+	var buf []byte
+	for _, k := range keys {
+		buf = encode(buf[:0], k)
+		b.AddBytes(buf)
+	}
+	return b.Build()
+}
+
+// LookupFunc searches for key in t, which must have been built by BuildFunc
+// with an equivalent encode, and returns its index and whether it was
+// found.
+func LookupFunc[K any](t *Table, key K, encode KeyEncoder[K]) (n uint32, ok bool) {
+	var buf [64]byte
+	return lookup(t, encode(buf[:0], key))
+}
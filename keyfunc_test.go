@@ -0,0 +1,40 @@
+package mph
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+type testPoint struct {
+	X, Y int32
+	Name string
+}
+
+func appendTestPoint(dst []byte, p testPoint) []byte {
+	var b [8]byte
+	binary.LittleEndian.PutUint32(b[:], uint32(p.X))
+	binary.LittleEndian.PutUint32(b[4:], uint32(p.Y))
+	return append(append(dst, b[:]...), p.Name...)
+}
+
+func TestBuildFunc(t *testing.T) {
+	var keys []testPoint
+	for i := int32(0); i < 100; i++ {
+		keys = append(keys, testPoint{i, -i, "p"}, testPoint{i, i, "q"})
+	}
+	table, err := BuildFunc(keys, appendTestPoint)
+	if err != nil {
+		t.Fatalf("BuildFunc: %v", err)
+	}
+	for i, k := range keys {
+		if n, ok := LookupFunc(table, k, appendTestPoint); !ok || int(n) != i {
+			t.Errorf("LookupFunc(%v): got %d, %t; want %d, true", k, n, ok, i)
+		}
+	}
+	if _, ok := LookupFunc(table, testPoint{1, 2, "p"}, appendTestPoint); ok {
+		t.Errorf("LookupFunc({1 2 p}): got ok; want !ok")
+	}
+	if _, err := BuildFunc([]testPoint{{1, 1, "p"}, {1, 1, "p"}}, appendTestPoint); err == nil {
+		t.Errorf("BuildFunc(duplicates): got nil error")
+	}
+}
@@ -0,0 +1,303 @@
+package mph
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"unsafe"
+)
+
+// A keyPool stores keys back to back in a single buffer, so that a table
+// costs two allocations for its keys, and four bytes of overhead per key,
+// however many keys it has.
+//
+// A pool built with WithBorrowedKeys instead refers to the keys of the
+// caller in borrowed, and has no data or offsets; one front coded with
+// WithFrontCoding holds them in front instead. A pool laid out by
+// WithWeights holds the keys in the order of their level1 slots, key i at
+// position slotOf[i], with an empty position for each free slot.
+type keyPool struct {
+	data    []byte
+	offsets []uint32 // key i is data[offsets[i]:offsets[i+1]]; empty if there are no keys
+
+	borrowed [][]byte // key i is borrowed[i], if not nil
+	nbytes   int      // total length of the borrowed keys
+
+	front  *frontPool
+	slotOf []uint32
+}
+
+// errPoolTooLarge is returned when building a table from keys whose total
+// length does not fit the uint32 offsets of a keyPool.
+var errPoolTooLarge = errors.New("mph: keys exceed 4 GiB in total")
+
+// errTooManyKeys is returned when building a table from more keys than its
+// uint32 indices can number, leaving NotFound unused.
+var errTooManyKeys = errors.New("mph: too many keys for one table; use BuildSharded")
+
+// newKeyPool copies keys into a new pool.
+func newKeyPool[T ~string | ~[]byte](keys []T) (keyPool, error) {
+	size := 0
+	for _, k := range keys {
+		size += len(k)
+	}
+	if uint64(size) > math.MaxUint32 {
+		return keyPool{}, errPoolTooLarge
+	}
+	if uint64(len(keys)) >= math.MaxUint32 {
+		return keyPool{}, errTooManyKeys
+	}
+	p := keyPool{
+		data:    make([]byte, 0, size),
+		offsets: make([]uint32, 1, len(keys)+1),
+	}
+	for _, k := range keys {
+		p.data = append(p.data, k...)
+		p.offsets = append(p.offsets, uint32(len(p.data)))
+	}
+	return p, nil
+}
+
+// WithBorrowedKeys makes BuildWithOptions keep references to keys instead
+// of copying them into the table, which saves a copy of the key bytes, for
+// example of keys sliced from a memory-mapped file. The caller must not
+// modify keys, or the bytes of any key, while the table is in use. Lookups
+// are slightly slower, since keys are no longer stored back to back.
+//
+// A borrowed key costs the table no memory, but a []byte key costs the
+// slice header of keys, which is not copied, and a string key a new slice
+// header. Clone copies the keys, so a clone no longer depends on them;
+// serializing the table writes the keys as usual.
+func WithBorrowedKeys() Option {
+	return func(c *buildConfig) {
+		c.borrowKeys = true
+	}
+}
+
+// borrowKeyPool returns a pool that refers to keys without copying them.
+func borrowKeyPool[T ~string | ~[]byte](keys []T) (keyPool, error) {
+	if len(keys) == 0 {
+		return newKeyPool(keys)
+	}
+	var p keyPool
+	if reflect.TypeOf(keys).Elem().Kind() == reflect.String {
+		p.borrowed = make([][]byte, len(keys))
+		for i := range keys {
+			p.borrowed[i] = stringBytes(string(keys[i]))
+		}
+	} else {
+		// T has the memory layout of []byte.
+		p.borrowed = *(*[][]byte)(unsafe.Pointer(&keys))
+	}
+	for _, k := range p.borrowed {
+		p.nbytes += len(k)
+	}
+	if uint64(p.nbytes) > math.MaxUint32 {
+		return keyPool{}, errPoolTooLarge
+	}
+	if uint64(len(keys)) >= math.MaxUint32 {
+		return keyPool{}, errTooManyKeys
+	}
+	return p, nil
+}
+
+// poolFromLens returns a pool of the keys in data, whose lengths are lens.
+// The keys alias data. It returns false if the lengths do not add up to
+// len(data).
+func poolFromLens(data []byte, lens []uint32) (keyPool, bool) {
+	p := keyPool{data: data, offsets: make([]uint32, len(lens)+1)}
+	var off uint64
+	for i, l := range lens {
+		off += uint64(l)
+		if off > uint64(len(data)) {
+			return keyPool{}, false
+		}
+		p.offsets[i+1] = uint32(off)
+	}
+	return p, off == uint64(len(data))
+}
+
+func (p *keyPool) len() int {
+	if p.borrowed != nil {
+		return len(p.borrowed)
+	}
+	if p.front != nil {
+		return p.front.n
+	}
+	if p.slotOf != nil {
+		return len(p.slotOf)
+	}
+	if len(p.offsets) == 0 {
+		return 0
+	}
+	return len(p.offsets) - 1
+}
+
+// key returns key i. Its capacity is limited to its length, so appending to
+// it does not overwrite the next key. A front coded key is copied.
+func (p *keyPool) key(i int) []byte {
+	if p.borrowed != nil {
+		k := p.borrowed[i]
+		return k[:len(k):len(k)]
+	}
+	if p.front != nil {
+		return p.front.key(i)
+	}
+	if p.slotOf != nil {
+		i = int(p.slotOf[i])
+	}
+	o := p.offsets[i : i+2 : i+2]
+	return p.data[o[0]:o[1]:o[1]]
+}
+
+// width returns the length of the keys if they all have the same non-zero
+// length, and 0 otherwise. Key i of a pool of width w is data[i*w:(i+1)*w],
+// which a lookup can find without loading the offsets. Borrowed keys are
+// not back to back, nor are front coded ones or ones in slot order, so
+// their width is 0.
+func (p *keyPool) width() int {
+	if p.borrowed != nil || p.front != nil || p.slotOf != nil || p.len() == 0 {
+		return 0
+	}
+	w := p.offsets[1]
+	for i := 2; i < len(p.offsets); i++ {
+		if p.offsets[i]-p.offsets[i-1] != w {
+			return 0
+		}
+	}
+	return int(w)
+}
+
+// equalFixed reports whether s equals k, which has length w. Keys of 4, 8,
+// and 16 bytes, such as 32- and 64-bit IDs and UUIDs, are compared a word
+// at a time.
+func equalFixed[T ~string | ~[]byte](s T, k []byte, w int) bool {
+	if len(s) != w {
+		return false
+	}
+	switch w {
+	case 4:
+		return wyr4(s, 0) == wyr4(k, 0)
+	case 8:
+		return wyr8(s, 0) == wyr8(k, 0)
+	case 16:
+		return wyr8(s, 0) == wyr8(k, 0) && wyr8(s, 8) == wyr8(k, 8)
+	}
+	return string(s) == string(k)
+}
+
+// size returns the total length of the keys.
+func (p *keyPool) size() int {
+	if p.borrowed != nil {
+		return p.nbytes
+	}
+	if p.front != nil {
+		return p.front.nbytes
+	}
+	if len(p.offsets) == 0 {
+		return 0
+	}
+	return int(p.offsets[len(p.offsets)-1])
+}
+
+// filter removes the keys at the positions in drop, which must be in
+// increasing order, compacting p in place. The borrowed keys of the caller
+// are left alone.
+func (p *keyPool) filter(drop []int) {
+	if p.borrowed != nil {
+		kept := make([][]byte, 0, len(p.borrowed)-len(drop))
+		for i, k := range p.borrowed {
+			if len(drop) > 0 && drop[0] == i {
+				drop = drop[1:]
+				p.nbytes -= len(k)
+				continue
+			}
+			kept = append(kept, k)
+		}
+		p.borrowed = kept
+		return
+	}
+	w, n := 0, 0
+	for i := 0; i < p.len(); i++ {
+		if len(drop) > 0 && drop[0] == i {
+			drop = drop[1:]
+			continue
+		}
+		k := p.key(i)
+		w += copy(p.data[w:], k)
+		n++
+		p.offsets[n] = uint32(w)
+	}
+	p.data = p.data[:w]
+	p.offsets = p.offsets[:n+1]
+}
+
+// permute returns a pool whose key i is key order[i] of p. A pool that
+// borrows its keys still borrows them.
+func (p *keyPool) permute(order []int) keyPool {
+	if p.borrowed != nil {
+		q := keyPool{borrowed: make([][]byte, len(order)), nbytes: p.nbytes}
+		for i, j := range order {
+			q.borrowed[i] = p.borrowed[j]
+		}
+		return q
+	}
+	q := keyPool{
+		data:    make([]byte, 0, p.size()),
+		offsets: make([]uint32, 1, len(order)+1),
+	}
+	for _, j := range order {
+		q.data = append(q.data, p.key(j)...)
+		q.offsets = append(q.offsets, uint32(len(q.data)))
+	}
+	return q
+}
+
+// equal reports whether p and q hold the same keys.
+func (p *keyPool) equal(q *keyPool) bool {
+	if p.plain() && q.plain() {
+		return equalUint32s(p.offsets, q.offsets) && string(p.data[:p.size()]) == string(q.data[:q.size()])
+	}
+	if p.len() != q.len() {
+		return false
+	}
+	for i := 0; i < p.len(); i++ {
+		if string(p.key(i)) != string(q.key(i)) {
+			return false
+		}
+	}
+	return true
+}
+
+// plain reports whether p holds its keys in a buffer and offsets, in index
+// order.
+func (p *keyPool) plain() bool {
+	return p.borrowed == nil && p.front == nil && p.slotOf == nil
+}
+
+// owned returns p with its keys in a buffer and offsets, in index order,
+// copying them if p borrows them, front codes them, or lays them out in
+// slot order.
+func (p *keyPool) owned() keyPool {
+	if p.plain() {
+		return *p
+	}
+	keys := p.borrowed
+	if keys == nil {
+		keys = make([][]byte, p.len())
+		for i := range keys {
+			keys[i] = p.key(i)
+		}
+	}
+	q, _ := newKeyPool(keys) // the sizes were checked when p was made
+	return q
+}
+
+// stored returns the memory used by the keys of p, not counting offsets,
+// which is their total length unless they are front coded.
+func (p *keyPool) stored() int {
+	if p.front != nil {
+		return p.front.size()
+	}
+	return p.size()
+}
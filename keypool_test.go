@@ -0,0 +1,202 @@
+package mph
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestKeyPool_filter(t *testing.T) {
+	p, err := newKeyPool([]string{"a", "bb", "", "ccc", "dd", "e"})
+	if err != nil {
+		t.Fatalf("newKeyPool: %v", err)
+	}
+	p.filter([]int{1, 2, 5})
+	want := []string{"a", "ccc", "dd"}
+	if p.len() != len(want) || p.size() != 6 {
+		t.Fatalf("filter: got %d keys of %d bytes; want %d of 6", p.len(), p.size(), len(want))
+	}
+	for i, k := range want {
+		if got := string(p.key(i)); got != k {
+			t.Errorf("key(%d): got %q; want %q", i, got, k)
+		}
+	}
+}
+
+func TestLoadBytes_allocs(t *testing.T) {
+	var keys []string
+	for i := 0; i < 10000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	data, err := Build(keys).MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	// The keys share one buffer, so loading allocates the same small number
+	// of times however many keys there are.
+	allocs := testing.AllocsPerRun(10, func() {
+		LoadBytes(data)
+	})
+	if allocs > 4 {
+		t.Errorf("LoadBytes: got %v allocs; want at most 4", allocs)
+	}
+}
+
+func TestKeyPool_width(t *testing.T) {
+	for _, tt := range []struct {
+		keys []string
+		want int
+	}{
+		{nil, 0},
+		{[]string{""}, 0},
+		{[]string{"a"}, 1},
+		{[]string{"ab", "cd", "ef"}, 2},
+		{[]string{"ab", "cd", "e"}, 0},
+		{[]string{"ab", "c", "de"}, 0},
+	} {
+		p, err := newKeyPool(tt.keys)
+		if err != nil {
+			t.Fatalf("newKeyPool: %v", err)
+		}
+		if got := p.width(); got != tt.want {
+			t.Errorf("width(%q): got %d; want %d", tt.keys, got, tt.want)
+		}
+	}
+}
+
+func TestLookup_fixedWidth(t *testing.T) {
+	for _, w := range []int{4, 5, 8, 16} {
+		keys := make([]string, 1000)
+		misses := []string{"", "x", strings.Repeat("y", w+1)}
+		for i := range keys {
+			s := strconv.Itoa(i)
+			keys[i] = strings.Repeat("k", w-len(s)) + s
+			misses = append(misses, strings.Repeat("m", w-len(s))+s)
+		}
+		table := Build(keys)
+		if table.keyWidth != w {
+			t.Fatalf("Build(%d-byte keys): got keyWidth %d", w, table.keyWidth)
+		}
+		checkTable(t, table, keys, misses)
+		loaded, err := LoadBytes(mustMarshal(t, table))
+		if err != nil {
+			t.Fatalf("LoadBytes: %v", err)
+		}
+		if loaded.keyWidth != w {
+			t.Errorf("LoadBytes(%d-byte keys): got keyWidth %d", w, loaded.keyWidth)
+		}
+		out := make([]uint32, len(misses))
+		if n := LookupAll(loaded, misses, out); n != 0 {
+			t.Errorf("LookupAll(misses): found %d", n)
+		}
+		out = make([]uint32, len(keys))
+		if n := LookupAll(loaded, keys, out); n != len(keys) {
+			t.Errorf("LookupAll(keys): found %d; want %d", n, len(keys))
+		}
+	}
+	if w := Build([]string{"a", "bb"}).keyWidth; w != 0 {
+		t.Errorf("Build(mixed lengths): got keyWidth %d; want 0", w)
+	}
+}
+
+func BenchmarkLookup_fixedWidth(b *testing.B) {
+	for _, w := range []int{8, 16} {
+		keys := make([]string, 1<<20)
+		for i := range keys {
+			s := strconv.Itoa(i)
+			keys[i] = strings.Repeat("k", w-len(s)) + s
+		}
+		stride := Build(keys)
+		// Query in random order, so that the loads of the stored keys and
+		// offsets miss the cache as in real use.
+		queries := append([]string(nil), keys...)
+		rand.New(rand.NewSource(1)).Shuffle(len(queries), func(i, j int) {
+			queries[i], queries[j] = queries[j], queries[i]
+		})
+		offsets := stride.CloneShared()
+		offsets.keyWidth = 0
+		for _, bc := range []struct {
+			name  string
+			table *Table
+		}{{"offsets", offsets}, {"stride", stride}} {
+			b.Run(strconv.Itoa(w)+"/"+bc.name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					bc.table.Lookup(queries[i%len(queries)])
+				}
+			})
+		}
+	}
+}
+
+func TestWithBorrowedKeys(t *testing.T) {
+	var strs []string
+	var file []byte
+	for i := 0; i < 1000; i++ {
+		s := "key-" + strconv.Itoa(i)
+		strs = append(strs, s)
+		file = append(file, s...)
+		file = append(file, '\n')
+	}
+	// Keys sliced from one buffer, as from a memory-mapped file.
+	var keys [][]byte
+	for off := 0; off < len(file); {
+		n := strings.IndexByte(string(file[off:]), '\n')
+		keys = append(keys, file[off:off+n])
+		off += n + 1
+	}
+	table, err := BuildWithOptions(keys, WithBorrowedKeys())
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	checkTable(t, table, strs, []string{"quux", "key-1000"})
+	for i, k := range keys {
+		if got, _ := table.Key(uint32(i)); &got[0] != &k[0] {
+			t.Fatalf("Key(%d): does not alias the borrowed key", i)
+		}
+	}
+	want := Build(keys)
+	if !Equal(table, want) || !Equal(want, table) {
+		t.Errorf("Equal(borrowed, copied): got false; want true")
+	}
+	if got, want := string(mustMarshal(t, table)), string(mustMarshal(t, want)); got != want {
+		t.Errorf("MarshalBinary(borrowed): differs from a table that copied its keys")
+	}
+	if s := table.Stats(); s.KeyBytes != want.Stats().KeyBytes {
+		t.Errorf("Stats: got KeyBytes %d; want %d", s.KeyBytes, want.Stats().KeyBytes)
+	}
+
+	// A clone owns its keys.
+	clone := table.Clone()
+	for i := range file {
+		file[i] = 'x'
+	}
+	checkTable(t, clone, strs, []string{"quux"})
+
+	strTable, err := BuildWithOptions(strs, WithBorrowedKeys())
+	if err != nil {
+		t.Fatalf("BuildWithOptions(strings): %v", err)
+	}
+	checkTable(t, strTable, strs, []string{"quux"})
+}
+
+func TestWithBorrowedKeys_dedup(t *testing.T) {
+	keys := [][]byte{[]byte("a"), []byte("b"), []byte("a"), []byte("c")}
+	var removed int
+	table, err := BuildWithOptions(keys, WithBorrowedKeys(), WithDedup(&removed))
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("WithDedup: got %d removed; want 1", removed)
+	}
+	checkTable(t, table, []string{"a", "b", "c"}, []string{"d"})
+	if string(keys[2]) != "a" || string(keys[3]) != "c" {
+		t.Errorf("BuildWithOptions: modified the borrowed keys: %q", keys)
+	}
+	merged, err := Merge(table, Build([]string{"c", "d"}), func([]byte) bool { return true })
+	if err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	checkTable(t, merged, []string{"a", "b", "c", "d"}, []string{"e"})
+}
@@ -0,0 +1,56 @@
+package mph
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+)
+
+// A KeySet is a set of keys, such as the trie of package trie, or of a
+// tokenizer that keeps its dictionary as a trie anyway, against which a
+// table checks lookups in place of its keys; see Table.WithKeySet.
+type KeySet interface {
+	// Contains reports whether key is in the set. It must not modify or
+	// retain key.
+	Contains(key []byte) bool
+}
+
+// WithKeySet returns a hash-only table that shares the level arrays of t
+// and checks the keys that it is asked to look up against set instead of
+// its own keys: a key is found if set contains it, at the index that t
+// gives it. Lookups are then exact, as long as set holds the keys of t and
+// no others, and the table costs only set and the few bits per key of its
+// hash function, rather than the bytes of the keys. With WithNormalizer,
+// set must hold the normalized keys.
+//
+// If t stores its keys, WithKeySet returns an error unless set contains
+// each of them; a hash-only t, such as one loaded without keys, is taken
+// to have been built from the keys of set. The returned table cannot tell
+// the candidates of a k-perfect table apart, so WithKeySet returns an
+// error for those. As for any hash-only table, serializing the returned
+// table omits the keys, and set with them.
+func (t *Table) WithKeySet(set KeySet) (*Table, error) {
+	if t.slotKeys > 1 {
+		return nil, errors.New("mph: a key set cannot check the keys of a k-perfect table")
+	}
+	for i := 0; i < t.keys.len(); i++ {
+		if k := t.keys.key(i); !set.Contains(k) {
+			return nil, fmt.Errorf("mph: key %q is not in the key set", k)
+		}
+	}
+	c := t.withoutKeys()
+	c.keySet = set
+	return c, nil
+}
+
+// containsKey reports whether the key set of t contains s.
+func containsKey[T ~string | ~[]byte](t *Table, s T) bool {
+	var b []byte
+	if unsafe.Sizeof(s) == unsafe.Sizeof("") {
+		// T is a string type, whose bytes are viewed without copying them.
+		b = stringBytes(string(s))
+	} else {
+		b = *(*[]byte)(unsafe.Pointer(&s))
+	}
+	return t.keySet.Contains(b)
+}
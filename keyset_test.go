@@ -0,0 +1,107 @@
+package mph
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/ikawaha/mph/trie"
+)
+
+// mapSet is a KeySet of the keys of a map.
+type mapSet map[string]bool
+
+func (s mapSet) Contains(key []byte) bool { return s[string(key)] }
+
+func TestWithKeySet(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, "word"+strconv.Itoa(i))
+	}
+	extra := []string{"", "word", "word1000", "word-1"}
+	for _, a := range []Algorithm{CHD, BBHash, RecSplit, PTHash, BDZ} {
+		table, err := BuildWithOptions(keys, WithAlgorithm(a))
+		if err != nil {
+			t.Fatalf("BuildWithOptions(%v): %v", a, err)
+		}
+		c, err := table.WithKeySet(trie.New(keys))
+		if err != nil {
+			t.Fatalf("WithKeySet(%v): %v", a, err)
+		}
+		checkTable(t, c, keys, extra)
+		if _, ok := c.Key(0); ok {
+			t.Errorf("Key(0): got ok; want !ok")
+		}
+		if _, _, err := LookupChecked(c, keys[0]); err != nil {
+			t.Errorf("LookupChecked: got err=%v; want nil", err)
+		}
+		out := make([]uint32, len(extra))
+		if n := LookupAll(c, extra, out); n != 0 {
+			t.Errorf("LookupAll(extra): found %d keys; want 0", n)
+		}
+		// A table loaded without keys takes the set on trust.
+		data, err := c.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary: %v", err)
+		}
+		loaded, err := LoadBytes(data)
+		if err != nil {
+			t.Fatalf("LoadBytes: %v", err)
+		}
+		c, err = loaded.WithKeySet(trie.New(keys))
+		if err != nil {
+			t.Fatalf("WithKeySet(loaded): %v", err)
+		}
+		checkTable(t, c, keys, extra)
+	}
+}
+
+func TestWithKeySet_errors(t *testing.T) {
+	keys := []string{"foo", "bar", "baz"}
+	if _, err := Build(keys).WithKeySet(mapSet{"foo": true, "bar": true}); err == nil {
+		t.Errorf("WithKeySet(missing baz): got no error")
+	}
+	table, err := BuildWithOptions(keys, WithKPerfect(2))
+	if err != nil {
+		t.Fatalf("BuildWithOptions(WithKPerfect): %v", err)
+	}
+	if _, err := table.WithKeySet(mapSet{"foo": true, "bar": true, "baz": true}); err == nil {
+		t.Errorf("WithKeySet(k-perfect): got no error")
+	}
+	if _, _, err := LookupChecked(Build(keys).WithoutKeys(), "foo"); !errors.Is(err, ErrNoKeys) {
+		t.Errorf("LookupChecked(hash-only): got err=%v; want %v", err, ErrNoKeys)
+	}
+}
+
+func TestWithKeySet_normalizer(t *testing.T) {
+	table, err := BuildWithOptions([]string{"Foo", "BAR"}, WithNormalizer(bytes.ToLower))
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	c, err := table.WithKeySet(mapSet{"foo": true, "bar": true})
+	if err != nil {
+		t.Fatalf("WithKeySet: %v", err)
+	}
+	checkTable(t, c, []string{"FOO", "bar"}, []string{"baz"})
+}
+
+func TestWithKeySet_allocs(t *testing.T) {
+	keys := []string{"foo", "bar", "baz"}
+	c, err := Build(keys).WithKeySet(trie.New(keys))
+	if err != nil {
+		t.Fatalf("WithKeySet: %v", err)
+	}
+	hit := []byte("bar")
+	for _, tt := range []struct {
+		name string
+		fn   func()
+	}{
+		{"Lookup", func() { c.Lookup("foo") }},
+		{"LookupBytes", func() { c.LookupBytes(hit) }},
+	} {
+		if allocs := testing.AllocsPerRun(100, tt.fn); allocs != 0 {
+			t.Errorf("%s: got %v allocs; want 0", tt.name, allocs)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package mph
+
+import (
+	"context"
+	"fmt"
+)
+
+// maxK is the largest number of keys per slot of a k-perfect table, which
+// the header stores in four bits.
+const maxK = 16
+
+// WithKPerfect makes BuildWithOptions build a k-perfect table, whose level1
+// slots each take up to k keys rather than one. The seed of a bucket then
+// only has to avoid the slots that are full, so the seed search is
+// shorter, and seeds smaller, than for a minimal perfect hash function: a
+// million keys build in half the time with k=4. A lookup in turn compares
+// s with each of the up to k candidates of its slot, which takes about
+// three times as long with k=4. Level1 has k entries per slot and about
+// as many entries as keys: the options that size it, WithLoadFactor and
+// WithExactSizes, size the slots for a k-th of the keys. A k of 0 or 1
+// builds an ordinary table.
+//
+// Only CHD supports k-perfect tables, and WithParallelism has no effect on
+// their build. A hash-only k-perfect table returns the first candidate
+// whose fingerprint matches s (see WithFingerprints), so it can only tell
+// its keys apart by their fingerprints, which WithoutKeys keeps for it and
+// BuildMPHF cannot; AppendCandidates lists the candidates of a key.
+// BuildExternal, Gen and GenC do not support k-perfect tables.
+func WithKPerfect(k int) Option {
+	return func(c *buildConfig) {
+		c.k = k
+	}
+}
+
+// checkK returns an error unless the k of c is supported.
+func (c *buildConfig) checkK() error {
+	if c.k < 0 || c.k > maxK {
+		return fmt.Errorf("mph: k %d is not in [0, %d]", c.k, maxK)
+	}
+	if c.k > 1 && c.algorithm != CHD {
+		return fmt.Errorf("mph: the %v algorithm does not support k-perfect tables", c.algorithm)
+	}
+	return nil
+}
+
+// slotKeys returns the number of keys per level1 slot of the table c
+// builds.
+func (c *buildConfig) slotKeys() int {
+	if c.k > 1 {
+		return c.k
+	}
+	return 1
+}
+
+// level1Slots returns the number of level1 slots for nkeys keys, k per
+// slot.
+func (c *buildConfig) level1Slots(nkeys int) int {
+	if c.sizes[1] != 0 {
+		return c.sizes[1]
+	}
+	k := c.slotKeys()
+	return c.level1Len((nkeys + k - 1) / k)
+}
+
+// K returns the number of keys that a level1 slot of t holds at most, which
+// is 1 unless t was built WithKPerfect.
+func (t *Table) K() int {
+	if t == nil || t.slotKeys == 0 {
+		return 1
+	}
+	return t.slotKeys
+}
+
+// placeK is place for a k-perfect table with n1 slots of k keys. Slot n of
+// level1 is level1[n*k:(n+1)*k], whose first entries are the keys in the
+// slot and whose other entries repeat the last key, or are zero if the slot
+// is empty, so that candidates end at the first repeated entry.
+func placeK(ctx context.Context, index bucketIndex, n1, k int, hash func(i int, seed uint32) uint32, cfg *buildConfig) (level0, level1 []uint32, err error) {
+	level0 = make([]uint32, index.len())
+	level1 = make([]uint32, n1*k)
+	slots1 := newSlotMap(n1)
+	sc := cfg.scratchSpace()
+	sc.buckets = index.bySize(sc.buckets)
+	buckets := sc.buckets
+	limit := cfg.seedLimit()
+
+	count := make([]uint8, n1) // the number of keys in each slot
+	var tmpPos []int
+	for b, bucket := range buckets {
+		if b%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, nil, err
+			}
+		}
+		var seed uint32
+	trySeed:
+		tmpPos = tmpPos[:0]
+		for _, i := range bucket.vals {
+			n := slots1.slot(hash(int(i), seed))
+			if int(count[n]) == k {
+				for _, p := range tmpPos {
+					count[p/k]--
+				}
+				if uint64(seed)+1 >= limit {
+					return nil, nil, ErrBuildFailed
+				}
+				seed++
+				goto trySeed
+			}
+			tmpPos = append(tmpPos, n*k+int(count[n]))
+			count[n]++
+		}
+		for j, p := range tmpPos {
+			level1[p] = bucket.vals[j]
+		}
+		level0[bucket.n] = seed
+		if cfg.progress != nil {
+			cfg.progress(b+1, len(buckets))
+		}
+	}
+	for n, c := range count {
+		for j := int(c); j > 0 && j < k; j++ {
+			level1[n*k+j] = level1[n*k+j-1]
+		}
+	}
+	return level0, level1, nil
+}
+
+// lookupSlot is the end of lookupKey for a k-perfect t, where slot is the
+// level1 slot of s and kh its key hash. It is kept out of lookupKey so that
+// the checks of ordinary tables stay inline.
+//
+//go:noinline
+func lookupSlot[T ~string | ~[]byte](t *Table, slot int, kh uint64, s T) (n uint32, ok bool) {
+	k := t.slotKeys
+	first := t.level1.get(slot * k)
+	for j, prev := 0, first; j < k; j++ {
+		n := t.level1.get(slot*k + j)
+		if j > 0 && n == prev {
+			break
+		}
+		prev = n
+		if t.hashOnly {
+			if matchFingerprint(t, n, kh, s) {
+				return n, true
+			}
+			continue
+		}
+		if w := t.keyWidth; w != 0 {
+			off := int(n) * w
+			if equalFixed(s, t.keys.data[off:off+w], w) {
+				return n, true
+			}
+		} else if f := t.keys.front; f != nil {
+			if frontEqual(f, int(n), s) {
+				return n, true
+			}
+		} else if string(s) == string(t.keys.key(int(n))) {
+			return n, true
+		}
+	}
+	return first, false
+}
+
+// AppendCandidates appends to dst the indices of the keys of t that s can be
+// equal to, without comparing s with them, and returns the extended slice.
+// There are at most t.K() candidates, in the order in which Lookup compares
+// them, and at most one unless t is k-perfect. A key of t is one of its own
+// candidates; no key is a candidate for an empty table, or for a key that
+// the prefilter of t or its hash function rules out. Fingerprints are not
+// checked.
+func AppendCandidates[T ~string | ~[]byte](dst []uint32, t *Table, s T) []uint32 {
+	if t.Len() == 0 {
+		return dst
+	}
+	if t.normalize != nil {
+		return appendCandidates(dst, t, t.normalize(append([]byte(nil), s...)))
+	}
+	return appendCandidates(dst, t, s)
+}
+
+// appendCandidates is AppendCandidates for a non-empty t and a key that is
+// already normalized.
+func appendCandidates[T ~string | ~[]byte](dst []uint32, t *Table, s T) []uint32 {
+	kh := keyHash(t.hash, t.seed, s)
+	if t.prefilter.words != nil && !t.prefilter.mayContain(kh) {
+		return dst
+	}
+	if t.algo != CHD {
+		r, ok := rankKey(t, kh, s)
+		if !ok {
+			return dst
+		}
+		return append(dst, t.rankIndex(r))
+	}
+	seed := t.level0.get(t.level0Slots.slot(uint32(kh)))
+	slot := t.level1Slots.slot(level1Hash(t.hash, kh, seed, s))
+	k := t.K()
+	for j := 0; j < k; j++ {
+		n := t.level1.get(slot*k + j)
+		if j > 0 && n == dst[len(dst)-1] {
+			break
+		}
+		dst = append(dst, n)
+	}
+	return dst
+}
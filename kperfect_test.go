@@ -0,0 +1,155 @@
+package mph
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWithKPerfect(t *testing.T) {
+	var keys []string
+	for i := 0; i < 5000; i++ {
+		keys = append(keys, "key"+strconv.Itoa(i))
+	}
+	extra := []string{"", "key-1", "key5000", "quux"}
+	base, err := BuildWithOptions(keys)
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	for _, h := range []Hash{Murmur3, Wyhash} {
+		for _, k := range []int{2, 4, 16} {
+			table, err := BuildWithOptions(keys, WithHash(h), WithKPerfect(k))
+			if err != nil {
+				t.Fatalf("BuildWithOptions(%v, k=%d): %v", h, k, err)
+			}
+			if table.K() != k {
+				t.Errorf("K(%v, k=%d): got %d", h, k, table.K())
+			}
+			checkTable(t, table, keys, extra)
+			if got, want := table.Stats().MaxSeed, base.Stats().MaxSeed; got >= want {
+				t.Errorf("Stats(%v, k=%d): got MaxSeed %d; want less than %d", h, k, got, want)
+			}
+			for i, key := range keys {
+				cands := AppendCandidates(nil, table, key)
+				if len(cands) == 0 || len(cands) > k || !containsIndex(cands, uint32(i)) {
+					t.Fatalf("AppendCandidates(%s): got %v; want at most %d including %d", key, cands, k, i)
+				}
+				if n := LookupUnchecked(table, key); n != cands[0] {
+					t.Errorf("LookupUnchecked(%s): got %d; want %d", key, n, cands[0])
+				}
+			}
+			out := make([]uint32, len(keys)+len(extra))
+			if n := LookupAll(table, append(keys[:len(keys):len(keys)], extra...), out); n != len(keys) {
+				t.Errorf("LookupAll(%v, k=%d): found %d keys; want %d", h, k, n, len(keys))
+			}
+
+			data, err := table.MarshalBinary()
+			if err != nil {
+				t.Fatalf("MarshalBinary: %v", err)
+			}
+			est, err := EstimateSize(len(keys), table.Stats().KeyBytes, WithHash(h), WithKPerfect(k))
+			if err != nil || est.File != len(data) {
+				t.Errorf("EstimateSize(%v, k=%d): got %d, %v; want %d", h, k, est.File, err, len(data))
+			}
+			var decoded Table
+			if err := decoded.UnmarshalBinary(data); err != nil {
+				t.Fatalf("UnmarshalBinary: %v", err)
+			}
+			if !Equal(&decoded, table) || Equal(&decoded, base) {
+				t.Errorf("UnmarshalBinary(%v, k=%d): decoded table differs", h, k)
+			}
+			checkTable(t, &decoded, keys, extra)
+			lazy, err := NewLazyTable(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("NewLazyTable: %v", err)
+			}
+			for i, key := range keys {
+				if n, ok, err := lazy.Lookup(key); !ok || n != uint32(i) || err != nil {
+					t.Fatalf("LazyTable.Lookup(%s): got %d, %t, %v; want %d, true, <nil>", key, n, ok, err, i)
+				}
+			}
+		}
+	}
+}
+
+func containsIndex(ns []uint32, n uint32) bool {
+	for _, m := range ns {
+		if m == n {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWithKPerfect_fingerprints(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	table, err := BuildWithOptions(keys, WithKPerfect(4))
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	fp, err := table.WithFingerprints(16)
+	if err != nil {
+		t.Fatalf("WithFingerprints: %v", err)
+	}
+	if fp.K() != 4 {
+		t.Errorf("K: got %d; want 4", fp.K())
+	}
+	checkTable(t, fp, keys, []string{"-1", "1000"})
+}
+
+func TestWithKPerfect_unsupported(t *testing.T) {
+	keys := []string{"foo", "bar", "baz"}
+	if _, err := BuildWithOptions(keys, WithKPerfect(-1)); err == nil || !strings.Contains(err.Error(), "[0, 16]") {
+		t.Errorf("BuildWithOptions(WithKPerfect(-1)): got err=%v; want one naming [0, 16]", err)
+	}
+	for _, opts := range [][]Option{
+		{WithKPerfect(maxK + 1)},
+		{WithKPerfect(2), WithAlgorithm(BDZ)},
+	} {
+		if _, err := BuildWithOptions(keys, opts...); err == nil {
+			t.Errorf("BuildWithOptions(%d options): got no error", len(opts))
+		}
+	}
+	table, err := BuildWithOptions(keys, WithKPerfect(2))
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	if err := table.Gen(io.Discard, "p", "t"); err == nil {
+		t.Errorf("Gen: got no error")
+	}
+	if err := table.GenC(io.Discard, "t"); err == nil {
+		t.Errorf("GenC: got no error")
+	}
+	err = BuildExternal(io.Discard, strings.NewReader("foo\nbar\n"), t.TempDir(), WithKPerfect(2))
+	if err == nil {
+		t.Errorf("BuildExternal: got no error")
+	}
+}
+
+func TestWithKPerfect_withoutKeys(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	table, err := BuildWithOptions(keys, WithKPerfect(4))
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	mphf := table.WithoutKeys()
+	for i, key := range keys {
+		if n, ok := mphf.Lookup(key); !ok || n != uint32(i) {
+			t.Errorf("Lookup(%s): got %d, %t; want %d, true", key, n, ok, i)
+		}
+	}
+	if again := mphf.WithoutKeys(); !Equal(again, mphf) {
+		t.Errorf("WithoutKeys of a hash-only table: dropped the fingerprints")
+	}
+	if _, err := BuildMPHF(keys, WithKPerfect(4)); err == nil {
+		t.Errorf("BuildMPHF(WithKPerfect(4)): got no error")
+	}
+}
@@ -0,0 +1,93 @@
+package mph
+
+import (
+	"bufio"
+	"io"
+)
+
+// A LazyTable is a read-only table whose level arrays are held in memory
+// but whose keys stay in the serialized table and are read on demand. Each
+// Lookup that finds a candidate of the right length reads that one key, or
+// each such candidate of a k-perfect table (see WithKPerfect), trading a
+// read from the underlying storage for not keeping the key pool, which
+// usually dominates the size of a table, in memory.
+type LazyTable struct {
+	t       Table
+	r       io.ReaderAt
+	offsets []int64 // offsets[i] is the position of key i in r; len(keys)+1 entries
+}
+
+// NewLazyTable reads the level arrays and key lengths of the serialized
+// table in r, as written by WriteTo or MarshalBinary, and returns a
+// LazyTable that reads keys from r as needed. r must remain valid and
+// unchanged while the table is in use. The checksum of the table is not
+// verified, since that would mean reading every key.
+func NewLazyTable(r io.ReaderAt) (*LazyTable, error) {
+	d := decoder{
+		r:    bufio.NewReader(io.NewSectionReader(r, 0, 1<<63-1)),
+		buf:  make([]byte, encodeBufSize),
+		size: -1,
+	}
+	if s, ok := r.(interface{ Size() int64 }); ok {
+		d.size = s.Size()
+	}
+	h, level0, level1, _, err := d.index(false)
+	if err != nil {
+		return nil, err
+	}
+	if h.hashOnly() {
+		return nil, ErrNoKeys
+	}
+	poolOffsets := d.keys(&h, false).offsets
+	if d.err != nil {
+		return nil, d.err
+	}
+	start := int64(h.size()) - 4 - int64(h.keyBytes)
+	offsets := make([]int64, len(poolOffsets))
+	for i, off := range poolOffsets {
+		offsets[i] = start + int64(off)
+	}
+	return &LazyTable{
+		t:       h.newTable(level0, level1, fingerprintArray{}, keyPool{}),
+		r:       r,
+		offsets: offsets,
+	}, nil
+}
+
+// Len returns the number of keys in t.
+func (t *LazyTable) Len() int {
+	return len(t.offsets) - 1
+}
+
+// Lookup searches for s in t and returns its index and whether it was
+// found. A non-nil error means the candidate key could not be read.
+func (t *LazyTable) Lookup(s string) (n uint32, ok bool, err error) {
+	if t.Len() == 0 {
+		return 0, false, nil
+	}
+	var buf [maxK]uint32
+	cands := appendCandidates(buf[:0], &t.t, s)
+	if len(cands) == 0 {
+		return 0, false, nil
+	}
+	var key []byte
+	for _, n := range cands {
+		off, end := t.offsets[n], t.offsets[n+1]
+		if end-off != int64(len(s)) {
+			continue
+		}
+		if key == nil {
+			key = make([]byte, len(s))
+		}
+		if _, err := t.r.ReadAt(key, off); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return n, false, err
+		}
+		if string(key) == s {
+			return n, true, nil
+		}
+	}
+	return cands[0], false, nil
+}
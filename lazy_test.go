@@ -0,0 +1,59 @@
+package mph
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"testing"
+)
+
+func TestLazyTable(t *testing.T) {
+	var keys, extra []string
+	for i := 0; i < 2000; i++ {
+		s := strconv.Itoa(i)
+		if i < 1000 {
+			keys = append(keys, s)
+		} else {
+			extra = append(extra, s)
+		}
+	}
+	data, err := Build(keys).MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	table, err := NewLazyTable(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewLazyTable: %v", err)
+	}
+	if table.Len() != len(keys) {
+		t.Errorf("Len: got %d; want %d", table.Len(), len(keys))
+	}
+	for i, key := range keys {
+		n, ok, err := table.Lookup(key)
+		if err != nil || !ok || int(n) != i {
+			t.Errorf("Lookup(%s): got %d, %t, %v; want %d, true, <nil>", key, n, ok, err, i)
+		}
+	}
+	for _, key := range extra {
+		if _, ok, err := table.Lookup(key); ok || err != nil {
+			t.Errorf("Lookup(%s): got %t, %v; want false, <nil>", key, ok, err)
+		}
+	}
+}
+
+func TestLazyTable_readError(t *testing.T) {
+	keys := []string{"foo", "bar", "baz"}
+	data, err := Build(keys).MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	table, err := NewLazyTable(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewLazyTable: %v", err)
+	}
+	// Drop the key bytes from the underlying data.
+	table.r = bytes.NewReader(data[:len(data)-13])
+	if _, _, err := table.Lookup("foo"); err != io.ErrUnexpectedEOF {
+		t.Errorf("Lookup: got err=%v; want %v", err, io.ErrUnexpectedEOF)
+	}
+}
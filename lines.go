@@ -0,0 +1,73 @@
+package mph
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+)
+
+// BuildFromReader builds a Table from the lines of r, one key per line, as
+// in a word list. A key's index is the number of keys on the lines before
+// it. Line endings ("\n" or "\r\n") are not part of the keys, and empty
+// lines are ignored. WithTrimSpace and WithComments control how lines are
+// read; the other options apply as for BuildWithOptions.
+func BuildFromReader(r io.Reader, opts ...Option) (*Table, error) {
+	return BuildFromReaderContext(context.Background(), r, opts...)
+}
+
+// BuildFromReaderContext is like BuildFromReader but may be canceled
+// through ctx, as for BuildContext.
+func BuildFromReaderContext(ctx context.Context, r io.Reader, opts ...Option) (*Table, error) {
+	b := NewBuilder(opts...)
+	cfg := newBuildConfig(opts)
+	err := cfg.readLines(r, func(key []byte) error {
+		b.AddBytes(key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b.BuildContext(ctx)
+}
+
+// readLines calls fn with the key on each line of r, stopping at the first
+// error. The key is only valid until fn returns.
+func (c *buildConfig) readLines(r io.Reader, fn func(key []byte) error) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			long := append([]byte(nil), line...)
+			for err == bufio.ErrBufferFull {
+				line, err = br.ReadSlice('\n')
+				long = append(long, line...)
+			}
+			line = long
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if key, ok := c.parseLine(line); ok {
+			if err := fn(key); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// parseLine returns the key on line and whether there is one.
+func (c *buildConfig) parseLine(line []byte) ([]byte, bool) {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	if c.trimSpace {
+		line = bytes.TrimSpace(line)
+	}
+	if c.comment != "" && bytes.HasPrefix(line, []byte(c.comment)) {
+		return nil, false
+	}
+	return line, len(line) > 0
+}
@@ -0,0 +1,49 @@
+package mph
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestBuildFromReader(t *testing.T) {
+	long := strings.Repeat("x", 2*bufio.MaxScanTokenSize)
+	for _, tt := range []struct {
+		name  string
+		input string
+		opts  []Option
+		want  []string
+	}{
+		{
+			name:  "plain",
+			input: "foo\nbar\r\n\nbaz",
+			want:  []string{"foo", "bar", "baz"},
+		},
+		{
+			name:  "untrimmed",
+			input: " foo\nfoo \n# bar\n",
+			want:  []string{" foo", "foo ", "# bar"},
+		},
+		{
+			name:  "trim and comments",
+			input: "# words\n  foo \n\t\n  # bar\nbaz\n",
+			opts:  []Option{WithTrimSpace(), WithComments("#")},
+			want:  []string{"foo", "baz"},
+		},
+		{
+			name:  "long line",
+			input: "foo\n" + long + "\nbar\n",
+			want:  []string{"foo", long, "bar"},
+		},
+	} {
+		table, err := BuildFromReader(strings.NewReader(tt.input), tt.opts...)
+		if err != nil {
+			t.Errorf("%s: BuildFromReader: %v", tt.name, err)
+			continue
+		}
+		if table.Len() != len(tt.want) {
+			t.Errorf("%s: got %d keys; want %d", tt.name, table.Len(), len(tt.want))
+		}
+		checkTable(t, table, tt.want, []string{"quux"})
+	}
+}
@@ -0,0 +1,162 @@
+package mph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"io"
+	"sort"
+)
+
+// A Map is an immutable map from keys to values of type V backed by a
+// Table. The values are stored in a slice indexed by the Table.
+type Map[V any] struct {
+	table  *Table
+	values []V
+}
+
+// BuildMap builds a Map in which keys[i] maps to values[i]. It returns a
+// *DuplicateKeyError if keys contains duplicates.
+func BuildMap[K ~string | ~[]byte, V any](keys []K, values []V) (*Map[V], error) {
+	if len(keys) != len(values) {
+		return nil, errors.New("mph: BuildMap: keys and values have different lengths")
+	}
+	table, err := BuildChecked(keys)
+	if err != nil {
+		return nil, err
+	}
+	return &Map[V]{
+		table:  table,
+		values: append([]V(nil), values...),
+	}, nil
+}
+
+// FromMap builds a Map with the same contents as m. The keys are indexed
+// in sorted order, so that the same m always gives the same Map.
+func FromMap[K ~string, V any](m map[K]V) (*Map[V], error) {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	values := make([]V, len(keys))
+	for i, k := range keys {
+		values[i] = m[k]
+	}
+	table, err := BuildChecked(keys)
+	if err != nil {
+		return nil, err
+	}
+	return &Map[V]{table: table, values: values}, nil
+}
+
+// Get returns the value for key and whether key is in m.
+func (m *Map[V]) Get(key string) (V, bool) {
+	return get(m, key)
+}
+
+// GetBytes is like Get but takes the key as a byte slice.
+func (m *Map[V]) GetBytes(key []byte) (V, bool) {
+	return get(m, key)
+}
+
+func get[V any, T ~string | ~[]byte](m *Map[V], key T) (v V, ok bool) {
+	n, ok := lookup(m.table, key)
+	if !ok {
+		return v, false
+	}
+	return m.values[n], true
+}
+
+// Len returns the number of keys in m.
+func (m *Map[V]) Len() int {
+	return len(m.values)
+}
+
+// Table returns the Table that m uses to index its values.
+func (m *Map[V]) Table() *Table {
+	return m.table
+}
+
+// The serialized form of a Map is the serialized form of its Table
+// followed by the gob encoding of its values, preceded by its length as a
+// little-endian uint64.
+
+// MarshalBinary implements encoding.BinaryMarshaler. The values are
+// encoded with encoding/gob, so V must be a type that gob can encode.
+func (m *Map[V]) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (m *Map[V]) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	if _, err := m.ReadFrom(r); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = ErrCorrupt
+		}
+		return err
+	}
+	if r.Len() != 0 {
+		return ErrCorrupt
+	}
+	return nil
+}
+
+// WriteTo implements io.WriterTo. The table is written in a streaming
+// fashion, but the encoded values are buffered in memory.
+func (m *Map[V]) WriteTo(w io.Writer) (int64, error) {
+	var vals bytes.Buffer
+	if err := gob.NewEncoder(&vals).Encode(m.values); err != nil {
+		return 0, err
+	}
+	n, err := m.table.WriteTo(w)
+	if err != nil {
+		return n, err
+	}
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(vals.Len()))
+	nn, err := w.Write(size[:])
+	n += int64(nn)
+	if err != nil {
+		return n, err
+	}
+	nn, err = w.Write(vals.Bytes())
+	return n + int64(nn), err
+}
+
+// ReadFrom implements io.ReaderFrom. It reads a map in the form written by
+// WriteTo or MarshalBinary and replaces the contents of m.
+func (m *Map[V]) ReadFrom(r io.Reader) (int64, error) {
+	var table Table
+	n, err := table.ReadFrom(r)
+	if err != nil {
+		return n, err
+	}
+	var size [8]byte
+	nn, err := io.ReadFull(r, size[:])
+	n += int64(nn)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return n, err
+	}
+	cr := countingReader{r: io.LimitReader(r, int64(binary.LittleEndian.Uint64(size[:])))}
+	var values []V
+	err = gob.NewDecoder(&cr).Decode(&values)
+	n += cr.n
+	if err != nil {
+		return n, err
+	}
+	if len(values) != table.Len() {
+		return n, ErrCorrupt
+	}
+	m.table, m.values = &table, values
+	return n, nil
+}
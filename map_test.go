@@ -0,0 +1,78 @@
+package mph
+
+import (
+	"reflect"
+	"testing"
+)
+
+type mapValue struct {
+	Name  string
+	Count int
+}
+
+func TestMap(t *testing.T) {
+	keys := []string{"foo", "foo2", "bar", "baz"}
+	values := []mapValue{{"a", 1}, {"b", 2}, {"c", 3}, {"d", 4}}
+	m, err := BuildMap(keys, values)
+	if err != nil {
+		t.Fatalf("BuildMap: %v", err)
+	}
+	data, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	var m2 Map[mapValue]
+	if err := m2.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	for _, m := range []*Map[mapValue]{m, &m2} {
+		if m.Len() != len(keys) {
+			t.Errorf("Len: got %d; want %d", m.Len(), len(keys))
+		}
+		for i, key := range keys {
+			if v, ok := m.Get(key); !ok || v != values[i] {
+				t.Errorf("Get(%s): got %v, %t; want %v, true", key, v, ok, values[i])
+			}
+			if v, ok := m.GetBytes([]byte(key)); !ok || v != values[i] {
+				t.Errorf("GetBytes(%s): got %v, %t; want %v, true", key, v, ok, values[i])
+			}
+		}
+		if v, ok := m.Get("quux"); ok || !reflect.ValueOf(v).IsZero() {
+			t.Errorf("Get(quux): got %v, %t; want zero value, false", v, ok)
+		}
+	}
+	if err := m2.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Errorf("UnmarshalBinary(truncated): got nil error")
+	}
+}
+
+func TestBuildMap_lengthMismatch(t *testing.T) {
+	if _, err := BuildMap([]string{"foo", "bar"}, []int{1}); err == nil {
+		t.Errorf("BuildMap: got nil error")
+	}
+}
+
+func TestFromMap(t *testing.T) {
+	src := map[string]int{"foo": 1, "bar": 2, "baz": 3}
+	m, err := FromMap(src)
+	if err != nil {
+		t.Fatalf("FromMap: %v", err)
+	}
+	if m.Len() != len(src) {
+		t.Errorf("Len: got %d; want %d", m.Len(), len(src))
+	}
+	for k, want := range src {
+		if v, ok := m.Get(k); !ok || v != want {
+			t.Errorf("Get(%s): got %d, %t; want %d, true", k, v, ok, want)
+		}
+	}
+	if _, ok := m.Get("quux"); ok {
+		t.Errorf("Get(quux): got ok; want !ok")
+	}
+	// Keys are indexed in sorted order.
+	for i, k := range []string{"bar", "baz", "foo"} {
+		if n, ok := m.Table().Lookup(k); !ok || int(n) != i {
+			t.Errorf("Table().Lookup(%s): got %d, %t; want %d, true", k, n, ok, i)
+		}
+	}
+}
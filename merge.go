@@ -0,0 +1,57 @@
+package mph
+
+import (
+	"context"
+	"errors"
+	"math"
+)
+
+// Merge builds a table holding the keys of a followed by the keys of b that
+// are not in a. Keys of a keep their indices, and the other keys of b are
+// numbered after them in their order in b. For each key in both tables,
+// Merge calls onConflict, if it is not nil, to decide whether the key may be
+// merged; a nil onConflict or a false result makes Merge return a
+// *DuplicateKeyError, whose positions refer to the keys of a followed by all
+// the keys of b.
+//
+// Merge copies the key pool of a as a whole and looks up the keys of b in a
+// rather than rehashing them all to find conflicts, and builds the table as
+// a was built, with its hash function, seed, algorithm, k and layout, and
+// its normalizer. Both tables must store their keys; Merge returns ErrNoKeys
+// otherwise, and a may not be built with WithHashOrder, which would number
+// its keys anew.
+func Merge(a, b *Table, onConflict func(key []byte) bool) (*Table, error) {
+	if a.hashOnly || b.hashOnly {
+		return nil, ErrNoKeys
+	}
+	if a.hashOrder {
+		return nil, errors.New("mph: Merge does not support tables built with WithHashOrder")
+	}
+	ak := a.keys.owned()
+	pool := keyPool{
+		data:    make([]byte, ak.size(), ak.size()+b.keys.size()),
+		offsets: make([]uint32, ak.len()+1, ak.len()+b.keys.len()+1),
+	}
+	copy(pool.data, ak.data)
+	copy(pool.offsets, ak.offsets)
+	for i := 0; i < b.keys.len(); i++ {
+		k := b.keys.key(i)
+		if n, ok := lookup(a, k); ok {
+			if onConflict == nil || !onConflict(k) {
+				return nil, &DuplicateKeyError{Key: k, First: int(n), Second: a.keys.len() + i}
+			}
+			continue
+		}
+		if uint64(len(pool.data))+uint64(len(k)) > math.MaxUint32 {
+			return nil, errPoolTooLarge
+		}
+		pool.data = append(pool.data, k...)
+		pool.offsets = append(pool.offsets, uint32(len(pool.data)))
+	}
+	t, err := buildPool(context.Background(), pool, a.rebuildConfig())
+	if err != nil {
+		return nil, err
+	}
+	t.normalize = a.normalize
+	return t, nil
+}
@@ -0,0 +1,69 @@
+package mph
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	a := Build([]string{"foo", "bar", "baz"})
+	b := Build([]string{"quux", "bar", "corge"})
+	var conflicts []string
+	merged, err := Merge(a, b, func(key []byte) bool {
+		conflicts = append(conflicts, string(key))
+		return true
+	})
+	if err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	checkTable(t, merged, []string{"foo", "bar", "baz", "quux", "corge"}, []string{"grault"})
+	if len(conflicts) != 1 || conflicts[0] != "bar" {
+		t.Errorf("Merge: got conflicts %q; want [bar]", conflicts)
+	}
+
+	_, err = Merge(a, b, nil)
+	var dup *DuplicateKeyError
+	if !errors.As(err, &dup) {
+		t.Fatalf("Merge(nil onConflict): got err=%v; want *DuplicateKeyError", err)
+	}
+	if string(dup.Key) != "bar" || dup.First != 1 || dup.Second != 4 {
+		t.Errorf("Merge(nil onConflict): got %v; want key bar at positions 1 and 4", dup)
+	}
+
+	if _, err := Merge(a, b.WithoutKeys(), nil); err != ErrNoKeys {
+		t.Errorf("Merge(hash-only): got err=%v; want %v", err, ErrNoKeys)
+	}
+}
+
+func TestMerge_options(t *testing.T) {
+	var aKeys, bKeys []string
+	for i := 0; i < 500; i++ {
+		aKeys = append(aKeys, strconv.Itoa(i))
+		bKeys = append(bKeys, strconv.Itoa(i+500))
+	}
+	for name, opts := range map[string][]Option{
+		"BBHash":     {WithAlgorithm(BBHash)},
+		"RecSplit":   {WithAlgorithm(RecSplit), WithRecSplitSizes(6, 50)},
+		"KPerfect":   {WithKPerfect(2)},
+		"Seed":       {WithHash(Wyhash), WithSeed(42)},
+		"ExactSizes": {WithExactSizes()},
+		"Packed":     {WithPackedIndices(), WithCompressedSeeds()},
+	} {
+		a, err := BuildWithOptions(aKeys, opts...)
+		if err != nil {
+			t.Fatalf("BuildWithOptions(%s): %v", name, err)
+		}
+		merged, err := Merge(a, Build(bKeys), nil)
+		if err != nil {
+			t.Fatalf("Merge(%s): %v", name, err)
+		}
+		want, err := BuildWithOptions(append(append([]string(nil), aKeys...), bKeys...), opts...)
+		if err != nil {
+			t.Fatalf("BuildWithOptions(%s): %v", name, err)
+		}
+		if !Equal(merged, want) {
+			t.Errorf("Merge(%s): got a table unlike one built with the options of a", name)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package mph
+
+import (
+	"os"
+)
+
+// A MappedTable is a Table whose level arrays and keys are read in place
+// from a read-only memory mapping of a serialized table file. Because the
+// mapping is shared through the page cache, several processes opening the
+// same file share a single copy of the table.
+type MappedTable struct {
+	*Table
+	data []byte
+}
+
+// OpenFile maps the serialized table stored in the named file, as written by
+// WriteTo or MarshalBinary, and returns a MappedTable backed by the mapping.
+// The table must not be used after Close is called.
+func OpenFile(name string) (*MappedTable, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+	if size < headerSize || size != int64(int(size)) {
+		return nil, ErrFormat
+	}
+	data, err := mmap(f, int(size))
+	if err != nil {
+		return nil, err
+	}
+	table, err := LoadBytes(data)
+	if err != nil {
+		munmap(data)
+		return nil, err
+	}
+	return &MappedTable{Table: table, data: data}, nil
+}
+
+// Close releases the memory mapping backing m.
+func (m *MappedTable) Close() error {
+	if m.data == nil {
+		return nil
+	}
+	err := munmap(m.data)
+	m.data = nil
+	m.Table = nil
+	return err
+}
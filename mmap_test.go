@@ -0,0 +1,46 @@
+package mph
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestOpenFile(t *testing.T) {
+	var keys, extra []string
+	for i := 0; i < 2000; i++ {
+		s := strconv.Itoa(i)
+		if i < 1000 {
+			keys = append(keys, s)
+		} else {
+			extra = append(extra, s)
+		}
+	}
+	data, err := Build(keys).MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	name := filepath.Join(t.TempDir(), "table.mph")
+	if err := os.WriteFile(name, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := OpenFile(name)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	checkTable(t, m.Table, keys, extra)
+	if err := m.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
+
+func TestOpenFile_invalid(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "table.mph")
+	if err := os.WriteFile(name, []byte("not a table"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenFile(name); err == nil {
+		t.Errorf("OpenFile: got nil error")
+	}
+}
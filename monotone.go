@@ -0,0 +1,81 @@
+package mph
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// WithMonotone makes BuildWithOptions number each key by its rank among the
+// keys in increasing order, as by bytes.Compare, rather than by its position
+// in keys, so that the table is an order-preserving minimal perfect hash
+// function: Lookup returns the position of a key in the sorted keys. A
+// sorted array of values, or anything else laid out in key order, such as a
+// companion for binary search, can then be indexed by Lookup directly. The
+// keys are ranked after normalization, and with WithDedup, among the keys
+// that remain. The table costs no more memory than without the option, but
+// the build sorts the keys, and Keys lists them in sorted order.
+//
+// A *DuplicateKeyError still reports positions in keys. BuildSharded ranks
+// the keys of each shard among themselves, so its indices are only
+// monotone within a shard. BuildExternal does not support the option.
+func WithMonotone() Option {
+	return func(c *buildConfig) {
+		c.monotone = true
+	}
+}
+
+// sortPool returns the keys of pool in increasing order, or a
+// *DuplicateKeyError unless cfg drops duplicates.
+func sortPool(pool keyPool, cfg *buildConfig) (keyPool, error) {
+	order := make([]int, pool.len())
+	for i := range order {
+		order[i] = i
+	}
+	// A stable sort keeps repeated keys in order, so that the duplicates
+	// that the build removes are the later ones, as without the option.
+	sort.SliceStable(order, func(i, j int) bool {
+		return bytes.Compare(pool.key(order[i]), pool.key(order[j])) < 0
+	})
+	if !cfg.dedup {
+		for i := 1; i < len(order); i++ {
+			if k := pool.key(order[i]); bytes.Equal(pool.key(order[i-1]), k) {
+				return keyPool{}, &DuplicateKeyError{Key: k, First: order[i-1], Second: order[i]}
+			}
+		}
+	}
+	return pool.permute(order), nil
+}
+
+// ErrNotSorted is returned by BuildSorted for keys that are not in
+// increasing order.
+var ErrNotSorted = errors.New("mph: keys are not sorted")
+
+// BuildSorted is like BuildWithOptions for keys in strictly increasing
+// order, as by bytes.Compare, and returns an error wrapping ErrNotSorted
+// if they are not, or a *DuplicateKeyError if a key repeats. The index of each key is then its position in keys, and so
+// its rank among them: the table is an order-preserving minimal perfect
+// hash function of keys as given, which needs none of the sorting of
+// WithMonotone, and a neighbor of a key can be found at the next or
+// previous index. The order is checked before normalization; a normalizer
+// that reorders the keys leaves the indices the positions in keys, and
+// one that makes two of them equal fails the build. Sorted keys also need
+// no ranks to be front coded; see WithFrontCoding. BuildSorted returns an
+// error for WithDedup, WithMonotone, WithStableIndices and WithHashOrder,
+// which would give the keys other indices.
+func BuildSorted[T ~string | ~[]byte](keys []T, opts ...Option) (*Table, error) {
+	if cfg := newBuildConfig(opts); cfg.dedup || cfg.monotone || cfg.stable != nil || cfg.hashOrder {
+		return nil, errors.New("mph: BuildSorted does not support WithDedup, WithMonotone, WithStableIndices or WithHashOrder")
+	}
+	for i := 1; i < len(keys); i++ {
+		// The conversions compare the keys in place, as bytes.Compare would.
+		if string(keys[i-1]) > string(keys[i]) {
+			return nil, fmt.Errorf("%w: %q at position %d follows %q", ErrNotSorted, keys[i], i, keys[i-1])
+		}
+		if string(keys[i-1]) == string(keys[i]) {
+			return nil, &DuplicateKeyError{Key: []byte(keys[i]), First: i - 1, Second: i}
+		}
+	}
+	return BuildWithOptions(keys, opts...)
+}
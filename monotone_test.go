@@ -0,0 +1,131 @@
+package mph
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWithMonotone(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, strconv.Itoa(i*7919%1000))
+	}
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	for _, a := range []Algorithm{CHD, BBHash, RecSplit, PTHash, BDZ} {
+		for _, borrow := range []bool{false, true} {
+			opts := []Option{WithMonotone(), WithAlgorithm(a)}
+			if borrow {
+				opts = append(opts, WithBorrowedKeys())
+			}
+			table, err := BuildWithOptions(keys, opts...)
+			if err != nil {
+				t.Fatalf("BuildWithOptions(%v, borrow=%t): %v", a, borrow, err)
+			}
+			checkTable(t, table, sorted, []string{"-1"})
+		}
+	}
+	// The keys of the caller are left in their order.
+	bkeys := [][]byte{[]byte("b"), []byte("c"), []byte("a")}
+	table, err := BuildWithOptions(bkeys, WithMonotone(), WithBorrowedKeys())
+	if err != nil {
+		t.Fatalf("BuildWithOptions([]byte): %v", err)
+	}
+	checkTable(t, table, []string{"a", "b", "c"}, nil)
+	if string(bkeys[0]) != "b" || string(bkeys[2]) != "a" {
+		t.Errorf("WithMonotone: reordered the borrowed keys to %q", bkeys)
+	}
+}
+
+func TestWithMonotone_duplicates(t *testing.T) {
+	keys := []string{"d", "b", "c", "b", "a", "d"}
+	_, err := BuildWithOptions(keys, WithMonotone())
+	var dup *DuplicateKeyError
+	if !errors.As(err, &dup) || string(dup.Key) != "b" || dup.First != 1 || dup.Second != 3 {
+		t.Errorf("BuildWithOptions(duplicates): got err=%v; want b at 1 and 3", err)
+	}
+	var removed int
+	table, err := BuildWithOptions(keys, WithMonotone(), WithDedup(&removed))
+	if err != nil {
+		t.Fatalf("BuildWithOptions(WithDedup): %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("WithDedup: removed %d keys; want 2", removed)
+	}
+	checkTable(t, table, []string{"a", "b", "c", "d"}, []string{"e"})
+}
+
+func TestWithMonotone_normalizer(t *testing.T) {
+	keys := []string{"b", "C", "a"}
+	table, err := BuildWithOptions(keys, WithMonotone(), WithNormalizer(bytes.ToLower))
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	for want, k := range []string{"A", "b", "c"} {
+		if n, ok := table.Lookup(k); !ok || n != uint32(want) {
+			t.Errorf("Lookup(%s): got %d, %t; want %d", k, n, ok, want)
+		}
+	}
+	if err := BuildExternal(io.Discard, strings.NewReader("b\na\n"), t.TempDir(), WithMonotone()); err == nil {
+		t.Errorf("BuildExternal(WithMonotone): got nil error")
+	}
+}
+
+func TestBuildSorted(t *testing.T) {
+	for _, keys := range [][]string{nil, {""}, {"", "a", "ab", "b"}, {"apple", "banana", "cherry"}} {
+		table, err := BuildSorted(keys)
+		if err != nil {
+			t.Fatalf("BuildSorted(%q): %v", keys, err)
+		}
+		checkTable(t, table, keys, []string{"c", "aa"})
+	}
+	var keys [][]byte
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("%05d", i)))
+	}
+	table, err := BuildSorted(keys, WithAlgorithm(PTHash))
+	if err != nil {
+		t.Fatalf("BuildSorted([]byte): %v", err)
+	}
+	for i, k := range keys {
+		if n, ok := Lookup(table, k); !ok || n != uint32(i) {
+			t.Errorf("Lookup(%s): got %d, %t; want %d, true", k, n, ok, i)
+		}
+	}
+}
+
+func TestBuildSorted_errors(t *testing.T) {
+	_, err := BuildSorted([]string{"a", "c", "b"})
+	if !errors.Is(err, ErrNotSorted) {
+		t.Errorf("BuildSorted(unsorted): got err=%v; want %v", err, ErrNotSorted)
+	}
+	var dup *DuplicateKeyError
+	_, err = BuildSorted([]string{"a", "b", "b"})
+	if !errors.As(err, &dup) || string(dup.Key) != "b" || dup.First != 1 || dup.Second != 2 {
+		t.Errorf("BuildSorted(duplicates): got err=%v; want b at 1 and 2", err)
+	}
+	_, err = BuildSorted([]string{"A", "a", "b"}, WithNormalizer(bytes.ToLower))
+	if !errors.As(err, &dup) || string(dup.Key) != "a" || dup.First != 0 || dup.Second != 1 {
+		t.Errorf("BuildSorted(normalized duplicates): got err=%v; want a at 0 and 1", err)
+	}
+}
+
+func TestBuildSorted_options(t *testing.T) {
+	keys := []string{"A", "a", "b"}
+	prev := Build([]string{"b", "a", "A"})
+	for name, opts := range map[string][]Option{
+		"WithDedup":         {WithNormalizer(bytes.ToLower), WithDedup(nil)},
+		"WithMonotone":      {WithMonotone()},
+		"WithStableIndices": {WithStableIndices(prev)},
+	} {
+		if _, err := BuildSorted(keys, opts...); err == nil {
+			t.Errorf("BuildSorted(%s): got no error", name)
+		}
+	}
+}
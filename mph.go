@@ -2,73 +2,491 @@
 package mph
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"sort"
 )
 
 // A Table is an immutable hash table that provides constant-time lookups of key
 // indices using a minimal perfect hash.
+//
+// A built, cloned, or decoded table keeps its level arrays, key offsets and
+// keys in one allocation, laid out in the order a lookup reads them, with
+// the level arrays aligned to cache lines. A table built with
+// WithBorrowedKeys refers to the keys of the caller instead.
 type Table struct {
-	keys       [][]byte
-	level0     []uint32 // power of 2 size
-	level0Mask int      // len(Level0) - 1
-	level1     []uint32 // power of 2 size >= len(keys)
-	level1Mask int      // len(Level1) - 1
+	keys        keyPool
+	level0      seedArray
+	level0Slots slotMap    // maps key hashes to level0
+	level1      indexArray // size >= len(keys)
+	level1Slots slotMap    // maps level1 hashes to level1
+
+	// algo is the algorithm that built the table. Unless it is CHD, level0
+	// holds the serialized hash function of the algorithm, which cascade,
+	// recsplit, pilots, hypergraph or the function of a registered backend
+	// view, in place of seeds, and level1 maps the number that function
+	// gives each key to its index; see WithAlgorithm.
+	algo       Algorithm
+	cascade    cascade
+	recsplit   recsplit
+	pilots     pilots
+	hypergraph hypergraph
+	backend    BackendFunc
+
+	// hashOrder is set for tables of another algorithm than CHD whose
+	// indices are the numbers of their hash function, in which case level1
+	// is empty; see WithHashOrder.
+	hashOrder bool
+
+	// slotKeys is the k of a k-perfect table, whose level1 holds k entries
+	// for each slot of level1Slots, and 0 otherwise; see WithKPerfect.
+	slotKeys int
+
+	// keyWidth is the length of every key if they all have the same
+	// length, as for IDs and UUIDs, and 0 otherwise; see keyPool.width.
+	keyWidth int
+
+	// hashOnly is set for tables that do not store their keys, in which
+	// case keys is empty and nkeys holds the number of keys.
+	hashOnly bool
+	nkeys    int
+
+	// fingerprints, if set, verify lookups in a hash-only table; see
+	// WithFingerprints.
+	fingerprints fingerprintArray
+
+	// keySet, if set, verifies lookups in a hash-only table in place of
+	// fingerprints; see WithKeySet.
+	keySet KeySet
+
+	// prefilter, if set, rejects most misses before the lookup proper; see
+	// WithPrefilter.
+	prefilter blockedBloom
+
+	// hash is the hash function applied to keys; see WithHash. seed is
+	// its base seed; see WithSeed.
+	hash Hash
+	seed uint64
+
+	// normalize, if not nil, is applied to keys before they are hashed
+	// and compared; see WithNormalizer.
+	normalize func([]byte) []byte
 }
 
 // Build builds a Table from keys using the "Hash, displace, and compress"
 // algorithm described in http://cmph.sourceforge.net/papers/esa09.pdf.
-func Build[T string | []byte](keys []T) *Table {
-	var (
-		level0        = make([]uint32, nextPow2(len(keys)/4))
-		level0Mask    = len(level0) - 1
-		level1        = make([]uint32, nextPow2(len(keys)))
-		level1Mask    = len(level1) - 1
-		sparseBuckets = make([][]int, len(level0))
-		zeroSeed      = murmurSeed(0)
-	)
-	var pool [][]byte
-	for i, s := range keys {
-		n := int(murmurHash(zeroSeed, s)) & level0Mask
-		sparseBuckets[n] = append(sparseBuckets[n], i)
-		pool = append(pool, []byte(s))
-	}
-	var buckets []indexBucket
-	for n, vals := range sparseBuckets {
-		if len(vals) > 0 {
-			buckets = append(buckets, indexBucket{n, vals})
-		}
-	}
-	sort.Sort(bySize(buckets))
-
-	occ := make([]bool, len(level1))
+// The index of each key in the table is its position in keys. Build panics
+// if keys contains duplicates; use BuildChecked to get an error instead.
+//
+// If all keys have the same length, as for fixed-width IDs or UUIDs, a
+// lookup finds the stored key of its candidate from the index alone, saving
+// a load, and compares keys of 4, 8, or 16 bytes a word at a time.
+func Build[T ~string | ~[]byte](keys []T) *Table {
+	t, err := BuildChecked(keys)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// ErrBuildFailed is returned when no seed allowed by WithMaxSeedAttempts
+// places some bucket of keys. Keys that hash identically, which no seed
+// can separate, make every build fail this way once all 2^32 seeds have
+// been tried, and make a BBHash build fail once they have collided in
+// every level.
+var ErrBuildFailed = errors.New("mph: no seed places all keys of a bucket")
+
+// ErrDuplicateKey is the error that a *DuplicateKeyError wraps.
+var ErrDuplicateKey = errors.New("mph: duplicate key")
+
+// A DuplicateKeyError reports a key that occurs more than once in the
+// input to BuildChecked.
+type DuplicateKeyError struct {
+	Key    []byte
+	First  int // position of the first occurrence of Key
+	Second int // position of the second occurrence of Key
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return fmt.Sprintf("mph: duplicate key %q at positions %d and %d", e.Key, e.First, e.Second)
+}
+
+func (e *DuplicateKeyError) Unwrap() error {
+	return ErrDuplicateKey
+}
+
+// BuildChecked is like Build but returns a *DuplicateKeyError if keys
+// contains duplicates.
+func BuildChecked[T ~string | ~[]byte](keys []T) (*Table, error) {
+	return BuildWithOptions(keys)
+}
+
+// ctxCheckInterval is how many keys or buckets build processes between
+// checks for cancellation.
+const ctxCheckInterval = 1 << 10
+
+func build[T ~string | ~[]byte](ctx context.Context, keys []T, cfg *buildConfig) (*Table, error) {
+	newPool := newKeyPool[T]
+	if cfg.borrowKeys {
+		newPool = borrowKeyPool[T]
+	}
+	pool, err := newPool(keys)
+	if err != nil {
+		return nil, err
+	}
+	return buildPool(ctx, pool, cfg)
+}
+
+// buildPool builds a table that takes ownership of pool.
+func buildPool(ctx context.Context, pool keyPool, cfg *buildConfig) (*Table, error) {
+	if cfg.normalize != nil {
+		normalized := make([][]byte, pool.len())
+		for i := range normalized {
+			normalized[i] = cfg.normalize(pool.key(i))
+		}
+		var err error
+		if pool, err = newKeyPool(normalized); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.check(); err != nil {
+		return nil, err
+	}
+	if cfg.weights != nil && len(cfg.weights) != pool.len() {
+		return nil, fmt.Errorf("mph: %d weights for %d keys", len(cfg.weights), pool.len())
+	}
+	if cfg.monotone {
+		var err error
+		if pool, err = sortPool(pool, cfg); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.stable != nil {
+		var err error
+		if pool, err = stablePool(pool, cfg); err != nil {
+			return nil, err
+		}
+	}
+	switch cfg.algorithm {
+	case BBHash:
+		return buildRanked(ctx, pool, cfg, BBHash, buildCascade)
+	case RecSplit:
+		return buildRanked(ctx, pool, cfg, RecSplit, buildRecSplit)
+	case PTHash:
+		return buildRanked(ctx, pool, cfg, PTHash, buildPilots)
+	case BDZ:
+		return buildRanked(ctx, pool, cfg, BDZ, buildHypergraph)
+	}
+	if b := cfg.algorithm.backend(); b != nil {
+		return buildRanked(ctx, pool, cfg, cfg.algorithm, buildBackend(cfg.algorithm, b))
+	}
+	nkeys := pool.len()
+	slots0 := newSlotMap(cfg.level0Len(nkeys))
+	buckets, hashes, err := bucketize(ctx, pool, cfg.hash, cfg.seed, slots0, cfg.workers(), cfg.scratchSpace())
+	if err != nil {
+		return nil, err
+	}
+	if dups := duplicates(pool, buckets); len(dups) > 0 {
+		if !cfg.dedup {
+			d := dups[0]
+			return nil, &DuplicateKeyError{Key: pool.key(d.second), First: d.first, Second: d.second}
+		}
+		removeDuplicates(&pool, dups)
+		slots0 = newSlotMap(cfg.level0Len(pool.len()))
+		if buckets, hashes, err = bucketize(ctx, pool, cfg.hash, cfg.seed, slots0, cfg.workers(), cfg.scratchSpace()); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.removed != nil {
+		*cfg.removed = nkeys - pool.len()
+	}
+
+	seed := cfg.seed
+	n1 := cfg.level1Slots(pool.len())
+	level0, level1, err := place(ctx, buckets, n1, slotHash(pool, hashes), cfg)
+	// A retry rehashes the keys with a fresh seed, which scatters the keys
+	// of a bucket that were crafted to collide under the last one, and
+	// every second retry also doubles level1; see WithRetries.
+	for retry := 0; err == ErrBuildFailed && retry < cfg.retries && uint64(4*n1*cfg.slotKeys()) <= 1<<32; retry++ {
+		seed = fmix64(seed + 0x9e3779b97f4a7c15)
+		if buckets, hashes, err = bucketize(ctx, pool, cfg.hash, seed, slots0, cfg.workers(), cfg.scratchSpace()); err != nil {
+			return nil, err
+		}
+		if retry%2 == 1 {
+			n1 *= 2
+		}
+		level0, level1, err = place(ctx, buckets, n1, slotHash(pool, hashes), cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	t := &Table{
+		keys:        pool,
+		keyWidth:    pool.width(),
+		level0:      cfg.seeds(level0),
+		level0Slots: slots0,
+		level1:      cfg.indices(level1, pool.len()),
+		level1Slots: newSlotMap(len(level1) / cfg.slotKeys()),
+		hash:        cfg.hash,
+		seed:        seed,
+		normalize:   cfg.normalize,
+	}
+	if k := cfg.slotKeys(); k > 1 {
+		t.slotKeys = k
+	}
+	if cfg.frontCoding {
+		t.frontCode()
+	}
+	if cfg.weights != nil {
+		t.layOutBySlot()
+	}
+	a, err := allocArena(t.arenaSize(true), cfg.alloc)
+	if err != nil {
+		return nil, err
+	}
+	t.compactInto(&a, true)
+	return t, nil
+}
+
+// slotHash returns the hash that place sends key i of pool to a level1
+// slot with under a bucket seed: one derived from its key hash, if
+// bucketize returned the key hashes, or its Murmur3 hash otherwise.
+func slotHash(pool keyPool, hashes []uint64) func(i int, seed uint32) uint32 {
+	if hashes != nil {
+		return func(i int, seed uint32) uint32 {
+			return wyslot(hashes[i], seed)
+		}
+	}
+	return func(i int, seed uint32) uint32 {
+		return murmurHash(murmurSeed(seed), pool.key(i))
+	}
+}
+
+// place finds a seed for each bucket of key positions in index such that
+// hash(i, seed) sends the keys of every bucket to distinct free slots of a
+// level1 array of size n1. It returns the seeds, indexed by
+// bucket, and the level1 array, which maps each slot to the key in it.
+// Buckets are placed largest first, while level1 is still mostly empty.
+// place returns ErrBuildFailed if a bucket fits with none of the seeds that
+// cfg allows. For a k-perfect table, n1 is the number of slots of k keys;
+// see placeK.
+func place(ctx context.Context, index bucketIndex, n1 int, hash func(i int, seed uint32) uint32, cfg *buildConfig) (level0, level1 []uint32, err error) {
+	if k := cfg.slotKeys(); k > 1 {
+		return placeK(ctx, index, n1, k, hash, cfg)
+	}
+	level0 = make([]uint32, index.len())
+	level1 = make([]uint32, n1)
+	slots1 := newSlotMap(n1)
+	sc := cfg.scratchSpace()
+	sc.buckets = index.bySize(sc.buckets)
+	buckets := sc.buckets
+	limit := cfg.seedLimit()
+	var hot bitset
+	var region int
+	if cfg.weights != nil {
+		hot, region = cfg.hotKeys(n1)
+		buckets = hotFirst(buckets, hot)
+	} else if w := cfg.workers(); w > 1 {
+		return level0, level1, placeParallel(ctx, buckets, level0, level1, slots1, hash, w, limit, cfg)
+	}
+
+	sc.occ = reuse(sc.occ, (len(level1)+63)/64)
+	occ := sc.occ
 	var tmpOcc []int
-	for _, bucket := range buckets {
-		var seed murmurSeed
+	for b, bucket := range buckets {
+		if b%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, nil, err
+			}
+		}
+		var seed uint32
+		// The hot keys of a bucket must land in the hot region, for up to
+		// hotSeeds seeds; see WithWeights.
+		inRegion := hot != nil && isHot(bucket.vals, hot)
 	trySeed:
 		tmpOcc = tmpOcc[:0]
 		for _, i := range bucket.vals {
-			n := int(murmurHash(seed, keys[i])) & level1Mask
-			if occ[n] {
+			n := slots1.slot(hash(int(i), seed))
+			if occ.has(n) || inRegion && n >= region && hot.has(int(i)) {
 				for _, n := range tmpOcc {
-					occ[n] = false
+					occ.clear(n)
+				}
+				if inRegion && (seed+1 >= hotSeeds || uint64(seed)+1 >= limit) {
+					inRegion = false
+					seed = 0
+					goto trySeed
+				}
+				if uint64(seed)+1 >= limit {
+					return nil, nil, ErrBuildFailed
 				}
 				seed++
 				goto trySeed
 			}
-			occ[n] = true
+			occ.set(n)
 			tmpOcc = append(tmpOcc, n)
-			level1[n] = uint32(i)
 		}
-		level0[bucket.n] = uint32(seed)
+		// Unused slots of level1 are left zero, whatever seeds were tried.
+		for j, n := range tmpOcc {
+			level1[n] = bucket.vals[j]
+		}
+		level0[bucket.n] = seed
+		if cfg.progress != nil {
+			cfg.progress(b+1, len(buckets))
+		}
 	}
+	return level0, level1, nil
+}
 
-	return &Table{
-		keys:       pool,
-		level0:     level0,
-		level0Mask: level0Mask,
-		level1:     level1,
-		level1Mask: level1Mask,
+// bucketize groups the positions of keys by their level0 slot under hash
+// and seed, hashing with the given number of goroutines. If level1 slots
+// are derived from the key hashes, as for Wyhash, it also returns the key
+// hashes, so that keys need not be hashed again to place them.
+func bucketize(ctx context.Context, keys keyPool, hash Hash, seed uint64, slots0 slotMap, workers int, sc *buildScratch) (bucketIndex, []uint64, error) {
+	sc.slots = reuse(sc.slots, keys.len())
+	slots := sc.slots
+	var hashes []uint64
+	if hash == Wyhash {
+		sc.hashes = reuse(sc.hashes, keys.len())
+		hashes = sc.hashes
+	}
+	if workers > 1 {
+		if err := hashParallel(ctx, keys, hash, seed, slots0, workers, slots, hashes); err != nil {
+			return bucketIndex{}, nil, err
+		}
+		sc.index.fill(slots, int(slots0.n))
+		return sc.index, hashes, nil
+	}
+	for i := range slots {
+		if i%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return bucketIndex{}, nil, err
+			}
+		}
+		kh := keyHash(hash, seed, keys.key(i))
+		slots[i] = uint32(slots0.slot(uint32(kh)))
+		if hashes != nil {
+			hashes[i] = kh
+		}
+	}
+	sc.index.fill(slots, int(slots0.n))
+	return sc.index, hashes, nil
+}
+
+// A bucketIndex groups key positions by level0 slot: the keys in slot n are
+// keys[start[n]:start[n+1]], in increasing order. It takes two allocations
+// however many slots there are.
+type bucketIndex struct {
+	keys  []uint32
+	start []uint32
+}
+
+// newBucketIndex returns the bucketIndex of keys whose level0 slots, out of
+// n0, are given by slots.
+func newBucketIndex(slots []uint32, n0 int) bucketIndex {
+	var b bucketIndex
+	b.fill(slots, n0)
+	return b
+}
+
+// fill makes b the bucketIndex of keys whose level0 slots, out of n0, are
+// given by slots, reusing the memory of b.
+func (b *bucketIndex) fill(slots []uint32, n0 int) {
+	b.keys = reuse(b.keys, len(slots))
+	b.start = reuse(b.start, n0+1)
+	for _, n := range slots {
+		b.start[n+1]++
 	}
+	for n := 1; n <= n0; n++ {
+		b.start[n] += b.start[n-1]
+	}
+	// Fill each slot, advancing its start to its end, which is the start of
+	// the next slot; then shift the starts back into place.
+	for i, n := range slots {
+		b.keys[b.start[n]] = uint32(i)
+		b.start[n]++
+	}
+	copy(b.start[1:], b.start[:n0])
+	b.start[0] = 0
+}
+
+// len returns the number of slots.
+func (b *bucketIndex) len() int {
+	return len(b.start) - 1
+}
+
+// bucket returns the positions of the keys in slot n.
+func (b *bucketIndex) bucket(n int) []uint32 {
+	start, end := b.start[n], b.start[n+1]
+	return b.keys[start:end:end]
+}
+
+// bySize returns the non-empty buckets, largest first and in slot order
+// among buckets of the same size. Buckets are small, so a counting sort by
+// size does this in linear time, and the order does not depend on the
+// sort algorithm of the standard library. The result reuses the memory of
+// buf if it is large enough.
+func (b *bucketIndex) bySize(buf []indexBucket) []indexBucket {
+	var counts []int // counts[size] is the number of buckets of that size
+	for n := 0; n < b.len(); n++ {
+		size := int(b.start[n+1] - b.start[n])
+		for len(counts) <= size {
+			counts = append(counts, 0)
+		}
+		counts[size]++
+	}
+	next := make([]int, len(counts))
+	total := 0
+	for size := len(counts) - 1; size > 0; size-- {
+		next[size] = total
+		total += counts[size]
+	}
+	buckets := reuse(buf, total)
+	for n := 0; n < b.len(); n++ {
+		vals := b.bucket(n)
+		if len(vals) == 0 {
+			continue
+		}
+		buckets[next[len(vals)]] = indexBucket{n, vals}
+		next[len(vals)]++
+	}
+	return buckets
+}
+
+// A duplicate records that the key at position second repeats the key at
+// position first.
+type duplicate struct {
+	first, second int
+}
+
+// duplicates returns every position in keys that repeats an earlier key,
+// in increasing order. Equal keys hash to the same bucket, so only keys that
+// share a bucket need to be compared.
+func duplicates(keys keyPool, buckets bucketIndex) []duplicate {
+	var dups []duplicate
+	for n := 0; n < buckets.len(); n++ {
+		vals := buckets.bucket(n)
+		for j, b := range vals {
+			for _, a := range vals[:j] {
+				if string(keys.key(int(a))) == string(keys.key(int(b))) {
+					dups = append(dups, duplicate{int(a), int(b)})
+					break
+				}
+			}
+		}
+	}
+	sort.Slice(dups, func(i, j int) bool { return dups[i].second < dups[j].second })
+	return dups
+}
+
+// removeDuplicates removes the repeated positions in dups, which must be in
+// increasing order, from keys.
+func removeDuplicates(keys *keyPool, dups []duplicate) {
+	drop := make([]int, len(dups))
+	for i, d := range dups {
+		drop[i] = d.second
+	}
+	keys.filter(drop)
 }
 
 func nextPow2(n int) int {
@@ -80,21 +498,249 @@ func nextPow2(n int) int {
 }
 
 // Lookup searches for s in t and returns its index and whether it was found.
-func Lookup[T string | []byte](t *Table, s T) (n uint32, ok bool) {
-	i0 := int(murmurHash(murmurSeed(0), s)) & t.level0Mask
-	seed := t.level0[i0]
-	i1 := int(murmurHash(murmurSeed(seed), s)) & t.level1Mask
-	n = t.level1[i1]
-	return n, string(s) == string(t.keys[int(n)])
+// Looking up any key in a nil or empty table returns 0, false.
+// It is equivalent to t.Lookup(s) or t.LookupBytes(s).
+func Lookup[T ~string | ~[]byte](t *Table, s T) (n uint32, ok bool) {
+	return lookup(t, s)
 }
 
-type indexBucket struct {
-	n    int
-	vals []int
+// Lookup searches for s in t and returns its index and whether it was found.
+//
+// If t is hash-only (see WithoutKeys), the index cannot be verified: Lookup
+// always reports that s was found, and the index is only meaningful if s is
+// one of the keys the table was built from. A hash-only table with
+// fingerprints (see WithFingerprints) rejects most other keys.
+func (t *Table) Lookup(s string) (n uint32, ok bool) {
+	return lookup(t, s)
 }
 
-type bySize []indexBucket
+// LookupBytes is like Lookup but takes the key as a byte slice. (Methods
+// cannot have type parameters, so unlike the Lookup function there is one
+// method for each kind of key.)
+func (t *Table) LookupBytes(b []byte) (n uint32, ok bool) {
+	return lookup(t, b)
+}
 
-func (s bySize) Len() int           { return len(s) }
-func (s bySize) Less(i, j int) bool { return len(s[i].vals) > len(s[j].vals) }
-func (s bySize) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+// Contains reports whether s is one of the keys of t. If t is hash-only,
+// Contains cannot tell and always returns true; see Lookup.
+func (t *Table) Contains(s string) bool {
+	_, ok := lookup(t, s)
+	return ok
+}
+
+// ContainsBytes is like Contains but takes the key as a byte slice.
+func (t *Table) ContainsBytes(b []byte) bool {
+	_, ok := lookup(t, b)
+	return ok
+}
+
+func lookup[T ~string | ~[]byte](t *Table, s T) (n uint32, ok bool) {
+	if t.Len() == 0 {
+		return 0, false
+	}
+	if t.normalize != nil {
+		return lookupNormalized(t, s)
+	}
+	return lookupKey(t, s)
+}
+
+// lookupNormalized is lookup for a non-empty t with a normalizer. It is
+// kept out of lookup so that lookup stays small enough to inline.
+//
+//go:noinline
+func lookupNormalized[T ~string | ~[]byte](t *Table, s T) (n uint32, ok bool) {
+	return lookupKey(t, t.normalize(append([]byte(nil), s...)))
+}
+
+// lookupKey is like lookup for a non-empty t and a key that is already
+// normalized. It repeats the body of locateHash, and tests for a prefilter
+// before calling it, to save two calls on the common path.
+func lookupKey[T ~string | ~[]byte](t *Table, s T) (n uint32, ok bool) {
+	kh := keyHash(t.hash, t.seed, s)
+	if t.prefilter.words != nil && !t.prefilter.mayContain(kh) {
+		return 0, false
+	}
+	if t.algo == PTHash {
+		n = t.rankIndex(pilotRank(&t.pilots, t.hash, kh, s))
+	} else if t.algo != CHD {
+		r, ok := rankKey(t, kh, s)
+		if !ok {
+			return 0, false
+		}
+		n = t.rankIndex(r)
+	} else {
+		seed := t.level0.get(t.level0Slots.slot(uint32(kh)))
+		slot := t.level1Slots.slot(level1Hash(t.hash, kh, seed, s))
+		if t.slotKeys > 1 {
+			return lookupSlot(t, slot, kh, s)
+		}
+		if t.keys.slotOf != nil {
+			return lookupBySlot(t, slot, s)
+		}
+		n = t.level1.get(slot)
+	}
+	if t.hashOnly {
+		return n, matchFingerprint(t, n, kh, s)
+	}
+	if w := t.keyWidth; w != 0 {
+		off := int(n) * w
+		return n, equalFixed(s, t.keys.data[off:off+w], w)
+	}
+	if f := t.keys.front; f != nil {
+		return n, frontEqual(f, int(n), s)
+	}
+	// The compiler compares the converted operands in place, so this does
+	// not allocate for either kind of key; TestLookup_allocs checks it.
+	return n, string(s) == string(t.keys.key(int(n)))
+}
+
+// LookupChecked is like Lookup but returns ErrNoKeys instead of an
+// unverified index if t is hash-only, unless it has a key set (see
+// WithKeySet).
+func LookupChecked[T ~string | ~[]byte](t *Table, s T) (n uint32, ok bool, err error) {
+	if t != nil && t.hashOnly && t.keySet == nil {
+		return 0, false, ErrNoKeys
+	}
+	n, ok = lookup(t, s)
+	return n, ok, nil
+}
+
+// LookupUnchecked returns the index of s in t without comparing s with the
+// stored key, which saves a load from the key pool. The result is only
+// meaningful if s is one of the keys of t; for any other s it is an
+// arbitrary index. For a k-perfect table (see WithKPerfect), which cannot
+// tell its candidates apart without comparing them, it is the first
+// candidate; see AppendCandidates.
+func LookupUnchecked[T ~string | ~[]byte](t *Table, s T) uint32 {
+	if t.Len() == 0 {
+		return 0
+	}
+	if t.normalize != nil {
+		return candidate(t, t.normalize(append([]byte(nil), s...)))
+	}
+	return candidate(t, s)
+}
+
+// ErrNoKeys is returned by operations that need the keys of a table when
+// the table is hash-only.
+var ErrNoKeys = errors.New("mph: table does not store its keys")
+
+// WithoutKeys returns a hash-only table that shares the level arrays of t
+// but does not store its keys. A hash-only table is a minimal perfect hash
+// function: it maps each key it was built from to its index, but cannot
+// tell whether a queried key is a member. Serializing a hash-only table
+// omits the key pool, which is usually most of the size of a table.
+//
+// A k-perfect table (see WithKPerfect) cannot tell the candidates of a key
+// apart without them, so WithoutKeys keeps a 16-bit fingerprint of each of
+// its keys, as WithFingerprints(16) does; a hash-only k-perfect t keeps
+// the fingerprints it has.
+func (t *Table) WithoutKeys() *Table {
+	c := t.withoutKeys()
+	if t.slotKeys > 1 {
+		if t.hashOnly {
+			c.fingerprints = t.fingerprints
+		} else {
+			c.fingerprints = t.fingerprintArray(16)
+		}
+	}
+	return c
+}
+
+// withoutKeys is WithoutKeys without the fingerprints.
+func (t *Table) withoutKeys() *Table {
+	return &Table{
+		level0:      t.level0,
+		level0Slots: t.level0Slots,
+		level1:      t.level1,
+		level1Slots: t.level1Slots,
+		algo:        t.algo,
+		cascade:     t.cascade,
+		recsplit:    t.recsplit,
+		pilots:      t.pilots,
+		hypergraph:  t.hypergraph,
+		backend:     t.backend,
+		hashOrder:   t.hashOrder,
+		slotKeys:    t.slotKeys,
+		hashOnly:    true,
+		nkeys:       t.Len(),
+		hash:        t.hash,
+		seed:        t.seed,
+		normalize:   t.normalize,
+	}
+}
+
+// BuildMPHF is like BuildWithOptions but returns a hash-only table, as
+// WithoutKeys does, for callers that only ever look up keys known to be
+// members. Lookup in the returned table reports every key as found. As
+// the table is meant to be small, BuildMPHF packs its indices and codes
+// its seeds, as WithPackedIndices and WithCompressedSeeds do: a CHD table
+// of a million keys then takes about 23 bits per key, 20 of them for the
+// indices, which map each key to its position in keys. A table that may
+// number the keys itself is far smaller: with WithAlgorithm(RecSplit) and
+// WithHashOrder, it takes 1.7 bits per key.
+//
+// The keys are still copied during the build, to detect duplicates, but
+// are not retained. BuildMPHF returns an error for a k-perfect table,
+// which cannot map its keys to their indices without them;
+// WithFingerprints gives one that tells them apart almost always.
+func BuildMPHF[T ~string | ~[]byte](keys []T, opts ...Option) (*Table, error) {
+	opts = append([]Option{WithPackedIndices(), WithCompressedSeeds()}, opts...)
+	t, err := BuildWithOptions(keys, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if t.slotKeys > 1 {
+		return nil, errors.New("mph: BuildMPHF does not support k-perfect tables")
+	}
+	return t.WithoutKeys(), nil
+}
+
+// Key returns the key with index i and whether there is one. It returns
+// false if i is out of range or t is hash-only. The returned slice must not
+// be modified.
+func (t *Table) Key(i uint32) ([]byte, bool) {
+	if t == nil || int(i) >= t.keys.len() {
+		return nil, false
+	}
+	return t.keys.key(int(i)), true
+}
+
+// Len returns the number of keys in t, which is one more than the largest
+// index that Lookup can return.
+func (t *Table) Len() int {
+	if t == nil {
+		return 0
+	}
+	if t.hashOnly {
+		return t.nkeys
+	}
+	return t.keys.len()
+}
+
+// candidate returns the index of the only key in t that s can be equal to.
+func candidate[T ~string | ~[]byte](t *Table, s T) uint32 {
+	return locate(t, s)
+}
+
+// locate returns the candidate of s in t.
+func locate[T ~string | ~[]byte](t *Table, s T) uint32 {
+	return locateHash(t, keyHash(t.hash, t.seed, s), s)
+}
+
+// locateHash returns the candidate of s, whose key hash is kh, in t. A key
+// that the hash function of t can tell is not a key has candidate 0.
+func locateHash[T ~string | ~[]byte](t *Table, kh uint64, s T) uint32 {
+	if t.algo != CHD {
+		r, _ := rankKey(t, kh, s)
+		return t.rankIndex(r)
+	}
+	seed := t.level0.get(t.level0Slots.slot(uint32(kh)))
+	i1 := t.level1Slots.slot(level1Hash(t.hash, kh, seed, s))
+	return t.level1.get(i1 * t.K())
+}
+
+type indexBucket struct {
+	n    int
+	vals []uint32
+}
@@ -2,8 +2,11 @@ package mph
 
 import (
 	"bufio"
+	"errors"
 	"os"
+	"reflect"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 )
@@ -26,7 +29,11 @@ func TestBuild_stress(t *testing.T) {
 }
 
 func testTable(t *testing.T, keys []string, extra []string) {
-	table := Build(keys)
+	checkTable(t, Build(keys), keys, extra)
+}
+
+func checkTable(t *testing.T, table *Table, keys []string, extra []string) {
+	t.Helper()
 	for i, key := range keys {
 		n, ok := Lookup(table, key)
 		if !ok {
@@ -65,6 +72,7 @@ func BenchmarkTable(b *testing.B) {
 	if len(words) == 0 {
 		b.Skip("unable to load dictionary file")
 	}
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		j := i % len(words)
@@ -78,6 +86,25 @@ func BenchmarkTable(b *testing.B) {
 	}
 }
 
+func BenchmarkTableBytes(b *testing.B) {
+	wordsOnce.Do(loadBenchTable)
+	if len(words) == 0 {
+		b.Skip("unable to load dictionary file")
+	}
+	keys := make([][]byte, len(words))
+	for i, w := range words {
+		keys[i] = []byte(w)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		j := i % len(keys)
+		if n, ok := benchTable.LookupBytes(keys[j]); !ok || n != uint32(j) {
+			b.Fatal("bad lookup")
+		}
+	}
+}
+
 // For comparison against BenchmarkTable.
 func BenchmarkTableMap(b *testing.B) {
 	wordsOnce.Do(loadBenchTable)
@@ -130,3 +157,250 @@ func loadDict(dict string) ([]string, error) {
 	}
 	return words, nil
 }
+
+func TestLookupChecked(t *testing.T) {
+	table := Build([]string{"foo", "bar"})
+	if n, ok, err := LookupChecked(table, "bar"); n != 1 || !ok || err != nil {
+		t.Errorf("LookupChecked(bar): got %d, %t, %v; want 1, true, <nil>", n, ok, err)
+	}
+	if _, ok, err := LookupChecked(table, "baz"); ok || err != nil {
+		t.Errorf("LookupChecked(baz): got %t, %v; want false, <nil>", ok, err)
+	}
+}
+
+func TestLen(t *testing.T) {
+	keys := []string{"foo", "foo2", "bar", "baz"}
+	table := Build(keys)
+	if got := table.Len(); got != len(keys) {
+		t.Errorf("Len: got %d; want %d", got, len(keys))
+	}
+	if got := table.WithoutKeys().Len(); got != len(keys) {
+		t.Errorf("WithoutKeys().Len: got %d; want %d", got, len(keys))
+	}
+}
+
+func TestBuildMPHF(t *testing.T) {
+	keys := []string{"foo", "foo2", "bar", "baz"}
+	table, err := BuildMPHF(keys, WithHash(Wyhash))
+	if err != nil {
+		t.Fatalf("BuildMPHF: %v", err)
+	}
+	if table.Len() != len(keys) || table.keys.len() != 0 {
+		t.Errorf("BuildMPHF: got %d keys, %d stored; want %d, 0", table.Len(), table.keys.len(), len(keys))
+	}
+	if table.level1.words == nil {
+		t.Errorf("BuildMPHF: got unpacked indices")
+	}
+	for i, key := range keys {
+		if n, ok := table.Lookup(key); !ok || n != uint32(i) {
+			t.Errorf("Lookup(%s): got %d, %t; want %d, true", key, n, ok, i)
+		}
+	}
+	if _, ok := table.Lookup("quux"); !ok {
+		t.Errorf("Lookup(quux): got !ok; want ok for a hash-only table")
+	}
+	if _, err := BuildMPHF([]string{"foo", "foo"}); err == nil {
+		t.Errorf("BuildMPHF(duplicates): got nil error")
+	}
+}
+
+func TestKey(t *testing.T) {
+	keys := []string{"foo", "foo2", "bar", "baz"}
+	table := Build(keys)
+	for i, key := range keys {
+		got, ok := table.Key(uint32(i))
+		if !ok || string(got) != key {
+			t.Errorf("Key(%d): got %q, %t; want %q, true", i, got, ok, key)
+		}
+	}
+	if _, ok := table.Key(uint32(len(keys))); ok {
+		t.Errorf("Key(%d): got ok; want !ok", len(keys))
+	}
+	if _, ok := table.WithoutKeys().Key(0); ok {
+		t.Errorf("WithoutKeys().Key(0): got ok; want !ok")
+	}
+}
+
+func TestTable_Lookup(t *testing.T) {
+	keys := []string{"foo", "foo2", "bar", "baz"}
+	table := Build(keys)
+	for i, key := range keys {
+		if n, ok := table.Lookup(key); !ok || int(n) != i {
+			t.Errorf("Lookup(%s): got %d, %t; want %d, true", key, n, ok, i)
+		}
+		if n, ok := table.LookupBytes([]byte(key)); !ok || int(n) != i {
+			t.Errorf("LookupBytes(%s): got %d, %t; want %d, true", key, n, ok, i)
+		}
+	}
+	if _, ok := table.Lookup("quux"); ok {
+		t.Errorf("Lookup(quux): got ok; want !ok")
+	}
+	if _, ok := table.LookupBytes([]byte("quux")); ok {
+		t.Errorf("LookupBytes(quux): got ok; want !ok")
+	}
+}
+
+func TestBuildChecked_duplicates(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	keys = append(keys, "500", "20", "500")
+	_, err := BuildChecked(keys)
+	var dup *DuplicateKeyError
+	if !errors.As(err, &dup) {
+		t.Fatalf("BuildChecked: got err=%v; want *DuplicateKeyError", err)
+	}
+	if string(dup.Key) != "500" || dup.First != 500 || dup.Second != 1000 {
+		t.Errorf("BuildChecked: got %v; want key 500 at positions 500 and 1000", dup)
+	}
+	if !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("BuildChecked: error does not wrap ErrDuplicateKey")
+	}
+	if _, err := BuildChecked(keys[:1000]); err != nil {
+		t.Errorf("BuildChecked(unique keys): %v", err)
+	}
+}
+
+func TestBuild_duplicatesPanic(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Build: did not panic on duplicate keys")
+		}
+	}()
+	Build([]string{"foo", "bar", "foo"})
+}
+
+func TestContains(t *testing.T) {
+	table := Build([]string{"foo", "bar"})
+	for _, tt := range []struct {
+		key  string
+		want bool
+	}{
+		{"foo", true},
+		{"bar", true},
+		{"baz", false},
+	} {
+		if got := table.Contains(tt.key); got != tt.want {
+			t.Errorf("Contains(%s): got %t; want %t", tt.key, got, tt.want)
+		}
+		if got := table.ContainsBytes([]byte(tt.key)); got != tt.want {
+			t.Errorf("ContainsBytes(%s): got %t; want %t", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestLookupUnchecked(t *testing.T) {
+	keys := []string{"foo", "foo2", "bar", "baz"}
+	table := Build(keys)
+	for i, key := range keys {
+		if n := LookupUnchecked(table, key); int(n) != i {
+			t.Errorf("LookupUnchecked(%s): got %d; want %d", key, n, i)
+		}
+	}
+	if n := LookupUnchecked(table, "quux"); int(n) >= len(keys) {
+		t.Errorf("LookupUnchecked(quux): got %d; want an index below %d", n, len(keys))
+	}
+}
+
+func TestLookup_empty(t *testing.T) {
+	empty := Build([]string{})
+	for _, tt := range []struct {
+		name  string
+		table *Table
+	}{
+		{"nil", nil},
+		{"zero", new(Table)},
+		{"empty", empty},
+		{"empty hash-only", empty.WithoutKeys()},
+	} {
+		if n, ok := Lookup(tt.table, "foo"); n != 0 || ok {
+			t.Errorf("%s: Lookup(foo): got %d, %t; want 0, false", tt.name, n, ok)
+		}
+		if tt.table.Contains("") {
+			t.Errorf("%s: Contains(\"\"): got true; want false", tt.name)
+		}
+		if n := LookupUnchecked(tt.table, "foo"); n != 0 {
+			t.Errorf("%s: LookupUnchecked(foo): got %d; want 0", tt.name, n)
+		}
+		out := []uint32{1}
+		if found := LookupAll(tt.table, []string{"foo"}, out); found != 0 || out[0] != NotFound {
+			t.Errorf("%s: LookupAll: got %d, %v; want 0, [NotFound]", tt.name, found, out)
+		}
+		if tt.table.Len() != 0 {
+			t.Errorf("%s: Len: got %d; want 0", tt.name, tt.table.Len())
+		}
+		if _, ok := tt.table.Key(0); ok {
+			t.Errorf("%s: Key(0): got ok; want !ok", tt.name)
+		}
+	}
+}
+
+func TestBuild_namedTypes(t *testing.T) {
+	type token string
+	type word []byte
+	tokens := []token{"foo", "bar", "baz"}
+	table := Build(tokens)
+	for i, tok := range tokens {
+		if n, ok := Lookup(table, tok); !ok || int(n) != i {
+			t.Errorf("Lookup(%s): got %d, %t; want %d, true", tok, n, ok, i)
+		}
+		if n, ok := Lookup(table, word(tok)); !ok || int(n) != i {
+			t.Errorf("Lookup(word(%s)): got %d, %t; want %d, true", tok, n, ok, i)
+		}
+	}
+	if _, ok := Lookup(table, token("quux")); ok {
+		t.Errorf("Lookup(quux): got ok; want !ok")
+	}
+	checkTable(t, Build([]word{word("foo"), word("bar")}), []string{"foo", "bar"}, []string{"baz"})
+}
+
+func TestLookup_allocs(t *testing.T) {
+	long := strings.Repeat("long key ", 10)
+	table := Build([]string{"foo", long})
+	hit, miss := []byte(long), []byte(long+"!")
+	for _, tt := range []struct {
+		name string
+		fn   func()
+	}{
+		{"Lookup", func() { table.Lookup(long) }},
+		{"LookupBytes hit", func() { table.LookupBytes(hit) }},
+		{"LookupBytes miss", func() { table.LookupBytes(miss) }},
+		{"generic Lookup", func() { Lookup(table, hit) }},
+		{"Contains", func() { table.ContainsBytes(hit) }},
+	} {
+		if allocs := testing.AllocsPerRun(100, tt.fn); allocs != 0 {
+			t.Errorf("%s: got %v allocs; want 0", tt.name, allocs)
+		}
+	}
+}
+
+func TestBuild_allocs(t *testing.T) {
+	var keys []string
+	for i := 0; i < 10000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	// The number of allocations must not grow with the number of keys or
+	// buckets.
+	if allocs := testing.AllocsPerRun(1, func() { Build(keys) }); allocs > 30 {
+		t.Errorf("Build: got %v allocs; want at most 30", allocs)
+	}
+}
+
+func TestBucketIndex(t *testing.T) {
+	slots := []uint32{2, 0, 2, 3, 2, 0}
+	b := newBucketIndex(slots, 4)
+	want := [][]uint32{{1, 5}, {}, {0, 2, 4}, {3}}
+	for n, w := range want {
+		if got := b.bucket(n); !reflect.DeepEqual(append([]uint32{}, got...), w) {
+			t.Errorf("bucket(%d): got %v; want %v", n, got, w)
+		}
+	}
+	var order []int
+	for _, bucket := range b.bySize(nil) {
+		order = append(order, bucket.n)
+	}
+	if !reflect.DeepEqual(order, []int{2, 0, 3}) {
+		t.Errorf("bySize: got slots %v; want [2 0 3]", order)
+	}
+}
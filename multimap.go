@@ -0,0 +1,77 @@
+package mph
+
+import "errors"
+
+// A MultiMap is an immutable map from keys to lists of values of type V,
+// for data in which a key can legitimately occur more than once, like the
+// surface forms of a dictionary with several entries each. The values of
+// each key are stored contiguously, in the order they were given.
+type MultiMap[V any] struct {
+	table  *Table
+	starts []uint32 // values of key i are values[starts[i]:starts[i+1]]
+	values []V
+}
+
+// BuildMultiMap builds a MultiMap in which each key maps to the values at
+// the positions where it occurs in keys. Unlike BuildMap, repeated keys are
+// allowed. The keys are numbered in order of first occurrence.
+func BuildMultiMap[K ~string | ~[]byte, V any](keys []K, values []V) (*MultiMap[V], error) {
+	if len(keys) != len(values) {
+		return nil, errors.New("mph: BuildMultiMap: keys and values have different lengths")
+	}
+	table, err := BuildWithOptions(keys, WithDedup(nil))
+	if err != nil {
+		return nil, err
+	}
+	index := make([]uint32, len(keys))
+	starts := make([]uint32, table.Len()+1)
+	for i, k := range keys {
+		n, _ := lookup(table, k)
+		index[i] = n
+		starts[n+1]++
+	}
+	for i := 1; i < len(starts); i++ {
+		starts[i] += starts[i-1]
+	}
+	next := append([]uint32(nil), starts[:len(starts)-1]...)
+	grouped := make([]V, len(values))
+	for i, n := range index {
+		grouped[next[n]] = values[i]
+		next[n]++
+	}
+	return &MultiMap[V]{
+		table:  table,
+		starts: starts,
+		values: grouped,
+	}, nil
+}
+
+// Get returns the values for key, which are nil if key is not in m. The
+// returned slice must not be modified.
+func (m *MultiMap[V]) Get(key string) []V {
+	return getAll(m, key)
+}
+
+// GetBytes is like Get but takes the key as a byte slice.
+func (m *MultiMap[V]) GetBytes(key []byte) []V {
+	return getAll(m, key)
+}
+
+func getAll[V any, T ~string | ~[]byte](m *MultiMap[V], key T) []V {
+	n, ok := lookup(m.table, key)
+	if !ok {
+		return nil
+	}
+	start, end := m.starts[n], m.starts[n+1]
+	return m.values[start:end:end]
+}
+
+// Len returns the number of distinct keys in m.
+func (m *MultiMap[V]) Len() int {
+	return m.table.Len()
+}
+
+// Table returns the Table that m uses to index its keys.
+func (m *MultiMap[V]) Table() *Table {
+	return m.table
+}
@@ -0,0 +1,37 @@
+package mph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildMultiMap(t *testing.T) {
+	keys := []string{"run", "set", "run", "go", "set", "run"}
+	values := []uint32{0, 1, 2, 3, 4, 5}
+	m, err := BuildMultiMap(keys, values)
+	if err != nil {
+		t.Fatalf("BuildMultiMap: %v", err)
+	}
+	if m.Len() != 3 {
+		t.Errorf("Len: got %d; want 3", m.Len())
+	}
+	for _, tt := range []struct {
+		key  string
+		want []uint32
+	}{
+		{"run", []uint32{0, 2, 5}},
+		{"set", []uint32{1, 4}},
+		{"go", []uint32{3}},
+		{"walk", nil},
+	} {
+		if got := m.Get(tt.key); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Get(%s): got %v; want %v", tt.key, got, tt.want)
+		}
+		if got := m.GetBytes([]byte(tt.key)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GetBytes(%s): got %v; want %v", tt.key, got, tt.want)
+		}
+	}
+	if _, err := BuildMultiMap(keys, values[:1]); err == nil {
+		t.Errorf("BuildMultiMap(mismatched lengths): got nil error")
+	}
+}
@@ -1,12 +1,19 @@
 package mph
 
 import (
+	"math/bits"
 	"reflect"
 	"unsafe"
 )
 
 // This file contains an optimized murmur3 32-bit implementation tailored for
 // our specific use case. See https://en.wikipedia.org/wiki/MurmurHash.
+//
+// There is no assembly version. Each round of the block loop depends on the
+// previous one through h, so SIMD has nothing to work on, and on amd64 the
+// compiler already turns the loop into the IMUL, ROL and LEA sequence that
+// would be written by hand. TestMurmurReference guards that any rewrite
+// still matches the plain reference implementation.
 
 // A murmurSeed is the initial state of a Murmur3 hash.
 type murmurSeed uint32
@@ -23,7 +30,7 @@ const (
 )
 
 // murmurHash computes the 32-bit Murmur3 hash of s using ms as the seed.
-func murmurHash[T string | []byte](ms murmurSeed, s T) uint32 {
+func murmurHash[T ~string | ~[]byte](ms murmurSeed, s T) uint32 {
 	h := uint32(ms)
 	l := len(s)
 	numBlocks := l / 4
@@ -33,6 +40,11 @@ func murmurHash[T string | []byte](ms murmurSeed, s T) uint32 {
 	header.Len = numBlocks
 	header.Cap = numBlocks
 	for _, k := range blocks {
+		if !hostLittleEndian {
+			// Murmur3 reads blocks as little-endian words. Doing the same
+			// on every host keeps tables portable across architectures.
+			k = bits.ReverseBytes32(k)
+		}
 		k *= c1
 		k = (k << r1Left) | (k >> r1Right)
 		k *= c2
@@ -41,18 +53,19 @@ func murmurHash[T string | []byte](ms murmurSeed, s T) uint32 {
 		h = h*m + n
 	}
 
+	// Slicing off the tail first costs one bounds check, after which the
+	// reads below are known to be in range.
 	var k uint32
-	ntail := l & 3
-	itail := l - ntail
-	switch ntail {
+	tail := s[l&^3:]
+	switch len(tail) {
 	case 3:
-		k ^= uint32(s[itail+2]) << 16
-		fallthrough
+		k = uint32(tail[0]) | uint32(tail[1])<<8 | uint32(tail[2])<<16
 	case 2:
-		k ^= uint32(s[itail+1]) << 8
-		fallthrough
+		k = uint32(tail[0]) | uint32(tail[1])<<8
 	case 1:
-		k ^= uint32(s[itail])
+		k = uint32(tail[0])
+	}
+	if len(tail) > 0 {
 		k *= c1
 		k = (k << r1Left) | (k >> r1Right)
 		k *= c2
@@ -1,7 +1,10 @@
 package mph
 
 import (
+	"encoding/binary"
 	"fmt"
+	"math/bits"
+	"math/rand"
 	"strings"
 	"testing"
 )
@@ -41,8 +44,53 @@ func TestMurmur(t *testing.T) {
 	}
 }
 
+// murmurReference is a direct transcription of the reference MurmurHash3_x86_32.
+func murmurReference(seed uint32, data []byte) uint32 {
+	h, l := seed, len(data)
+	for len(data) >= 4 {
+		k := binary.LittleEndian.Uint32(data)
+		k = bits.RotateLeft32(k*c1, r1Left) * c2
+		h = bits.RotateLeft32(h^k, r2Left)*m + n
+		data = data[4:]
+	}
+	var k uint32
+	for i := len(data) - 1; i >= 0; i-- {
+		k = k<<8 | uint32(data[i])
+	}
+	if len(data) > 0 {
+		h ^= bits.RotateLeft32(k*c1, r1Left) * c2
+	}
+	h ^= uint32(l)
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
+
+func TestMurmurReference(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for size := 0; size < 300; size++ {
+		buf := make([]byte, size+3)
+		rng.Read(buf)
+		seed := rng.Uint32()
+		// Unaligned starts exercise the unaligned block loads.
+		for off := 0; off < 4; off++ {
+			b := buf[off : off+size]
+			want := murmurReference(seed, b)
+			if got := murmurHash(murmurSeed(seed), b); got != want {
+				t.Errorf("hash(%x, seed=0x%x): got 0x%x; want 0x%x", b, seed, got, want)
+			}
+			if got := murmurHash(murmurSeed(seed), string(b)); got != want {
+				t.Errorf("hash(%q, seed=0x%x): got 0x%x; want 0x%x", b, seed, got, want)
+			}
+		}
+	}
+}
+
 func BenchmarkMurmur(b *testing.B) {
-	for _, size := range []int{1, 4, 8, 16, 32, 50, 500} {
+	for _, size := range []int{1, 4, 8, 16, 32, 50, 128, 500, 4096} {
 		b.Run(fmt.Sprint(size), func(b *testing.B) {
 			s := strings.Repeat("a", size)
 			b.SetBytes(int64(size))
@@ -0,0 +1,408 @@
+package mph
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// An Option configures how BuildWithOptions builds a Table. Options keep
+// the simple Build signature stable while allowing the construction to be
+// tuned.
+type Option func(*buildConfig)
+
+type buildConfig struct {
+	dedup       bool
+	removed     *int
+	verify      bool
+	progress    func(done, total int)
+	normalize   func([]byte) []byte
+	parallelism int
+	packLevel1  bool
+	codeSeeds   bool
+	monotone    bool
+	bucketSize  float64
+	loadFactor  float64
+	hash        Hash
+	seed        uint64 // for WithSeed
+	algorithm   Algorithm
+	leafSize    int // for RecSplit
+	splitBucket int // for RecSplit
+	k           int // for WithKPerfect
+	exactSizes  bool
+	borrowKeys  bool
+	frontCoding bool
+	weights     []float64
+	stable      *Table // for WithStableIndices
+	alloc       func(size int) []byte
+	scratch     *buildScratch // set by a Builder
+	maxSeeds    int
+	retries     int  // for WithRetries
+	hashOrder   bool // for WithHashOrder
+
+	// sizes, if set, are the numbers of level0 and level1 slots of a CHD
+	// table that is rebuilt as it was; see Apply.
+	sizes [2]int
+
+	// Line parsing for BuildFromReader.
+	trimSpace bool
+	comment   string
+}
+
+// BuildWithOptions is like BuildChecked but lets opts configure how the
+// table is built.
+func BuildWithOptions[T ~string | ~[]byte](keys []T, opts ...Option) (*Table, error) {
+	return BuildContext(context.Background(), keys, opts...)
+}
+
+// BuildContext is like BuildWithOptions but stops early and returns
+// ctx.Err() if ctx is done before the table is finished. Large tables can
+// take a long time to build, so this allows a build to be abandoned cleanly,
+// for example on shutdown.
+func BuildContext[T ~string | ~[]byte](ctx context.Context, keys []T, opts ...Option) (*Table, error) {
+	cfg := newBuildConfig(opts)
+	return cfg.finish(build(ctx, keys, cfg))
+}
+
+func newBuildConfig(opts []Option) *buildConfig {
+	var cfg buildConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &cfg
+}
+
+// rebuildConfig returns a configuration that builds tables like t: with
+// its hash function, seed, algorithm, k and layout, and level arrays of the
+// sizes that the options t was built with give for other keys. t does not
+// record its normalizer or weights, so they are not kept.
+func (t *Table) rebuildConfig() *buildConfig {
+	cfg := &buildConfig{
+		hash:        t.hash,
+		seed:        t.seed,
+		algorithm:   t.algo,
+		k:           t.slotKeys,
+		packLevel1:  t.level1.words != nil,
+		codeSeeds:   t.level0.coded != nil,
+		frontCoding: t.keys.front != nil,
+		hashOrder:   t.hashOrder,
+	}
+	n := t.Len()
+	switch {
+	case t.algo == RecSplit && len(t.recsplit.keys) > 1:
+		nb := len(t.recsplit.keys) - 1
+		cfg.leafSize = t.recsplit.leaf
+		cfg.splitBucket = (n + nb - 1) / nb
+	case t.algo == CHD && n > 0 && (t.level0Slots.mask < 0 || t.level1Slots.mask < 0):
+		k := t.K()
+		cfg.exactSizes = true
+		cfg.bucketSize = float64(n) / float64(t.level0Slots.n)
+		cfg.loadFactor = float64((n+k-1)/k) / float64(t.level1Slots.n)
+	}
+	return cfg
+}
+
+// finish applies the options that act on a built table.
+func (c *buildConfig) finish(t *Table, err error) (*Table, error) {
+	if err != nil {
+		return nil, err
+	}
+	if c.verify {
+		if err := t.verify(); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// WithDedup makes BuildWithOptions drop repeated keys, keeping the first
+// occurrence of each, instead of returning a *DuplicateKeyError. Indices are
+// assigned to the remaining keys in order, so a key's index is its position
+// in keys with the repeated occurrences removed. If removed is not nil, the
+// number of dropped keys is stored in *removed.
+func WithDedup(removed *int) Option {
+	return func(c *buildConfig) {
+		c.dedup = true
+		c.removed = removed
+	}
+}
+
+// WithVerify makes BuildWithOptions look up every key in the finished table
+// and return an error unless each one resolves to its own index. It roughly
+// doubles the build time and is meant for pipelines that want to check a
+// table before shipping it.
+func WithVerify() Option {
+	return func(c *buildConfig) {
+		c.verify = true
+	}
+}
+
+func (t *Table) verify() error {
+	for i := 0; i < t.keys.len(); i++ {
+		k := t.keys.key(i)
+		if n, ok := lookup(t, k); !ok || n != uint32(i) {
+			return fmt.Errorf("mph: verification failed for key %q: got index %d, %t; want %d", k, n, ok, i)
+		}
+	}
+	return nil
+}
+
+// WithProgress makes BuildWithOptions call fn after placing each bucket of
+// keys, with the number of buckets placed so far and the total number of
+// buckets. fn is called synchronously from the building goroutine, so it
+// should return quickly, for example by storing the values for a progress
+// bar or watchdog to pick up.
+func WithProgress(fn func(done, total int)) Option {
+	return func(c *buildConfig) {
+		c.progress = fn
+	}
+}
+
+// WithTrimSpace makes BuildFromReader remove leading and trailing white
+// space from each line. It has no effect on other build functions.
+func WithTrimSpace() Option {
+	return func(c *buildConfig) {
+		c.trimSpace = true
+	}
+}
+
+// WithComments makes BuildFromReader ignore lines that start with prefix,
+// such as "#", after any trimming. It has no effect on other build
+// functions.
+func WithComments(prefix string) Option {
+	return func(c *buildConfig) {
+		c.comment = prefix
+	}
+}
+
+// WithNormalizer makes BuildWithOptions store fn(key) in place of each key,
+// and the built table apply fn to every key it is asked to look up, so that
+// for example case folding or Unicode normalization need not be repeated
+// at each call site. fn may modify its argument, which is always a copy,
+// and must be idempotent: stored keys are normalized again when the table
+// is verified. Keys that are equal after normalization are duplicates.
+//
+// The normalizer is not serialized, and code generated by Gen or GenC does
+// not apply it; use Table.WithNormalizer to attach it to a loaded table.
+func WithNormalizer(fn func([]byte) []byte) Option {
+	return func(c *buildConfig) {
+		c.normalize = fn
+	}
+}
+
+// WithNormalizer returns a copy of t that shares its level arrays and keys
+// and normalizes keys with fn before looking them up, as if t had been built
+// with the WithNormalizer option. It is meant for tables loaded from a table
+// that was built with fn.
+func (t *Table) WithNormalizer(fn func([]byte) []byte) *Table {
+	c := *t
+	c.normalize = fn
+	return &c
+}
+
+// WithPackedIndices makes BuildWithOptions store the key indices of level1
+// in the fewest bits that can hold an index, rather than in 32 bits each.
+// For a table of a million keys, which needs 20 bits per index, that makes
+// level1 more than a third smaller, at the cost of a few more instructions
+// per lookup.
+func WithPackedIndices() Option {
+	return func(c *buildConfig) {
+		c.packLevel1 = true
+	}
+}
+
+// WithCompressedSeeds makes BuildWithOptions entropy code the level0 seeds
+// of CHD, as the "compress" step of "Hash, displace, and compress" does,
+// rather than store them in 16 bits each. Seeds take about 8 bits each
+// coded, so level0 is about half as large: with 4 keys per bucket, it takes
+// about 2.1 bits per key instead of 4.2, close to the figures of the paper.
+// Decoding a seed takes a short scan of the codes, which makes a lookup
+// about a third slower (see BenchmarkLookup_compressedSeeds).
+// WithBucketSize and WithLoadFactor trade seeds against buckets; larger
+// buckets need larger seeds but fewer of them. Seeds are stored as without
+// the option if coding them would not save space.
+func WithCompressedSeeds() Option {
+	return func(c *buildConfig) {
+		c.codeSeeds = true
+	}
+}
+
+// seeds returns level0 in the form selected by the options.
+func (c *buildConfig) seeds(level0 []uint32) seedArray {
+	if c.codeSeeds {
+		return newCodedSeeds(level0)
+	}
+	return newSeedArray(level0)
+}
+
+// indices returns level1 in the form selected by the options.
+func (c *buildConfig) indices(level1 []uint32, nkeys int) indexArray {
+	if c.packLevel1 {
+		return packIndices(level1, nkeys)
+	}
+	if nkeys <= maxNarrowKeys {
+		return narrowIndices(level1)
+	}
+	return indexArray{wide: level1}
+}
+
+// WithBucketSize sets the average number of keys per level0 bucket, which
+// is 4 by default. Larger buckets make level0 smaller but take longer to
+// place, since every key of a bucket must find a free level1 slot with the
+// same seed. The number of buckets is rounded up to a power of 2.
+func WithBucketSize(keysPerBucket float64) Option {
+	return func(c *buildConfig) {
+		c.bucketSize = keysPerBucket
+	}
+}
+
+// WithLoadFactor sets the largest fraction of level1 slots that may hold a
+// key, which is 1 by default. Lower load factors leave more free slots to
+// place buckets in, which speeds up the build, notably for large buckets,
+// at the cost of a larger level1. The number of slots is rounded up to a
+// power of 2, so the actual load factor is between half of alpha and alpha.
+func WithLoadFactor(alpha float64) Option {
+	return func(c *buildConfig) {
+		c.loadFactor = alpha
+	}
+}
+
+// check reports invalid option values.
+func (c *buildConfig) check() error {
+	if c.bucketSize != 0 && !(c.bucketSize >= 1) {
+		return fmt.Errorf("mph: bucket size %v is less than 1", c.bucketSize)
+	}
+	if c.loadFactor != 0 && !(c.loadFactor > 0 && c.loadFactor <= 1) {
+		return fmt.Errorf("mph: load factor %v is not in (0, 1]", c.loadFactor)
+	}
+	if c.hash > Wyhash {
+		return fmt.Errorf("mph: unknown hash %v", c.hash)
+	}
+	if !c.algorithm.known() {
+		return fmt.Errorf("mph: unknown algorithm %v", c.algorithm)
+	}
+	if c.algorithm == RecSplit {
+		if err := c.checkRecSplitSizes(); err != nil {
+			return err
+		}
+	}
+	if err := c.checkK(); err != nil {
+		return err
+	}
+	if err := c.checkWeights(); err != nil {
+		return err
+	}
+	if err := c.checkHashOrder(); err != nil {
+		return err
+	}
+	return c.checkStable()
+}
+
+// level0Len returns the number of level0 buckets for nkeys keys.
+func (c *buildConfig) level0Len(nkeys int) int {
+	if c.sizes[0] != 0 {
+		return c.sizes[0]
+	}
+	bucketSize := c.bucketSize
+	if bucketSize == 0 {
+		bucketSize = 4
+	}
+	if c.exactSizes {
+		return exactLen(nkeys, bucketSize)
+	}
+	return nextPow2(int(float64(nkeys) / bucketSize))
+}
+
+// level1Len returns the number of level1 slots for nkeys keys.
+func (c *buildConfig) level1Len(nkeys int) int {
+	loadFactor := c.loadFactor
+	if loadFactor == 0 {
+		loadFactor = 1
+	}
+	if c.exactSizes {
+		return exactLen(nkeys, loadFactor)
+	}
+	return nextPow2(int(math.Ceil(float64(nkeys) / loadFactor)))
+}
+
+// exactLen returns the size nkeys/ratio of a level array, rounded up, and
+// at least 1.
+func exactLen(nkeys int, ratio float64) int {
+	if n := int(math.Ceil(float64(nkeys) / ratio)); n > 1 {
+		return n
+	}
+	return 1
+}
+
+// WithHash makes BuildWithOptions hash keys with h instead of Murmur3. Code
+// generated by Gen or GenC only implements Murmur3, so they refuse tables
+// built with another hash.
+//
+// Wyhash is the better choice for large key sets. It hashes each key once,
+// to 64 bits, and derives the candidate slots of every seed tried for it
+// from that hash, so the seed search does not rehash keys and 64 bits keep
+// the keys of a bucket apart however many keys there are. For a million
+// short keys it builds in about half the time of Murmur3.
+func WithHash(h Hash) Option {
+	return func(c *buildConfig) {
+		c.hash = h
+	}
+}
+
+// WithSeed makes BuildWithOptions perturb the hash of every key with seed,
+// which the table records, and which its serialized form keeps, so that a
+// loaded table looks keys up as it was built. Keys whose hashes collide
+// with the default seed of 0, and so make for large level0 buckets and
+// long builds, are then unlikely to collide with another: a service that
+// builds tables from keys that others choose can pick a random seed per
+// deployment, so that nobody can compute such keys in advance.
+//
+// The seed perturbs the key hash of each key, from which its level0 bucket
+// derives, and with Wyhash every other hash of the key. With Murmur3, the
+// seed is folded to 32 bits, and the hashes that the bucket seeds of CHD
+// select level1 slots with are not perturbed; as Murmur3 has collisions
+// that hold for any seed, Wyhash is the better choice against adversarial
+// keys. Code generated by Gen or GenC refuses tables with a seed.
+func WithSeed(seed uint64) Option {
+	return func(c *buildConfig) {
+		c.seed = seed
+	}
+}
+
+// WithMaxSeedAttempts makes BuildWithOptions try at most n seeds for each
+// bucket of keys, and return ErrBuildFailed if some bucket fits with none
+// of them, rather than trying all 2^32 seeds. Unlucky inputs can take
+// millions of attempts for the last buckets placed, notably at the default
+// load factor, so a small n is best combined with WithLoadFactor or
+// WithRetries. If n is 0 or less, all seeds are allowed.
+func WithMaxSeedAttempts(n int) Option {
+	return func(c *buildConfig) {
+		c.maxSeeds = n
+	}
+}
+
+// WithRetries makes BuildWithOptions fall back, when some bucket fits with
+// none of the seeds that WithMaxSeedAttempts allows, to placing all the
+// keys again, up to n times, and only then return ErrBuildFailed. Each
+// retry rehashes the keys with a fresh seed, as WithSeed would give them,
+// which breaks up a large bucket of keys crafted to collide under the
+// last seed, and every second retry also doubles level1, which halves the
+// share of slots that the keys fill and makes any bucket far more likely
+// to fit. A small seed limit thus bounds the build time of adversarial
+// inputs without failing builds. A retry costs as much as the first
+// placement; the table keeps the seed of the last one, so Gen and GenC
+// refuse it, and Stats tells the level1 size that was used. Only CHD uses
+// the option.
+func WithRetries(n int) Option {
+	return func(c *buildConfig) {
+		c.retries = n
+	}
+}
+
+// seedLimit returns one more than the largest seed that may be tried.
+func (c *buildConfig) seedLimit() uint64 {
+	if c.maxSeeds <= 0 || uint64(c.maxSeeds) > 1<<32 {
+		return 1 << 32
+	}
+	return uint64(c.maxSeeds)
+}
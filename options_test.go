@@ -0,0 +1,336 @@
+package mph
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestWithDedup(t *testing.T) {
+	var keys, unique []string
+	for i := 0; i < 1000; i++ {
+		s := strconv.Itoa(i)
+		keys = append(keys, s)
+		unique = append(unique, s)
+		if i%10 == 0 {
+			keys = append(keys, strconv.Itoa(i/2))
+		}
+	}
+	removed := -1
+	table, err := BuildWithOptions(keys, WithDedup(&removed))
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	if removed != 100 {
+		t.Errorf("WithDedup: removed %d keys; want 100", removed)
+	}
+	checkTable(t, table, unique, []string{"1000", "quux"})
+
+	// Without duplicates, nothing is removed.
+	if _, err := BuildWithOptions(unique, WithDedup(&removed)); err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	if removed != 0 {
+		t.Errorf("WithDedup: removed %d keys; want 0", removed)
+	}
+}
+
+func TestWithVerify(t *testing.T) {
+	keys := []string{"foo", "foo2", "bar", "baz"}
+	table, err := BuildWithOptions(keys, WithVerify())
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	checkTable(t, table, keys, []string{"quux"})
+
+	l1 := table.level1.narrow
+	l1[0], l1[1] = l1[1], l1[0]
+	if err := table.verify(); err == nil {
+		t.Errorf("verify of a damaged table: got nil error")
+	}
+}
+
+func TestBuildContext(t *testing.T) {
+	var keys []string
+	for i := 0; i < 10000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	table, err := BuildContext(context.Background(), keys)
+	if err != nil {
+		t.Fatalf("BuildContext: %v", err)
+	}
+	checkTable(t, table, keys, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := BuildContext(ctx, keys); err != context.Canceled {
+		t.Errorf("BuildContext(canceled): got err=%v; want %v", err, context.Canceled)
+	}
+}
+
+func TestWithProgress(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	var calls, last, total int
+	_, err := BuildWithOptions(keys, WithProgress(func(done, n int) {
+		calls++
+		if done != last+1 || (total != 0 && n != total) {
+			t.Errorf("progress(%d, %d) after progress(%d, %d)", done, n, last, total)
+		}
+		last, total = done, n
+	}))
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	if calls == 0 || last != total {
+		t.Errorf("progress: %d calls ending at %d of %d", calls, last, total)
+	}
+}
+
+func TestWithNormalizer(t *testing.T) {
+	fold := func(b []byte) []byte { return bytes.ToLower(b) }
+	keys := []string{"Foo", "BAR", "baz"}
+	table, err := BuildWithOptions(keys, WithNormalizer(fold), WithVerify())
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	for _, tt := range []struct {
+		key  string
+		want uint32
+		ok   bool
+	}{
+		{"foo", 0, true},
+		{"FOO", 0, true},
+		{"Bar", 1, true},
+		{"BAZ", 2, true},
+		{"quux", 0, false},
+	} {
+		n, ok := table.Lookup(tt.key)
+		if ok != tt.ok || (ok && n != tt.want) {
+			t.Errorf("Lookup(%s): got %d, %t; want %d, %t", tt.key, n, ok, tt.want, tt.ok)
+		}
+		if ok && LookupUnchecked(table, tt.key) != tt.want {
+			t.Errorf("LookupUnchecked(%s): got %d; want %d", tt.key, LookupUnchecked(table, tt.key), tt.want)
+		}
+	}
+	key := []byte("FOO")
+	table.LookupBytes(key)
+	if string(key) != "FOO" {
+		t.Errorf("LookupBytes modified its argument: %q", key)
+	}
+	out := make([]uint32, 2)
+	if found := LookupAll(table, []string{"BaZ", "quux"}, out); found != 1 || out[0] != 2 || out[1] != NotFound {
+		t.Errorf("LookupAll: got %d, %v; want 1, [2 NotFound]", found, out)
+	}
+
+	data, err := table.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	loaded, err := LoadBytes(data)
+	if err != nil {
+		t.Fatalf("LoadBytes: %v", err)
+	}
+	if n, ok := loaded.WithNormalizer(fold).Lookup("Baz"); !ok || n != 2 {
+		t.Errorf("WithNormalizer(loaded).Lookup(Baz): got %d, %t; want 2, true", n, ok)
+	}
+
+	if _, err := BuildWithOptions([]string{"foo", "FOO"}, WithNormalizer(fold)); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("BuildWithOptions(foo, FOO): got err=%v; want %v", err, ErrDuplicateKey)
+	}
+}
+
+func TestWithBucketSizeAndLoadFactor(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	for _, tt := range []struct {
+		name       string
+		opts       []Option
+		wantLevel0 int
+		wantLevel1 int
+	}{
+		{"default", nil, 256, 1024},
+		{"small buckets", []Option{WithBucketSize(1)}, 1024, 1024},
+		{"large buckets", []Option{WithBucketSize(7.5)}, 256, 1024},
+		{"half full", []Option{WithLoadFactor(0.5)}, 256, 2048},
+		{"both", []Option{WithBucketSize(16), WithLoadFactor(0.9)}, 64, 2048},
+	} {
+		table, err := BuildWithOptions(keys, tt.opts...)
+		if err != nil {
+			t.Errorf("%s: BuildWithOptions: %v", tt.name, err)
+			continue
+		}
+		if s := table.Stats(); s.Level0Len != tt.wantLevel0 || s.Level1Len != tt.wantLevel1 {
+			t.Errorf("%s: got levels of %d and %d; want %d and %d", tt.name, s.Level0Len, s.Level1Len, tt.wantLevel0, tt.wantLevel1)
+		}
+		checkTable(t, table, keys, []string{"x"})
+	}
+	for _, opt := range []Option{WithBucketSize(0.5), WithLoadFactor(1.5), WithLoadFactor(-1)} {
+		if _, err := BuildWithOptions(keys, opt); err == nil {
+			t.Errorf("BuildWithOptions with invalid sizing: got nil error")
+		}
+	}
+}
+
+func TestWithMaxSeedAttempts(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	for _, workers := range []int{1, 4} {
+		_, err := BuildWithOptions(keys, WithMaxSeedAttempts(1), WithParallelism(workers))
+		if err != ErrBuildFailed {
+			t.Errorf("WithMaxSeedAttempts(1), %d workers: got err=%v; want %v", workers, err, ErrBuildFailed)
+		}
+		table, err := BuildWithOptions(keys, WithMaxSeedAttempts(1000), WithLoadFactor(0.5), WithParallelism(workers))
+		if err != nil {
+			t.Fatalf("WithMaxSeedAttempts(1000), %d workers: %v", workers, err)
+		}
+		if s := table.Stats(); s.MaxSeed >= 1000 {
+			t.Errorf("WithMaxSeedAttempts(1000): got a seed of %d", s.MaxSeed)
+		}
+		checkTable(t, table, keys, []string{"x"})
+	}
+}
+
+func TestWithRetries(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	for _, workers := range []int{1, 4} {
+		if _, err := BuildWithOptions(keys, WithMaxSeedAttempts(4), WithRetries(1), WithParallelism(workers)); err != ErrBuildFailed {
+			t.Errorf("WithRetries(1), %d workers: got err=%v; want %v", workers, err, ErrBuildFailed)
+		}
+		table, err := BuildWithOptions(keys, WithMaxSeedAttempts(4), WithRetries(10), WithParallelism(workers))
+		if err != nil {
+			t.Fatalf("WithRetries(10), %d workers: %v", workers, err)
+		}
+		if s := table.Stats(); s.MaxSeed >= 4 || s.Level1Len <= 1024 {
+			t.Errorf("WithRetries(10): got a seed of %d and %d level1 slots", s.MaxSeed, s.Level1Len)
+		}
+		checkTable(t, table, keys, []string{"x"})
+	}
+}
+
+func TestWithRetries_collisions(t *testing.T) {
+	for _, h := range []Hash{Murmur3, Wyhash} {
+		// Keys that all fall into the first of the 16 level0 buckets of
+		// 64 keys under the default seed.
+		slots0 := newSlotMap(16)
+		var keys []string
+		for i := 0; len(keys) < 64; i++ {
+			k := "key" + strconv.Itoa(i)
+			if slots0.slot(uint32(keyHash(h, 0, k))) == 0 {
+				keys = append(keys, k)
+			}
+		}
+		if _, err := BuildWithOptions(keys, WithHash(h), WithMaxSeedAttempts(1<<16)); err != ErrBuildFailed {
+			t.Fatalf("BuildWithOptions(%v): got err=%v; want %v", h, err, ErrBuildFailed)
+		}
+		table, err := BuildWithOptions(keys, WithHash(h), WithMaxSeedAttempts(1<<16), WithRetries(1))
+		if err != nil {
+			t.Fatalf("BuildWithOptions(%v, WithRetries(1)): %v", h, err)
+		}
+		if s := table.Stats(); s.Level1Len != 64 {
+			t.Errorf("WithRetries(1), %v: got %d level1 slots; want 64", h, s.Level1Len)
+		}
+		checkTable(t, table, keys, []string{"x"})
+		data, err := table.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary: %v", err)
+		}
+		loaded, err := LoadBytes(data)
+		if err != nil {
+			t.Fatalf("LoadBytes: %v", err)
+		}
+		checkTable(t, loaded, keys, []string{"x"})
+	}
+}
+
+func TestWithSeed(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, "key"+strconv.Itoa(i))
+	}
+	extra := []string{"", "key", "key1000"}
+	for _, h := range []Hash{Murmur3, Wyhash} {
+		for _, a := range []Algorithm{CHD, BBHash, RecSplit, PTHash, BDZ} {
+			plain, err := BuildWithOptions(keys, WithHash(h), WithAlgorithm(a))
+			if err != nil {
+				t.Fatalf("BuildWithOptions(%v, %v): %v", h, a, err)
+			}
+			table, err := BuildWithOptions(keys, WithHash(h), WithAlgorithm(a), WithSeed(0x0123456789abcdef), WithVerify())
+			if err != nil {
+				t.Fatalf("BuildWithOptions(%v, %v, WithSeed): %v", h, a, err)
+			}
+			checkTable(t, table, keys, extra)
+			if Equal(table, plain) {
+				t.Errorf("WithSeed(%v, %v): got the table of seed 0", h, a)
+			}
+			data, err := table.MarshalBinary()
+			if err != nil {
+				t.Fatalf("MarshalBinary: %v", err)
+			}
+			if hdr := table.header(); !hdr.seeded() || hdr.size() != uint64(len(data)) {
+				t.Errorf("MarshalBinary(%v, %v): got %d bytes and flags %#x; want %d and the seed flag", h, a, len(data), hdr.flags, hdr.size())
+			}
+			loaded, err := LoadBytes(data)
+			if err != nil {
+				t.Fatalf("LoadBytes: %v", err)
+			}
+			parallel, err := Unmarshal(data, WithDecodeParallelism(3))
+			if err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			var read Table
+			if err := read.UnmarshalBinary(data); err != nil {
+				t.Fatalf("UnmarshalBinary: %v", err)
+			}
+			for _, l := range []*Table{loaded, parallel, &read} {
+				checkTable(t, l, keys, extra)
+				if !Equal(l, table) {
+					t.Errorf("Equal(%v, %v): got false after decoding; want true", h, a)
+				}
+			}
+			lazy, err := NewLazyTable(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("NewLazyTable: %v", err)
+			}
+			if n, ok, err := lazy.Lookup(keys[7]); err != nil || !ok || n != 7 {
+				t.Errorf("LazyTable.Lookup(%s): got %d, %t, %v; want 7, true, nil", keys[7], n, ok, err)
+			}
+		}
+	}
+}
+
+func TestWithSeed_errors(t *testing.T) {
+	table, err := BuildWithOptions([]string{"a", "b", "c"}, WithSeed(1))
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := table.Gen(&buf, "p", "v"); err == nil {
+		t.Errorf("Gen: got no error")
+	}
+	if err := table.GenC(&buf, "p"); err == nil {
+		t.Errorf("GenC: got no error")
+	}
+	// A seed of zero is written without the flag.
+	data := mustMarshal(t, table)
+	for i := headerSize; i < headerSize+seedSize; i++ {
+		data[i] = 0
+	}
+	if _, err := LoadBytes(data); err != ErrCorrupt {
+		t.Errorf("LoadBytes(zero seed): got err=%v; want %v", err, ErrCorrupt)
+	}
+	if _, err := Unmarshal(data, WithDecodeParallelism(2)); err != ErrCorrupt {
+		t.Errorf("Unmarshal(zero seed): got err=%v; want %v", err, ErrCorrupt)
+	}
+}
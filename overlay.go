@@ -0,0 +1,92 @@
+package mph
+
+// An Overlay presents a Table with keys added and deleted since it was
+// built, for tables that are rebuilt periodically and patched in between:
+// the added keys are kept in an ordinary map and the deleted ones in a
+// bitset over the indices of the table. The keys of the table keep their
+// indices, and added keys are numbered from the length of the table on, in
+// the order they are added; the indices of deleted keys are not reused.
+// Unlike a DynamicTable, an Overlay never rebuilds its table, and it is not
+// safe for concurrent use if it is changed: Lookup may only be called
+// concurrently with other calls to Lookup.
+type Overlay struct {
+	table    *Table
+	deleted  bitset
+	ndeleted int
+	added    map[string]uint32
+	next     uint32 // the index of the next added key
+}
+
+// NewOverlay returns an Overlay of t with no keys added or deleted yet.
+func NewOverlay(t *Table) *Overlay {
+	return &Overlay{
+		table:   t,
+		deleted: newBitset(t.Len()),
+		added:   make(map[string]uint32),
+		next:    uint32(t.Len()),
+	}
+}
+
+// Table returns the table that o presents.
+func (o *Overlay) Table() *Table {
+	return o.table
+}
+
+// Len returns the number of keys in o.
+func (o *Overlay) Len() int {
+	return o.table.Len() - o.ndeleted + len(o.added)
+}
+
+// normalized returns s normalized as the keys of the table of o.
+func (o *Overlay) normalized(s string) string {
+	if n := o.table.normalize; n != nil {
+		return string(n([]byte(s)))
+	}
+	return s
+}
+
+// Lookup searches for s in o and returns its index and whether it was
+// found. As for Table.Lookup, every key that is not added or deleted is
+// found in a hash-only table.
+func (o *Overlay) Lookup(s string) (n uint32, ok bool) {
+	if len(o.added) > 0 {
+		if n, ok := o.added[o.normalized(s)]; ok {
+			return n, true
+		}
+	}
+	n, ok = o.table.Lookup(s)
+	if !ok || o.deleted.has(int(n)) {
+		return 0, false
+	}
+	return n, true
+}
+
+// Add adds s to o if it is not already in o, and returns its index and
+// whether it was added.
+func (o *Overlay) Add(s string) (n uint32, added bool) {
+	if n, ok := o.Lookup(s); ok {
+		return n, false
+	}
+	n = o.next
+	o.next++
+	o.added[o.normalized(s)] = n
+	return n, true
+}
+
+// Delete removes s from o and reports whether it was in o. For a hash-only
+// table, which cannot tell its keys from others, deleting a key that is
+// not in the table deletes the key whose index it shares.
+func (o *Overlay) Delete(s string) bool {
+	key := o.normalized(s)
+	if _, ok := o.added[key]; ok {
+		delete(o.added, key)
+		return true
+	}
+	n, ok := o.table.Lookup(s)
+	if !ok || o.deleted.has(int(n)) {
+		return false
+	}
+	o.deleted.set(int(n))
+	o.ndeleted++
+	return true
+}
@@ -0,0 +1,67 @@
+package mph
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestOverlay(t *testing.T) {
+	keys := []string{"foo", "bar", "baz"}
+	o := NewOverlay(Build(keys))
+	if n, ok := o.Add("bar"); ok || n != 1 {
+		t.Errorf("Add(bar): got %d, %t; want 1, false", n, ok)
+	}
+	if n, ok := o.Add("quux"); !ok || n != 3 {
+		t.Errorf("Add(quux): got %d, %t; want 3, true", n, ok)
+	}
+	if !o.Delete("foo") || o.Delete("foo") || o.Delete("nope") {
+		t.Errorf("Delete(foo, foo, nope): got wrong results")
+	}
+	if n, ok := o.Add("foo"); !ok || n != 4 {
+		t.Errorf("Add(foo): got %d, %t; want 4, true", n, ok)
+	}
+	if !o.Delete("quux") {
+		t.Errorf("Delete(quux): got false; want true")
+	}
+	for _, tt := range []struct {
+		key string
+		n   uint32
+		ok  bool
+	}{
+		{"foo", 4, true},
+		{"bar", 1, true},
+		{"baz", 2, true},
+		{"quux", 0, false},
+		{"nope", 0, false},
+	} {
+		if n, ok := o.Lookup(tt.key); n != tt.n || ok != tt.ok {
+			t.Errorf("Lookup(%s): got %d, %t; want %d, %t", tt.key, n, ok, tt.n, tt.ok)
+		}
+	}
+	if o.Len() != 3 {
+		t.Errorf("Len: got %d; want 3", o.Len())
+	}
+	if o.Table().Len() != 3 {
+		t.Errorf("Table: got %d keys; want 3", o.Table().Len())
+	}
+}
+
+func TestOverlay_normalizer(t *testing.T) {
+	table, err := BuildWithOptions([]string{"Foo"}, WithNormalizer(bytes.ToLower))
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	o := NewOverlay(table)
+	if _, ok := o.Add("BAR"); !ok {
+		t.Errorf("Add(BAR): got false; want true")
+	}
+	if n, ok := o.Lookup("bar"); !ok || n != 1 {
+		t.Errorf("Lookup(bar): got %d, %t; want 1, true", n, ok)
+	}
+	if !o.Delete("FOO") {
+		t.Errorf("Delete(FOO): got false; want true")
+	}
+	if _, ok := o.Lookup("foo"); ok {
+		t.Errorf("Lookup(foo): got true; want false")
+	}
+}
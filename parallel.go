@@ -0,0 +1,148 @@
+package mph
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// WithParallelism makes BuildWithOptions use up to n goroutines to hash
+// keys and search for seeds. If n is 0 or less, it uses GOMAXPROCS
+// goroutines. The table built is the same as without the option; only the
+// time to build it changes, so it is only worth setting for large tables.
+func WithParallelism(n int) Option {
+	return func(c *buildConfig) {
+		if n <= 0 {
+			n = runtime.GOMAXPROCS(0)
+		}
+		c.parallelism = n
+	}
+}
+
+// workers returns the number of goroutines to build with.
+func (c *buildConfig) workers() int {
+	if c.parallelism < 1 {
+		return 1
+	}
+	return c.parallelism
+}
+
+// parallelBatch is how many buckets each goroutine searches seeds for in a
+// round of placeParallel.
+const parallelBatch = 256
+
+// placeParallel does the work of place with workers goroutines, and finds
+// the same seeds. In each round, the goroutines search seeds for a batch of
+// buckets against the slots occupied before the round. The seeds are then
+// committed in order, and since slots only ever fill up, a seed that no
+// longer fits is replaced by searching onward from it, exactly as place
+// would have.
+func placeParallel(ctx context.Context, buckets []indexBucket, level0, level1 []uint32, slots1 slotMap, hash func(i int, seed uint32) uint32, workers int, limit uint64, cfg *buildConfig) error {
+	sc := cfg.scratchSpace()
+	sc.occ = reuse(sc.occ, (len(level1)+63)/64)
+	occ := sc.occ
+	seeds := make([]uint64, workers*parallelBatch)
+	scratch := make([][]int, workers)
+	for start := 0; start < len(buckets); start += len(seeds) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		batch := buckets[start:]
+		if len(batch) > len(seeds) {
+			batch = batch[:len(seeds)]
+		}
+		var wg sync.WaitGroup
+		for w := 0; w*parallelBatch < len(batch); w++ {
+			lo, hi := w*parallelBatch, (w+1)*parallelBatch
+			if hi > len(batch) {
+				hi = len(batch)
+			}
+			wg.Add(1)
+			go func(w, lo, hi int) {
+				defer wg.Done()
+				for j := lo; j < hi; j++ {
+					seeds[j], scratch[w] = findSeed(occ, slots1, batch[j].vals, hash, 0, limit, scratch[w])
+				}
+			}(w, lo, hi)
+		}
+		wg.Wait()
+		for j, bucket := range batch {
+			// A failed search leaves limit in seeds[j], from which the
+			// search fails at once.
+			var seed uint64
+			seed, scratch[0] = findSeed(occ, slots1, bucket.vals, hash, seeds[j], limit, scratch[0])
+			if seed == limit {
+				return ErrBuildFailed
+			}
+			for _, i := range bucket.vals {
+				n := slots1.slot(hash(int(i), uint32(seed)))
+				occ.set(n)
+				level1[n] = i
+			}
+			level0[bucket.n] = uint32(seed)
+			if cfg.progress != nil {
+				cfg.progress(start+j+1, len(buckets))
+			}
+		}
+	}
+	return nil
+}
+
+// findSeed returns the first seed from seed on that sends the keys vals to
+// distinct slots that are free in occ, which it does not modify, or limit
+// if no seed below limit does. slots is scratch space, returned for reuse.
+func findSeed(occ bitset, slots1 slotMap, vals []uint32, hash func(i int, seed uint32) uint32, seed, limit uint64, slots []int) (uint64, []int) {
+	for ; seed < limit; seed++ {
+		slots = slots[:0]
+		fits := true
+		for _, i := range vals {
+			n := slots1.slot(hash(int(i), uint32(seed)))
+			if occ.has(n) || containsInt(slots, n) {
+				fits = false
+				break
+			}
+			slots = append(slots, n)
+		}
+		if fits {
+			return seed, slots
+		}
+	}
+	return limit, slots
+}
+
+func containsInt(s []int, v int) bool {
+	for _, x := range s {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// hashParallel stores the level0 slot of every key under hash and seed in
+// slots, and its key hash in hashes if that is not nil, computed with
+// workers goroutines.
+func hashParallel(ctx context.Context, keys keyPool, hash Hash, seed uint64, slots0 slotMap, workers int, slots []uint32, hashes []uint64) error {
+	nkeys := keys.len()
+	chunk := (nkeys + workers - 1) / workers
+	var wg sync.WaitGroup
+	for lo := 0; lo < nkeys; lo += chunk {
+		hi := lo + chunk
+		if hi > nkeys {
+			hi = nkeys
+		}
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer wg.Done()
+			for i := lo; i < hi; i++ {
+				kh := keyHash(hash, seed, keys.key(i))
+				slots[i] = uint32(slots0.slot(uint32(kh)))
+				if hashes != nil {
+					hashes[i] = kh
+				}
+			}
+		}(lo, hi)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
@@ -0,0 +1,51 @@
+package mph
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestWithParallelism(t *testing.T) {
+	var keys []string
+	for i := 0; i < 100000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	want := Build(keys)
+	for _, n := range []int{0, 2, 7} {
+		var done, total int
+		got, err := BuildWithOptions(keys, WithParallelism(n), WithProgress(func(d, t int) {
+			done, total = d, t
+		}))
+		if err != nil {
+			t.Fatalf("WithParallelism(%d): %v", n, err)
+		}
+		if !Equal(got, want) {
+			t.Errorf("WithParallelism(%d): table differs from a sequential build", n)
+		}
+		if done == 0 || done != total {
+			t.Errorf("WithParallelism(%d): progress ended at %d of %d", n, done, total)
+		}
+	}
+}
+
+func BenchmarkBuildParallel(b *testing.B) {
+	var keys []string
+	for i := 0; i < 1000000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	for _, bm := range []struct {
+		name string
+		n    int
+	}{
+		{"sequential", 1},
+		{"parallel", 0},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := BuildWithOptions(keys, WithParallelism(bm.n)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package mph
+
+import "errors"
+
+// A blockedBloom is a Bloom filter whose probes for a key all fall in one
+// 64-bit word, so that a query costs a single load.
+type blockedBloom struct {
+	words []uint64
+	k     uint8 // bits set per key
+}
+
+// Bounds on the bits per key of a prefilter. Beyond 5 bits set per key of
+// a single word, more bits per key hardly lower the false-positive rate.
+const (
+	minPrefilterBits = 4
+	maxPrefilterBits = 32
+)
+
+// bloomSeed decorrelates the probes of a prefilter from the level0 bucket,
+// which is taken from the same key hash.
+const bloomSeed = 0xa0761d6478bd642f
+
+// probe returns the word and the bit mask of the key whose key hash is kh.
+func (f *blockedBloom) probe(kh uint64) (int, uint64) {
+	h := wymix(kh^bloomSeed, wyp1)
+	w := int((h >> 32) * uint64(len(f.words)) >> 32)
+	var mask uint64
+	for i := uint8(0); i < f.k; i++ {
+		mask |= 1 << (h & 63)
+		h >>= 6
+	}
+	return w, mask
+}
+
+// mayContain reports whether the key whose key hash is kh may have been
+// added to f. It is always true if f is empty.
+func (f *blockedBloom) mayContain(kh uint64) bool {
+	if f.words == nil {
+		return true
+	}
+	w, mask := f.probe(kh)
+	return f.words[w]&mask == mask
+}
+
+func (f *blockedBloom) size() int {
+	return 8 * len(f.words)
+}
+
+func (f *blockedBloom) clone() blockedBloom {
+	c := blockedBloom{k: f.k}
+	if f.words != nil {
+		c.words = append([]uint64(nil), f.words...)
+	}
+	return c
+}
+
+// WithPrefilter returns a table that shares the level arrays and keys of t
+// and checks each queried key against a Bloom filter of bitsPerKey bits
+// per key, between 4 and 32, before looking it up. The filter rejects
+// most keys that are not in t with a single load, instead of the three
+// dependent loads of a full lookup; at 8 bits per key it lets through
+// about 3% of misses, and at 16 bits about 0.5%. Keys that are in t pay
+// for the extra load, so a prefilter only pays off if most queries miss.
+//
+// The prefilter is not serialized: a table loaded from the output of
+// MarshalBinary or WriteTo has none until WithPrefilter is called on it.
+// WithPrefilter returns ErrNoKeys if t is hash-only.
+func (t *Table) WithPrefilter(bitsPerKey int) (*Table, error) {
+	if t.hashOnly {
+		return nil, ErrNoKeys
+	}
+	if bitsPerKey < minPrefilterBits || bitsPerKey > maxPrefilterBits {
+		return nil, errors.New("mph: prefilter must have between 4 and 32 bits per key")
+	}
+	n := t.keys.len()
+	k := (bitsPerKey*69 + 50) / 100 // ln 2 bits per key is optimal
+	if k > 5 {
+		k = 5
+	}
+	f := blockedBloom{words: make([]uint64, (n*bitsPerKey+63)/64+1), k: uint8(k)}
+	for i := 0; i < n; i++ {
+		w, mask := f.probe(keyHash(t.hash, t.seed, t.keys.key(i)))
+		f.words[w] |= mask
+	}
+	c := t.CloneShared()
+	c.prefilter = f
+	return c, nil
+}
@@ -0,0 +1,104 @@
+package mph
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestWithPrefilter(t *testing.T) {
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%d", i)
+	}
+	for _, h := range []Hash{Murmur3, Wyhash} {
+		table, err := BuildWithOptions(keys, WithHash(h))
+		if err != nil {
+			t.Fatalf("BuildWithOptions(%s): %v", h, err)
+		}
+		for _, bits := range []int{4, 8, 16, 32} {
+			pf, err := table.WithPrefilter(bits)
+			if err != nil {
+				t.Fatalf("WithPrefilter(%d): %v", bits, err)
+			}
+			for i, k := range keys {
+				if n, ok := pf.Lookup(k); !ok || n != uint32(i) {
+					t.Errorf("%s/%d: Lookup(%s): got %d, %t; want %d, true", h, bits, k, n, ok, i)
+				}
+			}
+			const misses = 100000
+			passed := 0
+			for i := 0; i < misses; i++ {
+				kh := keyHash(h, 0, fmt.Sprintf("miss%d", i))
+				if pf.prefilter.mayContain(kh) {
+					passed++
+				}
+				if _, ok := pf.Lookup(fmt.Sprintf("miss%d", i)); ok {
+					t.Errorf("Lookup(miss%d): got ok", i)
+				}
+			}
+			if bits >= 8 && passed > misses/20 {
+				t.Errorf("%s/%d: %d of %d misses pass the prefilter", h, bits, passed, misses)
+			}
+		}
+	}
+}
+
+func BenchmarkLookup_prefilter(b *testing.B) {
+	keys := make([]string, 1<<20)
+	misses := make([]string, len(keys))
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%d", i)
+		misses[i] = fmt.Sprintf("miss%d", i)
+	}
+	table := Build(keys)
+	pf, err := table.WithPrefilter(8)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, bc := range []struct {
+		name  string
+		table *Table
+	}{{"none", table}, {"bloom8", pf}} {
+		b.Run(bc.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				bc.table.Lookup(misses[i%len(misses)])
+			}
+		})
+	}
+}
+
+func TestWithPrefilterLookupAll(t *testing.T) {
+	keys := []string{"foo", "foo2", "bar", "baz"}
+	pf, err := Build(keys).WithPrefilter(8)
+	if err != nil {
+		t.Fatalf("WithPrefilter: %v", err)
+	}
+	queries := append([]string{"quux"}, keys...)
+	out := make([]uint32, len(queries))
+	if got := LookupAll(pf, queries, out); got != len(keys) {
+		t.Errorf("LookupAll: got %d found; want %d", got, len(keys))
+	}
+	if out[0] != NotFound {
+		t.Errorf("LookupAll: out[0] = %d; want NotFound", out[0])
+	}
+	for i := range keys {
+		if out[i+1] != uint32(i) {
+			t.Errorf("LookupAll: out[%d] = %d; want %d", i+1, out[i+1], i)
+		}
+	}
+	if !Equal(pf.Clone(), Build(keys)) {
+		t.Errorf("Clone: not Equal to the table without a prefilter")
+	}
+}
+
+func TestWithPrefilterErrors(t *testing.T) {
+	table := Build([]string{"foo", "bar"})
+	for _, bits := range []int{0, 3, 33} {
+		if _, err := table.WithPrefilter(bits); err == nil {
+			t.Errorf("WithPrefilter(%d): got nil error", bits)
+		}
+	}
+	if _, err := table.WithoutKeys().WithPrefilter(8); err != ErrNoKeys {
+		t.Errorf("WithPrefilter(hash-only): got %v; want %v", err, ErrNoKeys)
+	}
+}
@@ -0,0 +1,284 @@
+package mph
+
+import (
+	"context"
+	"math"
+	"math/bits"
+)
+
+// A pilots is the hash function of a table built with PTHash. Keys are
+// distributed into buckets by their hash, skewed so that a few buckets get
+// most of the keys, and each bucket has a pilot: a seed that sends its keys
+// to free positions out of size, which is slightly more than the number of
+// keys so that the last buckets placed still find room. A key numbered by
+// a position past the last key is renumbered by remap into one of the
+// positions that no key took. A lookup thus hashes the key once, reads one
+// pilot and mixes it into the hash.
+//
+// The pilots are coded compactly, in width bits each, which is as few as
+// the largest pilot takes, packed into codes. Both slices alias the
+// serialized form of the pilots in level0.wide:
+//
+//	nbuckets                uint32
+//	size                    uint32, the number of positions
+//	width                   uint32, between 1 and 32
+//	codes                   uint32, nbuckets*width bits padded to a word, and one zero word
+//	remap[0] ... remap[R-1] uint32, where R is size less the number of keys
+//
+// Bit i of codes is bit i%32 of word i/32. The number of keys, mask, dense,
+// m0 and m1 are derived from the rest.
+type pilots struct {
+	nkeys, size uint32
+	width       uint
+	mask        uint32 // 1<<width - 1
+	codes       []uint32
+	remap       []uint32
+
+	dense  uint32 // the number of buckets that the dense keys go to
+	m0, m1 uint64 // the multipliers that map bucket hashes onto buckets
+	nb     uint32
+}
+
+const (
+	// pilotDensity is the c of the paper: a table of n keys has about
+	// c*n/log2(n) buckets. Fewer buckets make the table smaller but slower
+	// to build.
+	pilotDensity = 6
+	// pilotSlack is such that a table of n keys has n/pilotSlack more
+	// positions than keys, a load of 99%.
+	pilotSlack = 100
+	// denseHashes is the number, out of 2^32, of the bucket hashes that go
+	// to the dense buckets, which are 3/10 of the buckets: 60% of the keys
+	// go to 30% of the buckets, as in the paper.
+	denseHashes = 3 << 32 / 5
+)
+
+// newPilots returns the pilots of nkeys keys in nb buckets and size
+// positions, with no codes yet.
+func newPilots(nkeys, nb, size uint32) pilots {
+	p := pilots{nkeys: nkeys, size: size, nb: nb}
+	if p.dense = nb * 3 / 10; p.dense == 0 {
+		p.dense = 1
+	}
+	// The largest products stay just below dense and nb-dense.
+	p.m0 = uint64(p.dense) << 32 / denseHashes
+	p.m1 = uint64(nb-p.dense) << 32 / (1<<32 - denseHashes)
+	return p
+}
+
+// pilotSizes returns the number of buckets and positions of a table of
+// nkeys keys.
+func pilotSizes(nkeys int) (nb, size uint32) {
+	n := float64(nkeys)
+	b := math.Ceil(pilotDensity * n / math.Log2(math.Max(n, 2)))
+	if nb = uint32(b); nb < 2 {
+		nb = 2
+	}
+	size = uint32(nkeys + (nkeys+pilotSlack-1)/pilotSlack)
+	if size == 0 {
+		size = 1
+	}
+	return nb, size
+}
+
+// splitPilots returns the pilots whose serialized form is words, which
+// must be valid.
+func splitPilots(words []uint32) pilots {
+	n := (int(words[0])*int(words[2])+31)/32 + 1
+	remap := words[3+n:]
+	p := newPilots(words[1]-uint32(len(remap)), words[0], words[1])
+	p.width = uint(words[2])
+	p.mask = uint32(1<<p.width - 1)
+	p.codes = words[3 : 3+n : 3+n]
+	p.remap = remap
+	return p
+}
+
+// checkPilots returns ErrCorrupt unless words is the serialized form of the
+// pilots of nkeys keys.
+func checkPilots(words []uint32, nkeys int) error {
+	if len(words) < 3 {
+		return ErrCorrupt
+	}
+	nb, size, width := uint64(words[0]), uint64(words[1]), uint64(words[2])
+	if nb < 2 || size == 0 || size < uint64(nkeys) || width == 0 || width > 32 {
+		return ErrCorrupt
+	}
+	if uint64(len(words)) != 3+(nb*width+31)/32+1+size-uint64(nkeys) {
+		return ErrCorrupt
+	}
+	// A table of no keys still numbers lookups 0.
+	for _, r := range splitPilots(words).remap {
+		if r != 0 && r >= uint32(nkeys) {
+			return ErrCorrupt
+		}
+	}
+	return nil
+}
+
+// bucket returns the bucket of the key whose 64-bit hash is fp. It takes
+// the low 32 bits, since fingerprints take the high ones of Wyhash.
+func (p *pilots) bucket(fp uint64) uint32 {
+	// Which of the two cases a key falls in is unpredictable, so both are
+	// computed and selected without a branch: dense is all ones if u is
+	// less than denseHashes.
+	u := uint32(fp)
+	b0 := uint32(uint64(u) * p.m0 >> 32)
+	b1 := p.dense + uint32(uint64(u-denseHashes)*p.m1>>32)
+	dense := -uint32((uint64(u) - denseHashes) >> 63)
+	return b1 ^ (b0^b1)&dense
+}
+
+// position returns the position of the key whose 64-bit hash is fp under
+// the pilot. As in the paper, the hash of the pilot is XORed into that of
+// the key, which is then multiplied so that every bit of it reaches the
+// high bits that fastrange keeps.
+func (p *pilots) position(fp uint64, pilot uint32) uint32 {
+	hi, _ := bits.Mul64((fp^uint64(pilot)*wyp1)*wyp3, uint64(p.size))
+	return uint32(hi)
+}
+
+// pilot returns the pilot of bucket b.
+func (p *pilots) pilot(b uint32) uint32 {
+	i := uint(b) * p.width
+	w := uint64(p.codes[i>>5]) | uint64(p.codes[i>>5+1])<<32
+	return uint32(w>>(i&31)) & p.mask
+}
+
+// pilotRank returns the number of s in p, where kh is keyHash(h, s).
+func pilotRank[T ~string | ~[]byte](p *pilots, h Hash, kh uint64, s T) uint32 {
+	fp := wideKeyHash(h, kh, s)
+	n := p.position(fp, p.pilot(p.bucket(fp)))
+	if n >= p.nkeys {
+		return p.remap[n-p.nkeys]
+	}
+	return n
+}
+
+// maxPilot returns the largest pilot of p.
+func (p *pilots) maxPilot() uint32 {
+	var max uint32
+	for b := uint32(0); b < p.nb; b++ {
+		if v := p.pilot(b); v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+// buildPilots builds the pilots of the keys of pool, whose key hashes are
+// hashes, as a rankBuild. Buckets are placed largest first, as by place.
+// Keys with equal 64-bit hashes are stuck.
+func buildPilots(ctx context.Context, pool keyPool, hashes []uint64, cfg *buildConfig) (words, level1 []uint32, stuck []int, err error) {
+	nkeys := pool.len()
+	if uint64(nkeys)+uint64(nkeys+pilotSlack-1)/pilotSlack > math.MaxUint32 {
+		return nil, nil, nil, errTooManyKeys
+	}
+	nb, size := pilotSizes(nkeys)
+	p := newPilots(uint32(nkeys), nb, size)
+	sc := cfg.scratchSpace()
+	sc.slots = reuse(sc.slots, nkeys)
+	for i := range hashes {
+		hashes[i] = wideKeyHash(cfg.hash, hashes[i], pool.key(i))
+		sc.slots[i] = p.bucket(hashes[i])
+	}
+	sc.index.fill(sc.slots, int(nb))
+	if stuck := equalHashes(&sc.index, hashes); stuck != nil {
+		return nil, nil, stuck, nil
+	}
+	sc.buckets = sc.index.bySize(sc.buckets)
+	buckets := sc.buckets
+
+	pilot := make([]uint32, nb)
+	pos := sc.slots // position of each key
+	sc.occ = reuse(sc.occ, (int(size)+63)/64)
+	occ := sc.occ
+	limit := cfg.seedLimit()
+	for b, bucket := range buckets {
+		if b%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		var seed uint32
+	trySeed:
+		for j, i := range bucket.vals {
+			n := p.position(hashes[i], seed)
+			if occ.has(int(n)) {
+				for _, i := range bucket.vals[:j] {
+					occ.clear(int(pos[i]))
+				}
+				if uint64(seed)+1 >= limit {
+					return nil, nil, nil, ErrBuildFailed
+				}
+				seed++
+				goto trySeed
+			}
+			occ.set(int(n))
+			pos[i] = n
+		}
+		pilot[bucket.n] = seed
+		if cfg.progress != nil {
+			cfg.progress(b+1, len(buckets))
+		}
+	}
+
+	// The positions past the last key that keys took are renumbered, in
+	// order, as the positions before it that no key took.
+	remap := make([]uint32, int(size)-nkeys)
+	free := 0
+	for n := nkeys; n < int(size); n++ {
+		if occ.has(n) {
+			for occ.has(free) {
+				free++
+			}
+			remap[n-nkeys] = uint32(free)
+			free++
+		}
+	}
+	level1 = make([]uint32, nkeys)
+	for i := 0; i < nkeys; i++ {
+		n := pos[i]
+		if int(n) >= nkeys {
+			n = remap[int(n)-nkeys]
+		}
+		level1[n] = uint32(i)
+	}
+	return encodePilots(pilot, size, remap), level1, nil, nil
+}
+
+// encodePilots returns the serialized form of the pilots of the buckets.
+func encodePilots(pilot []uint32, size uint32, remap []uint32) []uint32 {
+	var max uint32
+	for _, v := range pilot {
+		if v > max {
+			max = v
+		}
+	}
+	width := bits.Len32(max)
+	if width == 0 {
+		width = 1
+	}
+	n := (len(pilot)*width+31)/32 + 1
+	words := make([]uint32, 3+n, 3+n+len(remap))
+	words[0], words[1], words[2] = uint32(len(pilot)), size, uint32(width)
+	codes := words[3:]
+	for b, v := range pilot {
+		i := uint(b * width)
+		codes[i>>5] |= v << (i & 31)
+		if i&31+uint(width) > 32 {
+			codes[i>>5+1] |= v >> (32 - i&31)
+		}
+	}
+	return append(words, remap...)
+}
+
+// expectedPilotWords returns the expected size, in words, of the
+// serialized pilots of nkeys keys. The pilots of the last buckets placed,
+// into a table 99% full, are geometric with mean pilotSlack, so the
+// largest of them takes about log2(pilotSlack*ln(nb)) bits.
+func expectedPilotWords(nkeys int) int {
+	nb, size := pilotSizes(nkeys)
+	width := int(math.Ceil(math.Log2(pilotSlack * math.Log(float64(nb)))))
+	return 3 + (int(nb)*width+31)/32 + 1 + int(size) - nkeys
+}
@@ -0,0 +1,178 @@
+package mph
+
+import (
+	"errors"
+	"math/bits"
+	"strconv"
+	"testing"
+)
+
+func TestPTHash(t *testing.T) {
+	for _, nkeys := range []int{0, 1, 2, 100, 10000} {
+		for _, h := range []Hash{Murmur3, Wyhash} {
+			var keys []string
+			for i := 0; i < nkeys; i++ {
+				keys = append(keys, strconv.Itoa(i))
+			}
+			table, err := BuildWithOptions(keys, WithAlgorithm(PTHash), WithHash(h), WithVerify())
+			if err != nil {
+				t.Fatalf("BuildWithOptions(%d keys, %v): %v", nkeys, h, err)
+			}
+			checkTable(t, table, keys, []string{"-1", "quux"})
+			checkContiguous(t, "PTHash", table)
+			for i, k := range keys {
+				if n := LookupUnchecked(table, k); n != uint32(i) {
+					t.Errorf("LookupUnchecked(%s): got %d; want %d", k, n, i)
+				}
+			}
+
+			data := mustMarshal(t, table)
+			var read Table
+			if err := read.UnmarshalBinary(data); err != nil {
+				t.Fatalf("UnmarshalBinary(%d keys, %v): %v", nkeys, h, err)
+			}
+			if !Equal(table, &read) {
+				t.Errorf("UnmarshalBinary(%d keys, %v): table differs", nkeys, h)
+			}
+			checkTable(t, &read, keys, []string{"quux"})
+			loaded, err := LoadBytes(data)
+			if err != nil {
+				t.Fatalf("LoadBytes(%d keys, %v): %v", nkeys, h, err)
+			}
+			checkTable(t, loaded, keys, []string{"quux"})
+			parallel, err := Unmarshal(data, WithDecodeParallelism(4))
+			if err != nil {
+				t.Fatalf("Unmarshal(%d keys, %v): %v", nkeys, h, err)
+			}
+			checkTable(t, parallel, keys, []string{"quux"})
+			checkTable(t, table.Clone(), keys, []string{"quux"})
+		}
+	}
+}
+
+func TestPTHash_size(t *testing.T) {
+	var keys []string
+	for i := 0; i < 100000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	table, err := BuildWithOptions(keys, WithAlgorithm(PTHash))
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	s := table.Stats()
+	// The pilots take about 3.6 bits per key, and the remapped positions
+	// another 0.3.
+	if pilotBits := 32 * float64(s.Level0Len) / float64(len(keys)); pilotBits > 4.2 {
+		t.Errorf("Stats: pilots take %.2f bits per key; want at most 4.2", pilotBits)
+	}
+	if s.MaxSeed == 0 || s.MaxSeed != table.pilots.maxPilot() || bits.Len32(s.MaxSeed) != int(table.pilots.width) {
+		t.Errorf("Stats: got max seed %d for pilots of %d bits", s.MaxSeed, table.pilots.width)
+	}
+	est, err := EstimateSize(len(keys), s.KeyBytes, WithAlgorithm(PTHash))
+	if err != nil {
+		t.Fatalf("EstimateSize: %v", err)
+	}
+	if got := len(mustMarshal(t, table)); got < est.File*97/100 || got > est.File*103/100 {
+		t.Errorf("EstimateSize: got File %d; want within 3%% of %d", est.File, got)
+	}
+
+	// Too few pilot attempts fail the build.
+	if _, err := BuildWithOptions(keys, WithAlgorithm(PTHash), WithMaxSeedAttempts(2)); err != ErrBuildFailed {
+		t.Errorf("BuildWithOptions(WithMaxSeedAttempts(2)): got %v; want %v", err, ErrBuildFailed)
+	}
+}
+
+func TestPTHash_hashOnly(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	table, err := BuildWithOptions(keys, WithAlgorithm(PTHash))
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	for i, k := range keys {
+		if n, ok := table.WithoutKeys().Lookup(k); !ok || n != uint32(i) {
+			t.Errorf("WithoutKeys().Lookup(%s): got %d, %t; want %d", k, n, ok, i)
+		}
+	}
+	fp, err := table.WithFingerprints(16)
+	if err != nil {
+		t.Fatalf("WithFingerprints: %v", err)
+	}
+	var read Table
+	if err := read.UnmarshalBinary(mustMarshal(t, fp)); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	checkTable(t, &read, keys, []string{"quux", "-1"})
+}
+
+func TestPTHash_duplicates(t *testing.T) {
+	keys := []string{"a", "b", "c", "b", "d", "a"}
+	_, err := BuildWithOptions(keys, WithAlgorithm(PTHash))
+	var dup *DuplicateKeyError
+	if !errors.As(err, &dup) || string(dup.Key) != "b" || dup.First != 1 || dup.Second != 3 {
+		t.Errorf("BuildWithOptions(duplicates): got err=%v; want b at 1 and 3", err)
+	}
+	var removed int
+	table, err := BuildWithOptions(keys, WithAlgorithm(PTHash), WithDedup(&removed))
+	if err != nil {
+		t.Fatalf("BuildWithOptions(WithDedup): %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("WithDedup: removed %d keys; want 2", removed)
+	}
+	checkTable(t, table, []string{"a", "b", "c", "d"}, []string{"e"})
+}
+
+func TestPTHash_corrupt(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	table, err := BuildWithOptions(keys, WithAlgorithm(PTHash))
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	words := table.level0.wide
+	if err := checkPilots(words, len(keys)); err != nil {
+		t.Errorf("checkPilots: %v", err)
+	}
+	if err := checkPilots(words, len(keys)+1); err != ErrCorrupt {
+		t.Errorf("checkPilots(wrong count): got %v; want %v", err, ErrCorrupt)
+	}
+	if err := checkPilots(words[:len(words)-1], len(keys)); err != ErrCorrupt {
+		t.Errorf("checkPilots(truncated): got %v; want %v", err, ErrCorrupt)
+	}
+	corrupt := append([]uint32(nil), words...)
+	corrupt[len(corrupt)-1] = uint32(len(keys))
+	if err := checkPilots(corrupt, len(keys)); err != ErrCorrupt {
+		t.Errorf("checkPilots(remap out of range): got %v; want %v", err, ErrCorrupt)
+	}
+	corrupt = append(corrupt[:0], words...)
+	corrupt[2] = 33
+	if err := checkPilots(corrupt, len(keys)); err != ErrCorrupt {
+		t.Errorf("checkPilots(wide codes): got %v; want %v", err, ErrCorrupt)
+	}
+}
+
+func BenchmarkLookup_algorithm(b *testing.B) {
+	for _, h := range []Hash{Murmur3, Wyhash} {
+		for _, a := range []Algorithm{CHD, BBHash, RecSplit, PTHash, BDZ} {
+			b.Run(h.String()+"/"+a.String(), func(b *testing.B) {
+				keys := make([]string, 10000)
+				for i := range keys {
+					keys[i] = "key-" + strconv.Itoa(i)
+				}
+				table, err := BuildWithOptions(keys, WithHash(h), WithAlgorithm(a))
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					table.Lookup(keys[i*7919%len(keys)])
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,645 @@
+package mph
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// A recsplit is the hash function of a table built with RecSplit. Keys are
+// distributed into buckets by their hash, and the keys of each bucket are
+// split recursively into parts of predetermined sizes, each split by a seed
+// found by trial, down to leaves of at most leaf keys, each mapped onto
+// the numbers of its keys by a seed that makes the map a bijection. The
+// number of a key is the number of keys in the buckets before its bucket
+// plus its position in the bucket.
+//
+// The parts of a node of m keys are m/unit parts of unit keys and one of
+// the rest, where unit is leaf as long as m is at most lower, lower as long
+// as m is at most upper, and otherwise a multiple of upper that splits the
+// keys in two halves, as in the paper.
+//
+// The seeds of a bucket are stored in stream from bits[b], in the preorder
+// of the nodes, Golomb-Rice coded with a parameter that depends on the
+// number of keys of the node: first the fixed parts of all the seeds, then
+// their unary parts. A lookup thus finds the fixed part of a node from the
+// sizes of the nodes before it alone, and skips the unary parts before it
+// by counting ones.
+//
+// The serialized form of a recsplit, in level0.wide, is
+//
+//	leaf                        uint32
+//	nbuckets                    uint32
+//	maxm                        uint32, the number of keys of the largest bucket
+//	rice[0] ... rice[R-1]       uint8, padded with zeros to a multiple of 4 bytes
+//	keys[0] ... keys[nbuckets]  uint32, starting at 0 and ending at the number of keys
+//	bits[0] ... bits[nbuckets]  uint32, starting at 0
+//	stream                      uint32, bits[nbuckets] bits padded to a word, and one zero word
+//
+// where R is min(maxm, upper)+1. The parameters of larger nodes, which
+// split in two, are not stored but taken to be bits.Len(m)/2, which is
+// within one of the best one, so that the size of the table does not grow
+// with maxm. Bit i of stream is bit i%32 of word i/32. nodes and fixed are
+// derived from rice.
+type recsplit struct {
+	leaf, lower, upper int
+
+	keys   []uint32 // keys[b] is the number of keys in the buckets before b
+	bits   []uint32 // bits[b] is the position in stream of the seeds of bucket b
+	stream []uint32 // the seeds
+
+	rice  []uint8  // rice[m] is the Golomb-Rice parameter of seeds of nodes of m keys
+	nodes []uint32 // nodes[m] is the number of seeds of a node of m keys and its descendants
+	fixed []uint32 // fixed[m] is the number of bits of their fixed parts
+}
+
+const (
+	// defaultLeafSize and defaultSplitBucket are the sizes that RecSplit
+	// uses unless WithRecSplitSizes is given. A bucket of 2000 keys makes
+	// the bucket offsets cost less than 0.04 bits per key.
+	defaultLeafSize    = 8
+	defaultSplitBucket = 2000
+	// maxLeafSize bounds the leaf size, whose seeds take time exponential
+	// in it to find.
+	maxLeafSize = 16
+	// maxSplitBucket bounds the average number of keys per bucket.
+	maxSplitBucket = 1 << 15
+)
+
+// WithRecSplitSizes sets the leaf size and the average number of keys per
+// bucket of RecSplit (see WithAlgorithm), which are 8 and 2000 by default.
+// Larger leaves make the table smaller, down to about 1.6 bits per key for
+// leaves of 12 keys, but take exponentially longer to build: each leaf
+// needs about e^leafSize seeds tried. Larger buckets amortize the offsets
+// of the buckets over more keys, at the cost of slower lookups, which
+// split the keys of a bucket about log2(bucketSize/(8*leafSize)) more
+// times. leafSize must be between 2 and 16, and bucketSize between 1 and
+// 32768.
+func WithRecSplitSizes(leafSize, bucketSize int) Option {
+	return func(c *buildConfig) {
+		c.leafSize = leafSize
+		c.splitBucket = bucketSize
+	}
+}
+
+// recsplitSizes returns the leaf size and the average bucket size of
+// RecSplit for c.
+func (c *buildConfig) recsplitSizes() (leaf, bucket int) {
+	leaf, bucket = c.leafSize, c.splitBucket
+	if leaf == 0 {
+		leaf = defaultLeafSize
+	}
+	if bucket == 0 {
+		bucket = defaultSplitBucket
+	}
+	return leaf, bucket
+}
+
+// checkRecSplitSizes reports invalid RecSplit sizes.
+func (c *buildConfig) checkRecSplitSizes() error {
+	leaf, bucket := c.recsplitSizes()
+	if leaf < 2 || leaf > maxLeafSize {
+		return fmt.Errorf("mph: RecSplit leaf size %d is not in [2, %d]", leaf, maxLeafSize)
+	}
+	if bucket < 1 || bucket > maxSplitBucket {
+		return fmt.Errorf("mph: RecSplit bucket size %d is not in [1, %d]", bucket, maxSplitBucket)
+	}
+	return nil
+}
+
+// recsplitFanouts returns the lower and upper sizes of a recsplit with the
+// given leaf size, from the aggregation fanouts of the paper.
+func recsplitFanouts(leaf int) (lower, upper int) {
+	lo := (35*leaf + 149) / 100
+	if lo < 2 {
+		lo = 2
+	}
+	hi := (21*leaf + 189) / 100
+	if hi < 2 {
+		hi = 2
+	}
+	return leaf * lo, leaf * lo * hi
+}
+
+// storedRice returns the number of Golomb-Rice parameters that the
+// serialized form of a recsplit with the given leaf size and largest
+// bucket stores.
+func storedRice(leaf, maxm int) int {
+	if _, upper := recsplitFanouts(leaf); maxm > upper {
+		return upper + 1
+	}
+	return maxm + 1
+}
+
+// newRecSplit returns a recsplit for buckets of up to maxm keys with the
+// given leaf size and stored Golomb-Rice parameters, and the rest of rice,
+// nodes and fixed derived from them.
+func newRecSplit(leaf int, rice []uint8, maxm int) recsplit {
+	lower, upper := recsplitFanouts(leaf)
+	r := recsplit{leaf: leaf, lower: lower, upper: upper}
+	r.rice = make([]uint8, maxm+1)
+	copy(r.rice, rice)
+	for m := len(rice); m <= maxm; m++ {
+		r.rice[m] = uint8(bits.Len(uint(m)) / 2)
+	}
+	r.nodes = make([]uint32, maxm+1)
+	r.fixed = make([]uint32, maxm+1)
+	for m := 2; m <= maxm; m++ {
+		r.nodes[m], r.fixed[m] = 1, uint32(r.rice[m])
+		if m <= leaf {
+			continue
+		}
+		unit, parts := r.split(m)
+		last := m - unit*(parts-1)
+		r.nodes[m] += uint32(parts-1)*r.nodes[unit] + r.nodes[last]
+		r.fixed[m] += uint32(parts-1)*r.fixed[unit] + r.fixed[last]
+	}
+	return r
+}
+
+// split returns the size of all but the last part of a node of m keys,
+// which must be more than leaf, and the number of parts.
+func (r *recsplit) split(m int) (unit, parts int) {
+	switch {
+	case m <= r.lower:
+		unit = r.leaf
+	case m <= r.upper:
+		unit = r.lower
+	default:
+		unit = (m + 2*r.upper - 1) / (2 * r.upper) * r.upper
+	}
+	return unit, (m + unit - 1) / unit
+}
+
+// splitRecSplit returns the recsplit whose serialized form is words, which
+// must be valid.
+func splitRecSplit(words []uint32) recsplit {
+	leaf, nb, maxm := int(words[0]), int(words[1]), int(words[2])
+	rice := make([]uint8, storedRice(leaf, maxm))
+	for m := range rice {
+		rice[m] = uint8(words[3+m/4] >> (8 * (m % 4)))
+	}
+	r := newRecSplit(leaf, rice, maxm)
+	off := 3 + (len(rice)+3)/4
+	r.keys = words[off : off+nb+1 : off+nb+1]
+	off += nb + 1
+	r.bits = words[off : off+nb+1 : off+nb+1]
+	r.stream = words[off+nb+1:]
+	return r
+}
+
+// checkRecSplit returns ErrCorrupt unless words is the serialized form of
+// a recsplit of nkeys keys.
+func checkRecSplit(words []uint32, nkeys int) error {
+	if len(words) < 3 || words[0] < 2 || words[0] > maxLeafSize || uint64(words[2]) > uint64(nkeys) {
+		return ErrCorrupt
+	}
+	nb, maxm := uint64(words[1]), uint64(words[2])
+	nrice := uint64(storedRice(int(words[0]), int(maxm)))
+	off := 3 + (nrice+3)/4
+	if nb == 0 || uint64(len(words)) < off+2*(nb+1)+1 {
+		return ErrCorrupt
+	}
+	for m := uint64(2); m < nrice; m++ {
+		if uint8(words[3+m/4]>>(8*(m%4))) > 31 {
+			return ErrCorrupt
+		}
+	}
+	keyz, bitz := words[off:off+nb+1], words[off+nb+1:off+2*(nb+1)]
+	if uint64(len(words)) != off+2*(nb+1)+(uint64(bitz[nb])+31)/32+1 {
+		return ErrCorrupt
+	}
+	if keyz[0] != 0 || bitz[0] != 0 || keyz[nb] != uint32(nkeys) {
+		return ErrCorrupt
+	}
+	for b := uint64(0); b < nb; b++ {
+		if keyz[b+1] < keyz[b] || uint64(keyz[b+1]-keyz[b]) > maxm || bitz[b+1] < bitz[b] {
+			return ErrCorrupt
+		}
+	}
+	// Every bucket must hold the fixed parts of its seeds, and then exactly
+	// as many unary parts as it has seeds, so that no lookup reads past
+	// its bucket.
+	r := splitRecSplit(words)
+	for b := 0; b < int(nb); b++ {
+		m := r.keys[b+1] - r.keys[b]
+		start, end := uint64(r.bits[b]), uint64(r.bits[b+1])
+		unary := start + uint64(r.fixed[m])
+		if unary > end || r.ones(unary, end) != uint64(r.nodes[m]) || (end > unary && !r.bit(end-1)) {
+			return ErrCorrupt
+		}
+	}
+	return nil
+}
+
+// ones returns the number of ones in bits [from, to) of the stream.
+func (r *recsplit) ones(from, to uint64) uint64 {
+	var n uint64
+	for p := from; p < to; {
+		w := r.stream[p>>5] >> (p & 31)
+		k := 32 - p&31
+		if to-p < k {
+			k = to - p
+			w &= 1<<k - 1
+		}
+		n += uint64(bits.OnesCount32(w))
+		p += k
+	}
+	return n
+}
+
+func (r *recsplit) bit(p uint64) bool {
+	return r.stream[p>>5]&(1<<(p&31)) != 0
+}
+
+// recsplitHash returns the hash of the key whose hash is fp under seed for
+// a node at depth.
+func recsplitHash(fp uint64, seed uint32, depth int) uint32 {
+	return uint32(wymix(fp^wyp1, (uint64(depth)<<32|uint64(seed))*wyp3^wyp2))
+}
+
+// recsplitBucket returns the bucket, out of nb, of the key whose hash is fp.
+func recsplitBucket(fp uint64, nb int) int {
+	hi, _ := bits.Mul64(fp, uint64(nb))
+	return int(hi)
+}
+
+// fastrange32 maps v onto [0, n).
+func fastrange32(v uint32, n int) int {
+	return int(uint64(v) * uint64(n) >> 32)
+}
+
+// recsplitRank returns the number of s in r, where kh is keyHash(h, s).
+func recsplitRank[T ~string | ~[]byte](r *recsplit, h Hash, kh uint64, s T) uint32 {
+	fp := wideKeyHash(h, kh, s)
+	b := recsplitBucket(fp, len(r.keys)-1)
+	rank := r.keys[b]
+	m := int(r.keys[b+1] - rank)
+	fixed := uint(r.bits[b])
+	unary := fixed + uint(r.fixed[m])
+	for depth := 0; m > 1; depth++ {
+		k := uint(r.rice[m])
+		w := uint64(r.stream[fixed>>5]) | uint64(r.stream[fixed>>5+1])<<32
+		seed := uint32(w>>(fixed&31)) & (1<<k - 1)
+		fixed += k
+		var q uint32
+		q, unary = r.unary(unary)
+		p := fastrange32(recsplitHash(fp, q<<k|seed, depth), m)
+		if m <= r.leaf {
+			return rank + uint32(p)
+		}
+		unit, parts := r.split(m)
+		part := p / unit
+		fixed += uint(part) * uint(r.fixed[unit])
+		unary = r.skip(unary, part*int(r.nodes[unit]))
+		rank += uint32(part * unit)
+		if part == parts-1 {
+			m -= unit * part
+		} else {
+			m = unit
+		}
+	}
+	return rank
+}
+
+// unary returns the number of zeros from bit p of the stream up to the
+// next one, and the position after that one.
+func (r *recsplit) unary(p uint) (uint32, uint) {
+	w := p >> 5
+	if v := r.stream[w] >> (p & 31); v != 0 {
+		z := uint(bits.TrailingZeros32(v))
+		return uint32(z), p + z + 1
+	}
+	q := 32 - p&31
+	for w++; r.stream[w] == 0; w++ {
+		q += 32
+	}
+	z := uint(bits.TrailingZeros32(r.stream[w]))
+	return uint32(q + z), w<<5 + z + 1
+}
+
+// skip returns the position after the n-th one from bit p of the stream.
+func (r *recsplit) skip(p uint, n int) uint {
+	if n == 0 {
+		return p
+	}
+	w := p >> 5
+	v := r.stream[w] &^ (1<<(p&31) - 1)
+	for {
+		if c := bits.OnesCount32(v); c < n {
+			n -= c
+			w++
+			v = r.stream[w]
+			continue
+		}
+		for ; n > 1; n-- {
+			v &= v - 1
+		}
+		return w<<5 + uint(bits.TrailingZeros32(v)) + 1
+	}
+}
+
+// riceParam returns the Golomb-Rice parameter that codes the seed of a node
+// most compactly, if each seed tried succeeds with probability p: the
+// number of seeds tried is then geometrically distributed. This is the
+// formula of Kiely, "Selecting the Golomb parameter in Rice coding", 2004.
+func riceParam(p float64) uint8 {
+	if p >= 1 {
+		return 0
+	}
+	k := 1 + math.Floor(math.Log2(math.Log((math.Sqrt(5)-1)/2)/math.Log1p(-p)))
+	if k < 0 {
+		return 0
+	}
+	if k > 31 {
+		return 31
+	}
+	return uint8(k)
+}
+
+// recsplitProb returns the probability that a seed succeeds for a node of
+// m keys of r: that it maps the keys of a leaf bijectively onto [0, m), or
+// sends each part of a split the right number of keys.
+func (r *recsplit) prob(m int) float64 {
+	lm, _ := math.Lgamma(float64(m + 1))
+	if m <= r.leaf {
+		return math.Exp(lm - float64(m)*math.Log(float64(m)))
+	}
+	unit, parts := r.split(m)
+	lp := lm
+	for j := 0; j < parts; j++ {
+		s := unit
+		if j == parts-1 {
+			s = m - unit*(parts-1)
+		}
+		ls, _ := math.Lgamma(float64(s + 1))
+		lp += float64(s)*math.Log(float64(s)/float64(m)) - ls
+	}
+	return math.Exp(lp)
+}
+
+// riceTable returns the stored Golomb-Rice parameters of a recsplit with
+// the given leaf size and largest bucket.
+func riceTable(leaf, maxm int) []uint8 {
+	r := newRecSplit(leaf, nil, 0)
+	rice := make([]uint8, storedRice(leaf, maxm))
+	for m := 2; m < len(rice); m++ {
+		rice[m] = riceParam(r.prob(m))
+	}
+	return rice
+}
+
+// A bitWriter appends bits to words.
+type bitWriter struct {
+	words []uint32
+	n     uint64 // number of bits written
+}
+
+// write appends the k low bits of v.
+func (w *bitWriter) write(v uint32, k uint) {
+	if k == 0 {
+		return
+	}
+	v &= uint32(1<<k - 1)
+	off := uint(w.n & 31)
+	if off == 0 {
+		w.words = append(w.words, 0)
+	}
+	w.words[len(w.words)-1] |= v << off
+	if off+k > 32 {
+		w.words = append(w.words, v>>(32-off))
+	}
+	w.n += uint64(k)
+}
+
+// unary appends q zeros and a one.
+func (w *bitWriter) unary(q uint32) {
+	for ; q >= 31; q -= 31 {
+		w.write(0, 31)
+	}
+	w.write(1<<q, uint(q)+1)
+}
+
+// append appends the bits of v.
+func (w *bitWriter) append(v *bitWriter) {
+	for i, word := range v.words {
+		k := uint(32)
+		if rest := v.n - 32*uint64(i); rest < 32 {
+			k = uint(rest)
+		}
+		w.write(word, k)
+	}
+}
+
+func (w *bitWriter) reset() {
+	w.words, w.n = w.words[:0], 0
+}
+
+// A recsplitBuilder finds the seeds of the buckets of a recsplit.
+type recsplitBuilder struct {
+	r            recsplit
+	fixed, unary bitWriter // the seeds of the current bucket
+	level1       []uint32
+	fps          []uint64 // scratch space for splitting
+	ids          []uint32
+}
+
+// buildRecSplit builds the recsplit of the keys of pool, whose key hashes
+// under h are hashes, as a rankBuild.
+func buildRecSplit(ctx context.Context, pool keyPool, hashes []uint64, cfg *buildConfig) (words, level1 []uint32, stuck []int, err error) {
+	nkeys := pool.len()
+	leaf, bucket := cfg.recsplitSizes()
+	nb := (nkeys + bucket - 1) / bucket
+	if nb == 0 {
+		nb = 1
+	}
+	// The key hashes are replaced by those that RecSplit splits keys by.
+	sc := cfg.scratchSpace()
+	sc.slots = reuse(sc.slots, nkeys)
+	for i := range hashes {
+		hashes[i] = wideKeyHash(cfg.hash, hashes[i], pool.key(i))
+		sc.slots[i] = uint32(recsplitBucket(hashes[i], nb))
+	}
+	sc.index.fill(sc.slots, nb)
+	index := sc.index
+	// Keys with equal hashes cannot be split.
+	if stuck := equalHashes(&index, hashes); stuck != nil {
+		return nil, nil, stuck, nil
+	}
+	maxm := 0
+	for b := 0; b < nb; b++ {
+		if m := len(index.bucket(b)); m > maxm {
+			maxm = m
+		}
+	}
+
+	rb := recsplitBuilder{
+		r:      newRecSplit(leaf, riceTable(leaf, maxm), maxm),
+		level1: make([]uint32, nkeys),
+		fps:    make([]uint64, 2*maxm),
+		ids:    make([]uint32, 2*maxm),
+	}
+	keyz := make([]uint32, nb+1)
+	bitz := make([]uint32, nb+1)
+	var stream bitWriter
+	for b := 0; b < nb; b++ {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, nil, err
+		}
+		vals := index.bucket(b)
+		fps, ids := rb.fps[:len(vals)], rb.ids[:len(vals)]
+		for j, i := range vals {
+			fps[j], ids[j] = hashes[i], i
+		}
+		rb.fixed.reset()
+		rb.unary.reset()
+		rb.place(fps, ids, 0, int(keyz[b]))
+		stream.append(&rb.fixed)
+		stream.append(&rb.unary)
+		if stream.n > math.MaxUint32 {
+			return nil, nil, nil, errTooManyKeys
+		}
+		keyz[b+1] = keyz[b] + uint32(len(vals))
+		bitz[b+1] = uint32(stream.n)
+		if cfg.progress != nil {
+			cfg.progress(b+1, nb)
+		}
+	}
+
+	nrice := storedRice(leaf, maxm)
+	words = make([]uint32, 3, 3+(nrice+3)/4+2*(nb+1)+len(stream.words)+1)
+	words[0], words[1], words[2] = uint32(leaf), uint32(nb), uint32(maxm)
+	for m, k := range rb.r.rice[:nrice] {
+		if m%4 == 0 {
+			words = append(words, 0)
+		}
+		words[len(words)-1] |= uint32(k) << (8 * (m % 4))
+	}
+	words = append(words, keyz...)
+	words = append(words, bitz...)
+	words = append(words, stream.words...)
+	words = append(words, 0)
+	return words, rb.level1, nil, nil
+}
+
+// place finds the seeds of the node of the keys whose hashes are fps and
+// positions are ids, at depth, and of its descendants, and records the
+// numbers of the keys, from base, in level1.
+func (rb *recsplitBuilder) place(fps []uint64, ids []uint32, depth, base int) {
+	r := &rb.r
+	m := len(fps)
+	if m <= 1 {
+		if m == 1 {
+			rb.level1[base] = ids[0]
+		}
+		return
+	}
+	var seed uint32
+	if m <= r.leaf {
+	leaf:
+		for ; ; seed++ {
+			var used uint32
+			for _, fp := range fps {
+				bit := uint32(1) << fastrange32(recsplitHash(fp, seed, depth), m)
+				if used&bit != 0 {
+					continue leaf
+				}
+				used |= bit
+			}
+			break
+		}
+		rb.emit(m, seed)
+		for j, fp := range fps {
+			rb.level1[base+fastrange32(recsplitHash(fp, seed, depth), m)] = ids[j]
+		}
+		return
+	}
+
+	unit, parts := r.split(m)
+	var counts [maxLeafSize]int // parts never exceed the fanouts, which are smaller
+split:
+	for ; ; seed++ {
+		for j := range counts[:parts] {
+			counts[j] = 0
+		}
+		for _, fp := range fps {
+			part := fastrange32(recsplitHash(fp, seed, depth), m) / unit
+			if counts[part]++; counts[part] > unit {
+				continue split
+			}
+		}
+		for _, c := range counts[:parts-1] {
+			if c != unit {
+				continue split
+			}
+		}
+		break
+	}
+	rb.emit(m, seed)
+	// Parts are filled in order in the second half of the scratch space,
+	// then copied back over the node.
+	tfps, tids := rb.fps[len(rb.fps)/2:], rb.ids[len(rb.ids)/2:]
+	var next [maxLeafSize]int
+	for j := 1; j < parts; j++ {
+		next[j] = j * unit
+	}
+	for j, fp := range fps {
+		part := fastrange32(recsplitHash(fp, seed, depth), m) / unit
+		tfps[next[part]], tids[next[part]] = fp, ids[j]
+		next[part]++
+	}
+	copy(fps, tfps[:m])
+	copy(ids, tids[:m])
+	for j := 0; j < parts; j++ {
+		end := (j + 1) * unit
+		if end > m {
+			end = m
+		}
+		rb.place(fps[j*unit:end], ids[j*unit:end], depth+1, base+j*unit)
+	}
+}
+
+// emit records the seed of a node of m keys.
+func (rb *recsplitBuilder) emit(m int, seed uint32) {
+	k := uint(rb.r.rice[m])
+	rb.fixed.write(seed, k)
+	rb.unary.unary(seed >> k)
+}
+
+// expectedRecSplitWords returns the expected size, in words, of the
+// serialized recsplit of nkeys keys with the given leaf and bucket sizes.
+// Bucket sizes follow a Poisson distribution, over which the expected
+// number of bits of the seeds of a bucket is averaged.
+func expectedRecSplitWords(nkeys, leaf, bucket int) int {
+	nb := (nkeys + bucket - 1) / bucket
+	if nb == 0 {
+		nb = 1
+	}
+	mean := float64(nkeys) / float64(nb)
+	maxm := int(mean + 6*math.Sqrt(mean) + 6)
+	if maxm > nkeys {
+		maxm = nkeys
+	}
+	r := newRecSplit(leaf, riceTable(leaf, maxm), maxm)
+	// expected[m] is the expected number of bits of the seeds of a node of
+	// m keys and its descendants.
+	expected := make([]float64, maxm+1)
+	var total float64
+	for m := 0; m <= maxm && mean > 0; m++ {
+		if m >= 2 {
+			k := float64(r.rice[m])
+			// The unary part of a seed tried with probability p of
+			// success is geometric with success probability q.
+			q := 1 - math.Pow(1-r.prob(m), math.Exp2(k))
+			expected[m] = k + 1 + (1-q)/q
+			if m > leaf {
+				unit, parts := r.split(m)
+				expected[m] += float64(parts-1)*expected[unit] + expected[m-unit*(parts-1)]
+			}
+		}
+		lp, _ := math.Lgamma(float64(m + 1))
+		total += math.Exp(float64(m)*math.Log(mean)-mean-lp) * expected[m]
+	}
+	return 3 + (storedRice(leaf, maxm)+3)/4 + 2*(nb+1) + int(float64(nb)*total/32) + 1
+}
@@ -0,0 +1,180 @@
+package mph
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"strconv"
+	"testing"
+)
+
+func TestRecSplit(t *testing.T) {
+	for _, nkeys := range []int{0, 1, 2, 7, 100, 10000} {
+		for _, h := range []Hash{Murmur3, Wyhash} {
+			var keys []string
+			for i := 0; i < nkeys; i++ {
+				keys = append(keys, strconv.Itoa(i))
+			}
+			table, err := BuildWithOptions(keys, WithAlgorithm(RecSplit), WithHash(h), WithVerify())
+			if err != nil {
+				t.Fatalf("BuildWithOptions(%d keys, %v): %v", nkeys, h, err)
+			}
+			checkTable(t, table, keys, []string{"-1", "quux"})
+			checkContiguous(t, "RecSplit", table)
+			for i, k := range keys {
+				if n := LookupUnchecked(table, k); n != uint32(i) {
+					t.Errorf("LookupUnchecked(%s): got %d; want %d", k, n, i)
+				}
+			}
+
+			data := mustMarshal(t, table)
+			var read Table
+			if err := read.UnmarshalBinary(data); err != nil {
+				t.Fatalf("UnmarshalBinary(%d keys, %v): %v", nkeys, h, err)
+			}
+			if !Equal(table, &read) {
+				t.Errorf("UnmarshalBinary(%d keys, %v): table differs", nkeys, h)
+			}
+			checkTable(t, &read, keys, []string{"quux"})
+			loaded, err := LoadBytes(data)
+			if err != nil {
+				t.Fatalf("LoadBytes(%d keys, %v): %v", nkeys, h, err)
+			}
+			checkTable(t, loaded, keys, []string{"quux"})
+			parallel, err := Unmarshal(data, WithDecodeParallelism(4))
+			if err != nil {
+				t.Fatalf("Unmarshal(%d keys, %v): %v", nkeys, h, err)
+			}
+			checkTable(t, parallel, keys, []string{"quux"})
+			checkTable(t, table.Clone(), keys, []string{"quux"})
+			if sum, err := BuildWithOptions(keys, WithAlgorithm(RecSplit), WithHash(h)); err != nil || !Equal(table, sum) {
+				t.Errorf("BuildWithOptions(%d keys, %v): not deterministic, err=%v", nkeys, h, err)
+			}
+		}
+	}
+}
+
+func TestRecSplit_sizes(t *testing.T) {
+	var keys []string
+	for i := 0; i < 100000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	for _, c := range []struct {
+		leaf, bucket int
+		maxBits      float64
+	}{
+		{0, 0, 1.8},
+		{5, 100, 2.6},
+		{10, 2000, 1.75},
+		{2, 1, 70}, // the bucket offsets take 64 bits per key
+	} {
+		opts := []Option{WithAlgorithm(RecSplit)}
+		if c.leaf != 0 {
+			opts = append(opts, WithRecSplitSizes(c.leaf, c.bucket))
+		}
+		table, err := BuildWithOptions(keys, opts...)
+		if err != nil {
+			t.Fatalf("BuildWithOptions(%d, %d): %v", c.leaf, c.bucket, err)
+		}
+		checkTable(t, table, keys[:1000], []string{"quux"})
+		s := table.Stats()
+		if hashBits := 32 * float64(s.Level0Len) / float64(len(keys)); hashBits > c.maxBits {
+			t.Errorf("Stats(%d, %d): hash function takes %.2f bits per key; want at most %.2f", c.leaf, c.bucket, hashBits, c.maxBits)
+		}
+		if s.Levels != 0 || s.BucketSizes != nil || s.MaxSeed != 0 {
+			t.Errorf("Stats(%d, %d): got %d levels, buckets %v, max seed %d", c.leaf, c.bucket, s.Levels, s.BucketSizes, s.MaxSeed)
+		}
+		est, err := EstimateSize(len(keys), s.KeyBytes, opts...)
+		if err != nil {
+			t.Fatalf("EstimateSize(%d, %d): %v", c.leaf, c.bucket, err)
+		}
+		if got := len(mustMarshal(t, table)); got < est.File*97/100 || got > est.File*103/100 {
+			t.Errorf("EstimateSize(%d, %d): got File %d; want within 3%% of %d", c.leaf, c.bucket, est.File, got)
+		}
+	}
+
+	for _, c := range [][2]int{{1, 100}, {17, 100}, {8, -1}, {8, 1 << 16}} {
+		if _, err := BuildWithOptions(keys[:10], WithAlgorithm(RecSplit), WithRecSplitSizes(c[0], c[1])); err == nil {
+			t.Errorf("WithRecSplitSizes(%d, %d): got nil error", c[0], c[1])
+		}
+	}
+}
+
+func TestRecSplit_hashOnly(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	table, err := BuildWithOptions(keys, WithAlgorithm(RecSplit), WithPackedIndices())
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	for i, k := range keys {
+		if n, ok := table.WithoutKeys().Lookup(k); !ok || n != uint32(i) {
+			t.Errorf("WithoutKeys().Lookup(%s): got %d, %t; want %d", k, n, ok, i)
+		}
+	}
+	fp, err := table.WithFingerprints(16)
+	if err != nil {
+		t.Fatalf("WithFingerprints: %v", err)
+	}
+	var read Table
+	if err := read.UnmarshalBinary(mustMarshal(t, fp)); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	checkTable(t, &read, keys, []string{"quux", "-1"})
+}
+
+func TestRecSplit_duplicates(t *testing.T) {
+	keys := []string{"a", "b", "c", "b", "d", "a"}
+	_, err := BuildWithOptions(keys, WithAlgorithm(RecSplit))
+	var dup *DuplicateKeyError
+	if !errors.As(err, &dup) || string(dup.Key) != "b" || dup.First != 1 || dup.Second != 3 {
+		t.Errorf("BuildWithOptions(duplicates): got err=%v; want b at 1 and 3", err)
+	}
+	var removed int
+	table, err := BuildWithOptions(keys, WithAlgorithm(RecSplit), WithDedup(&removed))
+	if err != nil {
+		t.Fatalf("BuildWithOptions(WithDedup): %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("WithDedup: removed %d keys; want 2", removed)
+	}
+	checkTable(t, table, []string{"a", "b", "c", "d"}, []string{"e"})
+}
+
+func TestRecSplit_corrupt(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	table, err := BuildWithOptions(keys, WithAlgorithm(RecSplit))
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	words := table.level0.wide
+	if err := checkRecSplit(words, len(keys)); err != nil {
+		t.Errorf("checkRecSplit: %v", err)
+	}
+	if err := checkRecSplit(words, len(keys)+1); err != ErrCorrupt {
+		t.Errorf("checkRecSplit(wrong count): got %v; want %v", err, ErrCorrupt)
+	}
+	if err := checkRecSplit(words[:len(words)-1], len(keys)); err != ErrCorrupt {
+		t.Errorf("checkRecSplit(truncated): got %v; want %v", err, ErrCorrupt)
+	}
+	// Clearing the last unary bit of the stream leaves a bucket a seed short.
+	corrupt := append([]uint32(nil), words...)
+	end := uint64(table.recsplit.bits[len(table.recsplit.bits)-1]) - 1
+	corrupt[len(corrupt)-len(table.recsplit.stream)+int(end/32)] &^= 1 << (end % 32)
+	if err := checkRecSplit(corrupt, len(keys)); err != ErrCorrupt {
+		t.Errorf("checkRecSplit(cleared bit): got %v; want %v", err, ErrCorrupt)
+	}
+
+	data := mustMarshal(t, table)
+	data[9] = 0xf // the algorithm bits of flags
+	binary.LittleEndian.PutUint32(data[32:], crc32.Checksum(data[:32], crcTable))
+	var read Table
+	if err := read.UnmarshalBinary(data); err != ErrVersion {
+		t.Errorf("UnmarshalBinary(unknown algorithm): got %v; want %v", err, ErrVersion)
+	}
+}
@@ -0,0 +1,206 @@
+package mph
+
+import (
+	"math"
+	"math/bits"
+)
+
+// A seedCodes holds the level0 seeds of a table entropy coded, as by the
+// "compress" step of "Hash, displace, and compress" (Belazzougui et al.,
+// 2009). Seeds are mostly small and their distribution is skewed, so seed
+// s is coded in the bits.Len(s+1)-1 bits that s+1 has below its highest
+// set bit, and the codes are concatenated. The start of each code, and of
+// the end of the last one, is kept in an Elias-Fano sequence: its low l
+// bits are stored in low, and its high bits in unary in high, where the
+// start of code i sets bit i+start>>l. The position of every
+// seedSample-th set bit of high is sampled, so finding a start takes one
+// sample and a short scan, and a seed is decoded in constant time.
+//
+// All slices alias the serialized form of the codes in level0.coded:
+//
+//	n        uint32, the number of seeds
+//	l        uint32, at most 5, since codes take at most 32 bits
+//	nbits    uint32, the length of the codes, in bits
+//	low      uint32, n*l/32+2 words
+//	high     uint32, n+1+nbits>>l bits, padded to a word
+//	samples  uint32, n/seedSample+1 positions in high
+//	codes    uint32, nbits/32+2 words
+//
+// Bit i of each bit string is bit i%32 of word i/32. The low bits and codes
+// are read 64 bits at a time, hence their extra word.
+type seedCodes struct {
+	n       uint32
+	l       uint
+	low     []uint32
+	high    []uint32
+	samples []uint32
+	codes   []uint32
+}
+
+// seedSample is the number of starts per sample. Each sample takes half a
+// bit per seed.
+const seedSample = 64
+
+// seedCodeSizes returns the number of words of the low, high, samples and
+// codes sections of the codes of n seeds with the given l and nbits.
+func seedCodeSizes(n, l, nbits uint64) (low, high, samples, codes uint64) {
+	low = n*l/32 + 2
+	high = (n + 1 + nbits>>l + 31) / 32
+	samples = n/seedSample + 1
+	codes = nbits/32 + 2
+	return low, high, samples, codes
+}
+
+// splitSeedCodes returns the codes whose serialized form is words, which
+// must be valid.
+func splitSeedCodes(words []uint32) seedCodes {
+	low, high, samples, _ := seedCodeSizes(uint64(words[0]), uint64(words[1]), uint64(words[2]))
+	c := seedCodes{n: words[0], l: uint(words[1])}
+	words = words[3:]
+	c.low, words = words[:low:low], words[low:]
+	c.high, words = words[:high:high], words[high:]
+	c.samples, c.codes = words[:samples:samples], words[samples:]
+	return c
+}
+
+// codeSeeds returns the serialized codes of seeds, or nil if they would be
+// too long to address.
+func codeSeeds(seeds []uint32) []uint32 {
+	n := uint64(len(seeds))
+	var nbits uint64
+	for _, s := range seeds {
+		nbits += uint64(bits.Len64(uint64(s)+1) - 1)
+	}
+	if nbits+n+1 > math.MaxUint32 {
+		return nil
+	}
+	var l uint64
+	if nbits > n+1 {
+		l = uint64(bits.Len64(nbits/(n+1)) - 1)
+	}
+	low, high, samples, codes := seedCodeSizes(n, l, nbits)
+	words := make([]uint32, 3+low+high+samples+codes)
+	words[0], words[1], words[2] = uint32(n), uint32(l), uint32(nbits)
+	c := splitSeedCodes(words)
+	var start uint64
+	for i := uint64(0); i <= n; i++ {
+		setBits(c.low, i*l, uint32(start)&(1<<l-1))
+		p := i + start>>l
+		c.high[p>>5] |= 1 << (p & 31)
+		if i%seedSample == 0 {
+			c.samples[i/seedSample] = uint32(p)
+		}
+		if i == n {
+			break
+		}
+		v := uint64(seeds[i]) + 1
+		width := uint64(bits.Len64(v) - 1)
+		setBits(c.codes, start, uint32(v-1<<width))
+		start += width
+	}
+	return words
+}
+
+// setBits ORs v into the bit string words from bit i on. The bits of v
+// must fit in the string.
+func setBits(words []uint32, i uint64, v uint32) {
+	if v == 0 {
+		return
+	}
+	words[i>>5] |= v << (i & 31)
+	if i&31 != 0 {
+		if hi := v >> (32 - i&31); hi != 0 {
+			words[i>>5+1] |= hi
+		}
+	}
+}
+
+// window returns the 32 bits of the bit string words from bit i on.
+func window(words []uint32, i uint64) uint32 {
+	w := uint64(words[i>>5]) | uint64(words[i>>5+1])<<32
+	return uint32(w >> (i & 31))
+}
+
+// start returns the start of code i, whose set bit in high is p.
+func (c *seedCodes) start(i, p uint32) uint32 {
+	return (p-i)<<c.l | window(c.low, uint64(i)*uint64(c.l))&(1<<c.l-1)
+}
+
+// select1 returns the position of set bit i of high.
+func (c *seedCodes) select1(i uint32) uint32 {
+	p := c.samples[i/seedSample]
+	r := i % seedSample
+	w := p >> 5
+	x := c.high[w] &^ (1<<(p&31) - 1)
+	for {
+		n := uint32(bits.OnesCount32(x))
+		if r < n {
+			break
+		}
+		r -= n
+		w++
+		x = c.high[w]
+	}
+	for ; r > 0; r-- {
+		x &= x - 1
+	}
+	return w<<5 + uint32(bits.TrailingZeros32(x))
+}
+
+// get returns seed i.
+func (c *seedCodes) get(i int) uint32 {
+	p := c.select1(uint32(i))
+	// The start of the next code is the next set bit.
+	w := p >> 5
+	x := c.high[w] &^ (uint32(2)<<(p&31) - 1)
+	for x == 0 {
+		w++
+		x = c.high[w]
+	}
+	q := w<<5 + uint32(bits.TrailingZeros32(x))
+	start := c.start(uint32(i), p)
+	width := c.start(uint32(i)+1, q) - start
+	v := uint64(1)<<width | uint64(window(c.codes, uint64(start)))&(1<<width-1)
+	return uint32(v - 1)
+}
+
+// checkSeedCodes returns ErrCorrupt unless words is the serialized form of
+// the codes of n seeds.
+func checkSeedCodes(words []uint32, n int) error {
+	if len(words) < 3 || int64(words[0]) != int64(n) || words[1] > 5 {
+		return ErrCorrupt
+	}
+	nbits := uint64(words[2])
+	if nbits+uint64(n)+1 > math.MaxUint32 {
+		return ErrCorrupt
+	}
+	low, high, samples, codes := seedCodeSizes(uint64(n), uint64(words[1]), nbits)
+	if uint64(len(words)) != 3+low+high+samples+codes {
+		return ErrCorrupt
+	}
+	c := splitSeedCodes(words)
+	// Walk the set bits of high: there must be n+1 of them, sampled as
+	// stated, starting codes of at most 32 bits that end at nbits.
+	var i, prev uint32
+	for w, x := range c.high {
+		for ; x != 0; x &= x - 1 {
+			if i > uint32(n) {
+				return ErrCorrupt
+			}
+			p := uint32(w)<<5 + uint32(bits.TrailingZeros32(x))
+			if i%seedSample == 0 && c.samples[i/seedSample] != p {
+				return ErrCorrupt
+			}
+			start := c.start(i, p)
+			if i == 0 && start != 0 || i > 0 && (start < prev || start-prev > 32) {
+				return ErrCorrupt
+			}
+			prev = start
+			i++
+		}
+	}
+	if i != uint32(n)+1 || uint64(prev) != nbits {
+		return ErrCorrupt
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package mph
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestCodeSeeds(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	random := make([]uint32, 1000)
+	for i := range random {
+		random[i] = uint32(r.ExpFloat64() * 20)
+	}
+	for _, seeds := range [][]uint32{
+		{0},
+		{math.MaxUint32},
+		{0, 0, 0, 0, 0},
+		{1, 2, 3, 4, 1 << 20, math.MaxUint32, 0, 7},
+		make([]uint32, 300),
+		random,
+	} {
+		words := codeSeeds(seeds)
+		if err := checkSeedCodes(words, len(seeds)); err != nil {
+			t.Fatalf("checkSeedCodes(%d seeds): %v", len(seeds), err)
+		}
+		c := splitSeedCodes(words)
+		for i, s := range seeds {
+			if got := c.get(i); got != s {
+				t.Errorf("get(%d): got %d; want %d", i, got, s)
+			}
+		}
+	}
+}
+
+func TestCodeSeeds_corrupt(t *testing.T) {
+	seeds := make([]uint32, 1000)
+	for i := range seeds {
+		seeds[i] = uint32(i % 37)
+	}
+	words := codeSeeds(seeds)
+	if err := checkSeedCodes(words, len(seeds)+1); err != ErrCorrupt {
+		t.Errorf("checkSeedCodes(wrong count): got %v; want %v", err, ErrCorrupt)
+	}
+	if err := checkSeedCodes(words[:len(words)-1], len(seeds)); err != ErrCorrupt {
+		t.Errorf("checkSeedCodes(truncated): got %v; want %v", err, ErrCorrupt)
+	}
+	low, high, samples, _ := seedCodeSizes(uint64(words[0]), uint64(words[1]), uint64(words[2]))
+	for _, i := range []uint64{1, 2, 3 + low + 1, 3 + low + high + samples - 1} {
+		corrupt := append([]uint32(nil), words...)
+		corrupt[i] ^= 4
+		if err := checkSeedCodes(corrupt, len(seeds)); err != ErrCorrupt {
+			t.Errorf("checkSeedCodes(word %d changed): got %v; want %v", i, err, ErrCorrupt)
+		}
+	}
+}
+
+func TestWithCompressedSeeds(t *testing.T) {
+	var keys []string
+	for i := 0; i < 100000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	for _, h := range []Hash{Murmur3, Wyhash} {
+		plain, err := BuildWithOptions(keys, WithHash(h))
+		if err != nil {
+			t.Fatalf("BuildWithOptions(%v): %v", h, err)
+		}
+		table, err := BuildWithOptions(keys, WithHash(h), WithCompressedSeeds())
+		if err != nil {
+			t.Fatalf("BuildWithOptions(%v, WithCompressedSeeds): %v", h, err)
+		}
+		if table.level0.coded == nil {
+			t.Fatalf("WithCompressedSeeds(%v): seeds not coded", h)
+		}
+		checkTable(t, table, keys[:1000], []string{"-1", "quux"})
+		// Coded seeds take about 8 bits each rather than 16.
+		if got, want := table.level0.size(), plain.level0.size(); 2*got > want {
+			t.Errorf("WithCompressedSeeds(%v): level0 takes %d bytes; want less than half of %d", h, got, want)
+		}
+		if got, want := table.level0.uint32s(), plain.level0.uint32s(); !equalUint32s(got, want) {
+			t.Errorf("WithCompressedSeeds(%v): seeds differ", h)
+		}
+
+		data := mustMarshal(t, table)
+		var read Table
+		if err := read.UnmarshalBinary(data); err != nil {
+			t.Fatalf("UnmarshalBinary(%v): %v", h, err)
+		}
+		if !Equal(table, &read) || Equal(table, plain) {
+			t.Errorf("UnmarshalBinary(%v): got Equal %t, %t; want true, false", h, Equal(table, &read), Equal(table, plain))
+		}
+		checkTable(t, &read, keys[:1000], []string{"quux"})
+		loaded, err := LoadBytes(data)
+		if err != nil {
+			t.Fatalf("LoadBytes(%v): %v", h, err)
+		}
+		checkTable(t, loaded, keys[:1000], []string{"quux"})
+		parallel, err := Unmarshal(data, WithDecodeParallelism(4))
+		if err != nil {
+			t.Fatalf("Unmarshal(%v): %v", h, err)
+		}
+		checkTable(t, parallel, keys[:1000], []string{"quux"})
+		checkTable(t, table.Clone(), keys[:1000], []string{"quux"})
+	}
+
+	// Seeds that coding does not shrink are stored as without the option.
+	table, err := BuildWithOptions([]string{"a"}, WithCompressedSeeds())
+	if err != nil {
+		t.Fatalf("BuildWithOptions(1 key): %v", err)
+	}
+	if table.level0.coded != nil {
+		t.Errorf("WithCompressedSeeds(1 key): got coded seeds")
+	}
+}
+
+func BenchmarkLookup_compressedSeeds(b *testing.B) {
+	keys := make([]string, 100000)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+	}
+	for _, opts := range [][]Option{nil, {WithCompressedSeeds()}} {
+		table, err := BuildWithOptions(keys, opts...)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run("coded="+strconv.FormatBool(table.level0.coded != nil), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				table.Lookup(keys[i*7919%len(keys)])
+			}
+		})
+	}
+}
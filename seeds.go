@@ -0,0 +1,173 @@
+package mph
+
+import (
+	"encoding/binary"
+	"sort"
+	"unsafe"
+)
+
+// A seedArray holds the level0 seeds of a table. Almost all seeds are
+// small, so unless too many are large the seeds are stored in 16 bits each,
+// and the few that do not fit are replaced by seedEscape and kept in a
+// sorted list of escapes, halving the size of level0. With
+// WithCompressedSeeds, the seeds are entropy coded instead.
+type seedArray struct {
+	wide    []uint32 // all seeds, if they are stored in 32 bits
+	narrow  []uint16 // all seeds, if they are stored in 16 bits
+	escapes []uint32 // index and seed pairs for the narrow seeds that are seedEscape
+	coded   []uint32 // all seeds, if they are coded, in the serialized form of codes
+	codes   seedCodes
+}
+
+// seedEscape marks a narrow seed that is stored in the escape list.
+const seedEscape = 0xffff
+
+// newSeedArray returns the most compact seedArray holding seeds.
+func newSeedArray(seeds []uint32) seedArray {
+	nesc := 0
+	for _, s := range seeds {
+		if s >= seedEscape {
+			nesc++
+		}
+	}
+	// Each escape costs 8 bytes; use 16-bit seeds while they save space.
+	if 8*nesc >= 2*len(seeds) {
+		return seedArray{wide: seeds}
+	}
+	a := seedArray{narrow: make([]uint16, len(seeds))}
+	for i, s := range seeds {
+		if s >= seedEscape {
+			a.escapes = append(a.escapes, uint32(i), s)
+			s = seedEscape
+		}
+		a.narrow[i] = uint16(s)
+	}
+	return a
+}
+
+// newCodedSeeds returns a seedArray holding seeds coded, unless that would
+// not make it smaller than newSeedArray does.
+func newCodedSeeds(seeds []uint32) seedArray {
+	a := newSeedArray(seeds)
+	if words := codeSeeds(seeds); words != nil && 4*len(words) < a.size() {
+		a = seedArray{coded: words}
+		a.view()
+	}
+	return a
+}
+
+// view sets the view of the coded seeds of a.
+func (a *seedArray) view() {
+	if a.coded != nil {
+		a.codes = splitSeedCodes(a.coded)
+	}
+}
+
+func (a *seedArray) len() int {
+	if a.wide != nil {
+		return len(a.wide)
+	}
+	if a.coded != nil {
+		return int(a.coded[0])
+	}
+	return len(a.narrow)
+}
+
+// get returns seed i.
+func (a *seedArray) get(i int) uint32 {
+	if a.wide != nil {
+		return a.wide[i]
+	}
+	if a.narrow == nil {
+		return a.codes.get(i)
+	}
+	if s := a.narrow[i]; s != seedEscape {
+		return uint32(s)
+	}
+	return a.escaped(i)
+}
+
+func (a *seedArray) escaped(i int) uint32 {
+	n := len(a.escapes) / 2
+	k := sort.Search(n, func(k int) bool { return a.escapes[2*k] >= uint32(i) })
+	return a.escapes[2*k+1]
+}
+
+// uint32s returns all the seeds as 32-bit values. The result must not be
+// modified.
+func (a *seedArray) uint32s() []uint32 {
+	if a.wide != nil {
+		return a.wide
+	}
+	seeds := make([]uint32, a.len())
+	for i := range seeds {
+		seeds[i] = a.get(i)
+	}
+	return seeds
+}
+
+// size returns the memory used by the seeds, in bytes.
+func (a *seedArray) size() int {
+	return 4*len(a.wide) + 2*len(a.narrow) + 4*len(a.escapes) + 4*len(a.coded)
+}
+
+// equal reports whether a and b hold the same seeds in the same form.
+func (a *seedArray) equal(b *seedArray) bool {
+	if !equalUint32s(a.wide, b.wide) || !equalUint32s(a.escapes, b.escapes) || !equalUint32s(a.coded, b.coded) || len(a.narrow) != len(b.narrow) {
+		return false
+	}
+	for i, s := range a.narrow {
+		if s != b.narrow[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// narrowBytes returns the size of n narrow seeds in the serialized form,
+// which is padded to a multiple of 4 bytes to keep the sections after it
+// aligned.
+func narrowBytes(n int) int {
+	return (2*n + 3) &^ 3
+}
+
+// uint16sInPlace interprets b as a little-endian []uint16, like
+// uint32sInPlace.
+func uint16sInPlace(b []byte) []uint16 {
+	n := len(b) / 2
+	if n == 0 {
+		return []uint16{}
+	}
+	if hostLittleEndian && uintptr(unsafe.Pointer(&b[0]))%2 == 0 {
+		return unsafe.Slice((*uint16)(unsafe.Pointer(&b[0])), n)
+	}
+	vs := make([]uint16, n)
+	for i := range vs {
+		vs[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return vs
+}
+
+// check returns ErrCorrupt unless the escape list of a names exactly the
+// narrow seeds that are seedEscape, in increasing order.
+func (a *seedArray) check() error {
+	if a.wide != nil {
+		return nil
+	}
+	nesc := 0
+	for _, s := range a.narrow {
+		if s == seedEscape {
+			nesc++
+		}
+	}
+	if 2*nesc != len(a.escapes) {
+		return ErrCorrupt
+	}
+	for k := 0; k < nesc; k++ {
+		i := a.escapes[2*k]
+		if int(i) >= len(a.narrow) || a.narrow[i] != seedEscape || (k > 0 && i <= a.escapes[2*k-2]) {
+			return ErrCorrupt
+		}
+	}
+	return nil
+}
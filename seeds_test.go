@@ -0,0 +1,102 @@
+package mph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"strconv"
+	"testing"
+)
+
+func TestSeedArray(t *testing.T) {
+	seeds := []uint32{0, 3, 70000, 1, seedEscape, 9, 0, 2, 1, 0, 0, 5}
+	a := newSeedArray(seeds)
+	if a.narrow == nil || len(a.escapes) != 4 {
+		t.Fatalf("newSeedArray: got %d narrow seeds and %d escapes; want 12 and 2", len(a.narrow), len(a.escapes)/2)
+	}
+	for i, s := range seeds {
+		if got := a.get(i); got != s {
+			t.Errorf("get(%d): got %d; want %d", i, got, s)
+		}
+	}
+	if err := a.check(); err != nil {
+		t.Errorf("check: %v", err)
+	}
+	a.escapes[0], a.escapes[2] = a.escapes[2], a.escapes[0]
+	if err := a.check(); err != ErrCorrupt {
+		t.Errorf("check(unsorted escapes): got %v; want %v", err, ErrCorrupt)
+	}
+
+	// Too many large seeds are stored in 32 bits.
+	if w := newSeedArray([]uint32{1 << 20, 1 << 20, 3, 4}); w.wide == nil {
+		t.Errorf("newSeedArray(mostly large): got narrow seeds")
+	}
+}
+
+// tableWithSeeds returns a table for keys whose level0 is replaced by a.
+func tableWithSeeds(keys []string, a func(seeds []uint32) seedArray) *Table {
+	table := Build(keys)
+	table.level0 = a(table.level0.uint32s())
+	return table
+}
+
+func TestMarshalBinary_seeds(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	for _, tt := range []struct {
+		name  string
+		seeds func([]uint32) seedArray
+	}{
+		{"wide", func(s []uint32) seedArray { return seedArray{wide: s} }},
+		{"escapes", func(s []uint32) seedArray {
+			// Escape every seed above 4 as if it did not fit in 16 bits.
+			a := seedArray{narrow: make([]uint16, len(s))}
+			for i, v := range s {
+				if v > 4 {
+					a.escapes = append(a.escapes, uint32(i), v)
+					v = seedEscape
+				}
+				a.narrow[i] = uint16(v)
+			}
+			return a
+		}},
+	} {
+		table := tableWithSeeds(keys, tt.seeds)
+		checkTable(t, table, keys, []string{"x"})
+		data, err := table.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%s: MarshalBinary: %v", tt.name, err)
+		}
+		var got Table
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s: UnmarshalBinary: %v", tt.name, err)
+		}
+		loaded, err := LoadBytes(data)
+		if err != nil {
+			t.Fatalf("%s: LoadBytes: %v", tt.name, err)
+		}
+		for _, tb := range []*Table{&got, loaded} {
+			if !Equal(tb, table) {
+				t.Errorf("%s: decoded table differs", tt.name)
+			}
+			checkTable(t, tb, keys, []string{"x"})
+		}
+	}
+}
+
+func TestUnmarshalBinary_reserved(t *testing.T) {
+	table := tableWithSeeds([]string{"foo", "bar", "baz"}, func(s []uint32) seedArray { return seedArray{wide: s} })
+	data, err := table.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	// The escape count is reserved in tables with 32-bit seeds.
+	binary.LittleEndian.PutUint32(data[36:], 1)
+	binary.LittleEndian.PutUint32(data[32:], crc32.Checksum(data[:32], crcTable))
+	var got Table
+	if _, err := got.ReadFrom(bytes.NewReader(data)); err != ErrVersion {
+		t.Errorf("ReadFrom: got err=%v; want %v", err, ErrVersion)
+	}
+}
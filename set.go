@@ -0,0 +1,82 @@
+package mph
+
+import "errors"
+
+// A Set is an immutable set of keys, for callers that only test membership
+// and have no use for the indices of a Table.
+type Set struct {
+	table  *Table
+	filter *Filter // in place of table, for BuildApproxSet
+}
+
+// BuildSet builds a Set of keys. Unlike a Table, a Set may be built from
+// keys with duplicates, which are ignored. As its indices are of no use,
+// the Set lets PTHash number the keys (see WithHashOrder), which spares it
+// the level1 of a table, that maps them to their positions: it takes the
+// keys and their offsets, and about 4 bits per key. If two keys have equal
+// 64-bit hashes, which PTHash cannot tell apart, the Set holds a table
+// built with the defaults instead. BuildSet returns an error if there are
+// too many keys for one table.
+func BuildSet[T ~string | ~[]byte](keys []T) (*Set, error) {
+	t, err := BuildWithOptions(keys, setOptions()...)
+	if errors.Is(err, ErrBuildFailed) {
+		t, err = BuildWithOptions(keys, WithDedup(nil))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Set{table: t}, nil
+}
+
+// BuildApproxSet builds a Set of keys that does not store them but holds
+// a Filter of them, with fingerprints of bits bits, which must be 8 or 16
+// (see Table.Filter). Contains then reports every key of keys as present,
+// and any other with probability about 2^-bits, and the Set takes about
+// 1.125*bits bits per key. Duplicates in keys are ignored, and keys with
+// equal hashes are handled as by BuildSet.
+func BuildApproxSet[T ~string | ~[]byte](keys []T, bits int) (*Set, error) {
+	_, f, err := BuildWithFilter(keys, bits, setOptions()...)
+	if errors.Is(err, ErrBuildFailed) {
+		_, f, err = BuildWithFilter(keys, bits, WithDedup(nil))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Set{filter: f}, nil
+}
+
+// setAlgorithm is the algorithm that numbers the keys of a Set. It is a
+// variable so that tests can make it fail as keys with equal hashes do.
+var setAlgorithm = PTHash
+
+// setOptions returns the options that BuildSet and BuildApproxSet try
+// first.
+func setOptions() []Option {
+	return []Option{WithDedup(nil), WithHash(Wyhash), WithAlgorithm(setAlgorithm), WithHashOrder()}
+}
+
+// Contains reports whether key is in s.
+func (s *Set) Contains(key string) bool {
+	if s.filter != nil {
+		return s.filter.Contains(key)
+	}
+	_, ok := lookup(s.table, key)
+	return ok
+}
+
+// ContainsBytes is like Contains but takes the key as a byte slice.
+func (s *Set) ContainsBytes(key []byte) bool {
+	if s.filter != nil {
+		return s.filter.ContainsBytes(key)
+	}
+	_, ok := lookup(s.table, key)
+	return ok
+}
+
+// Len returns the number of distinct keys in s.
+func (s *Set) Len() int {
+	if s.filter != nil {
+		return s.filter.Len()
+	}
+	return s.table.Len()
+}
@@ -0,0 +1,146 @@
+package mph
+
+import (
+	"context"
+	"strconv"
+	"testing"
+)
+
+func TestBuildSet(t *testing.T) {
+	s, err := BuildSet([]string{"foo", "bar", "foo", "baz"})
+	if err != nil {
+		t.Fatalf("BuildSet: %v", err)
+	}
+	if s.Len() != 3 {
+		t.Errorf("Len: got %d; want 3", s.Len())
+	}
+	for _, tt := range []struct {
+		key  string
+		want bool
+	}{
+		{"foo", true},
+		{"bar", true},
+		{"baz", true},
+		{"quux", false},
+		{"", false},
+	} {
+		if got := s.Contains(tt.key); got != tt.want {
+			t.Errorf("Contains(%q): got %t; want %t", tt.key, got, tt.want)
+		}
+		if got := s.ContainsBytes([]byte(tt.key)); got != tt.want {
+			t.Errorf("ContainsBytes(%q): got %t; want %t", tt.key, got, tt.want)
+		}
+	}
+	if empty, err := BuildSet([]string(nil)); err != nil || empty.Contains("foo") {
+		t.Errorf("empty set: Contains(foo): got true or err=%v; want false", err)
+	}
+}
+
+func TestBuildSet_noIndices(t *testing.T) {
+	var keys []string
+	for i := 0; i < 10000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	s, err := BuildSet(keys)
+	if err != nil {
+		t.Fatalf("BuildSet: %v", err)
+	}
+	if st := s.table.Stats(); st.Level1Len != 0 {
+		t.Errorf("BuildSet: got %d level1 entries; want 0", st.Level1Len)
+	}
+	for _, k := range keys {
+		if !s.Contains(k) {
+			t.Errorf("Contains(%s): got false; want true", k)
+		}
+	}
+}
+
+func TestBuildApproxSet(t *testing.T) {
+	var keys []string
+	for i := 0; i < 10000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	keys = append(keys, "0", "1")
+	for _, bits := range []int{8, 16} {
+		s, err := BuildApproxSet(keys, bits)
+		if err != nil {
+			t.Fatalf("BuildApproxSet(%d): %v", bits, err)
+		}
+		if s.Len() != 10000 {
+			t.Errorf("Len(%d bits): got %d; want 10000", bits, s.Len())
+		}
+		for _, k := range keys {
+			if !s.Contains(k) || !s.ContainsBytes([]byte(k)) {
+				t.Errorf("Contains(%d bits, %s): got false; want true", bits, k)
+			}
+		}
+		misses := 0
+		for i := 0; i < 10000; i++ {
+			if s.Contains("x" + strconv.Itoa(i)) {
+				misses++
+			}
+		}
+		// 2^-8 of 10000 is 39.
+		if misses > 100 {
+			t.Errorf("Contains(%d bits): got %d false positives in 10000", bits, misses)
+		}
+	}
+	empty, err := BuildApproxSet([]string(nil), 8)
+	if err != nil {
+		t.Fatalf("BuildApproxSet(empty): %v", err)
+	}
+	if empty.Len() != 0 {
+		t.Errorf("BuildApproxSet(empty): got Len %d; want 0", empty.Len())
+	}
+	if _, err := BuildApproxSet(keys, 12); err == nil {
+		t.Errorf("BuildApproxSet(12 bits): got no error")
+	}
+}
+
+// collidingBackend hashes every key to the same value, and so cannot tell
+// any two keys apart.
+type collidingBackend struct{ sortedBackend }
+
+func (collidingBackend) Build(ctx context.Context, hashes []uint64) (BackendFunc, []uint32, error) {
+	if len(hashes) > 1 {
+		return nil, nil, ErrBuildFailed
+	}
+	return sortedBackend{}.Build(ctx, hashes)
+}
+
+func TestBuildSet_collisions(t *testing.T) {
+	a := sortedAlgorithm + 2
+	backends.Lock()
+	backends.b[a] = collidingBackend{}
+	backends.Unlock()
+	defer func(prev Algorithm) {
+		setAlgorithm = prev
+		backends.Lock()
+		backends.b[a] = nil
+		backends.Unlock()
+	}(setAlgorithm)
+	setAlgorithm = a
+
+	keys := []string{"foo", "bar", "foo", "baz"}
+	s, err := BuildSet(keys)
+	if err != nil {
+		t.Fatalf("BuildSet: %v", err)
+	}
+	approx, err := BuildApproxSet(keys, 16)
+	if err != nil {
+		t.Fatalf("BuildApproxSet: %v", err)
+	}
+	for name, s := range map[string]*Set{"BuildSet": s, "BuildApproxSet": approx} {
+		if s.Len() != 3 {
+			t.Errorf("%s: got Len %d; want 3", name, s.Len())
+		}
+		for _, k := range keys {
+			if !s.Contains(k) {
+				t.Errorf("%s: Contains(%s): got false; want true", name, k)
+			}
+		}
+	}
+	if s.Contains("quux") {
+		t.Errorf("BuildSet: Contains(quux): got true; want false")
+	}
+}
@@ -0,0 +1,384 @@
+package mph
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// A ShardedTable is a set of Tables, each holding the keys that a hash of
+// their own sends to it, that together index more keys than one Table can:
+// a Table numbers keys with uint32 indices and keeps them in a pool of at
+// most 4 GiB, while a ShardedTable numbers keys with uint64 indices.
+//
+// The indices of the keys of shard i follow those of the keys of the shards
+// before it, and within a shard, keys keep their relative order in the
+// input. Unlike for a Table, the index of a key is therefore not its
+// position in the input.
+type ShardedTable struct {
+	shards []*Table
+	starts []uint64 // starts[i] is the index of the first key of shard i; len(shards)+1 entries
+
+	// normalize, if not nil, is applied to keys before they are routed
+	// to a shard.
+	normalize func([]byte) []byte
+}
+
+// shardSeed seeds the hash that routes keys to shards. It differs from the
+// seeds that the tables use, so that routing does not bias the buckets of
+// a shard.
+const shardSeed = 0x5d588b65
+
+// maxShards bounds the number of shards that ReadFrom accepts.
+const maxShards = 1 << 20
+
+// keysPerShard is the number of keys per shard that BuildSharded aims for
+// when it chooses the number of shards.
+const keysPerShard = 1 << 30
+
+// BuildSharded builds a ShardedTable with the given number of shards from
+// keys, which may number more than 2^32. If shards is 0 or less, it uses one
+// shard per 2^30 keys. The options apply to each shard, except that a
+// normalizer is applied once, before routing, and WithDedup reports the
+// total number of keys removed. The positions in a *DuplicateKeyError refer
+// to keys.
+func BuildSharded[T ~string | ~[]byte](keys []T, shards int, opts ...Option) (*ShardedTable, error) {
+	return BuildShardedContext(context.Background(), keys, shards, opts...)
+}
+
+// BuildShardedContext is like BuildSharded but may be canceled through ctx,
+// as for BuildContext.
+func BuildShardedContext[T ~string | ~[]byte](ctx context.Context, keys []T, shards int, opts ...Option) (*ShardedTable, error) {
+	if shards <= 0 {
+		shards = (len(keys) + keysPerShard - 1) / keysPerShard
+		if shards == 0 {
+			shards = 1
+		}
+	}
+	if shards > maxShards {
+		return nil, errors.New("mph: too many shards")
+	}
+	cfg := newBuildConfig(opts)
+	st := &ShardedTable{
+		shards:    make([]*Table, shards),
+		starts:    make([]uint64, shards+1),
+		normalize: cfg.normalize,
+	}
+	// Route every key, then gather the positions of each shard's keys.
+	route := make([]uint32, len(keys))
+	for i, k := range keys {
+		if cfg.normalize != nil {
+			route[i] = uint32(shardOf(shards, cfg.normalize(append([]byte(nil), k...))))
+		} else {
+			route[i] = uint32(shardOf(shards, k))
+		}
+	}
+	positions, counts := byShard(route, shards)
+
+	removed := 0
+	for s := range st.shards {
+		pos := positions[counts[s]:counts[s+1]]
+		shardKeys := make([]T, len(pos))
+		for j, i := range pos {
+			shardKeys[j] = keys[i]
+		}
+		c := *cfg
+		var r int
+		c.removed = &r
+		t, err := c.finish(build(ctx, shardKeys, &c))
+		if err != nil {
+			var dup *DuplicateKeyError
+			if errors.As(err, &dup) {
+				dup.First, dup.Second = pos[dup.First], pos[dup.Second]
+			}
+			return nil, err
+		}
+		t.normalize = nil // st normalizes keys before routing them
+		st.shards[s] = t
+		st.starts[s+1] = st.starts[s] + uint64(t.Len())
+		removed += r
+	}
+	if cfg.removed != nil {
+		*cfg.removed = removed
+	}
+	return st, nil
+}
+
+// byShard returns the positions of keys grouped by shard, where route[i]
+// is the shard of key i, out of shards: the keys of shard s are at
+// positions[counts[s]:counts[s+1]], in increasing order.
+func byShard(route []uint32, shards int) (positions, counts []int) {
+	counts = make([]int, shards+1)
+	for _, r := range route {
+		counts[r+1]++
+	}
+	for i := 1; i <= shards; i++ {
+		counts[i] += counts[i-1]
+	}
+	positions = make([]int, len(route))
+	next := append([]int(nil), counts[:shards]...)
+	for i, r := range route {
+		positions[next[r]] = i
+		next[r]++
+	}
+	return positions, counts
+}
+
+// shardOf returns which of n shards a normalized key belongs to.
+func shardOf[T ~string | ~[]byte](n int, s T) int {
+	return int((wyhash(shardSeed, s) >> 32) * uint64(n) >> 32)
+}
+
+// Lookup searches for s in st and returns its index and whether it was
+// found.
+func (st *ShardedTable) Lookup(s string) (n uint64, ok bool) {
+	return lookupSharded(st, s)
+}
+
+// LookupBytes is like Lookup but takes the key as a byte slice.
+func (st *ShardedTable) LookupBytes(b []byte) (n uint64, ok bool) {
+	return lookupSharded(st, b)
+}
+
+func lookupSharded[T ~string | ~[]byte](st *ShardedTable, s T) (uint64, bool) {
+	if st.normalize != nil {
+		return lookupShard(st, st.normalize(append([]byte(nil), s...)))
+	}
+	return lookupShard(st, s)
+}
+
+func lookupShard[T ~string | ~[]byte](st *ShardedTable, s T) (uint64, bool) {
+	if len(st.shards) == 0 {
+		return 0, false
+	}
+	i := shardOf(len(st.shards), s)
+	t := st.shards[i]
+	if t.Len() == 0 {
+		return 0, false
+	}
+	n, ok := lookupKey(t, s)
+	return st.starts[i] + uint64(n), ok
+}
+
+// Key returns the key with index i and whether there is one.
+func (st *ShardedTable) Key(i uint64) ([]byte, bool) {
+	if i >= st.Len() {
+		return nil, false
+	}
+	// Find the last shard that starts at or before i; empty shards share
+	// their start with the next one.
+	lo, hi := 0, len(st.shards)
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		if st.starts[mid] <= i {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return st.shards[lo].Key(uint32(i - st.starts[lo]))
+}
+
+// Len returns the number of keys in st.
+func (st *ShardedTable) Len() uint64 {
+	if len(st.starts) == 0 {
+		return 0
+	}
+	return st.starts[len(st.shards)]
+}
+
+// Shards returns the tables of st, in shard order. Their indices are local
+// to each shard. They must not be modified.
+func (st *ShardedTable) Shards() []*Table {
+	return st.shards
+}
+
+// WithNormalizer returns a copy of st that shares its shards and normalizes
+// keys with fn before looking them up, as Table.WithNormalizer does.
+func (st *ShardedTable) WithNormalizer(fn func([]byte) []byte) *ShardedTable {
+	c := *st
+	c.normalize = fn
+	return &c
+}
+
+// ShardNotFound is the index that LookupParallel stores for keys that are
+// not in the ShardedTable.
+const ShardNotFound = ^uint64(0)
+
+// LookupParallel looks up each of keys in st with up to workers goroutines,
+// or GOMAXPROCS if workers is 0 or less, and stores its index in the
+// corresponding element of out, or ShardNotFound if the key is not in st.
+// It returns the number of keys found, and panics if out is shorter than
+// keys.
+//
+// The keys are first routed to their shards, and each goroutine then looks
+// up all the keys of one shard at a time, so that it works on the level
+// arrays of that shard alone. With enough shards that the level arrays of
+// a shard fit in the L2 cache of a core (see Stats), most of the loads of
+// a lookup hit that cache, which keeps the latency of the slowest lookups
+// down for large batches. A batch uses at most one goroutine per shard.
+func LookupParallel[T ~string | ~[]byte](st *ShardedTable, keys []T, out []uint64, workers int) int {
+	out = out[:len(keys)]
+	if len(st.shards) == 0 {
+		for i := range out {
+			out[i] = ShardNotFound
+		}
+		return 0
+	}
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if st.normalize != nil {
+		normalized := make([][]byte, len(keys))
+		for i, k := range keys {
+			normalized[i] = st.normalize(append([]byte(nil), k...))
+		}
+		return lookupParallel(st, normalized, out, workers)
+	}
+	return lookupParallel(st, keys, out, workers)
+}
+
+// lookupParallel is LookupParallel for normalized keys.
+func lookupParallel[T ~string | ~[]byte](st *ShardedTable, keys []T, out []uint64, workers int) int {
+	shards := len(st.shards)
+	route := make([]uint32, len(keys))
+	for i, k := range keys {
+		route[i] = uint32(shardOf(shards, k))
+	}
+	positions, counts := byShard(route, shards)
+
+	if workers > shards {
+		workers = shards
+	}
+	var (
+		wg    sync.WaitGroup
+		shard int64 = -1 // the last shard taken
+		found int64
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n := 0
+			for {
+				s := int(atomic.AddInt64(&shard, 1))
+				if s >= shards {
+					break
+				}
+				t, start := st.shards[s], st.starts[s]
+				for _, i := range positions[counts[s]:counts[s+1]] {
+					if t.Len() > 0 {
+						if m, ok := lookupKey(t, keys[i]); ok {
+							out[i] = start + uint64(m)
+							n++
+							continue
+						}
+					}
+					out[i] = ShardNotFound
+				}
+			}
+			atomic.AddInt64(&found, int64(n))
+		}()
+	}
+	wg.Wait()
+	return int(found)
+}
+
+// The serialized form of a ShardedTable is a header
+//
+//	magic    [4]byte  "MPHS"
+//	version  uint32   formatVersion
+//	nshards  uint32
+//	reserved uint32   zero
+//
+// followed by the serialized form of each shard in turn.
+
+const shardedMagic = "MPHS"
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (st *ShardedTable) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := st.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (st *ShardedTable) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	if _, err := st.ReadFrom(r); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = ErrCorrupt
+		}
+		return err
+	}
+	if r.Len() != 0 {
+		return ErrCorrupt
+	}
+	return nil
+}
+
+// WriteTo implements io.WriterTo.
+func (st *ShardedTable) WriteTo(w io.Writer) (int64, error) {
+	var h [16]byte
+	copy(h[:], shardedMagic)
+	binary.LittleEndian.PutUint32(h[4:], formatVersion)
+	binary.LittleEndian.PutUint32(h[8:], uint32(len(st.shards)))
+	nn, err := w.Write(h[:])
+	n := int64(nn)
+	if err != nil {
+		return n, err
+	}
+	for _, t := range st.shards {
+		nn, err := t.WriteTo(w)
+		n += nn
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// ReadFrom implements io.ReaderFrom. It reads a sharded table in the form
+// written by WriteTo or MarshalBinary and replaces the contents of st. Like
+// Table.ReadFrom, it does not restore a normalizer.
+func (st *ShardedTable) ReadFrom(r io.Reader) (int64, error) {
+	var h [16]byte
+	nn, err := io.ReadFull(r, h[:])
+	n := int64(nn)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return n, err
+	}
+	if string(h[:4]) != shardedMagic {
+		return n, ErrFormat
+	}
+	if binary.LittleEndian.Uint32(h[4:]) != formatVersion {
+		return n, ErrVersion
+	}
+	nshards := binary.LittleEndian.Uint32(h[8:])
+	if nshards == 0 || nshards > maxShards || binary.LittleEndian.Uint32(h[12:]) != 0 {
+		return n, ErrCorrupt
+	}
+	shards := make([]*Table, nshards)
+	starts := make([]uint64, nshards+1)
+	for i := range shards {
+		shards[i] = new(Table)
+		nn, err := shards[i].ReadFrom(r)
+		n += nn
+		if err != nil {
+			return n, err
+		}
+		starts[i+1] = starts[i] + uint64(shards[i].Len())
+	}
+	*st = ShardedTable{shards: shards, starts: starts}
+	return n, nil
+}
@@ -0,0 +1,156 @@
+package mph
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestBuildSharded(t *testing.T) {
+	var keys []string
+	for i := 0; i < 5000; i++ {
+		keys = append(keys, "key"+strconv.Itoa(i))
+	}
+	st, err := BuildSharded(keys, 7, WithVerify())
+	if err != nil {
+		t.Fatalf("BuildSharded: %v", err)
+	}
+	if st.Len() != uint64(len(keys)) || len(st.Shards()) != 7 {
+		t.Fatalf("BuildSharded: got %d keys in %d shards; want %d in 7", st.Len(), len(st.Shards()), len(keys))
+	}
+	checkSharded(t, st, keys)
+
+	data, err := st.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	var loaded ShardedTable
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+	checkSharded(t, &loaded, keys)
+	if err := loaded.UnmarshalBinary(data[:len(data)-1]); err != ErrCorrupt {
+		t.Errorf("UnmarshalBinary(truncated): got err=%v; want %v", err, ErrCorrupt)
+	}
+
+	one, err := BuildSharded(keys, 0)
+	if err != nil {
+		t.Fatalf("BuildSharded(0 shards): %v", err)
+	}
+	if len(one.Shards()) != 1 {
+		t.Errorf("BuildSharded(0 shards): got %d shards; want 1", len(one.Shards()))
+	}
+	var empty ShardedTable
+	if _, ok := empty.Lookup("key1"); ok || empty.Len() != 0 {
+		t.Errorf("zero ShardedTable: got a key")
+	}
+}
+
+// checkSharded checks that st numbers keys from 0 to len(keys)-1.
+func checkSharded(t *testing.T, st *ShardedTable, keys []string) {
+	t.Helper()
+	seen := make([]bool, len(keys))
+	for _, k := range keys {
+		n, ok := st.Lookup(k)
+		if !ok || n >= uint64(len(keys)) || seen[n] {
+			t.Fatalf("Lookup(%s): got %d, %t", k, n, ok)
+		}
+		seen[n] = true
+		if key, ok := st.Key(n); !ok || string(key) != k {
+			t.Errorf("Key(%d): got %q, %t; want %q, true", n, key, ok, k)
+		}
+		if m, ok := st.LookupBytes([]byte(k)); !ok || m != n {
+			t.Errorf("LookupBytes(%s): got %d, %t; want %d, true", k, m, ok, n)
+		}
+	}
+	if _, ok := st.Lookup("missing"); ok {
+		t.Errorf("Lookup(missing): got true")
+	}
+	if _, ok := st.Key(uint64(len(keys))); ok {
+		t.Errorf("Key(%d): got true", len(keys))
+	}
+}
+
+func TestBuildSharded_options(t *testing.T) {
+	keys := []string{"a", "B", "c", "A", "d", "b"}
+	removed := -1
+	st, err := BuildSharded(keys, 3, WithNormalizer(bytes.ToLower), WithDedup(&removed))
+	if err != nil {
+		t.Fatalf("BuildSharded: %v", err)
+	}
+	if removed != 2 || st.Len() != 4 {
+		t.Errorf("WithDedup: removed %d keys leaving %d; want 2 leaving 4", removed, st.Len())
+	}
+	for _, k := range []string{"A", "b", "C", "d"} {
+		if _, ok := st.Lookup(k); !ok {
+			t.Errorf("Lookup(%s): not found", k)
+		}
+	}
+
+	_, err = BuildSharded(keys, 3, WithNormalizer(bytes.ToLower))
+	var dup *DuplicateKeyError
+	if !errors.As(err, &dup) {
+		t.Fatalf("BuildSharded with duplicates: got err=%v", err)
+	}
+	if !bytes.EqualFold([]byte(keys[dup.First]), []byte(keys[dup.Second])) || dup.First >= dup.Second {
+		t.Errorf("BuildSharded: duplicate positions %d and %d do not refer to keys", dup.First, dup.Second)
+	}
+}
+
+func TestLookupParallel(t *testing.T) {
+	var keys, queries []string
+	for i := 0; i < 5000; i++ {
+		keys = append(keys, "key"+strconv.Itoa(i))
+	}
+	for i := 0; i < 6000; i++ {
+		queries = append(queries, "key"+strconv.Itoa(i))
+	}
+	st, err := BuildSharded(keys, 7)
+	if err != nil {
+		t.Fatalf("BuildSharded: %v", err)
+	}
+	for _, workers := range []int{0, 1, 3, 16} {
+		out := make([]uint64, len(queries))
+		if found := LookupParallel(st, queries, out, workers); found != len(keys) {
+			t.Errorf("LookupParallel(%d workers): found %d keys; want %d", workers, found, len(keys))
+		}
+		for i, q := range queries {
+			want, ok := st.Lookup(q)
+			if !ok {
+				want = ShardNotFound
+			}
+			if out[i] != want {
+				t.Errorf("LookupParallel(%d workers, %s): got %d; want %d", workers, q, out[i], want)
+			}
+		}
+	}
+
+	upper := st.WithNormalizer(bytes.ToLower)
+	out := make([]uint64, 2)
+	if found := LookupParallel(upper, [][]byte{[]byte("KEY1"), []byte("KEY-1")}, out, 2); found != 1 || out[1] != ShardNotFound {
+		t.Errorf("LookupParallel(normalized): found %d keys, %v; want 1", found, out)
+	}
+	if n, _ := st.Lookup("key1"); out[0] != n {
+		t.Errorf("LookupParallel(normalized): got %d; want %d", out[0], n)
+	}
+	if found := LookupParallel(new(ShardedTable), []string{"key1"}, out, 0); found != 0 || out[0] != ShardNotFound {
+		t.Errorf("LookupParallel(empty): found %d keys, %v; want 0", found, out)
+	}
+}
+
+func BenchmarkLookupParallel(b *testing.B) {
+	var keys []string
+	for i := 0; i < 1<<20; i++ {
+		keys = append(keys, "key"+strconv.Itoa(i))
+	}
+	st, err := BuildSharded(keys, 64, WithHash(Wyhash))
+	if err != nil {
+		b.Fatal(err)
+	}
+	out := make([]uint64, len(keys))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		LookupParallel(st, keys, out, 0)
+	}
+}
@@ -0,0 +1,92 @@
+package mph
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+)
+
+// WithStableIndices makes BuildWithOptions keep the indices that prev, an
+// earlier version of the table, gives its keys, so that values and caches
+// kept by index need no remapping when a table is rebuilt with mostly the
+// same keys. Each key of prev that is also one of keys keeps its index in
+// prev, and the other keys take the indices that are left, in increasing
+// order, in the order of keys: first those of the keys of prev that were
+// dropped, then those past the end of prev. As the table stays minimal, a
+// kept key whose index in prev is not less than len(keys), which only
+// happens if there are fewer keys than in prev, is one of the others.
+//
+// Keys are matched with prev after normalization, as prev looks them up.
+// prev must store its keys, or hold a KeySet, or BuildWithOptions returns
+// ErrNoKeys, and the option cannot be used with WithDedup or WithMonotone,
+// whose indices are given by the keys.
+func WithStableIndices(prev *Table) Option {
+	return func(c *buildConfig) {
+		c.stable = prev
+	}
+}
+
+// checkStable returns an error if c has a previous table to keep the
+// indices of, and options that do not go with it.
+func (c *buildConfig) checkStable() error {
+	if c.stable == nil {
+		return nil
+	}
+	if c.dedup || c.monotone {
+		return errors.New("mph: WithStableIndices does not support WithDedup or WithMonotone")
+	}
+	if c.stable.hashOnly && c.stable.keySet == nil {
+		return ErrNoKeys
+	}
+	return nil
+}
+
+// stablePool returns the keys of pool in the order of the indices that
+// they keep from cfg.stable, with the weights of cfg in the same order, or
+// a *DuplicateKeyError if a key repeats.
+func stablePool(pool keyPool, cfg *buildConfig) (keyPool, error) {
+	n := pool.len()
+	order := make([]int, n) // order[i] is the position of the key of index i
+	for i := range order {
+		order[i] = -1
+	}
+	var rest []int
+	for i := 0; i < n; i++ {
+		k := pool.key(i)
+		j, ok := lookup(cfg.stable, k)
+		if !ok || int(j) >= n {
+			rest = append(rest, i)
+			continue
+		}
+		if order[j] >= 0 {
+			return keyPool{}, &DuplicateKeyError{Key: k, First: order[j], Second: i}
+		}
+		order[j] = i
+	}
+	// The keys that keep no index are the only ones that can repeat
+	// without landing on the same index.
+	sorted := append([]int(nil), rest...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return bytes.Compare(pool.key(sorted[i]), pool.key(sorted[j])) < 0
+	})
+	for i := 1; i < len(sorted); i++ {
+		if k := pool.key(sorted[i]); bytes.Equal(pool.key(sorted[i-1]), k) {
+			return keyPool{}, &DuplicateKeyError{Key: k, First: sorted[i-1], Second: sorted[i]}
+		}
+	}
+	j := 0
+	for _, i := range rest {
+		for order[j] >= 0 {
+			j++
+		}
+		order[j] = i
+	}
+	if cfg.weights != nil {
+		weights := make([]float64, n)
+		for j, i := range order {
+			weights[j] = cfg.weights[i]
+		}
+		cfg.weights = weights
+	}
+	return pool.permute(order), nil
+}
@@ -0,0 +1,119 @@
+package mph
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestWithStableIndices(t *testing.T) {
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, "key"+strconv.Itoa(i))
+	}
+	for _, a := range []Algorithm{CHD, BBHash, RecSplit, PTHash, BDZ} {
+		prev, err := BuildWithOptions(keys, WithAlgorithm(a))
+		if err != nil {
+			t.Fatalf("BuildWithOptions(%v): %v", a, err)
+		}
+		// Drop every tenth key, add new ones, and shuffle the rest.
+		var next, added []string
+		for i := len(keys) - 1; i >= 0; i-- {
+			if i%10 != 0 {
+				next = append(next, keys[i])
+			}
+		}
+		for i := 0; i < 150; i++ {
+			added = append(added, "new"+strconv.Itoa(i))
+		}
+		next = append(next, added...)
+		table, err := BuildWithOptions(next, WithAlgorithm(a), WithStableIndices(prev), WithVerify())
+		if err != nil {
+			t.Fatalf("BuildWithOptions(%v, WithStableIndices): %v", a, err)
+		}
+		if table.Len() != len(next) {
+			t.Fatalf("Len(%v): got %d; want %d", a, table.Len(), len(next))
+		}
+		for i, key := range keys {
+			if i%10 == 0 {
+				continue
+			}
+			if n, ok := table.Lookup(key); !ok || n != uint32(i) {
+				t.Errorf("Lookup(%v, %s): got %d, %t; want %d, true", a, key, n, ok, i)
+			}
+		}
+		// The new keys fill the freed indices first, in order.
+		for i, key := range added {
+			want := uint32(len(keys) + i - 100)
+			if i < 100 {
+				want = uint32(10 * i)
+			}
+			if n, ok := table.Lookup(key); !ok || n != want {
+				t.Errorf("Lookup(%v, %s): got %d, %t; want %d, true", a, key, n, ok, want)
+			}
+		}
+	}
+}
+
+func TestWithStableIndices_shrink(t *testing.T) {
+	prev := Build([]string{"a", "b", "c", "d", "e"})
+	table, err := BuildWithOptions([]string{"e", "b", "x"}, WithStableIndices(prev))
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	// b keeps 1; e, past the end, and x take 0 and 2.
+	for key, want := range map[string]uint32{"b": 1, "e": 0, "x": 2} {
+		if n, ok := table.Lookup(key); !ok || n != want {
+			t.Errorf("Lookup(%s): got %d, %t; want %d, true", key, n, ok, want)
+		}
+	}
+}
+
+func TestWithStableIndices_options(t *testing.T) {
+	prev, err := BuildWithOptions([]string{"Foo", "BAR"}, WithNormalizer(bytes.ToLower))
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	keys := []string{"baz", "bar", "FOO"}
+	weights := []float64{1, 2, 3}
+	table, err := BuildWithOptions(keys, WithNormalizer(bytes.ToLower), WithStableIndices(prev), WithWeights(weights))
+	if err != nil {
+		t.Fatalf("BuildWithOptions: %v", err)
+	}
+	for key, want := range map[string]uint32{"foo": 0, "BAR": 1, "baz": 2} {
+		if n, ok := table.Lookup(key); !ok || n != want {
+			t.Errorf("Lookup(%s): got %d, %t; want %d, true", key, n, ok, want)
+		}
+	}
+	if weights[0] != 1 {
+		t.Errorf("BuildWithOptions: changed the weights to %v", weights)
+	}
+}
+
+func TestWithStableIndices_errors(t *testing.T) {
+	prev := Build([]string{"a", "b", "c"})
+	for _, tt := range []struct {
+		name string
+		keys []string
+		pos  [2]int
+	}{
+		{"kept", []string{"b", "x", "b"}, [2]int{0, 2}},
+		{"new", []string{"y", "a", "y"}, [2]int{0, 2}},
+		{"past the end", []string{"c", "c"}, [2]int{0, 1}},
+	} {
+		_, err := BuildWithOptions(tt.keys, WithStableIndices(prev))
+		var dup *DuplicateKeyError
+		if !errors.As(err, &dup) || dup.First != tt.pos[0] || dup.Second != tt.pos[1] {
+			t.Errorf("BuildWithOptions(%s): got err=%v; want a *DuplicateKeyError at %v", tt.name, err, tt.pos)
+		}
+	}
+	if _, err := BuildWithOptions([]string{"a"}, WithStableIndices(prev.WithoutKeys())); !errors.Is(err, ErrNoKeys) {
+		t.Errorf("BuildWithOptions(hash-only): got err=%v; want %v", err, ErrNoKeys)
+	}
+	for name, opt := range map[string]Option{"WithDedup": WithDedup(nil), "WithMonotone": WithMonotone()} {
+		if _, err := BuildWithOptions([]string{"a"}, WithStableIndices(prev), opt); err == nil {
+			t.Errorf("BuildWithOptions(%s): got no error", name)
+		}
+	}
+}
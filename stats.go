@@ -0,0 +1,155 @@
+package mph
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Stats describes the layout of a Table.
+type Stats struct {
+	Keys      int // number of keys
+	Level0Len int // number of level0 slots (buckets), or words of another hash function than CHD
+	Level1Len int // number of level1 slots, or entries, k for each slot, of a k-perfect table
+	KeyBytes  int // total length of the stored keys
+
+	// Size is the memory used by the level arrays, fingerprints,
+	// prefilter, and stored keys, in bytes, not counting slice headers or
+	// the offsets of the keys. Front coded keys count as their encoding,
+	// with the ranks of the keys; see WithFrontCoding.
+	Size int
+
+	// BitsPerKey is the size of the hash function alone, that is the
+	// level arrays, in bits per key.
+	BitsPerKey float64
+
+	// MaxSeed is the largest displacement seed, which is the number of
+	// seeds the hardest bucket needed during the build, less one, or the
+	// largest pilot of PTHash, or the seed of the BDZ hypergraph, which is
+	// the number of seeds its build tried, less one. It is 0 for other
+	// algorithms.
+	MaxSeed uint32
+
+	// BucketSizes[n] is the number of level0 buckets holding n keys. It is
+	// nil for hash-only tables, whose keys are not known, and for tables
+	// not built with CHD, which have no level0 buckets.
+	BucketSizes []int
+
+	// Levels is the number of levels of a BBHash cascade, and 0 for other
+	// tables.
+	Levels int
+}
+
+// Stats returns statistics about the layout of t.
+func (t *Table) Stats() Stats {
+	s := Stats{
+		Keys:      t.Len(),
+		Level0Len: t.level0.len(),
+		Level1Len: t.level1.len(),
+	}
+	s.KeyBytes = t.keys.size()
+	levels := t.level0.size() + t.level1.size()
+	s.Size = levels + t.fingerprints.size() + t.prefilter.size() + t.keys.stored()
+	if s.Keys > 0 {
+		s.BitsPerKey = float64(8*levels) / float64(s.Keys)
+	}
+	if t.algo != CHD {
+		switch t.algo {
+		case BBHash:
+			s.Levels = len(t.cascade.starts) - 1
+		case PTHash:
+			s.MaxSeed = t.pilots.maxPilot()
+		case BDZ:
+			s.MaxSeed = t.hypergraph.seed
+		}
+		return s
+	}
+	for _, seed := range t.level0.uint32s() {
+		if seed > s.MaxSeed {
+			s.MaxSeed = seed
+		}
+	}
+	if !t.hashOnly {
+		counts := make([]int, t.level0.len())
+		for i := 0; i < t.keys.len(); i++ {
+			counts[t.level0Slots.slot(uint32(keyHash(t.hash, t.seed, t.keys.key(i))))]++
+		}
+		for _, c := range counts {
+			for len(s.BucketSizes) <= c {
+				s.BucketSizes = append(s.BucketSizes, 0)
+			}
+			s.BucketSizes[c]++
+		}
+	}
+	return s
+}
+
+// A SizeEstimate is the predicted size of a table, as returned by
+// EstimateSize.
+type SizeEstimate struct {
+	Heap int // memory allocated for the table once built or decoded
+	File int // length of the serialized table, as written by WriteTo
+}
+
+// EstimateSize predicts the size of the table that BuildWithOptions would
+// build with opts from nkeys keys of keyBytes bytes in total, without
+// building it, for capacity planning and admission control. The prediction
+// is exact unless some seeds need 32 bits, which makes level0 at most twice
+// as large, and unless WithCompressedSeeds codes them, which makes level0
+// about half as large as predicted; duplicates dropped by WithDedup make
+// the table smaller. For other algorithms than CHD, the size of the hash
+// function is the expected one, which the actual size rarely exceeds by
+// more than a few percent. The build itself takes several times the size
+// of the table in temporary memory. EstimateSize returns the errors
+// BuildWithOptions would return for the options and the sizes, and an
+// error for a registered Backend, whose size it cannot predict.
+func EstimateSize(nkeys, keyBytes int, opts ...Option) (SizeEstimate, error) {
+	cfg := newBuildConfig(opts)
+	if err := cfg.check(); err != nil {
+		return SizeEstimate{}, err
+	}
+	if nkeys < 0 || keyBytes < 0 {
+		return SizeEstimate{}, errors.New("mph: negative number of keys or bytes")
+	}
+	if uint64(keyBytes) > math.MaxUint32 {
+		return SizeEstimate{}, errPoolTooLarge
+	}
+	if uint64(nkeys) >= math.MaxUint32 {
+		return SizeEstimate{}, errTooManyKeys
+	}
+	h := header{
+		flags:    flagSeeds16,
+		nkeys:    uint32(nkeys),
+		n0:       uint32(cfg.level0Len(nkeys)),
+		n1:       uint32(cfg.level1Slots(nkeys) * cfg.slotKeys()),
+		keyBytes: uint64(keyBytes),
+	}
+	if cfg.algorithm != CHD {
+		h.flags = uint32(cfg.algorithm) << algorithmShift
+		switch cfg.algorithm {
+		case BBHash:
+			h.n0 = uint32(expectedCascadeWords(nkeys))
+		case RecSplit:
+			leaf, bucket := cfg.recsplitSizes()
+			h.n0 = uint32(expectedRecSplitWords(nkeys, leaf, bucket))
+		case PTHash:
+			h.n0 = uint32(expectedPilotWords(nkeys))
+		case BDZ:
+			h.n0 = uint32(expectedHypergraphWords(nkeys))
+		default:
+			return SizeEstimate{}, fmt.Errorf("mph: EstimateSize does not support the %v algorithm", cfg.algorithm)
+		}
+		if h.n1 = uint32(nkeys); nkeys == 0 {
+			h.n1 = 1
+		}
+	}
+	if cfg.packLevel1 {
+		h.flags |= flagPacked
+	} else if nkeys <= maxNarrowKeys {
+		h.flags |= flagIndices16
+	}
+	return SizeEstimate{
+		Heap: (h.memSize(true) + 7) &^ 7,
+		File: int(h.size()),
+	}, nil
+}
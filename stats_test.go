@@ -0,0 +1,90 @@
+package mph
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	var keys []string
+	size := 0
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+		size += len(keys[i])
+	}
+	table := Build(keys)
+	s := table.Stats()
+	if s.Keys != len(keys) || s.Level0Len != 256 || s.Level1Len != 1024 || s.KeyBytes != size {
+		t.Errorf("Stats: got %+v; want 1000 keys with levels of 256 and 1024", s)
+	}
+	// Seeds and indices are small enough to be stored in 16 bits.
+	if want := 2*256 + 2*1024 + size; s.Size != want {
+		t.Errorf("Stats: got Size %d; want %d", s.Size, want)
+	}
+	if want := float64(16*256+16*1024) / 1000; s.BitsPerKey != want {
+		t.Errorf("Stats: got BitsPerKey %v; want %v", s.BitsPerKey, want)
+	}
+	buckets, n := 0, 0
+	for size, count := range s.BucketSizes {
+		buckets += count
+		n += size * count
+	}
+	if buckets != s.Level0Len || n != len(keys) {
+		t.Errorf("Stats: histogram covers %d buckets and %d keys; want %d and %d", buckets, n, s.Level0Len, len(keys))
+	}
+	if s.MaxSeed == 0 {
+		t.Errorf("Stats: got MaxSeed 0; want some displacement")
+	}
+	if h := table.WithoutKeys().Stats(); h.BucketSizes != nil || h.MaxSeed != s.MaxSeed {
+		t.Errorf("WithoutKeys().Stats: got %+v", h)
+	}
+}
+
+func TestEstimateSize(t *testing.T) {
+	small := make([]string, 1000)
+	large := make([]string, 70000)
+	for _, keys := range [][]string{small, large} {
+		for i := range keys {
+			keys[i] = "key-" + strconv.Itoa(i)
+		}
+	}
+	for _, tt := range []struct {
+		name string
+		keys []string
+		opts []Option
+	}{
+		{"small", small, nil},
+		{"large", large, nil},
+		{"packed", large, []Option{WithPackedIndices()}},
+		{"exact", small, []Option{WithExactSizes(), WithHash(Wyhash), WithBucketSize(5)}},
+		{"empty", nil, nil},
+	} {
+		size := 0
+		for _, k := range tt.keys {
+			size += len(k)
+		}
+		est, err := EstimateSize(len(tt.keys), size, tt.opts...)
+		if err != nil {
+			t.Fatalf("EstimateSize(%s): %v", tt.name, err)
+		}
+		table, err := BuildWithOptions(tt.keys, tt.opts...)
+		if err != nil {
+			t.Fatalf("BuildWithOptions(%s): %v", tt.name, err)
+		}
+		if len(table.level0.escapes) != 0 {
+			continue
+		}
+		if n := len(mustMarshal(t, table)); est.File != n {
+			t.Errorf("EstimateSize(%s): got File %d; want %d", tt.name, est.File, n)
+		}
+		if n := (table.arenaSize(true) + 7) &^ 7; est.Heap != n {
+			t.Errorf("EstimateSize(%s): got Heap %d; want %d", tt.name, est.Heap, n)
+		}
+	}
+	if _, err := EstimateSize(10, 100, WithLoadFactor(2)); err == nil {
+		t.Errorf("EstimateSize(load factor 2): got nil error")
+	}
+	if _, err := EstimateSize(10, 1<<32); err != errPoolTooLarge {
+		t.Errorf("EstimateSize(4 GiB): got err=%v; want %v", err, errPoolTooLarge)
+	}
+}
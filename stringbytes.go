@@ -0,0 +1,14 @@
+//go:build go1.20
+
+package mph
+
+import "unsafe"
+
+// stringBytes returns the bytes of s without copying them. They must not be
+// modified.
+func stringBytes(s string) []byte {
+	if len(s) == 0 {
+		return []byte{}
+	}
+	return unsafe.Slice(unsafe.StringData(s), len(s))
+}
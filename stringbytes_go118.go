@@ -0,0 +1,22 @@
+//go:build !go1.20
+
+package mph
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// stringBytes returns the bytes of s without copying them. They must not be
+// modified.
+func stringBytes(s string) []byte {
+	if len(s) == 0 {
+		return []byte{}
+	}
+	var b []byte
+	header := (*reflect.SliceHeader)(unsafe.Pointer(&b))
+	header.Data = (*reflect.StringHeader)(unsafe.Pointer(&s)).Data
+	header.Len = len(s)
+	header.Cap = len(s)
+	return b
+}
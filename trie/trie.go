@@ -0,0 +1,329 @@
+// Package trie implements a compact trie of a set of keys, which can serve
+// a table of package mph as its key set (see mph.Table.WithKeySet) in
+// place of the key bytes, and other components, such as a tokenizer that
+// searches the prefixes of its input, at the same time.
+//
+// The trie is stored as LOUDS, the level-order unary degree sequence of
+// "Space-efficient static trees and graphs" (Jacobson, 1989): its nodes,
+// numbered in breadth-first order, take two bits each for the shape of the
+// trie, a byte for the label of the edge into them, and a bit for whether
+// a key ends there, with rank and select indexes from package bitvector
+// over the bits. Keys that share prefixes share their nodes, so a
+// dictionary of words takes a fraction of its size in bytes.
+package trie
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"sort"
+
+	"github.com/ikawaha/mph/bitvector"
+)
+
+// A Trie is an immutable set of keys. It is safe for concurrent use.
+type Trie struct {
+	// louds holds, for each node in breadth-first order, a one for each of
+	// its children followed by a zero. Child j of all, counting from 0, is
+	// node j+1, root being node 0.
+	louds    *bitvector.Vector
+	shape    []uint64 // the words of louds
+	labels   []byte   // labels[j] is the label of the edge into node j+1
+	terminal *bitvector.Vector
+}
+
+// New returns a Trie of keys, which may be in any order and contain
+// duplicates.
+func New[T ~string | ~[]byte](keys []T) *Trie {
+	sorted := make([]string, len(keys))
+	for i, k := range keys {
+		sorted[i] = string(k)
+	}
+	sort.Strings(sorted)
+	n := 0
+	for i, k := range sorted {
+		if i == 0 || k != sorted[n-1] {
+			sorted[n] = k
+			n++
+		}
+	}
+	sorted = sorted[:n]
+
+	// Each node of the queue is the range of sorted keys under it, all of
+	// which share their first depth bytes.
+	type node struct{ lo, hi, depth int }
+	queue := []node{{0, len(sorted), 0}}
+	var louds, terminal bitBuilder
+	var labels []byte
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		lo := v.lo
+		// A key that ends at the node sorts before the others under it.
+		end := lo < v.hi && len(sorted[lo]) == v.depth
+		terminal.add(end)
+		if end {
+			lo++
+		}
+		for lo < v.hi {
+			c := sorted[lo][v.depth]
+			hi := lo + 1
+			for hi < v.hi && sorted[hi][v.depth] == c {
+				hi++
+			}
+			louds.add(true)
+			labels = append(labels, c)
+			queue = append(queue, node{lo, hi, v.depth + 1})
+			lo = hi
+		}
+		louds.add(false)
+	}
+	return &Trie{
+		louds:    louds.vector(),
+		shape:    louds.words,
+		labels:   labels,
+		terminal: terminal.vector(),
+	}
+}
+
+// A bitBuilder appends bits to the words of a bitvector.Vector.
+type bitBuilder struct {
+	words []uint64
+	n     int
+}
+
+func (b *bitBuilder) add(bit bool) {
+	if b.n%64 == 0 {
+		b.words = append(b.words, 0)
+	}
+	if bit {
+		b.words[b.n/64] |= 1 << (b.n % 64)
+	}
+	b.n++
+}
+
+func (b *bitBuilder) vector() *bitvector.Vector {
+	return bitvector.New(b.words, b.n)
+}
+
+// Len returns the number of keys in t.
+func (t *Trie) Len() int {
+	return t.terminal.Ones()
+}
+
+// Nodes returns the number of nodes of t, including the root.
+func (t *Trie) Nodes() int {
+	return t.terminal.Len()
+}
+
+// Size returns the memory used by t, in bytes.
+func (t *Trie) Size() int {
+	return (t.louds.Len()+t.terminal.Len()+63)/64*8 + t.louds.Size() + t.terminal.Size() + len(t.labels)
+}
+
+// child returns the child of node v whose edge is labeled c, and false if
+// there is none.
+func (t *Trie) child(v int, c byte) (int, bool) {
+	start := 0
+	if v > 0 {
+		start = t.louds.Select0(v-1) + 1
+	}
+	end := nextZero(t.shape, start)
+	// The children of v are the nodes first+1 to first+end-start, and their
+	// labels are in increasing order.
+	first := start - v
+	lo, hi := first, first+end-start
+	for lo < hi {
+		m := int(uint(lo+hi) >> 1)
+		if t.labels[m] < c {
+			lo = m + 1
+		} else {
+			hi = m
+		}
+	}
+	if lo == first+end-start || t.labels[lo] != c {
+		return 0, false
+	}
+	return lo + 1, true
+}
+
+// nextZero returns the position of the first zero of words from bit i on,
+// of which there must be one.
+func nextZero(words []uint64, i int) int {
+	w := i / 64
+	if x := ^words[w] >> (i % 64); x != 0 {
+		return i + bits.TrailingZeros64(x)
+	}
+	for w++; words[w] == ^uint64(0); w++ {
+	}
+	return 64*w + bits.TrailingZeros64(^words[w])
+}
+
+// find returns the node at which key ends, and false if there is none.
+func (t *Trie) find(key []byte) (int, bool) {
+	v := 0
+	for _, c := range key {
+		var ok bool
+		if v, ok = t.child(v, c); !ok {
+			return 0, false
+		}
+	}
+	return v, true
+}
+
+// Contains reports whether key is in t.
+func (t *Trie) Contains(key []byte) bool {
+	v, ok := t.find(key)
+	return ok && t.terminal.Get(v)
+}
+
+// Index returns the index of key in t, in [0, Len()), and whether key is in
+// t. Keys are numbered in breadth-first order of their nodes: by length,
+// then in increasing order.
+func (t *Trie) Index(key []byte) (int, bool) {
+	v, ok := t.find(key)
+	if !ok || !t.terminal.Get(v) {
+		return 0, false
+	}
+	return t.terminal.Rank1(v), true
+}
+
+// Prefixes calls fn with the length and index of each key of t that is a
+// prefix of s, shortest first, until fn returns false.
+func (t *Trie) Prefixes(s []byte, fn func(n, index int) bool) {
+	v := 0
+	for i := 0; ; i++ {
+		if t.terminal.Get(v) && !fn(i, t.terminal.Rank1(v)) {
+			return
+		}
+		if i == len(s) {
+			return
+		}
+		var ok bool
+		if v, ok = t.child(v, s[i]); !ok {
+			return
+		}
+	}
+}
+
+// magic starts the serialized form of a Trie.
+const magic = "MPHT"
+
+// MarshalBinary implements encoding.BinaryMarshaler. The serialized form is
+// the magic string "MPHT", the number of nodes as a little-endian uint32,
+// the words of the shape bits and of the terminal bits, little-endian, and
+// the labels.
+func (t *Trie) MarshalBinary() ([]byte, error) {
+	n := t.Nodes()
+	b := make([]byte, 0, 8+8*((2*n+62)/64+(n+63)/64)+len(t.labels))
+	b = append(b, magic...)
+	b = append(b, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(b[4:], uint32(n))
+	b = appendBits(b, t.louds)
+	b = appendBits(b, t.terminal)
+	return append(b, t.labels...), nil
+}
+
+// appendBits appends the bits of v to b in little-endian words.
+func appendBits(b []byte, v *bitvector.Vector) []byte {
+	var w uint64
+	for i := 0; i < v.Len(); i++ {
+		if v.Get(i) {
+			w |= 1 << (i % 64)
+		}
+		if i%64 == 63 || i == v.Len()-1 {
+			var buf [8]byte
+			binary.LittleEndian.PutUint64(buf[:], w)
+			b = append(b, buf[:]...)
+			w = 0
+		}
+	}
+	return b
+}
+
+// ErrCorrupt is returned by UnmarshalBinary for data that is not a valid
+// serialized Trie.
+var ErrCorrupt = errors.New("trie: corrupt data")
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. It does not retain
+// data.
+func (t *Trie) UnmarshalBinary(data []byte) error {
+	if len(data) < 8 || string(data[:4]) != magic {
+		return ErrCorrupt
+	}
+	n := int(binary.LittleEndian.Uint32(data[4:]))
+	data = data[8:]
+	shape, data, ok := readBits(data, 2*n-1)
+	if !ok {
+		return ErrCorrupt
+	}
+	terminal, data, ok := readBits(data, n)
+	if !ok {
+		return ErrCorrupt
+	}
+	louds := bitvector.New(shape, 2*n-1)
+	if louds.Ones() != n-1 || len(data) != n-1 || !validShape(louds) {
+		return ErrCorrupt
+	}
+	u := Trie{
+		louds:    louds,
+		shape:    shape,
+		labels:   append([]byte(nil), data...),
+		terminal: bitvector.New(terminal, n),
+	}
+	if err := u.checkLabels(); err != nil {
+		return err
+	}
+	*t = u
+	return nil
+}
+
+// readBits returns the first n bits of data, in little-endian words, and
+// the rest of data.
+func readBits(data []byte, n int) ([]uint64, []byte, bool) {
+	nw := (n + 63) / 64
+	if n < 0 || len(data) < 8*nw {
+		return nil, nil, false
+	}
+	words := make([]uint64, nw)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint64(data[8*i:])
+	}
+	if n%64 != 0 && words[nw-1]>>(n%64) != 0 {
+		return nil, nil, false
+	}
+	return words, data[8*nw:], true
+}
+
+// validShape reports whether louds, which holds one more zero than ones,
+// describes a tree: every proper prefix of it holds fewer zeros than the
+// nodes it has introduced, counting the root, so that no node is described
+// before the edge into it.
+func validShape(louds *bitvector.Vector) bool {
+	ones, zeros := 0, 0
+	for i := 0; i < louds.Len()-1; i++ {
+		if louds.Get(i) {
+			ones++
+		} else if zeros++; zeros > ones {
+			return false
+		}
+	}
+	return true
+}
+
+// checkLabels returns ErrCorrupt unless the labels of the children of each
+// node of t are in strictly increasing order.
+func (t *Trie) checkLabels() error {
+	for j, prev := 0, -1; j < t.louds.Len(); j++ {
+		if !t.louds.Get(j) {
+			prev = -1
+			continue
+		}
+		c := int(t.labels[t.louds.Rank1(j)])
+		if c <= prev {
+			return ErrCorrupt
+		}
+		prev = c
+	}
+	return nil
+}
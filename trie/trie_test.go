@@ -0,0 +1,175 @@
+package trie
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestTrie(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, n := range []int{0, 1, 2, 10, 1000} {
+		var keys []string
+		set := make(map[string]bool)
+		for len(set) < n {
+			k := make([]byte, r.Intn(6))
+			for i := range k {
+				k[i] = "abc\x00\xff"[r.Intn(5)]
+			}
+			if !set[string(k)] {
+				set[string(k)] = true
+				keys = append(keys, string(k))
+			}
+		}
+		// Duplicates are ignored.
+		tr := New(append(keys, keys...))
+		if tr.Len() != n {
+			t.Errorf("Len(n=%d): got %d", n, tr.Len())
+		}
+		indices := make(map[int]bool)
+		for _, k := range keys {
+			if !tr.Contains([]byte(k)) {
+				t.Errorf("Contains(%q): got false; want true", k)
+			}
+			i, ok := tr.Index([]byte(k))
+			if !ok || i < 0 || i >= n || indices[i] {
+				t.Errorf("Index(%q): got %d, %t; want a new index in [0, %d)", k, i, ok, n)
+			}
+			indices[i] = true
+		}
+		for i := 0; i < 1000; i++ {
+			k := make([]byte, r.Intn(7))
+			for i := range k {
+				k[i] = "abcd\x00\xff"[r.Intn(6)]
+			}
+			if got := tr.Contains(k); got != set[string(k)] {
+				t.Errorf("Contains(%q): got %t; want %t", k, got, set[string(k)])
+			}
+		}
+	}
+}
+
+func TestTrie_index(t *testing.T) {
+	keys := []string{"b", "ab", "a", "abc", "ba"}
+	tr := New(keys)
+	// Shorter keys come first, and keys of a length in increasing order.
+	for i, k := range []string{"a", "b", "ab", "ba", "abc"} {
+		if n, ok := tr.Index([]byte(k)); !ok || n != i {
+			t.Errorf("Index(%q): got %d, %t; want %d, true", k, n, ok, i)
+		}
+	}
+	if _, ok := tr.Index([]byte("c")); ok {
+		t.Errorf("Index(c): got true; want false")
+	}
+	if tr.Nodes() != 6 {
+		t.Errorf("Nodes: got %d; want 6", tr.Nodes())
+	}
+}
+
+func TestTrie_prefixes(t *testing.T) {
+	tr := New([]string{"", "to", "tok", "token", "tokens", "top"})
+	var got []int
+	tr.Prefixes([]byte("tokenizer"), func(n, index int) bool {
+		if i, _ := tr.Index([]byte("tokenizer"[:n])); i != index {
+			t.Errorf("Prefixes: got index %d for length %d; want %d", index, n, i)
+		}
+		got = append(got, n)
+		return true
+	})
+	if want := []int{0, 2, 3, 5}; !equalInts(got, want) {
+		t.Errorf("Prefixes(tokenizer): got lengths %v; want %v", got, want)
+	}
+	got = got[:0]
+	tr.Prefixes([]byte("tokens"), func(n, index int) bool {
+		got = append(got, n)
+		return n < 3
+	})
+	if want := []int{0, 2, 3}; !equalInts(got, want) {
+		t.Errorf("Prefixes(tokens, stop at 3): got lengths %v; want %v", got, want)
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTrie_size(t *testing.T) {
+	var keys []string
+	for i := 0; i < 10000; i++ {
+		keys = append(keys, "https://example.com/dictionary/"+strconv.Itoa(i))
+	}
+	raw := 0
+	for _, k := range keys {
+		raw += len(k)
+	}
+	tr := New(keys)
+	if size := tr.Size(); size >= raw/4 {
+		t.Errorf("Size: got %d; want less than a quarter of %d", size, raw)
+	}
+}
+
+func TestTrie_marshal(t *testing.T) {
+	for _, keys := range [][]string{nil, {""}, {"a", "ab", "b", "abc", "zz"}} {
+		tr := New(keys)
+		data, err := tr.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary: %v", err)
+		}
+		var u Trie
+		if err := u.UnmarshalBinary(data); err != nil {
+			t.Fatalf("UnmarshalBinary(%q): %v", keys, err)
+		}
+		if u.Len() != len(keys) || u.Nodes() != tr.Nodes() {
+			t.Errorf("UnmarshalBinary(%q): got %d keys, %d nodes; want %d, %d", keys, u.Len(), u.Nodes(), len(keys), tr.Nodes())
+		}
+		for _, k := range keys {
+			if !u.Contains([]byte(k)) {
+				t.Errorf("Contains(%q): got false; want true", k)
+			}
+		}
+	}
+}
+
+func TestTrie_corrupt(t *testing.T) {
+	keys := []string{"a", "ab", "b", "abc", "zz"}
+	sort.Strings(keys)
+	data, _ := New(keys).MarshalBinary()
+	if err := new(Trie).UnmarshalBinary(data[:len(data)-1]); err != ErrCorrupt {
+		t.Errorf("UnmarshalBinary(truncated): got %v; want %v", err, ErrCorrupt)
+	}
+	// Every single bit flip either fails or gives a trie that is safe to
+	// search.
+	for i := 0; i < 8*len(data); i++ {
+		b := append([]byte(nil), data...)
+		b[i/8] ^= 1 << (i % 8)
+		var u Trie
+		if err := u.UnmarshalBinary(b); err != nil {
+			continue
+		}
+		for _, k := range append(keys, "", "abd", "c") {
+			u.Contains([]byte(k))
+			u.Prefixes([]byte(k), func(n, index int) bool { return true })
+		}
+	}
+}
+
+func BenchmarkContains(b *testing.B) {
+	var keys [][]byte
+	for i := 0; i < 100000; i++ {
+		keys = append(keys, []byte("https://example.com/dictionary/"+strconv.Itoa(i)))
+	}
+	tr := New(keys)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tr.Contains(keys[i%len(keys)])
+	}
+}
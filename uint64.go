@@ -0,0 +1,83 @@
+package mph
+
+import (
+	"context"
+	"fmt"
+)
+
+// A Uint64Table is like a Table but over uint64 keys, such as database IDs.
+// It hashes keys with an integer mixer rather than Murmur3 over their
+// bytes, which makes both building and lookups cheaper than converting the
+// keys to strings.
+type Uint64Table struct {
+	keys       []uint64
+	level0     []uint32
+	level0Mask int
+	level1     []uint32
+	level1Mask int
+}
+
+// BuildUint64 builds a Uint64Table from keys. The index of each key is its
+// position in keys. If keys contains duplicates, the error wraps
+// ErrDuplicateKey.
+func BuildUint64(keys []uint64) (*Uint64Table, error) {
+	ctx := context.Background()
+	level0Mask := nextPow2(len(keys)/4) - 1
+	slots := make([]uint32, len(keys))
+	for i, k := range keys {
+		slots[i] = mix64(0, k) & uint32(level0Mask)
+	}
+	buckets := newBucketIndex(slots, level0Mask+1)
+	for n := 0; n < buckets.len(); n++ {
+		vals := buckets.bucket(n)
+		for j, b := range vals {
+			for _, a := range vals[:j] {
+				if keys[a] == keys[b] {
+					return nil, fmt.Errorf("mph: duplicate key %d at positions %d and %d: %w", keys[a], a, b, ErrDuplicateKey)
+				}
+			}
+		}
+	}
+	level0, level1, err := place(ctx, buckets, nextPow2(len(keys)), func(i int, seed uint32) uint32 {
+		return mix64(seed, keys[i])
+	}, new(buildConfig))
+	if err != nil {
+		return nil, err
+	}
+	return &Uint64Table{
+		keys:       append([]uint64(nil), keys...),
+		level0:     level0,
+		level0Mask: level0Mask,
+		level1:     level1,
+		level1Mask: len(level1) - 1,
+	}, nil
+}
+
+// Lookup searches for k in t and returns its index and whether it was found.
+func (t *Uint64Table) Lookup(k uint64) (n uint32, ok bool) {
+	if t.Len() == 0 {
+		return 0, false
+	}
+	seed := t.level0[int(mix64(0, k))&t.level0Mask]
+	n = t.level1[int(mix64(seed, k))&t.level1Mask]
+	return n, t.keys[n] == k
+}
+
+// Len returns the number of keys in t.
+func (t *Uint64Table) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.keys)
+}
+
+// mix64 hashes k with seed using the finalizer of Murmur3's 64-bit variant.
+func mix64(seed uint32, k uint64) uint32 {
+	k ^= uint64(seed) * 0x9e3779b97f4a7c15
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	k *= 0xc4ceb9fe1a85ec53
+	k ^= k >> 33
+	return uint32(k)
+}
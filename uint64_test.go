@@ -0,0 +1,61 @@
+package mph
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBuildUint64(t *testing.T) {
+	var keys []uint64
+	for i := uint64(0); i < 10000; i++ {
+		keys = append(keys, i*i*7919)
+	}
+	table, err := BuildUint64(keys)
+	if err != nil {
+		t.Fatalf("BuildUint64: %v", err)
+	}
+	if table.Len() != len(keys) {
+		t.Errorf("Len: got %d; want %d", table.Len(), len(keys))
+	}
+	for i, k := range keys {
+		if n, ok := table.Lookup(k); !ok || int(n) != i {
+			t.Errorf("Lookup(%d): got %d, %t; want %d, true", k, n, ok, i)
+		}
+	}
+	for _, k := range []uint64{1, 2, 1 << 63} {
+		if _, ok := table.Lookup(k); ok {
+			t.Errorf("Lookup(%d): got ok; want !ok", k)
+		}
+	}
+}
+
+func TestBuildUint64_duplicates(t *testing.T) {
+	if _, err := BuildUint64([]uint64{1, 2, 3, 2}); !errors.Is(err, ErrDuplicateKey) {
+		t.Errorf("BuildUint64: got err=%v; want %v", err, ErrDuplicateKey)
+	}
+}
+
+func TestBuildUint64_empty(t *testing.T) {
+	table, err := BuildUint64(nil)
+	if err != nil {
+		t.Fatalf("BuildUint64: %v", err)
+	}
+	if _, ok := table.Lookup(0); ok {
+		t.Errorf("Lookup(0): got ok; want !ok")
+	}
+}
+
+func BenchmarkUint64Table(b *testing.B) {
+	var keys []uint64
+	for i := uint64(0); i < 1000000; i++ {
+		keys = append(keys, i*7919)
+	}
+	table, err := BuildUint64(keys)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		table.Lookup(keys[i%len(keys)])
+	}
+}
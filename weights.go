@@ -0,0 +1,156 @@
+package mph
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// WithWeights makes BuildWithOptions lay out the table for lookups whose
+// keys follow weights, where weights[i] is the frequency, or any other
+// non-negative weight, of key i, such as the counts of a Zipfian workload.
+// The heaviest keys, up to a 32nd of the level1 slots, are hot: their
+// buckets are placed first, with the seeds searched for ones that send the
+// hot keys into the first 16th of level1, and the keys are stored in the
+// order of their slots, so that the hot keys share the cache lines of one
+// region of level1 and one region of the key pool. A lookup in a cache
+// that holds those regions then costs no misses for a hot key, whatever
+// its index. Keys of weight 0 are never hot.
+//
+// The indices are unchanged, and the layout is only kept in memory:
+// serializing the table writes its keys in index order, and decoding gives
+// a table without the layout. The search for seeds that keep the hot keys
+// in their region makes for larger seeds, so level0 may take more memory,
+// and the keys of the table take four more bytes each. Only CHD supports
+// the option, which makes WithParallelism have no effect, and it cannot be
+// used with WithDedup, WithMonotone, WithKPerfect or WithFrontCoding.
+// BuildWithOptions returns an error if len(weights) differs from the
+// number of keys.
+func WithWeights(weights []float64) Option {
+	return func(c *buildConfig) {
+		c.weights = weights
+	}
+}
+
+// Layout of the hot region of a weighted table: it takes 1/hotRegion of
+// level1, and holds up to 1/hotShare as many hot keys as there are slots;
+// hotSeeds seeds are tried for a hot bucket before its keys are let out of
+// the region.
+const (
+	hotRegion = 16
+	hotShare  = 2 * hotRegion
+	hotSeeds  = 1 << 12
+)
+
+// checkWeights returns an error if c has weights and options that do not
+// go with them.
+func (c *buildConfig) checkWeights() error {
+	if c.weights == nil {
+		return nil
+	}
+	if c.algorithm != CHD {
+		return fmt.Errorf("mph: the %v algorithm does not support WithWeights", c.algorithm)
+	}
+	if c.dedup || c.monotone || c.k > 1 || c.frontCoding {
+		return errors.New("mph: WithWeights does not support WithDedup, WithMonotone, WithKPerfect or WithFrontCoding")
+	}
+	for i, w := range c.weights {
+		if !(w >= 0) {
+			return fmt.Errorf("mph: weight %v of key %d is not a non-negative number", w, i)
+		}
+	}
+	return nil
+}
+
+// hotKeys returns the set of hot keys of a table of n1 level1 slots, and
+// the number of slots of its hot region; see WithWeights.
+func (c *buildConfig) hotKeys(n1 int) (bitset, int) {
+	order := make([]int, 0, len(c.weights))
+	for i, w := range c.weights {
+		if w > 0 {
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool { return c.weights[order[a]] > c.weights[order[b]] })
+	if max := n1 / hotShare; len(order) > max {
+		order = order[:max]
+	}
+	hot := newBitset(len(c.weights))
+	for _, i := range order {
+		hot.set(i)
+	}
+	return hot, n1 / hotRegion
+}
+
+// hotFirst returns buckets with those that hold a hot key first, each part
+// in its previous order.
+func hotFirst(buckets []indexBucket, hot bitset) []indexBucket {
+	sorted := make([]indexBucket, 0, len(buckets))
+	var cold []indexBucket
+	for _, b := range buckets {
+		if isHot(b.vals, hot) {
+			sorted = append(sorted, b)
+		} else {
+			cold = append(cold, b)
+		}
+	}
+	return append(sorted, cold...)
+}
+
+// isHot reports whether any of the keys at the positions vals is hot.
+func isHot(vals []uint32, hot bitset) bool {
+	for _, i := range vals {
+		if hot.has(int(i)) {
+			return true
+		}
+	}
+	return false
+}
+
+// layOutBySlot stores the keys of t, a CHD table, in the order of their
+// level1 slots, and the slot of each key in slotOf.
+func (t *Table) layOutBySlot() {
+	p := &t.keys
+	n, n1 := p.len(), t.level1.len()
+	if n == 0 {
+		return
+	}
+	slotOf := make([]uint32, n)
+	bySlot := make([]int, n1)
+	for s := range bySlot {
+		bySlot[s] = -1
+	}
+	for i := 0; i < n; i++ {
+		k := p.key(i)
+		kh := keyHash(t.hash, t.seed, k)
+		seed := t.level0.get(t.level0Slots.slot(uint32(kh)))
+		s := t.level1Slots.slot(level1Hash(t.hash, kh, seed, k))
+		slotOf[i] = uint32(s)
+		bySlot[s] = i
+	}
+	q := keyPool{
+		data:    make([]byte, 0, p.size()),
+		offsets: make([]uint32, 1, n1+1),
+		slotOf:  slotOf,
+	}
+	for _, i := range bySlot {
+		if i >= 0 {
+			q.data = append(q.data, p.key(i)...)
+		}
+		q.offsets = append(q.offsets, uint32(len(q.data)))
+	}
+	*p = q
+	t.keyWidth = 0
+}
+
+// lookupBySlot is the end of lookupKey for a table whose keys are stored
+// in slot order, where s maps to slot.
+func lookupBySlot[T ~string | ~[]byte](t *Table, slot int, s T) (n uint32, ok bool) {
+	n = t.level1.get(slot)
+	// A free slot holds index 0, and no key.
+	if n == 0 && t.keys.slotOf[0] != uint32(slot) {
+		return 0, false
+	}
+	o := t.keys.offsets[slot : slot+2 : slot+2]
+	return n, string(s) == string(t.keys.data[o[0]:o[1]])
+}
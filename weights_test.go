@@ -0,0 +1,120 @@
+package mph
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+// zipfKeys returns n keys and Zipfian weights for them, the heaviest keys
+// spread through keys.
+func zipfKeys(n int) ([]string, []float64) {
+	keys := make([]string, n)
+	weights := make([]float64, n)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+		weights[i*7919%n] = 1 / float64(i+1)
+	}
+	return keys, weights
+}
+
+func TestWithWeights(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 1000, 100000} {
+		keys, weights := zipfKeys(n)
+		table, err := BuildWithOptions(keys, WithWeights(weights))
+		if err != nil {
+			t.Fatalf("BuildWithOptions(n=%d): %v", n, err)
+		}
+		checkTable(t, table, keys, []string{"", "key", "key-1", "key" + strconv.Itoa(n)})
+		for i, key := range keys {
+			if k, _ := table.Key(uint32(i)); string(k) != key {
+				t.Errorf("Key(%d): got %q; want %q", i, k, key)
+			}
+		}
+		out := make([]uint32, len(keys))
+		if found := LookupAll(table, keys, out); found != n {
+			t.Errorf("LookupAll(n=%d): found %d keys; want %d", n, found, n)
+		}
+		if n == 0 {
+			continue
+		}
+
+		// The heaviest keys are in the hot region, and stored at the
+		// start of the pool.
+		n1 := table.level1.len()
+		hot, region := (&buildConfig{weights: weights}).hotKeys(n1)
+		in, total := 0, 0
+		for i := range keys {
+			if hot.has(i) {
+				total++
+				if int(table.keys.slotOf[i]) < region {
+					in++
+				}
+			}
+		}
+		if in < total*9/10 {
+			t.Errorf("WithWeights(n=%d): %d of %d hot keys in the hot region; want at least 90%%", n, in, total)
+		}
+
+		data, err := table.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary: %v", err)
+		}
+		loaded, err := LoadBytes(data)
+		if err != nil {
+			t.Fatalf("LoadBytes: %v", err)
+		}
+		checkTable(t, loaded, keys, nil)
+		if !Equal(loaded, table) || !Equal(table.Clone(), table) {
+			t.Errorf("Equal(n=%d): got false; want true", n)
+		}
+	}
+}
+
+func TestWithWeights_errors(t *testing.T) {
+	keys := []string{"a", "b", "c"}
+	for _, tt := range []struct {
+		name string
+		opts []Option
+	}{
+		{"short", []Option{WithWeights([]float64{1, 2})}},
+		{"negative", []Option{WithWeights([]float64{1, -2, 3})}},
+		{"NaN", []Option{WithWeights([]float64{1, math.NaN(), 3})}},
+		{"BDZ", []Option{WithWeights([]float64{1, 2, 3}), WithAlgorithm(BDZ)}},
+		{"WithDedup", []Option{WithWeights([]float64{1, 2, 3}), WithDedup(nil)}},
+		{"WithFrontCoding", []Option{WithWeights([]float64{1, 2, 3}), WithFrontCoding()}},
+	} {
+		if _, err := BuildWithOptions(keys, tt.opts...); err == nil {
+			t.Errorf("BuildWithOptions(%s): got no error", tt.name)
+		}
+	}
+}
+
+func BenchmarkLookupZipf(b *testing.B) {
+	const n = 1 << 20
+	keys, weights := zipfKeys(n)
+	// Queries follow the weights.
+	z := rand.NewZipf(rand.New(rand.NewSource(1)), 1.01, 1, n-1)
+	queries := make([]string, 1<<16)
+	for i := range queries {
+		queries[i] = keys[int(z.Uint64())*7919%n]
+	}
+	for _, tt := range []struct {
+		name string
+		opts []Option
+	}{
+		{"plain", nil},
+		{"weighted", []Option{WithWeights(weights)}},
+	} {
+		table, err := BuildWithOptions(keys, tt.opts...)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(tt.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				table.Lookup(queries[i%len(queries)])
+			}
+		})
+	}
+}
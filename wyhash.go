@@ -0,0 +1,70 @@
+package mph
+
+import "math/bits"
+
+// This file contains a 64-bit wyhash (final version 4) implementation. See
+// https://github.com/wangyi-fudan/wyhash. It reads keys eight bytes at a
+// time, so it is faster than Murmur3 on long keys.
+
+const (
+	wyp0 = 0x2d358dccaa6c78a5
+	wyp1 = 0x8bb84b93962eacc9
+	wyp2 = 0x4b33a62ed433d4a3
+	wyp3 = 0x4d5a2da51de1aa47
+)
+
+func wymix(a, b uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	return hi ^ lo
+}
+
+// wyr8 and wyr4 read little-endian words from s at i. The compiler combines
+// the byte loads into one load.
+func wyr8[T ~string | ~[]byte](s T, i int) uint64 {
+	s = s[i : i+8]
+	return uint64(s[0]) | uint64(s[1])<<8 | uint64(s[2])<<16 | uint64(s[3])<<24 |
+		uint64(s[4])<<32 | uint64(s[5])<<40 | uint64(s[6])<<48 | uint64(s[7])<<56
+}
+
+func wyr4[T ~string | ~[]byte](s T, i int) uint64 {
+	s = s[i : i+4]
+	return uint64(s[0]) | uint64(s[1])<<8 | uint64(s[2])<<16 | uint64(s[3])<<24
+}
+
+// wyhash computes the 64-bit wyhash of s using seed and the default secret.
+func wyhash[T ~string | ~[]byte](seed uint64, s T) uint64 {
+	seed ^= wymix(seed^wyp0, wyp1)
+	l := len(s)
+	var a, b uint64
+	switch {
+	case l > 16:
+		p, i := 0, l
+		if i > 48 {
+			see1, see2 := seed, seed
+			for i > 48 {
+				seed = wymix(wyr8(s, p)^wyp1, wyr8(s, p+8)^seed)
+				see1 = wymix(wyr8(s, p+16)^wyp2, wyr8(s, p+24)^see1)
+				see2 = wymix(wyr8(s, p+32)^wyp3, wyr8(s, p+40)^see2)
+				p += 48
+				i -= 48
+			}
+			seed ^= see1 ^ see2
+		}
+		for i > 16 {
+			seed = wymix(wyr8(s, p)^wyp1, wyr8(s, p+8)^seed)
+			p += 16
+			i -= 16
+		}
+		a, b = wyr8(s, p+i-16), wyr8(s, p+i-8)
+	case l >= 4:
+		q := (l >> 3) << 2
+		a = wyr4(s, 0)<<32 | wyr4(s, q)
+		b = wyr4(s, l-4)<<32 | wyr4(s, l-4-q)
+	case l > 0:
+		a = uint64(s[0])<<16 | uint64(s[l>>1])<<8 | uint64(s[l-1])
+	}
+	a ^= wyp1
+	b ^= seed
+	hi, lo := bits.Mul64(a, b)
+	return wymix(lo^wyp0^uint64(l), hi^wyp1)
+}
@@ -0,0 +1,29 @@
+package mph
+
+import "testing"
+
+// The test vectors of the reference implementation, which uses the index
+// of each vector as its seed.
+var wyhashTestCases = []struct {
+	input string
+	want  uint64
+}{
+	{"", 0x93228a4de0eec5a2},
+	{"a", 0xc5bac3db178713c4},
+	{"abc", 0xa97f2f7b1d9b3314},
+	{"message digest", 0x786d1f1df3801df4},
+	{"abcdefghijklmnopqrstuvwxyz", 0xdca5a8138ad37c87},
+	{"ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789", 0xb9e734f117cfaf70},
+	{"12345678901234567890123456789012345678901234567890123456789012345678901234567890", 0x6cc5eab49a92d617},
+}
+
+func TestWyhash(t *testing.T) {
+	for i, tt := range wyhashTestCases {
+		if got := wyhash(uint64(i), tt.input); got != tt.want {
+			t.Errorf("wyhash(%q, seed=%d): got 0x%x; want 0x%x", tt.input, i, got, tt.want)
+		}
+		if got := wyhash(uint64(i), []byte(tt.input)); got != tt.want {
+			t.Errorf("wyhash([]byte(%q), seed=%d): got 0x%x; want 0x%x", tt.input, i, got, tt.want)
+		}
+	}
+}